@@ -2,8 +2,8 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +13,13 @@ import (
 	"github.com/apex/log"
 )
 
+// ErrChatSessionChangedDuringRequest another process recorded exchanges in the session while
+// the request was in progress. The exchange was still recorded, but the response does not
+// account for the other exchanges.
+var ErrChatSessionChangedDuringRequest = errors.New(
+	"chat session changed during the request, the response does not account for the changes",
+)
+
 /*
 ChatSessionHandler represents a chat session
 */
@@ -20,11 +27,50 @@ type ChatSessionHandler interface {
 	/*
 		SendRequest send a new request within the session
 
+		If another process records exchanges in the session while the request is in progress,
+		the exchange is recorded along with theirs, and ErrChatSessionChangedDuringRequest is
+		returned so the caller can warn about it.
+
+			@param ctxt context.Context - query context
+			@param prompt string - the prompt to send
+			@param attachments []persistence.ChatExchangeAttachment - files sent along with the
+				prompt
+			@param resp chan string - channel for sending out the responses from the model
+	*/
+	SendRequest(
+		ctxt context.Context,
+		prompt string,
+		attachments []persistence.ChatExchangeAttachment,
+		resp chan string,
+	) error
+
+	/*
+		AmendLatestRequest replace the newest exchange by sending a new request in its place
+
+		The request is sent with the session history prior to the newest exchange, and keeps
+		the files attached to the newest exchange. The newest exchange is only replaced once the
+		new request completes.
+
 			@param ctxt context.Context - query context
 			@param prompt string - the prompt to send
 			@param resp chan string - channel for sending out the responses from the model
 	*/
-	SendRequest(ctxt context.Context, prompt string, resp chan string) error
+	AmendLatestRequest(ctxt context.Context, prompt string, resp chan string) error
+
+	/*
+		RegenerateLatestResponse send the newest request again, and record the response as a
+		new variant of the newest exchange
+
+		The request is sent with the session history prior to the newest exchange.
+
+			@param ctxt context.Context - query context
+			@param settings persistence.ChatSessionParameters - request parameters to use in place
+				of the session wide parameters
+			@param resp chan string - channel for sending out the responses from the model
+	*/
+	RegenerateLatestResponse(
+		ctxt context.Context, settings persistence.ChatSessionParameters, resp chan string,
+	) error
 
 	/*
 		Close close this session
@@ -86,21 +132,176 @@ func DefineChatSessionHandler(
 /*
 SendRequest send a new request within the session
 
+If another process records exchanges in the session while the request is in progress,
+the exchange is recorded along with theirs, and ErrChatSessionChangedDuringRequest is returned
+so the caller can warn about it.
+
 	@param ctxt context.Context - query context
 	@param prompt string - the prompt to send
+	@param attachments []persistence.ChatExchangeAttachment - files sent along with the prompt
 	@param resp chan string - channel for sending out the responses from the model
 */
 func (s *chatSessionHandlerImpl) SendRequest(
+	ctxt context.Context,
+	prompt string,
+	attachments []persistence.ChatExchangeAttachment,
+	resp chan string,
+) error {
+	logtags := s.GetLogTagsForContext(ctxt)
+	defer close(resp)
+
+	exchange, err := s.makeRequest(ctxt, s.session, prompt, attachments, resp)
+	if err != nil {
+		return err
+	}
+
+	// Record this exchange
+	err = s.session.RecordOneExchange(ctxt, exchange)
+	changed := errors.Is(err, persistence.ErrChatSessionModified)
+	if changed {
+		// Another process recorded exchanges while the request was in progress. Load them, and
+		// record this exchange alongside them.
+		if err := s.session.Refresh(ctxt); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to reload chat session")
+			return err
+		}
+		err = s.session.RecordOneExchange(ctxt, exchange)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to record new exchange")
+		return err
+	}
+
+	if changed {
+		return ErrChatSessionChangedDuringRequest
+	}
+	return nil
+}
+
+/*
+AmendLatestRequest replace the newest exchange by sending a new request in its place
+
+The request is sent with the session history prior to the newest exchange, and keeps the
+files attached to the newest exchange. The newest exchange is only replaced once the new
+request completes.
+
+	@param ctxt context.Context - query context
+	@param prompt string - the prompt to send
+	@param resp chan string - channel for sending out the responses from the model
+*/
+func (s *chatSessionHandlerImpl) AmendLatestRequest(
 	ctxt context.Context, prompt string, resp chan string,
 ) error {
 	logtags := s.GetLogTagsForContext(ctxt)
 	defer close(resp)
 
+	exchanges, err := s.session.Exchanges(ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to read session exchanges")
+		return err
+	}
+	if len(exchanges) == 0 {
+		err := fmt.Errorf("chat session has no exchanges to amend")
+		log.WithError(err).WithFields(logtags).Error("Unable to amend latest request")
+		return err
+	}
+
+	exchange, err := s.makeRequest(
+		ctxt,
+		priorHistorySession{ChatSession: s.session},
+		prompt,
+		exchanges[len(exchanges)-1].Attachments,
+		resp,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Replace the newest exchange with this exchange
+	if err := s.session.ReplaceLatestExchange(ctxt, exchange); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to replace newest exchange")
+		return err
+	}
+
+	return nil
+}
+
+/*
+RegenerateLatestResponse send the newest request again, and record the response as a
+new variant of the newest exchange
+
+The request is sent with the session history prior to the newest exchange.
+
+	@param ctxt context.Context - query context
+	@param settings persistence.ChatSessionParameters - request parameters to use in place
+		of the session wide parameters
+	@param resp chan string - channel for sending out the responses from the model
+*/
+func (s *chatSessionHandlerImpl) RegenerateLatestResponse(
+	ctxt context.Context, settings persistence.ChatSessionParameters, resp chan string,
+) error {
+	logtags := s.GetLogTagsForContext(ctxt)
+	defer close(resp)
+
+	exchanges, err := s.session.Exchanges(ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to read session exchanges")
+		return err
+	}
+	if len(exchanges) == 0 {
+		err := fmt.Errorf("chat session has no exchanges to regenerate")
+		log.WithError(err).WithFields(logtags).Error("Unable to regenerate latest response")
+		return err
+	}
+
+	history := regenerateSession{
+		priorHistorySession: priorHistorySession{ChatSession: s.session}, settings: settings,
+	}
+	latest := exchanges[len(exchanges)-1]
+	exchange, err := s.makeRequest(ctxt, history, latest.Request, latest.Attachments, resp)
+	if err != nil {
+		return err
+	}
+
+	// Record the response as a new variant
+	variant := persistence.ChatExchangeVariant{
+		ResponseTimestamp: exchange.ResponseTimestamp,
+		Response:          exchange.Response,
+		Model:             settings.Model,
+		Temperature:       settings.Temperature,
+	}
+	if err := s.session.RecordLatestExchangeVariant(ctxt, variant); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to record new response variant")
+		return err
+	}
+
+	return nil
+}
+
+/*
+makeRequest send a request to the model, and collect the response
+
+	@param ctxt context.Context - query context
+	@param history persistence.ChatSession - the session providing the request history
+	@param prompt string - the prompt to send
+	@param attachments []persistence.ChatExchangeAttachment - files sent along with the prompt
+	@param resp chan string - channel for sending out the responses from the model
+	@return the completed exchange
+*/
+func (s *chatSessionHandlerImpl) makeRequest(
+	ctxt context.Context,
+	history persistence.ChatSession,
+	prompt string,
+	attachments []persistence.ChatExchangeAttachment,
+	resp chan string,
+) (persistence.ChatExchange, error) {
+	logtags := s.GetLogTagsForContext(ctxt)
+
 	// Verify state is correct
 	currentState, err := s.session.SessionState(ctxt)
 	if err != nil {
 		log.WithError(err).WithFields(logtags).Error("Unable to read session state")
-		return err
+		return persistence.ChatExchange{}, err
 	}
 	if currentState != persistence.ChatSessionStateOpen {
 		err := fmt.Errorf("chat session is closed")
@@ -108,7 +309,7 @@ func (s *chatSessionHandlerImpl) SendRequest(
 			WithError(err).
 			WithFields(logtags).
 			Error("Session state does not allow new requests")
-		return err
+		return persistence.ChatExchange{}, err
 	}
 
 	// Prepare a separate channel for receiving responses from the client
@@ -128,7 +329,9 @@ func (s *chatSessionHandlerImpl) SendRequest(
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := s.client.MakeCompletionRequest(requestCtxt, s.session, prompt, clientResp)
+		err := s.client.MakeCompletionRequest(
+			requestCtxt, history, requestWithAttachments(prompt, attachments), clientResp,
+		)
 		if err != nil {
 			requestErr = err
 			ctxtCancel()
@@ -136,8 +339,6 @@ func (s *chatSessionHandlerImpl) SendRequest(
 	}()
 	requestTimestamp := time.Now()
 
-	rg := regexp.MustCompile(`(\r\n?|\n){2,}`)
-
 	// Process the received response segments
 	respBuilder := strings.Builder{}
 	complete := false
@@ -145,10 +346,8 @@ func (s *chatSessionHandlerImpl) SendRequest(
 		select {
 		case msg, ok := <-clientResp:
 			if ok {
-				// Clean newline
-				cleaned := rg.ReplaceAllString(msg, "$1")
-				// New response segment
-				respBuilder.WriteString(cleaned)
+				// New response segment, stored verbatim
+				respBuilder.WriteString(msg)
 				// Pass up to caller
 				resp <- msg
 			} else {
@@ -162,7 +361,7 @@ func (s *chatSessionHandlerImpl) SendRequest(
 
 	if requestErr != nil {
 		log.WithError(requestErr).WithFields(logtags).Error("Request call failed with error")
-		return requestErr
+		return persistence.ChatExchange{}, requestErr
 	}
 
 	responseTimestamp := time.Now()
@@ -170,20 +369,49 @@ func (s *chatSessionHandlerImpl) SendRequest(
 
 	log.WithFields(logtags).Debug("Received full response")
 
-	// Record this exchange
-	exchange := persistence.ChatExchange{
+	return persistence.ChatExchange{
 		RequestTimestamp:  requestTimestamp,
 		Request:           strings.TrimSpace(prompt),
 		ResponseTimestamp: responseTimestamp,
-		Response:          strings.TrimSpace(response),
-	}
+		Response:          response,
+		Attachments:       attachments,
+	}, nil
+}
 
-	if err := s.session.RecordOneExchange(ctxt, exchange); err != nil {
-		log.WithError(err).WithFields(logtags).Error("Failed to record new exchange")
-		return err
+// priorHistorySession view of a chat session which hides the newest exchange
+type priorHistorySession struct {
+	persistence.ChatSession
+}
+
+/*
+Exchanges fetch all the session exchanges, except the newest one
+
+	@param ctxt context.Context - query context
+	@return the session exchanges in order
+*/
+func (s priorHistorySession) Exchanges(ctxt context.Context) ([]persistence.ChatExchange, error) {
+	exchanges, err := s.ChatSession.Exchanges(ctxt)
+	if err != nil || len(exchanges) == 0 {
+		return exchanges, err
 	}
+	return exchanges[:len(exchanges)-1], nil
+}
 
-	return nil
+// regenerateSession view of a chat session which hides the newest exchange, and overrides the
+// session wide request parameters
+type regenerateSession struct {
+	priorHistorySession
+	settings persistence.ChatSessionParameters
+}
+
+/*
+Settings returns the request parameters to use in place of the session wide parameters
+
+	@param ctxt context.Context - query context
+	@return request parameters
+*/
+func (s regenerateSession) Settings(ctxt context.Context) (persistence.ChatSessionParameters, error) {
+	return s.settings, nil
 }
 
 /*
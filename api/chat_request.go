@@ -2,11 +2,13 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/alwitt/cli-gpt/persistence"
 	"github.com/alwitt/goutils"
 	"github.com/apex/log"
+	openai "github.com/sashabaranov/go-openai"
 )
 
 /*
@@ -51,6 +53,8 @@ func GetSimpleChatPromptBuilder() (ChatPromptBuilder, error) {
 CreatePrompt build a complete prompt using the existing session exchanges, and the new
 request from the user.
 
+The notes pinned to the session always start the prompt.
+
 	@param ctxt context.Context - query context
 	@param session persistence.ChatSession - current chat session
 	@param newRequest string - new user request
@@ -67,11 +71,28 @@ func (b *concatenateChatPromptBuilder) CreatePrompt(
 		return "", err
 	}
 
+	notes, err := pinnedNotesText(ctxt, session)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to query for session pinned notes")
+		return "", err
+	}
+
 	fullPromptBuilder := strings.Builder{}
 
+	// Start with the pinned notes
+	if notes != "" {
+		for _, entry := range []string{notes, "\n\n"} {
+			if _, err := fullPromptBuilder.WriteString(entry); err != nil {
+				log.WithError(err).WithFields(logtags).Error("Request concatenation failed")
+				return "", err
+			}
+		}
+	}
+
 	// Pull together the existing exchanges
 	for _, oneExchange := range allExchanges {
-		for _, entry := range []string{oneExchange.Request, "\n\n", oneExchange.Response, "\n\n"} {
+		request := requestWithAttachments(oneExchange.Request, oneExchange.Attachments)
+		for _, entry := range []string{request, "\n\n", oneExchange.Response, "\n\n"} {
 			if _, err := fullPromptBuilder.WriteString(entry); err != nil {
 				log.WithError(err).WithFields(logtags).Error("Request concatenation failed")
 				return "", err
@@ -87,3 +108,132 @@ func (b *concatenateChatPromptBuilder) CreatePrompt(
 
 	return fullPromptBuilder.String(), nil
 }
+
+// pinnedNotesPreamble introduces the notes pinned to a chat session
+const pinnedNotesPreamble = "Keep the following notes in mind for the whole conversation."
+
+/*
+fencedBlock helper function to place text in a labeled markdown code block
+
+The fence is longer than any run of backticks in the text, so the text can not end the
+block early.
+
+	@param label string - label placed before the block
+	@param content string - the text
+	@return the labeled block
+*/
+func fencedBlock(label, content string) string {
+	longestRun := 0
+	currentRun := 0
+	for _, char := range content {
+		if char == '`' {
+			currentRun++
+			if currentRun > longestRun {
+				longestRun = currentRun
+			}
+		} else {
+			currentRun = 0
+		}
+	}
+	fenceLength := 3
+	if longestRun >= fenceLength {
+		fenceLength = longestRun + 1
+	}
+	fence := strings.Repeat("`", fenceLength)
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return fmt.Sprintf("%s:\n%s\n%s%s", label, fence, content, fence)
+}
+
+/*
+requestWithAttachments helper function to combine a request with the files attached to it
+
+Each file is placed in a code block labeled with the file name, after the request.
+
+	@param request string - the request
+	@param attachments []persistence.ChatExchangeAttachment - the attached files
+	@return the combined request
+*/
+func requestWithAttachments(
+	request string, attachments []persistence.ChatExchangeAttachment,
+) string {
+	if len(attachments) == 0 {
+		return request
+	}
+	sections := []string{strings.TrimRight(request, "\n")}
+	for _, oneAttachment := range attachments {
+		sections = append(sections, fencedBlock(oneAttachment.Name, oneAttachment.Content))
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+/*
+pinnedNotesText helper function to combine the notes pinned to a session into one block of text
+
+Notes read from a file are placed in a code block labeled with the file name.
+
+	@param ctxt context.Context - query context
+	@param session persistence.ChatSession - current chat session
+	@return the combined notes. Empty if no notes are pinned.
+*/
+func pinnedNotesText(ctxt context.Context, session persistence.ChatSession) (string, error) {
+	notes, err := session.PinnedNotes(ctxt)
+	if err != nil {
+		return "", err
+	}
+	if len(notes) == 0 {
+		return "", nil
+	}
+	sections := []string{pinnedNotesPreamble}
+	for _, oneNote := range notes {
+		if oneNote.Source != "" {
+			sections = append(sections, fencedBlock(oneNote.Source, oneNote.Content))
+		} else {
+			sections = append(sections, oneNote.Content)
+		}
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+/*
+chatCompletionMessages build the messages of a chat completion request from the session
+history and the new request
+
+The notes pinned to the session always follow the system message.
+
+	@param ctxt context.Context - query context
+	@param session persistence.ChatSession - current chat session
+	@param newRequest string - new user request
+	@return the request messages
+*/
+func chatCompletionMessages(
+	ctxt context.Context, session persistence.ChatSession, newRequest string,
+) ([]openai.ChatCompletionMessage, error) {
+	requestMsgs := []openai.ChatCompletionMessage{
+		{Role: "system", Content: "You are a helpful assistant."},
+	}
+	notes, err := pinnedNotesText(ctxt, session)
+	if err != nil {
+		return nil, err
+	}
+	if notes != "" {
+		requestMsgs = append(requestMsgs, openai.ChatCompletionMessage{Role: "system", Content: notes})
+	}
+	exchanges, err := session.Exchanges(ctxt)
+	if err != nil {
+		return nil, err
+	}
+	for _, oneExchange := range exchanges {
+		requestMsgs = append(requestMsgs, []openai.ChatCompletionMessage{
+			{
+				Role:    "user",
+				Content: requestWithAttachments(oneExchange.Request, oneExchange.Attachments),
+			},
+			{Role: "assistant", Content: oneExchange.Response},
+		}...)
+	}
+	return append(
+		requestMsgs, openai.ChatCompletionMessage{Role: "user", Content: newRequest},
+	), nil
+}
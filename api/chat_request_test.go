@@ -22,7 +22,7 @@ func TestConcatenateChatPromptBuilder(t *testing.T) {
 	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
 
 	userManager, err := persistence.GetSQLUserManager(
-		persistence.GetSqliteDialector(testDB), logger.Info,
+		persistence.GetSqliteDialector(testDB), logger.Info, nil,
 	)
 	assert.Nil(err)
 
@@ -77,3 +77,152 @@ func TestConcatenateChatPromptBuilder(t *testing.T) {
 		assert.Equal(expectedPrompt, fullPrompt)
 	}
 }
+
+func TestPinnedNotesInRequests(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := persistence.GetSQLUserManager(
+		persistence.GetSqliteDialector(testDB), logger.Info, nil,
+	)
+	assert.Nil(err)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, "unit-tester-0")
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+	chatSession, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+
+	currentTime := time.Now()
+	exchange := persistence.ChatExchange{
+		RequestTimestamp:  currentTime,
+		Request:           "req-0",
+		ResponseTimestamp: currentTime.Add(time.Second),
+		Response:          "resp-0",
+	}
+	assert.Nil(chatSession.RecordOneExchange(utContext, exchange))
+
+	// Case 0: no pinned notes
+	{
+		builder, err := GetSimpleChatPromptBuilder()
+		assert.Nil(err)
+		prompt, err := builder.CreatePrompt(utContext, chatSession, "Hello World")
+		assert.Nil(err)
+		assert.Equal("req-0\n\nresp-0\n\nHello World", prompt)
+
+		msgs, err := chatCompletionMessages(utContext, chatSession, "Hello World")
+		assert.Nil(err)
+		assert.Len(msgs, 4)
+		assert.Equal("system", msgs[0].Role)
+		assert.Equal("req-0", msgs[1].Content)
+		assert.Equal("Hello World", msgs[3].Content)
+	}
+
+	// Case 1: pinned notes come before the history
+	{
+		_, err := chatSession.PinNote(
+			utContext, persistence.ChatSessionNote{Content: "Stack is Go 1.21 + Postgres"},
+		)
+		assert.Nil(err)
+		_, err = chatSession.PinNote(
+			utContext, persistence.ChatSessionNote{Content: "package main", Source: "main.go"},
+		)
+		assert.Nil(err)
+		expectedNotes := pinnedNotesPreamble +
+			"\n\nStack is Go 1.21 + Postgres\n\nmain.go:\n```\npackage main\n```"
+
+		builder, err := GetSimpleChatPromptBuilder()
+		assert.Nil(err)
+		prompt, err := builder.CreatePrompt(utContext, chatSession, "Hello World")
+		assert.Nil(err)
+		assert.Equal(expectedNotes+"\n\nreq-0\n\nresp-0\n\nHello World", prompt)
+
+		msgs, err := chatCompletionMessages(utContext, chatSession, "Hello World")
+		assert.Nil(err)
+		assert.Len(msgs, 5)
+		assert.Equal("system", msgs[1].Role)
+		assert.Equal(expectedNotes, msgs[1].Content)
+		assert.Equal("req-0", msgs[2].Content)
+		assert.Equal("Hello World", msgs[4].Content)
+
+		// The notes are kept when the history is cut short
+		msgs, err = chatCompletionMessages(
+			utContext, priorHistorySession{ChatSession: chatSession}, "Hello World",
+		)
+		assert.Nil(err)
+		assert.Len(msgs, 3)
+		assert.Equal(expectedNotes, msgs[1].Content)
+	}
+
+	// Case 2: fenced blocks are longer than fences in the content
+	{
+		block := fencedBlock("README.md", "```go\nfunc main() {}\n```\n")
+		assert.Equal("README.md:\n````\n```go\nfunc main() {}\n```\n````", block)
+	}
+}
+
+func TestAttachmentsInRequests(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := persistence.GetSQLUserManager(
+		persistence.GetSqliteDialector(testDB), logger.Info, nil,
+	)
+	assert.Nil(err)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, "unit-tester-0")
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+	chatSession, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+
+	currentTime := time.Now()
+	exchange := persistence.ChatExchange{
+		RequestTimestamp:  currentTime,
+		Request:           "req-0",
+		ResponseTimestamp: currentTime.Add(time.Second),
+		Response:          "resp-0",
+		Attachments: []persistence.ChatExchangeAttachment{
+			{Name: "main.go", Content: "package main\n"},
+			{Name: "go.mod", Content: "module example"},
+		},
+	}
+	assert.Nil(chatSession.RecordOneExchange(utContext, exchange))
+
+	expectedRequest := "req-0\n\nmain.go:\n```\npackage main\n```\n\ngo.mod:\n```\nmodule example\n```"
+
+	// Case 0: the attached files follow the request in the history
+	{
+		builder, err := GetSimpleChatPromptBuilder()
+		assert.Nil(err)
+		prompt, err := builder.CreatePrompt(utContext, chatSession, "Hello World")
+		assert.Nil(err)
+		assert.Equal(expectedRequest+"\n\nresp-0\n\nHello World", prompt)
+
+		msgs, err := chatCompletionMessages(utContext, chatSession, "Hello World")
+		assert.Nil(err)
+		assert.Len(msgs, 4)
+		assert.Equal(expectedRequest, msgs[1].Content)
+		assert.Equal("resp-0", msgs[2].Content)
+	}
+
+	// Case 1: combine a new request with its attached files
+	{
+		assert.Equal("Hello World", requestWithAttachments("Hello World", nil))
+		assert.Equal(
+			expectedRequest, requestWithAttachments("req-0\n", exchange.Attachments),
+		)
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -73,7 +74,7 @@ func TestChatSessionHandler(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			assert.Nil(uut.SendRequest(utContext, testPrompt, testRespChan))
+			assert.Nil(uut.SendRequest(utContext, testPrompt, nil, testRespChan))
 		}()
 
 		// Read expected response
@@ -97,7 +98,7 @@ func TestChatSessionHandler(t *testing.T) {
 			Return(persistence.ChatSessionStateClose, nil).
 			Once()
 
-		assert.NotNil(uut.SendRequest(utContext, testPrompt, testRespChan))
+		assert.NotNil(uut.SendRequest(utContext, testPrompt, nil, testRespChan))
 	}
 
 	// Case 2: client ended request with error
@@ -124,7 +125,7 @@ func TestChatSessionHandler(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			assert.NotNil(uut.SendRequest(utContext, testPrompt, testRespChan))
+			assert.NotNil(uut.SendRequest(utContext, testPrompt, nil, testRespChan))
 		}()
 
 		// Read expected response
@@ -172,7 +173,7 @@ func TestChatSessionHandler(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			assert.Nil(uut.SendRequest(utContext, testPrompt, testRespChan))
+			assert.Nil(uut.SendRequest(utContext, testPrompt, nil, testRespChan))
 		}()
 
 		// Read expected response
@@ -183,4 +184,357 @@ func TestChatSessionHandler(t *testing.T) {
 			assert.False(ok, "unexpected response")
 		}
 	}
+
+	// Case 4: response is recorded verbatim
+	{
+		testPrompt := uuid.NewString()
+		testResponse := []string{"\n\n```go\nfunc main() {\n\n", "\tprint(\"hello\")\n}\n```\n\n"}
+		testRespChan := make(chan string)
+
+		// Setup mocks
+		mockChatSession.
+			On("SessionState", utContext).
+			Return(persistence.ChatSessionStateOpen, nil).
+			Once()
+		mockClient.On(
+			"MakeCompletionRequest",
+			mock.AnythingOfType("*context.cancelCtx"),
+			mockChatSession,
+			testPrompt,
+			mock.AnythingOfType("chan string"),
+		).Run(func(args mock.Arguments) {
+			respChan := args.Get(3).(chan string)
+			defer close(respChan)
+			for _, segment := range testResponse {
+				respChan <- segment
+			}
+		}).Return(nil).Once()
+		mockChatSession.On(
+			"RecordOneExchange",
+			utContext,
+			mock.AnythingOfType("persistence.ChatExchange"),
+		).Run(func(args mock.Arguments) {
+			newExchange := args.Get(1).(persistence.ChatExchange)
+			assert.Equal(testPrompt, newExchange.Request)
+			assert.Equal(strings.Join(testResponse, ""), newExchange.Response)
+		}).Return(nil).Once()
+
+		// Make request
+		wg := sync.WaitGroup{}
+		defer wg.Wait()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(uut.SendRequest(utContext, testPrompt, nil, testRespChan))
+		}()
+
+		// Read expected response
+		for _, segment := range testResponse {
+			select {
+			case <-time.After(time.Millisecond * 10):
+				assert.NotNilf(nil, "timeout reading for response")
+			case rxMsg, ok := <-testRespChan:
+				assert.True(ok)
+				assert.Equal(segment, rxMsg)
+			}
+		}
+	}
+
+	// Case 5: amend the latest request
+	{
+		testPrompt := uuid.NewString()
+		testResponse := uuid.NewString()
+		testRespChan := make(chan string)
+		history := []persistence.ChatExchange{
+			{Request: "req-0", Response: "resp-0"}, {Request: "req-1", Response: "resp-1"},
+		}
+
+		// Setup mocks
+		mockChatSession.On("Exchanges", utContext).Return(history, nil).Twice()
+		mockChatSession.
+			On("SessionState", utContext).
+			Return(persistence.ChatSessionStateOpen, nil).
+			Once()
+		mockClient.On(
+			"MakeCompletionRequest",
+			mock.AnythingOfType("*context.cancelCtx"),
+			mock.AnythingOfType("api.priorHistorySession"),
+			testPrompt,
+			mock.AnythingOfType("chan string"),
+		).Run(func(args mock.Arguments) {
+			// The newest exchange is not part of the history
+			session := args.Get(1).(persistence.ChatSession)
+			exchanges, err := session.Exchanges(utContext)
+			assert.Nil(err)
+			assert.Equal(history[:1], exchanges)
+			respChan := args.Get(3).(chan string)
+			defer close(respChan)
+			respChan <- testResponse
+		}).Return(nil).Once()
+		mockChatSession.On(
+			"ReplaceLatestExchange",
+			utContext,
+			mock.AnythingOfType("persistence.ChatExchange"),
+		).Run(func(args mock.Arguments) {
+			newExchange := args.Get(1).(persistence.ChatExchange)
+			assert.Equal(testPrompt, newExchange.Request)
+			assert.Equal(testResponse, newExchange.Response)
+		}).Return(nil).Once()
+
+		// Make request
+		wg := sync.WaitGroup{}
+		defer wg.Wait()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(uut.AmendLatestRequest(utContext, testPrompt, testRespChan))
+		}()
+
+		// Read expected response
+		select {
+		case <-time.After(time.Millisecond * 10):
+			assert.NotNilf(nil, "timeout reading for response")
+		case rxMsg, ok := <-testRespChan:
+			assert.True(ok)
+			assert.Equal(testResponse, rxMsg)
+		}
+	}
+
+	// Case 6: nothing to amend
+	{
+		testRespChan := make(chan string)
+
+		// Setup mocks
+		mockChatSession.
+			On("Exchanges", utContext).
+			Return([]persistence.ChatExchange{}, nil).
+			Once()
+
+		assert.NotNil(uut.AmendLatestRequest(utContext, uuid.NewString(), testRespChan))
+	}
+
+	// Case 7: regenerate the latest response with different settings
+	{
+		testResponse := uuid.NewString()
+		testRespChan := make(chan string)
+		history := []persistence.ChatExchange{
+			{Request: "req-0", Response: "resp-0"}, {Request: "req-1", Response: "resp-1"},
+		}
+		settings := persistence.GetDefaultChatSessionParams("davinci")
+		temperature := float32(1.5)
+		settings.Temperature = &temperature
+
+		// Setup mocks
+		mockChatSession.On("Exchanges", utContext).Return(history, nil).Twice()
+		mockChatSession.
+			On("SessionState", utContext).
+			Return(persistence.ChatSessionStateOpen, nil).
+			Once()
+		mockClient.On(
+			"MakeCompletionRequest",
+			mock.AnythingOfType("*context.cancelCtx"),
+			mock.AnythingOfType("api.regenerateSession"),
+			"req-1",
+			mock.AnythingOfType("chan string"),
+		).Run(func(args mock.Arguments) {
+			// The request is made with the history prior to the newest exchange, and the
+			// requested settings
+			session := args.Get(1).(persistence.ChatSession)
+			exchanges, err := session.Exchanges(utContext)
+			assert.Nil(err)
+			assert.Equal(history[:1], exchanges)
+			requestSettings, err := session.Settings(utContext)
+			assert.Nil(err)
+			assert.Equal(settings, requestSettings)
+			respChan := args.Get(3).(chan string)
+			defer close(respChan)
+			respChan <- testResponse
+		}).Return(nil).Once()
+		mockChatSession.On(
+			"RecordLatestExchangeVariant",
+			utContext,
+			mock.AnythingOfType("persistence.ChatExchangeVariant"),
+		).Run(func(args mock.Arguments) {
+			variant := args.Get(1).(persistence.ChatExchangeVariant)
+			assert.Equal(testResponse, variant.Response)
+			assert.Equal("davinci", variant.Model)
+			assert.Equal(&temperature, variant.Temperature)
+		}).Return(nil).Once()
+
+		// Make request
+		wg := sync.WaitGroup{}
+		defer wg.Wait()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(uut.RegenerateLatestResponse(utContext, settings, testRespChan))
+		}()
+
+		// Read expected response
+		select {
+		case <-time.After(time.Millisecond * 10):
+			assert.NotNilf(nil, "timeout reading for response")
+		case rxMsg, ok := <-testRespChan:
+			assert.True(ok)
+			assert.Equal(testResponse, rxMsg)
+		}
+	}
+
+}
+
+func TestChatSessionHandlerAttachments(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	// Define mock objects
+	mockUser := new(mocks.User)
+	mockClient := new(mocks.Client)
+	mockChatSession := new(mocks.ChatSession)
+
+	utContext := context.Background()
+
+	// Setup default responses
+	mockChatSession.On("User", utContext).Return(mockUser, nil)
+	mockUser.On("GetName", utContext).Return("unit-tester", nil)
+	mockChatSession.On("SessionID", utContext).Return(uuid.NewString(), nil)
+
+	// Create new chat session handler
+	uut, err := DefineChatSessionHandler(utContext, mockChatSession, mockClient)
+	assert.Nil(err)
+
+	// Files attached to the request are sent after the request, and recorded apart from it
+	{
+		testPrompt := uuid.NewString()
+		testResponse := uuid.NewString()
+		testRespChan := make(chan string)
+		attachments := []persistence.ChatExchangeAttachment{
+			{Name: "main.go", Content: "package main\n"},
+		}
+
+		// Setup mocks
+		mockChatSession.
+			On("SessionState", utContext).
+			Return(persistence.ChatSessionStateOpen, nil).
+			Once()
+		mockClient.On(
+			"MakeCompletionRequest",
+			mock.AnythingOfType("*context.cancelCtx"),
+			mockChatSession,
+			testPrompt+"\n\nmain.go:\n```\npackage main\n```",
+			mock.AnythingOfType("chan string"),
+		).Run(func(args mock.Arguments) {
+			respChan := args.Get(3).(chan string)
+			defer close(respChan)
+			respChan <- testResponse
+		}).Return(nil).Once()
+		mockChatSession.On(
+			"RecordOneExchange",
+			utContext,
+			mock.AnythingOfType("persistence.ChatExchange"),
+		).Run(func(args mock.Arguments) {
+			// The attachments are recorded apart from the request
+			newExchange := args.Get(1).(persistence.ChatExchange)
+			assert.Equal(testPrompt, newExchange.Request)
+			assert.Equal(attachments, newExchange.Attachments)
+		}).Return(nil).Once()
+
+		// Make request
+		wg := sync.WaitGroup{}
+		defer wg.Wait()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(uut.SendRequest(utContext, testPrompt, attachments, testRespChan))
+		}()
+
+		// Read expected response
+		select {
+		case <-time.After(time.Millisecond * 10):
+			assert.NotNilf(nil, "timeout reading for response")
+		case rxMsg, ok := <-testRespChan:
+			assert.True(ok)
+			assert.Equal(testResponse, rxMsg)
+		}
+	}
+
+}
+
+func TestChatSessionHandlerSessionChanged(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	// Define mock objects
+	mockUser := new(mocks.User)
+	mockClient := new(mocks.Client)
+	mockChatSession := new(mocks.ChatSession)
+
+	utContext := context.Background()
+
+	// Setup default responses
+	mockChatSession.On("User", utContext).Return(mockUser, nil)
+	mockUser.On("GetName", utContext).Return("unit-tester", nil)
+	mockChatSession.On("SessionID", utContext).Return(uuid.NewString(), nil)
+
+	// Create new chat session handler
+	uut, err := DefineChatSessionHandler(utContext, mockChatSession, mockClient)
+	assert.Nil(err)
+
+	testPrompt := uuid.NewString()
+	testResponse := uuid.NewString()
+	testRespChan := make(chan string)
+
+	// Setup mocks
+	mockChatSession.
+		On("SessionState", utContext).
+		Return(persistence.ChatSessionStateOpen, nil).
+		Once()
+	mockClient.On(
+		"MakeCompletionRequest",
+		mock.AnythingOfType("*context.cancelCtx"),
+		mockChatSession,
+		testPrompt,
+		mock.AnythingOfType("chan string"),
+	).Run(func(args mock.Arguments) {
+		respChan := args.Get(3).(chan string)
+		defer close(respChan)
+		respChan <- testResponse
+	}).Return(nil).Once()
+	mockChatSession.On(
+		"RecordOneExchange",
+		utContext,
+		mock.AnythingOfType("persistence.ChatExchange"),
+	).Return(persistence.ErrChatSessionModified).Once()
+	mockChatSession.On("Refresh", utContext).Return(nil).Once()
+	mockChatSession.On(
+		"RecordOneExchange",
+		utContext,
+		mock.AnythingOfType("persistence.ChatExchange"),
+	).Run(func(args mock.Arguments) {
+		newExchange := args.Get(1).(persistence.ChatExchange)
+		assert.Equal(testPrompt, newExchange.Request)
+		assert.Equal(testResponse, newExchange.Response)
+	}).Return(nil).Once()
+
+	// Make request, which sees the session changed when recording the exchange
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.ErrorIs(
+			uut.SendRequest(utContext, testPrompt, nil, testRespChan),
+			ErrChatSessionChangedDuringRequest,
+		)
+	}()
+
+	// Read expected response
+	select {
+	case <-time.After(time.Millisecond * 10):
+		assert.NotNilf(nil, "timeout reading for response")
+	case rxMsg, ok := <-testRespChan:
+		assert.True(ok)
+		assert.Equal(testResponse, rxMsg)
+	}
+
+	wg.Wait()
+	mockChatSession.AssertExpectations(t)
 }
@@ -286,24 +286,12 @@ func (c *clientImpl) makeChatCompletionRequest(
 	}
 
 	// Define request messages
-	requestMsgs := []openai.ChatCompletionMessage{
-		{Role: "system", Content: "You are a helpful assistant."},
-	}
-	exchanges, err := session.Exchanges(ctxt)
+	requestMsgs, err := chatCompletionMessages(ctxt, session, prompt)
 	if err != nil {
-		log.WithError(err).WithFields(logtags).Error("Unable to fetch session exchanges")
+		log.WithError(err).WithFields(logtags).Error("Unable to build request messages")
 		return err
 	}
-	for _, oneExchange := range exchanges {
-		requestMsgs = append(requestMsgs, []openai.ChatCompletionMessage{
-			{Role: "user", Content: oneExchange.Request},
-			{Role: "assistant", Content: oneExchange.Response},
-		}...)
-	}
 	request.Messages = requestMsgs
-	request.Messages = append(
-		request.Messages, openai.ChatCompletionMessage{Role: "user", Content: prompt},
-	)
 
 	stream, err := c.client.CreateChatCompletionStream(ctxt, request)
 	if err != nil {
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/alwitt/cli-gpt/api"
+	"github.com/alwitt/cli-gpt/display"
+	"github.com/apex/log"
+	"github.com/urfave/cli/v2"
+)
+
+// amendChatActionCLIArgs cli arguments to amend the latest request of a chat session
+type amendChatActionCLIArgs struct {
+	commonCLIArgs
+	chatDisplayArgs
+	// SessionID the chat session ID. The active chat session is used if not given.
+	SessionID string
+	// NoEditor always edit the request with the inline prompt
+	NoEditor bool
+}
+
+/*
+GetCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *amendChatActionCLIArgs) GetCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.StringFlag{
+			Name:        "session-id",
+			Usage:       "Target chat session ID. Defaults to the currently active chat session.",
+			Aliases:     []string{"i"},
+			EnvVars:     []string{"TARGET_SESSION_ID"},
+			Destination: &c.SessionID,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "no-editor",
+			Usage:       "Enter the amended request inline, even if $EDITOR is set",
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.NoEditor,
+			Required:    false,
+		},
+	}...)
+	cliFlags = append(cliFlags, c.chatDisplayArgs.getCLIFlags()...)
+
+	return cliFlags
+}
+
+// AmendChatParams CLI arguments for amending the latest request of a chat session
+var AmendChatParams amendChatActionCLIArgs
+
+/*
+editTextInEditor let the user edit some text with $VISUAL or $EDITOR
+
+	@param ctxt context.Context - query context
+	@param editor string - the editor command
+	@param original string - the text to edit
+	@return the edited text
+*/
+func editTextInEditor(ctxt context.Context, editor, original string) (string, error) {
+	editFile, err := os.CreateTemp("", "gpt-edit-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.Remove(editFile.Name())
+	}()
+	if _, err := editFile.WriteString(original); err != nil {
+		_ = editFile.Close()
+		return "", err
+	}
+	if err := editFile.Close(); err != nil {
+		return "", err
+	}
+
+	// The editor setting may include arguments, e.g. "code --wait"
+	cmd := exec.CommandContext(ctxt, "sh", "-c", editor+` "$1"`, "sh", editFile.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor '%s' failed: %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(editFile.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(edited), nil
+}
+
+/*
+editText let the user edit some text, either with $VISUAL or $EDITOR, or inline
+
+	@param ctxt context.Context - query context
+	@param kind string - what is being edited, e.g. "request"
+	@param original string - the text to edit
+	@param allowEditor bool - whether an external editor can be used
+	@return the edited text
+*/
+func editText(ctxt context.Context, kind, original string, allowEditor bool) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if allowEditor && editor != "" && display.IsTerminal(os.Stdin) {
+		return editTextInEditor(ctxt, editor, original)
+	}
+
+	fmt.Printf("Current %s:\n%s\n\nEnter the amended %s:\n", kind, strings.TrimSpace(original), kind)
+	return multilinePrompt(ctxt)
+}
+
+/*
+ActionAmendLatestRequest edit the latest request of a chat session, and resend it in place of
+the latest exchange
+
+	@param args *amendChatActionCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func ActionAmendLatestRequest(args *amendChatActionCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		output, err := args.responseWriter()
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid output display options")
+			return err
+		}
+
+		session, err := selectedOrActiveSession(app, chatManager, args.SessionID)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Could not fetch chat session")
+			return err
+		}
+
+		exchanges, err := session.Exchanges(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Session exchanges read failed")
+			return err
+		}
+		if len(exchanges) == 0 {
+			return fmt.Errorf("chat session has no exchanges to amend")
+		}
+
+		prompt, err := editText(
+			app.ctxt, "request", exchanges[len(exchanges)-1].Request, !args.NoEditor,
+		)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to edit the latest request")
+			return err
+		}
+		if strings.TrimSpace(prompt) == "" {
+			return fmt.Errorf("amended request is empty, latest exchange left unchanged")
+		}
+
+		log.WithFields(logtags).Debugf("Your amended prompt:\n%s\n", prompt)
+
+		return streamChatRequest(
+			app, session, output, logtags,
+			func(chatHandler api.ChatSessionHandler, respChan chan string) error {
+				return chatHandler.AmendLatestRequest(app.ctxt, prompt, respChan)
+			},
+		)
+	}
+}
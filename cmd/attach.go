@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alwitt/cli-gpt/persistence"
+)
+
+// maxAttachedFileSize largest file which can be attached to a request
+const maxAttachedFileSize = 64 * 1024
+
+// maxAttachedTotalSize largest combined size of the files attached to one request. Attached
+// files are sent again with every later request of the chat session.
+const maxAttachedTotalSize = 256 * 1024
+
+/*
+readAttachments read the files to attach to a request
+
+A pattern may be a file name, or a glob such as "cmd/*.go". Directories matched by a glob are
+skipped, and a file matched more than once is only attached once.
+
+	@param patterns []string - the file names or globs, in the order given
+	@return the attachments
+*/
+func readAttachments(patterns []string) ([]persistence.ChatExchangeAttachment, error) {
+	attachments := []persistence.ChatExchangeAttachment{}
+	attached := map[string]bool{}
+	totalSize := int64(0)
+	for _, pattern := range patterns {
+		fileNames, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid file pattern: %w", pattern, err)
+		}
+		if len(fileNames) == 0 {
+			return nil, fmt.Errorf("no files match '%s'", pattern)
+		}
+		isGlob := strings.ContainsAny(pattern, "*?[")
+		for _, fileName := range fileNames {
+			if attached[fileName] {
+				continue
+			}
+			if isGlob {
+				if fileInfo, err := os.Stat(fileName); err == nil && fileInfo.IsDir() {
+					continue
+				}
+			}
+			content, err := readTextFile(fileName, maxAttachedFileSize)
+			if err != nil {
+				return nil, err
+			}
+			attachment := persistence.ChatExchangeAttachment{Name: fileName, Content: content}
+			totalSize += attachment.Size()
+			if totalSize > maxAttachedTotalSize {
+				return nil, fmt.Errorf(
+					"attached files are larger than the %s limit",
+					formatByteSize(maxAttachedTotalSize),
+				)
+			}
+			attached[fileName] = true
+			attachments = append(attachments, attachment)
+		}
+	}
+	return attachments, nil
+}
+
+/*
+describeAttachment summary of an attached file for display, e.g. "main.go (3.2 KB)"
+
+	@param attachment persistence.ChatExchangeAttachment - the attached file
+	@return the summary
+*/
+func describeAttachment(attachment persistence.ChatExchangeAttachment) string {
+	return fmt.Sprintf("%s (%s)", attachment.Name, formatByteSize(attachment.Size()))
+}
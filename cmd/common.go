@@ -4,15 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/user"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/alwitt/cli-gpt/display"
 	"github.com/alwitt/cli-gpt/persistence"
 	"github.com/alwitt/goutils"
 	"github.com/apex/log"
 	apexJSON "github.com/apex/log/handlers/json"
 	"github.com/go-playground/validator/v10"
+	"github.com/manifoldco/promptui"
 	"github.com/urfave/cli/v2"
 	gormLogger "gorm.io/gorm/logger"
 )
@@ -31,6 +37,17 @@ type configFileArgs struct {
 	UserContext string `validate:"required"`
 	// SqliteDB sqlite DB file for persistence
 	SqliteDB string `validate:"required"`
+	// Ephemeral whether to keep all data in memory, leaving no trace on disk
+	Ephemeral bool
+	// PassphraseFile file containing the passphrase for encrypting stored API tokens
+	PassphraseFile string
+	// ArchiveIdleAfter archive chat sessions not used for this long. Disabled if zero.
+	ArchiveIdleAfter time.Duration
+	// PurgeTrashAfter permanently delete chat sessions in the trash for this long. Disabled if
+	// zero.
+	PurgeTrashAfter time.Duration
+	// AutoPrune whether to enforce the active user's retention policy at startup
+	AutoPrune bool
 }
 
 /*
@@ -139,30 +156,158 @@ func (c *commonCLIArgs) GetCommonCLIFlags() []cli.Flag {
 			Destination: &c.Config.SqliteDB,
 			Required:    false,
 		},
+		&cli.StringFlag{
+			Name: "passphrase-file",
+			Usage: fmt.Sprintf(
+				"File containing the passphrase for encrypting stored API tokens. "+
+					"The passphrase can also be provided through %s, or is prompted for",
+				tokenPassphraseEnvVar,
+			),
+			Aliases:     []string{"pf"},
+			EnvVars:     []string{"PASSPHRASE_FILE"},
+			Destination: &c.Config.PassphraseFile,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name: "ephemeral",
+			Usage: fmt.Sprintf(
+				"Keep all data in memory, leaving no trace on disk. The API token is read from %s",
+				ephemeralAPITokenEnvVar,
+			),
+			EnvVars:     []string{"EPHEMERAL"},
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.Config.Ephemeral,
+			Required:    false,
+		},
+		&cli.DurationFlag{
+			Name:        "archive-idle-after",
+			Usage:       "Archive chat sessions which were not used for this long, e.g. 720h",
+			EnvVars:     []string{"ARCHIVE_IDLE_AFTER"},
+			Value:       0,
+			DefaultText: "never",
+			Destination: &c.Config.ArchiveIdleAfter,
+			Required:    false,
+		},
+		&cli.DurationFlag{
+			Name:        "purge-trash-after",
+			Usage:       "Permanently delete chat sessions which were in the trash for this long. Never if 0",
+			EnvVars:     []string{"PURGE_TRASH_AFTER"},
+			Value:       defaultPurgeTrashAfter,
+			DefaultText: defaultPurgeTrashAfter.String(),
+			Destination: &c.Config.PurgeTrashAfter,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "auto-prune",
+			Usage:       "Prune chat history exceeding the active user's retention policy at startup",
+			EnvVars:     []string{"AUTO_PRUNE"},
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.Config.AutoPrune,
+			Required:    false,
+		},
 	}
 }
 
 // CommonParams basic CLI arguments
 var CommonParams commonCLIArgs
 
+// chatDisplayArgs cli arguments related to how model outputs are displayed
+type chatDisplayArgs struct {
+	// OutputFilters filters to apply to the model output before it is displayed
+	OutputFilters cli.StringSlice
+	// Raw whether to display the model output without markdown rendering
+	Raw bool
+}
+
 /*
-initialSetup perform basic application setup
+getCLIFlags fetch the list of CLI arguments
 
-	@param validate *validator.Validate - validation engine
-	@param appInstance string - application instance name
-	@return new application context
+	@return the list of CLI arguments
 */
-func (c *commonCLIArgs) initialSetup(
-	validate *validator.Validate, appInstance string,
-) (*applicationContext, error) {
-	if err := validate.Struct(c); err != nil {
+func (c *chatDisplayArgs) getCLIFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name: "output-filter",
+			Usage: fmt.Sprintf(
+				"Filters applied, in order, to model output before display: [%s]",
+				strings.Join(display.SupportedOutputFilters(), " "),
+			),
+			Aliases:     []string{"of"},
+			EnvVars:     []string{"OUTPUT_FILTERS"},
+			Destination: &c.OutputFilters,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "raw",
+			Usage:       "Display model output as is, without markdown rendering",
+			EnvVars:     []string{"RAW_OUTPUT"},
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.Raw,
+			Required:    false,
+		},
+	}
+}
+
+/*
+outputFilterPipeline define the output filter pipeline requested by the user
+
+	@return the output filter pipeline
+*/
+func (c *chatDisplayArgs) outputFilterPipeline() (display.OutputFilterPipeline, error) {
+	return display.DefineOutputFilterPipeline(c.OutputFilters.Value())
+}
+
+/*
+markdownRenderer define the markdown renderer for displaying model output
+
+Markdown rendering is only used when STDOUT is a terminal, and the user did not request
+raw output.
+
+	@return the markdown renderer, or nil if the output should not be rendered
+*/
+func (c *chatDisplayArgs) markdownRenderer() (display.TextRenderer, error) {
+	if c.Raw || !display.IsTerminal(os.Stdout) {
+		return nil, nil
+	}
+	return display.DefineMarkdownRenderer(display.TerminalWidth(os.Stdout))
+}
+
+/*
+responseWriter define the writer for displaying streamed model output on STDOUT
+
+	@return the response writer
+*/
+func (c *chatDisplayArgs) responseWriter() (display.ResponseWriter, error) {
+	outputFilter, err := c.outputFilterPipeline()
+	if err != nil {
+		return nil, err
+	}
+	renderer, err := c.markdownRenderer()
+	if err != nil {
 		return nil, err
 	}
-	if c.Logging.JSONLog {
+	if renderer == nil {
+		return display.DefineRawResponseWriter(os.Stdout, outputFilter), nil
+	}
+	return display.DefineMarkdownResponseWriter(
+		os.Stdout, outputFilter, renderer, display.TerminalWidth(os.Stdout),
+	), nil
+}
+
+/*
+setupLogging configure application logging
+
+	@return the matching SQL log level
+*/
+func (c *loggingArgs) setupLogging() gormLogger.LogLevel {
+	if c.JSONLog {
 		log.SetHandler(apexJSON.New(os.Stderr))
 	}
 	var sqlLogLevel gormLogger.LogLevel
-	switch c.Logging.LogLevel {
+	switch c.LogLevel {
 	case "debug":
 		sqlLogLevel = gormLogger.Info
 		log.SetLevel(log.DebugLevel)
@@ -179,6 +324,23 @@ func (c *commonCLIArgs) initialSetup(
 		sqlLogLevel = gormLogger.Silent
 		log.SetLevel(log.ErrorLevel)
 	}
+	return sqlLogLevel
+}
+
+/*
+initialSetup perform basic application setup
+
+	@param validate *validator.Validate - validation engine
+	@param appInstance string - application instance name
+	@return new application context
+*/
+func (c *commonCLIArgs) initialSetup(
+	validate *validator.Validate, appInstance string,
+) (*applicationContext, error) {
+	if err := validate.Struct(c); err != nil {
+		return nil, err
+	}
+	sqlLogLevel := c.Logging.setupLogging()
 	{
 		tmp, _ := json.Marshal(c)
 		log.Debugf("Starting common params %s", tmp)
@@ -215,6 +377,72 @@ type applicationContext struct {
 	config      configFileArgs
 	currentUser persistence.User
 	userManager persistence.UserManager
+	sqlLogLevel gormLogger.LogLevel
+}
+
+const (
+	// ephemeralUserName name of the user defined when running in ephemeral mode
+	ephemeralUserName = "ephemeral"
+	// ephemeralAPITokenEnvVar ENV variable holding the API token when running in ephemeral mode
+	ephemeralAPITokenEnvVar = "OPENAI_API_KEY"
+	// tokenPassphraseEnvVar ENV variable holding the passphrase for encrypting stored API tokens
+	tokenPassphraseEnvVar = "CLI_GPT_PASSPHRASE"
+)
+
+/*
+readPassphrase read a passphrase from ENV, file, or by prompting the user, in that order
+
+	@param envVar string - ENV variable which may hold the passphrase
+	@param passphraseFile string - file which may hold the passphrase
+	@param label string - prompt label
+	@param confirm bool - whether to prompt the user twice to confirm the passphrase
+	@return the passphrase
+*/
+func readPassphrase(envVar, passphraseFile, label string, confirm bool) (string, error) {
+	if passphrase := os.Getenv(envVar); passphrase != "" {
+		return passphrase, nil
+	}
+	if passphraseFile != "" {
+		content, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+	if !display.IsTerminal(os.Stdin) {
+		return "", fmt.Errorf(
+			"passphrase required. Provide it through %s or a passphrase file", envVar,
+		)
+	}
+	passphrasePrompt := promptui.Prompt{Label: label, Mask: '*'}
+	passphrase, err := passphrasePrompt.Run()
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		confirmPrompt := promptui.Prompt{Label: fmt.Sprintf("Confirm %s", label), Mask: '*'}
+		confirmed, err := confirmPrompt.Run()
+		if err != nil {
+			return "", err
+		}
+		if confirmed != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+/*
+secretCipher define the cipher for encrypting stored API tokens
+
+The passphrase is only read when an API token is first encrypted or decrypted.
+
+	@return the secret cipher
+*/
+func (c *configFileArgs) secretCipher() persistence.SecretCipher {
+	return persistence.DefineSecretCipher(func() (string, error) {
+		return readPassphrase(tokenPassphraseEnvVar, c.PassphraseFile, "API token passphrase", false)
+	})
 }
 
 // userContext the contents of the user context file
@@ -244,9 +472,45 @@ func defineApplicationContext(
 	}
 }
 
+// Initialize application context which only exists in memory
+func (c *applicationContext) initializeEphemeral() error {
+	logtags := c.GetLogTagsForContext(c.ctxt)
+
+	apiToken := os.Getenv(ephemeralAPITokenEnvVar)
+	if apiToken == "" {
+		return fmt.Errorf("ephemeral mode requires the API token in ENV '%s'", ephemeralAPITokenEnvVar)
+	}
+
+	log.WithFields(logtags).Debug("Define in-memory user manager")
+	manager, err := persistence.GetMemoryUserManager()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to define in-memory user manager")
+		return err
+	}
+	c.userManager = manager
+
+	userEntry, err := c.userManager.RecordNewUser(c.ctxt, ephemeralUserName)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to define ephemeral user")
+		return err
+	}
+	if err := userEntry.SetAPIToken(c.ctxt, apiToken); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to record API token to ephemeral user")
+		return err
+	}
+	c.currentUser = userEntry
+
+	return nil
+}
+
 // Initialize application context
 func (c *applicationContext) initialize(sqlLogLevel gormLogger.LogLevel) error {
 	logtags := c.GetLogTagsForContext(c.ctxt)
+	c.sqlLogLevel = sqlLogLevel
+
+	if c.config.Ephemeral {
+		return c.initializeEphemeral()
+	}
 
 	if err := c.config.initialize(); err != nil {
 		log.WithError(err).WithFields(logtags).Error("Config file setup failed")
@@ -256,9 +520,11 @@ func (c *applicationContext) initialize(sqlLogLevel gormLogger.LogLevel) error {
 	// Open sqlite DB
 	log.WithFields(logtags).Debugf("Opening sqlite persistence DB '%s'", c.config.SqliteDB)
 	manager, err := persistence.GetSQLUserManager(
-		persistence.GetSqliteDialector(c.config.SqliteDB), sqlLogLevel,
+		persistence.GetSqliteDialector(c.config.SqliteDB), sqlLogLevel, c.config.secretCipher(),
 	)
-	if err != nil {
+	if errors.Is(err, persistence.ErrSQLSchemaOutdated) {
+		return fmt.Errorf("%w, run 'db migrate' to update it first", err)
+	} else if err != nil {
 		log.
 			WithError(err).
 			WithFields(logtags).
@@ -292,13 +558,66 @@ func (c *applicationContext) initialize(sqlLogLevel gormLogger.LogLevel) error {
 		c.currentUser = userEntry
 	}
 
+	// Enforce the retention policy of the active user
+	if c.config.AutoPrune && c.currentUser != nil {
+		if err := c.autoPrune(); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to prune chat history")
+			return err
+		}
+	}
+
 	return nil
 }
 
+/*
+backupSqliteDB make a copy of a sqlite DB file next to the original
+
+	@param ctxt context.Context - query context
+	@param dbFile string - sqlite DB file
+	@param sqlLogLevel gormLogger.LogLevel - SQL log level
+	@return the backup file
+*/
+func backupSqliteDB(
+	ctxt context.Context, dbFile string, sqlLogLevel gormLogger.LogLevel,
+) (string, error) {
+	// Recent changes may only be in the write-ahead log
+	if err := persistence.CheckpointSQLiteDB(ctxt, dbFile, sqlLogLevel); err != nil {
+		return "", err
+	}
+
+	backupFile := fmt.Sprintf("%s.bak-%s", dbFile, time.Now().UTC().Format("20060102T150405.000000Z"))
+
+	source, err := os.Open(dbFile)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	backup, err := os.OpenFile(backupFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(backup, source); err != nil {
+		_ = backup.Close()
+		return "", err
+	}
+	if err := backup.Close(); err != nil {
+		return "", err
+	}
+	return backupFile, nil
+}
+
 // Record current application context
 func (c *applicationContext) record() error {
 	logtags := c.GetLogTagsForContext(c.ctxt)
 
+	if c.config.Ephemeral {
+		log.WithFields(logtags).Debug("Ephemeral mode, not recording user context")
+		return nil
+	}
+
 	contextFile, err := os.Create(c.config.UserContext)
 	if err != nil {
 		log.
@@ -359,8 +678,38 @@ func GenerateGetSubcommands() []*cli.Command {
 			Aliases:     []string{"chat"},
 			Usage:       "List chat sessions",
 			Description: "List chat sessions associated with the currently active user",
+			Flags:       listChatSessionsParams.getCLIFlags(),
+			Action:      actionListChatSession(&listChatSessionsParams),
+		},
+		{
+			Name:        "retention",
+			Usage:       "Print the retention policy",
+			Description: "Print the chat history retention policy of the currently active user",
 			Flags:       CommonParams.GetCommonCLIFlags(),
-			Action:      actionListChatSession(&CommonParams),
+			Action:      actionGetRetentionPolicy(&CommonParams),
+		},
+		{
+			Name:        "presets",
+			Aliases:     []string{"preset"},
+			Usage:       "List chat session presets",
+			Description: "List chat session presets of the currently active user",
+			Flags:       CommonParams.GetCommonCLIFlags(),
+			Action:      actionListPresets(&CommonParams),
+		},
+		{
+			Name:        "trash",
+			Usage:       "List chat sessions in the trash",
+			Description: "List deleted chat sessions of the currently active user which can still be restored",
+			Flags:       CommonParams.GetCommonCLIFlags(),
+			Action:      actionListTrash(&CommonParams),
+		},
+		{
+			Name:        "variants",
+			Aliases:     []string{"variant"},
+			Usage:       "List response variants of the latest exchange",
+			Description: "List the response variants of the latest exchange of a chat session",
+			Flags:       exchangeVariantParams.getCLIFlags(false),
+			Action:      actionListExchangeVariants(&exchangeVariantParams),
 		},
 	}
 }
@@ -402,10 +751,18 @@ func GenerateCreateSubcommands() []*cli.Command {
 			Name:        "chat",
 			Aliases:     []string{"chats"},
 			Usage:       "Start new chat session",
-			Description: "Start new chat session for currently active user",
+			Description: "Start new chat session for currently active user, optionally as a fork of an existing chat session",
 			Flags:       startNewChatParams.getCLIFlags(),
 			Action:      actionStartNewChat(&startNewChatParams),
 		},
+		{
+			Name:        "preset",
+			Aliases:     []string{"presets"},
+			Usage:       "Record new chat session preset",
+			Description: "Record a named set of chat session request settings for currently active user. Without any settings given, the user is prompted for them.",
+			Flags:       createPresetParams.getCLIFlags(),
+			Action:      actionCreatePreset(&createPresetParams),
+		},
 	}
 }
 
@@ -420,17 +777,40 @@ func GenerateUpdateSubcommands() []*cli.Command {
 			Name:        "user",
 			Aliases:     []string{"users"},
 			Usage:       "Update user settings",
-			Description: "Update user settings",
-			Flags:       specifyUserParams.getCLIFlags(),
-			Action:      actionUpdateUser(&specifyUserParams),
+			Description: "Update user name and API token, or with --chat-settings or any request setting, the default request settings of new chat sessions",
+			Flags:       updateUserParams.getCLIFlags(),
+			Action:      actionUpdateUser(&updateUserParams),
 		},
 		{
 			Name:        "chat",
 			Aliases:     []string{"chats"},
-			Usage:       "Update chat session request settings",
-			Description: "Update chat session request settings",
-			Flags:       standardChatActionParams.getCLIFlags(),
-			Action:      actionUpdateChatSessionSettings(&standardChatActionParams),
+			Usage:       "Update chat session request settings, title, description, or tags",
+			Description: "Update chat session request settings, or with --title, --description, --tag, or --untag, the session title, description, or tags",
+			Flags:       updateChatActionParams.getCLIFlags(),
+			Action:      actionUpdateChatSession(&updateChatActionParams),
+		},
+		{
+			Name:        "retention",
+			Usage:       "Update the retention policy",
+			Description: "Update the chat history retention policy of the currently active user. Only the given limits are changed.",
+			Flags:       updateRetentionParams.getCLIFlags(),
+			Action:      actionUpdateRetentionPolicy(&updateRetentionParams),
+		},
+		{
+			Name:        "preset",
+			Aliases:     []string{"presets"},
+			Usage:       "Update chat session preset request settings",
+			Description: "Update the request settings of a chat session preset. Only the given settings are changed. Without any settings given, the user is prompted for them.",
+			Flags:       updatePresetParams.getCLIFlags(),
+			Action:      actionUpdatePreset(&updatePresetParams),
+		},
+		{
+			Name:        "exchange",
+			Aliases:     []string{"exchanges"},
+			Usage:       "Edit the stored request or response of one exchange",
+			Description: "Edit the stored request, or with --response the stored response, of one exchange of a chat session. The change is recorded in the session audit records.",
+			Flags:       editExchangeParams.getCLIFlags(),
+			Action:      actionEditExchange(&editExchangeParams),
 		},
 	}
 }
@@ -453,8 +833,8 @@ func GenerateDeleteSubcommands() []*cli.Command {
 		{
 			Name:        "chat",
 			Aliases:     []string{"chats"},
-			Usage:       "Delete chat session",
-			Description: "Delete chat session",
+			Usage:       "Move chat sessions to the trash",
+			Description: "Move chat sessions to the trash. Use \"restore chat\" to undo.",
 			Flags:       deleteChatSessionsParams.getCLIFlags(),
 			Action:      actionDeleteChatSession(&deleteChatSessionsParams),
 		},
@@ -466,6 +846,188 @@ func GenerateDeleteSubcommands() []*cli.Command {
 			Flags:       standardChatActionParams.getCLIFlags(),
 			Action:      actionDeleteLatestExchange(&standardChatActionParams),
 		},
+		{
+			Name:        "exchanges",
+			Aliases:     []string{"exchange"},
+			Usage:       "Delete exchanges by ID, position, or position range",
+			Description: "Delete exchanges of a chat session selected by ID, position, or position range. The deletions are recorded in the session audit records.",
+			Flags:       deleteExchangesParams.getCLIFlags(),
+			Action:      actionDeleteExchanges(&deleteExchangesParams),
+		},
+	}
+}
+
+/*
+GenerateRestoreSubcommands generate list of subcommands for "restore"
+
+	@return the list of CLI subcommands
+*/
+func GenerateRestoreSubcommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:        "chat",
+			Aliases:     []string{"chats"},
+			Usage:       "Restore chat sessions from the trash",
+			Description: "Move deleted chat sessions out of the trash",
+			Flags:       restoreChatSessionsParams.getCLIFlags(),
+			Action:      actionRestoreChatSession(&restoreChatSessionsParams),
+		},
+	}
+}
+
+/*
+GenerateEmptySubcommands generate list of subcommands for "empty"
+
+	@return the list of CLI subcommands
+*/
+func GenerateEmptySubcommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:        "trash",
+			Usage:       "Permanently delete chat sessions in the trash",
+			Description: "Permanently delete chat sessions in the trash, optionally only those deleted a while ago",
+			Flags:       emptyTrashParams.getCLIFlags(),
+			Action:      actionEmptyTrash(&emptyTrashParams),
+		},
+	}
+}
+
+/*
+GenerateExportSubcommands generate list of subcommands for "export"
+
+	@return the list of CLI subcommands
+*/
+func GenerateExportSubcommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:        "chat",
+			Aliases:     []string{"chats"},
+			Usage:       "Export chat sessions as Markdown, JSON, or HTML",
+			Description: "Export chat session transcripts, with the session settings, state, and timestamps, as Markdown, JSON, or self-contained HTML",
+			Flags:       exportChatParams.getCLIFlags(),
+			Action:      actionExportChatSessions(&exportChatParams),
+		},
+	}
+}
+
+/*
+GenerateImportSubcommands generate list of subcommands for "import"
+
+	@return the list of CLI subcommands
+*/
+func GenerateImportSubcommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:        "chat",
+			Aliases:     []string{"chats"},
+			Usage:       "Import chat sessions",
+			Description: "Import chat sessions from a JSON or Markdown export, or from the conversations.json of a web ChatGPT data export. Sessions which were already imported are skipped.",
+			ArgsUsage:   "<file>",
+			Flags:       importChatParams.getCLIFlags(),
+			Action:      actionImportChatSessions(&importChatParams),
+		},
+	}
+}
+
+/*
+GenerateExtractSubcommands generate list of subcommands for "extract"
+
+	@return the list of CLI subcommands
+*/
+func GenerateExtractSubcommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:        "code",
+			Usage:       "Extract code blocks",
+			Description: "Extract fenced code blocks from chat session responses",
+			Flags:       extractCodeParams.getCLIFlags(),
+			Action:      actionExtractCode(&extractCodeParams),
+		},
+	}
+}
+
+/*
+GenerateDBSubcommands generate list of subcommands for "db"
+
+	@return the list of CLI subcommands
+*/
+func GenerateDBSubcommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:        "backup",
+			Usage:       "Backup DB",
+			Description: "Write a verified copy of the persistence DB, optionally compressed and encrypted",
+			Flags:       dbBackupParams.getCLIFlags(),
+			Action:      actionBackupDB(&dbBackupParams),
+		},
+		{
+			Name:        "migrate",
+			Usage:       "Migrate DB schema",
+			Description: "Migrate the persistence DB schema. The DB file is backed up first.",
+			Flags:       dbMigrateParams.getCLIFlags(),
+			Action:      actionMigrateDB(&dbMigrateParams),
+		},
+		{
+			Name:        "prune",
+			Usage:       "Prune chat history",
+			Description: "Permanently delete, and optionally export, the chat sessions which exceed the active user's retention policy",
+			Flags:       dbPruneParams.getCLIFlags(),
+			Action:      actionPruneDB(&dbPruneParams),
+		},
+		{
+			Name:        "rekey",
+			Usage:       "Change API token passphrase",
+			Description: "Re-encrypt all stored API tokens with a new passphrase",
+			Flags:       dbRekeyParams.getCLIFlags(),
+			Action:      actionRekeyDB(&dbRekeyParams),
+		},
+		{
+			Name:        "restore",
+			Usage:       "Restore DB from backup",
+			Description: "Replace the persistence DB with a verified backup. The DB file is backed up first.",
+			ArgsUsage:   "<backup file>",
+			Flags:       dbRestoreParams.getCLIFlags(),
+			Action:      actionRestoreDB(&dbRestoreParams),
+		},
+		{
+			Name:        "status",
+			Usage:       "DB schema status",
+			Description: "Print the persistence DB schema version and migration status",
+			Flags:       CommonParams.GetCommonCLIFlags(),
+			Action:      actionDBStatus(&CommonParams),
+		},
+	}
+}
+
+/*
+GeneratePinSubcommands generate list of subcommands for "pin"
+
+	@return the list of CLI subcommands
+*/
+func GeneratePinSubcommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:        "add",
+			Usage:       "Pin a note",
+			Description: "Pin a note, or the current content of a text file, to a chat session. Pinned notes are included in every request of the session.",
+			ArgsUsage:   "[note]",
+			Flags:       pinAddParams.getCLIFlags(),
+			Action:      actionPinNote(&pinAddParams),
+		},
+		{
+			Name:        "list",
+			Usage:       "List pinned notes",
+			Description: "List the notes pinned to a chat session",
+			Flags:       pinListParams.getCLIFlags(),
+			Action:      actionListPinnedNotes(&pinListParams),
+		},
+		{
+			Name:        "rm",
+			Usage:       "Remove pinned notes",
+			Description: "Remove notes pinned to a chat session",
+			Flags:       pinRemoveParams.getCLIFlags(),
+			Action:      actionUnpinNotes(&pinRemoveParams),
+		},
 	}
 }
 
@@ -490,12 +1052,39 @@ func GenerateContextSubcommands() []*cli.Command {
 			Flags:       standardChatActionParams.getCLIFlags(),
 			Action:      actionChangeActiveChatSession(&standardChatActionParams),
 		},
+		{
+			Name:        "select-variant",
+			Usage:       "Change selected response variant",
+			Description: "Select the response variant of the latest exchange used as context for future requests",
+			Flags:       exchangeVariantParams.getCLIFlags(true),
+			Action:      actionSelectExchangeVariant(&exchangeVariantParams),
+		},
 		{
 			Name:        "close-chat",
 			Usage:       "Close chat session",
 			Description: "Close chat session. User can not append to session after closing",
 			Flags:       standardChatActionParams.getCLIFlags(),
-			Action:      actionCloseChatSession(&standardChatActionParams),
+			Action: actionChangeChatSessionState(
+				&standardChatActionParams, persistence.ChatSessionStateClose,
+			),
+		},
+		{
+			Name:        "reopen-chat",
+			Usage:       "Reopen chat session",
+			Description: "Reopen a closed or archived chat session, so the user can append to it again",
+			Flags:       standardChatActionParams.getCLIFlags(),
+			Action: actionChangeChatSessionState(
+				&standardChatActionParams, persistence.ChatSessionStateOpen,
+			),
+		},
+		{
+			Name:        "archive-chat",
+			Usage:       "Archive chat session",
+			Description: "Archive chat session. Archived sessions are hidden from 'get chats', and can not be the active chat session until reopened",
+			Flags:       standardChatActionParams.getCLIFlags(),
+			Action: actionChangeChatSessionState(
+				&standardChatActionParams, persistence.ChatSessionStateArchived,
+			),
 		},
 	}
 }
@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/apex/log"
+	"github.com/urfave/cli/v2"
+)
+
+// exchangeSelectionArgs cli arguments to select exchanges of a chat session
+type exchangeSelectionArgs struct {
+	// SessionID the chat session ID. The active chat session is used if not given.
+	SessionID string
+	// ExchangeIDs the exchange IDs
+	ExchangeIDs cli.StringSlice
+	// Indexes the exchange positions, starting from 1
+	Indexes cli.IntSlice
+	// Ranges the exchange position ranges, in the form "<first>-<last>"
+	Ranges cli.StringSlice
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@param multiple bool - whether multiple exchanges can be selected
+	@return the list of CLI arguments
+*/
+func (c *exchangeSelectionArgs) getCLIFlags(multiple bool) []cli.Flag {
+	cliFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:        "session-id",
+			Usage:       "Target chat session ID. Defaults to the currently active chat session.",
+			Aliases:     []string{"i"},
+			EnvVars:     []string{"TARGET_SESSION_ID"},
+			Destination: &c.SessionID,
+			Required:    false,
+		},
+		&cli.StringSliceFlag{
+			Name:        "id",
+			Usage:       "Target exchange ID, as shown by 'describe chat --detailed'",
+			Destination: &c.ExchangeIDs,
+			Required:    false,
+		},
+		&cli.IntSliceFlag{
+			Name:        "index",
+			Usage:       "Target exchange position in the session, starting from 1",
+			Aliases:     []string{"n"},
+			Destination: &c.Indexes,
+			Required:    false,
+		},
+	}
+	if multiple {
+		cliFlags = append(cliFlags, &cli.StringSliceFlag{
+			Name:        "range",
+			Usage:       "Target exchange positions in the session, in the form '<first>-<last>'",
+			Aliases:     []string{"r"},
+			Destination: &c.Ranges,
+			Required:    false,
+		})
+	}
+	return cliFlags
+}
+
+/*
+parseExchangeRange parse an exchange position range of the form "<first>-<last>"
+
+	@param exchangeRange string - the range
+	@return the first and last position
+*/
+func parseExchangeRange(exchangeRange string) (int, int, error) {
+	first, last, ok := strings.Cut(exchangeRange, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("exchange range '%s' is not of the form '<first>-<last>'", exchangeRange)
+	}
+	firstIdx, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return 0, 0, fmt.Errorf("exchange range '%s' start not valid: %w", exchangeRange, err)
+	}
+	lastIdx, err := strconv.Atoi(strings.TrimSpace(last))
+	if err != nil {
+		return 0, 0, fmt.Errorf("exchange range '%s' end not valid: %w", exchangeRange, err)
+	}
+	if firstIdx > lastIdx {
+		return 0, 0, fmt.Errorf("exchange range '%s' start is after its end", exchangeRange)
+	}
+	return firstIdx, lastIdx, nil
+}
+
+/*
+selectedExchangeIDs resolve the selected exchanges into exchange IDs
+
+	@param exchanges []persistence.ChatExchange - the session exchanges
+	@return the selected exchange IDs, in session order without duplicates
+*/
+func (c *exchangeSelectionArgs) selectedExchangeIDs(
+	exchanges []persistence.ChatExchange,
+) ([]string, error) {
+	selected := map[string]bool{}
+	for _, exchangeID := range c.ExchangeIDs.Value() {
+		selected[exchangeID] = true
+	}
+	selectPosition := func(position int) error {
+		if position < 1 || position > len(exchanges) {
+			return fmt.Errorf(
+				"exchange position %d is outside of 1-%d", position, len(exchanges),
+			)
+		}
+		selected[exchanges[position-1].ID] = true
+		return nil
+	}
+	for _, position := range c.Indexes.Value() {
+		if err := selectPosition(position); err != nil {
+			return nil, err
+		}
+	}
+	for _, exchangeRange := range c.Ranges.Value() {
+		first, last, err := parseExchangeRange(exchangeRange)
+		if err != nil {
+			return nil, err
+		}
+		for position := first; position <= last; position++ {
+			if err := selectPosition(position); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Exchange IDs not in the session are left for the persistence layer to reject
+	result := []string{}
+	for _, oneExchange := range exchanges {
+		if selected[oneExchange.ID] {
+			result = append(result, oneExchange.ID)
+			delete(selected, oneExchange.ID)
+		}
+	}
+	for exchangeID := range selected {
+		result = append(result, exchangeID)
+	}
+	return result, nil
+}
+
+// ================================================================================
+
+// deleteExchangesCLIArgs cli arguments to delete exchanges from a chat session
+type deleteExchangesCLIArgs struct {
+	commonCLIArgs
+	exchangeSelectionArgs
+	// Reason why the exchanges are deleted
+	Reason string
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *deleteExchangesCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, c.exchangeSelectionArgs.getCLIFlags(true)...)
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:        "reason",
+		Usage:       "Why the exchanges are deleted. Recorded in the session audit records.",
+		Destination: &c.Reason,
+		Required:    false,
+	})
+
+	return cliFlags
+}
+
+var deleteExchangesParams deleteExchangesCLIArgs
+
+/*
+actionDeleteExchanges delete selected exchanges from a chat session
+
+	@param args *deleteExchangesCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionDeleteExchanges(args *deleteExchangesCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		session, err := selectedOrActiveSession(app, chatManager, args.SessionID)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Could not fetch chat session")
+			return err
+		}
+
+		exchanges, err := session.Exchanges(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Session exchanges read failed")
+			return err
+		}
+
+		exchangeIDs, err := args.selectedExchangeIDs(exchanges)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid exchange selection")
+			return err
+		}
+		if len(exchangeIDs) == 0 {
+			return fmt.Errorf("no exchanges selected, use --id, --index, or --range")
+		}
+
+		if err := session.DeleteExchanges(app.ctxt, exchangeIDs, args.Reason); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to delete exchanges")
+			return err
+		}
+
+		return nil
+	}
+}
+
+// ================================================================================
+
+// editExchangeCLIArgs cli arguments to edit one exchange of a chat session
+type editExchangeCLIArgs struct {
+	commonCLIArgs
+	exchangeSelectionArgs
+	// Response edit the response instead of the request
+	Response bool
+	// Reason why the exchange is edited
+	Reason string
+	// NoEditor always edit the text with the inline prompt
+	NoEditor bool
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *editExchangeCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, c.exchangeSelectionArgs.getCLIFlags(false)...)
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "response",
+			Usage:       "Edit the stored response instead of the request",
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.Response,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "reason",
+			Usage:       "Why the exchange is edited. Recorded in the session audit records.",
+			Destination: &c.Reason,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "no-editor",
+			Usage:       "Enter the new text inline, even if $EDITOR is set",
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.NoEditor,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var editExchangeParams editExchangeCLIArgs
+
+/*
+actionEditExchange edit the stored request or response text of one exchange of a chat session
+
+	@param args *editExchangeCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionEditExchange(args *editExchangeCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		session, err := selectedOrActiveSession(app, chatManager, args.SessionID)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Could not fetch chat session")
+			return err
+		}
+
+		exchanges, err := session.Exchanges(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Session exchanges read failed")
+			return err
+		}
+
+		exchangeIDs, err := args.selectedExchangeIDs(exchanges)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid exchange selection")
+			return err
+		}
+		if len(exchangeIDs) != 1 {
+			return fmt.Errorf("select exactly one exchange with --id or --index")
+		}
+		var target *persistence.ChatExchange
+		for idx := range exchanges {
+			if exchanges[idx].ID == exchangeIDs[0] {
+				target = &exchanges[idx]
+			}
+		}
+		if target == nil {
+			return fmt.Errorf("exchange '%s' is not part of the chat session", exchangeIDs[0])
+		}
+
+		kind, original := "request", target.Request
+		if args.Response {
+			kind, original = "response", target.Response
+		}
+		edited, err := editText(app.ctxt, kind, original, !args.NoEditor)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Failed to edit the %s", kind)
+			return err
+		}
+
+		edit := persistence.ChatExchangeEdit{Reason: args.Reason}
+		if args.Response {
+			edit.Response = &edited
+		} else {
+			edit.Request = &edited
+		}
+		if err := session.EditExchange(app.ctxt, target.ID, edit); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to edit exchange")
+			return err
+		}
+
+		return nil
+	}
+}
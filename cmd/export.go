@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/alwitt/cli-gpt/transcript"
+	"github.com/apex/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/urfave/cli/v2"
+)
+
+// exportChatCLIArgs cli arguments to export chat sessions
+type exportChatCLIArgs struct {
+	commonCLIArgs
+	// SessionIDs the chat session IDs. The active chat session is used if not given.
+	SessionIDs cli.StringSlice
+	// All whether to export all chat sessions
+	All bool
+	// Format the export format
+	Format string `validate:"required,oneof=markdown json html"`
+	// Out file to write the export to. The export is printed if not set.
+	Out string
+	// NoAttachments whether to leave out the files attached to the requests
+	NoAttachments bool
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *exportChatCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "session-id",
+			Usage:       "Chat session to export. Defaults to the currently active chat session.",
+			Aliases:     []string{"i"},
+			EnvVars:     []string{"TARGET_SESSION_ID"},
+			Destination: &c.SessionIDs,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "all",
+			Usage:       "Export all chat sessions, including archived ones",
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.All,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name: "format",
+			Usage: fmt.Sprintf(
+				"Export format: [%s]", strings.Join(transcript.SupportedFormats(), " "),
+			),
+			Aliases:     []string{"f"},
+			Value:       string(transcript.FormatMarkdown),
+			DefaultText: string(transcript.FormatMarkdown),
+			Destination: &c.Format,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "out",
+			Usage:       "File to write the export to. The export is printed to STDOUT if not set",
+			Aliases:     []string{"o"},
+			Destination: &c.Out,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "no-attachments",
+			Usage:       "Leave out the content of files attached to the requests",
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.NoAttachments,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var exportChatParams exportChatCLIArgs
+
+/*
+actionExportChatSessions export chat sessions as Markdown, JSON, or HTML
+
+	@param args *exportChatCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionExportChatSessions(args *exportChatCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+		if err := validator.New().Struct(args); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid export options")
+			return err
+		}
+
+		var sessions []persistence.ChatSession
+		switch {
+		case args.All && len(args.SessionIDs.Value()) > 0:
+			return fmt.Errorf("--all and --session-id can not be used together")
+		case args.All:
+			sessions, err = chatManager.ListSessions(app.ctxt)
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Error("Unable to list user's chat sessions")
+				return err
+			}
+		case len(args.SessionIDs.Value()) > 0:
+			for _, sessionID := range args.SessionIDs.Value() {
+				session, err := chatManager.GetSession(app.ctxt, sessionID)
+				if err != nil {
+					log.
+						WithError(err).
+						WithFields(logtags).
+						Errorf("Could not fetch chat session '%s'", sessionID)
+					return err
+				}
+				sessions = append(sessions, session)
+			}
+		default:
+			session, err := chatManager.CurrentActiveSession(app.ctxt)
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Error("Could not fetch active chat session")
+				return err
+			}
+			sessions = append(sessions, session)
+		}
+
+		return exportChatSessions(
+			app, sessions, transcript.Format(args.Format), args.Out, !args.NoAttachments,
+		)
+	}
+}
+
+/*
+exportChatSessions write chat sessions out in one of the transcript formats
+
+	@param app *applicationContext - application context
+	@param sessions []persistence.ChatSession - the chat sessions to export
+	@param format transcript.Format - the export format
+	@param out string - file to write the export to. The export is printed if empty.
+	@param withAttachments bool - whether to include the files attached to the requests
+*/
+func exportChatSessions(
+	app *applicationContext,
+	sessions []persistence.ChatSession,
+	format transcript.Format,
+	out string,
+	withAttachments bool,
+) error {
+	logtags := app.GetLogTagsForContext(app.ctxt)
+
+	export, err := transcript.DefineTranscript(app.ctxt, sessions)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read chat sessions for export")
+		return err
+	}
+	if !withAttachments {
+		export = export.WithoutAttachments()
+	}
+
+	return writeTranscript(app, export, format, out)
+}
+
+/*
+writeTranscript write a transcript out in one of the transcript formats
+
+	@param app *applicationContext - application context
+	@param export transcript.Transcript - the transcript
+	@param format transcript.Format - the export format
+	@param out string - file to write the export to. The export is printed if empty.
+*/
+func writeTranscript(
+	app *applicationContext, export transcript.Transcript, format transcript.Format, out string,
+) error {
+	logtags := app.GetLogTagsForContext(app.ctxt)
+
+	var output io.Writer = os.Stdout
+	if out != "" {
+		outFile, err := os.Create(out)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Unable to create '%s'", out)
+			return err
+		}
+		defer func() {
+			_ = outFile.Close()
+		}()
+		output = outFile
+	}
+
+	if err := transcript.Write(output, export, format); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to write export")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alwitt/cli-gpt/display"
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/apex/log"
+	"github.com/urfave/cli/v2"
+)
+
+// extractCodeCLIArgs cli arguments to extract code blocks from chat session responses
+type extractCodeCLIArgs struct {
+	commonCLIArgs
+	// SessionID the chat session ID
+	SessionID string
+	// ExchangeIndex index of the exchange to extract from. Negative means all exchanges.
+	ExchangeIndex int
+	// Latest extract from the latest exchange only
+	Latest bool
+	// BlockIndex index of the code block within each exchange. Negative means all blocks.
+	BlockIndex int
+	// OutputDir DIR to write the code blocks to. Code blocks are printed if not set.
+	OutputDir string
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *extractCodeCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.StringFlag{
+			Name:        "session-id",
+			Usage:       "Target chat session ID",
+			Aliases:     []string{"i"},
+			EnvVars:     []string{"TARGET_SESSION_ID"},
+			Destination: &c.SessionID,
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "exchange",
+			Usage:       "Index of the exchange to extract from, starting at 0. Negative for all exchanges",
+			Aliases:     []string{"e"},
+			Value:       -1,
+			DefaultText: "-1",
+			Destination: &c.ExchangeIndex,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "latest",
+			Usage:       "Extract from the latest exchange. Uses the active session if no session ID given",
+			Aliases:     []string{"L"},
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.Latest,
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "block",
+			Usage:       "Index of the code block within the exchange, starting at 0. Negative for all blocks",
+			Aliases:     []string{"b"},
+			Value:       -1,
+			DefaultText: "-1",
+			Destination: &c.BlockIndex,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "out",
+			Usage:       "DIR to write the code blocks to. Code blocks are printed to STDOUT if not set",
+			Aliases:     []string{"o"},
+			Destination: &c.OutputDir,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var extractCodeParams extractCodeCLIArgs
+
+/*
+actionExtractCode extract code blocks from chat session responses
+
+	@param args *extractCodeCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionExtractCode(args *extractCodeCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		var session persistence.ChatSession
+		if args.SessionID == "" && args.Latest {
+			if session, err = chatManager.CurrentActiveSession(app.ctxt); err != nil {
+				log.WithError(err).WithFields(logtags).Error("Could not fetch active chat session")
+				return err
+			}
+			if args.SessionID, err = session.SessionID(app.ctxt); err != nil {
+				log.WithError(err).WithFields(logtags).Error("Session ID read failed")
+				return err
+			}
+		} else {
+			if args.SessionID == "" {
+				args.SessionID, err = interactiveChatSessionSelection(app, chatManager, logtags)
+				if err != nil {
+					log.WithError(err).WithFields(logtags).Error("Session selection failure")
+					return err
+				}
+			}
+			if session, err = chatManager.GetSession(app.ctxt, args.SessionID); err != nil {
+				log.
+					WithError(err).
+					WithFields(logtags).
+					Errorf("Could not fetch chat session '%s'", args.SessionID)
+				return err
+			}
+		}
+
+		exchanges, err := session.Exchanges(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Session exchanges read failed")
+			return err
+		}
+		if len(exchanges) == 0 {
+			return fmt.Errorf("chat session '%s' has no exchanges", args.SessionID)
+		}
+
+		// Select the exchanges to extract from
+		exchangeIndexes := []int{}
+		if args.Latest {
+			exchangeIndexes = append(exchangeIndexes, len(exchanges)-1)
+		} else if args.ExchangeIndex >= 0 {
+			if args.ExchangeIndex >= len(exchanges) {
+				return fmt.Errorf(
+					"chat session '%s' only has %d exchanges", args.SessionID, len(exchanges),
+				)
+			}
+			exchangeIndexes = append(exchangeIndexes, args.ExchangeIndex)
+		} else {
+			for idx := range exchanges {
+				exchangeIndexes = append(exchangeIndexes, idx)
+			}
+		}
+
+		if args.OutputDir != "" {
+			if err := os.MkdirAll(args.OutputDir, 0770); err != nil {
+				log.
+					WithError(err).
+					WithFields(logtags).
+					Errorf("Unable to create output DIR '%s'", args.OutputDir)
+				return err
+			}
+		}
+
+		foundBlocks := 0
+		for _, exchangeIdx := range exchangeIndexes {
+			blocks := display.ExtractCodeBlocks(exchanges[exchangeIdx].Response)
+			for blockIdx, oneBlock := range blocks {
+				if args.BlockIndex >= 0 && blockIdx != args.BlockIndex {
+					continue
+				}
+				foundBlocks++
+
+				// Print the code block, separated from the previous one by a blank line
+				if args.OutputDir == "" {
+					if foundBlocks > 1 {
+						fmt.Println()
+					}
+					fmt.Print(oneBlock.Content)
+					continue
+				}
+
+				// Write the code block to file
+				fileName := filepath.Join(
+					args.OutputDir,
+					fmt.Sprintf(
+						"%s-%d-%d.%s", args.SessionID, exchangeIdx, blockIdx, oneBlock.FileExtension(),
+					),
+				)
+				if err := os.WriteFile(fileName, []byte(oneBlock.Content), 0660); err != nil {
+					log.WithError(err).WithFields(logtags).Errorf("Failed to write '%s'", fileName)
+					return err
+				}
+				fmt.Println(fileName)
+			}
+		}
+
+		if foundBlocks == 0 {
+			return fmt.Errorf("no matching code blocks found")
+		}
+
+		return nil
+	}
+}
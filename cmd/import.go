@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alwitt/cli-gpt/transcript"
+	"github.com/apex/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// importChatCLIArgs cli arguments to import chat sessions
+type importChatCLIArgs struct {
+	commonCLIArgs
+	// Format the import source format
+	Format string `validate:"required,oneof=cli-gpt-json chatgpt markdown"`
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *importChatCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name: "format",
+		Usage: fmt.Sprintf(
+			"Import source format: [%s]", strings.Join(transcript.SupportedSourceFormats(), " "),
+		),
+		Aliases:     []string{"f"},
+		Value:       string(transcript.SourceCLIGPTJSON),
+		DefaultText: string(transcript.SourceCLIGPTJSON),
+		Destination: &c.Format,
+		Required:    false,
+	})
+
+	return cliFlags
+}
+
+var importChatParams importChatCLIArgs
+
+/*
+actionImportChatSessions import chat sessions from a JSON or Markdown export, or from a web
+ChatGPT conversations.json
+
+	@param args *importChatCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionImportChatSessions(args *importChatCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+		if err := validator.New().Struct(args); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid import options")
+			return err
+		}
+		if ctx.Args().Len() != 1 {
+			return fmt.Errorf("exactly one file to import must be given")
+		}
+
+		sourceFile, err := os.Open(ctx.Args().First())
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Unable to open '%s'", ctx.Args().First())
+			return err
+		}
+		defer func() {
+			_ = sourceFile.Close()
+		}()
+
+		source, err := transcript.Parse(sourceFile, transcript.SourceFormat(args.Format))
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Unable to parse '%s'", ctx.Args().First())
+			return err
+		}
+
+		result, err := transcript.Import(app.ctxt, chatManager, source)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Chat session import failed")
+			return err
+		}
+
+		type toDisplay struct {
+			Imported []string `yaml:"imported"`
+			Skipped  []string `yaml:"skipped,omitempty"`
+		}
+		display := toDisplay{Imported: result.Imported, Skipped: result.Skipped}
+
+		// Display as YAML
+		t, _ := yaml.Marshal(&display)
+
+		fmt.Printf("%s\n", t)
+
+		return nil
+	}
+}
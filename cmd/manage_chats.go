@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -11,6 +12,7 @@ import (
 	"sync"
 
 	"github.com/alwitt/cli-gpt/api"
+	"github.com/alwitt/cli-gpt/display"
 	"github.com/alwitt/cli-gpt/persistence"
 	"github.com/apex/log"
 	"github.com/go-playground/validator/v10"
@@ -43,9 +45,51 @@ func baseChatAppInitialization(args cliArgContext) (
 		return nil, nil, nil, err
 	}
 
+	// Purge the chat sessions which were in the trash for long enough
+	if app.config.PurgeTrashAfter > 0 {
+		purged, err := chatManager.EmptyTrash(app.ctxt, app.config.PurgeTrashAfter)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to purge chat sessions in the trash")
+			return nil, nil, nil, err
+		}
+		if len(purged) > 0 {
+			log.WithFields(logtags).Infof("Purged %d chat sessions from the trash", len(purged))
+		}
+	}
+
+	// Archive the chat sessions which went stale
+	if app.config.ArchiveIdleAfter > 0 {
+		archived, err := chatManager.ArchiveIdleSessions(app.ctxt, app.config.ArchiveIdleAfter)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to archive idle chat sessions")
+			return nil, nil, nil, err
+		}
+		if len(archived) > 0 {
+			log.WithFields(logtags).Infof("Archived %d idle chat sessions", len(archived))
+		}
+	}
+
 	return app, logtags, chatManager, nil
 }
 
+/*
+selectedOrActiveSession fetch the chat session selected on the CLI, or the active chat session
+if none is selected
+
+	@param app *applicationContext - application context
+	@param chatManager persistence.ChatSessionManager - chat session manager
+	@param sessionID string - the selected chat session ID. May be empty.
+	@return the chat session
+*/
+func selectedOrActiveSession(
+	app *applicationContext, chatManager persistence.ChatSessionManager, sessionID string,
+) (persistence.ChatSession, error) {
+	if sessionID != "" {
+		return chatManager.GetSession(app.ctxt, sessionID)
+	}
+	return chatManager.CurrentActiveSession(app.ctxt)
+}
+
 // multilinePrompt prompt the user to input multi-line input
 func multilinePrompt(ctxt context.Context) (string, error) {
 	scanner := bufio.NewScanner(os.Stdin)
@@ -65,9 +109,21 @@ func multilinePrompt(ctxt context.Context) (string, error) {
 	return inputBuilder.String(), nil
 }
 
-// processOneChatExchange helper function to handle one chat exchange
+/*
+processOneChatExchange helper function to handle one chat exchange
+
+	@param app *applicationContext - application context
+	@param session persistence.ChatSession - the chat session
+	@param attachments []persistence.ChatExchangeAttachment - files sent along with the request
+	@param output display.ResponseWriter - response display
+	@param logtags log.Fields - logging tags
+*/
 func processOneChatExchange(
-	app *applicationContext, session persistence.ChatSession, logtags log.Fields,
+	app *applicationContext,
+	session persistence.ChatSession,
+	attachments []persistence.ChatExchangeAttachment,
+	output display.ResponseWriter,
+	logtags log.Fields,
 ) error {
 	prompt, err := multilinePrompt(app.ctxt)
 	if err != nil {
@@ -77,6 +133,38 @@ func processOneChatExchange(
 
 	log.WithFields(logtags).Debugf("Your prompt:\n%s\n", prompt)
 
+	// Load exchanges which other processes recorded while the prompt was typed, so they are
+	// part of the request
+	if err := session.Refresh(app.ctxt); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to reload chat session")
+		return err
+	}
+
+	return streamChatRequest(
+		app, session, output, logtags,
+		func(chatHandler api.ChatSessionHandler, respChan chan string) error {
+			return chatHandler.SendRequest(app.ctxt, prompt, attachments, respChan)
+		},
+	)
+}
+
+/*
+streamChatRequest helper function to make a request, and display the response as it arrives
+
+	@param app *applicationContext - application context
+	@param session persistence.ChatSession - the chat session
+	@param output display.ResponseWriter - response display
+	@param logtags log.Fields - logging tags
+	@param request func(api.ChatSessionHandler, chan string) error - make the request, and close
+		the response channel when it completes
+*/
+func streamChatRequest(
+	app *applicationContext,
+	session persistence.ChatSession,
+	output display.ResponseWriter,
+	logtags log.Fields,
+	request func(chatHandler api.ChatSessionHandler, respChan chan string) error,
+) error {
 	promptBuilder, err := api.GetSimpleChatPromptBuilder()
 	if err != nil {
 		log.WithError(err).WithFields(logtags).Error("Failed to define basic prompt builder")
@@ -106,7 +194,8 @@ func processOneChatExchange(
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if reqErr = chatHandler.SendRequest(app.ctxt, prompt, respChan); reqErr != nil {
+		reqErr = request(chatHandler, respChan)
+		if reqErr != nil && !errors.Is(reqErr, api.ErrChatSessionChangedDuringRequest) {
 			log.WithError(reqErr).WithFields(logtags).Error("Request-response failed")
 		}
 	}()
@@ -118,7 +207,9 @@ func processOneChatExchange(
 			terminate = true
 		case msg, ok := <-respChan:
 			if ok {
-				print(msg)
+				if err := output.WriteSegment(msg); err != nil {
+					log.WithError(err).WithFields(logtags).Error("Failed to display response")
+				}
 				terminate = false
 			} else {
 				terminate = true
@@ -126,7 +217,17 @@ func processOneChatExchange(
 		}
 	}
 
-	print("\n")
+	if err := output.Close(); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to display response")
+	}
+	fmt.Println()
+
+	// The warning is shown regardless of the log level
+	wg.Wait()
+	if errors.Is(reqErr, api.ErrChatSessionChangedDuringRequest) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", reqErr)
+		return nil
+	}
 
 	return reqErr
 }
@@ -138,10 +239,16 @@ func askUserForChatRequestOptions(currentSetting persistence.ChatSessionParamete
 	newSetting := persistence.ChatSessionParameters{}
 
 	var err error
-	// Ask for model
+	// Ask for model, starting at the current model
+	models := []string{"turbo", "davinci", "curie", "babbage", "ada"}
 	modelPrompt := promptui.Select{
 		Label: "Select request model",
-		Items: []string{"turbo", "davinci", "curie", "babbage", "ada"},
+		Items: models,
+	}
+	for idx, model := range models {
+		if model == currentSetting.Model {
+			modelPrompt.CursorPos = idx
+		}
 	}
 	if _, newSetting.Model, err = modelPrompt.Run(); err != nil {
 		return newSetting, err
@@ -237,63 +344,79 @@ func askUserForChatRequestOptions(currentSetting persistence.ChatSessionParamete
 	return newSetting, nil
 }
 
-// interactiveChatSessionSelection interactive way to select a session
+/*
+interactiveChatSessionSelection interactive way to select a session
+
+	@param app *applicationContext - application context
+	@param chatManager persistence.ChatSessionManager - chat session manager
+	@param logtags log.Fields - log tags
+	@param states ...persistence.ChatSessionState - only offer sessions in these states. All
+	    sessions are offered if none are given.
+	@return the selected session ID
+*/
 func interactiveChatSessionSelection(
-	app *applicationContext, chatManager persistence.ChatSessionManager, logtags log.Fields,
+	app *applicationContext,
+	chatManager persistence.ChatSessionManager,
+	logtags log.Fields,
+	states ...persistence.ChatSessionState,
 ) (string, error) {
-	allSession, err := chatManager.ListSessions(app.ctxt)
+	page, err := chatManager.ListSessionSummaries(
+		app.ctxt, persistence.ChatSessionListQuery{States: states},
+	)
 	if err != nil {
 		log.WithError(err).WithFields(logtags).Error("Failed to read all chat sessions")
 		return "", err
 	}
-	if len(allSession) == 0 {
-		return "", fmt.Errorf("user has no chat sessions")
+	if len(page.Sessions) == 0 {
+		return "", fmt.Errorf("user has no chat sessions to select from")
 	}
 
-	// Go through each session, and get the ID and first request
-	type chatDisplay struct {
-		SessionID    string
-		FirstRequest string
-	}
-	displayEntries := []chatDisplay{}
+	return promptChatSessionSummary(page.Sessions, logtags)
+}
 
-	for _, oneSession := range allSession {
-		sessionID, err := oneSession.SessionID(app.ctxt)
-		if err != nil {
-			log.WithError(err).WithFields(logtags).Error("Session ID read failed")
-			return "", err
+/*
+promptChatSessionSummary interactively select one chat session from a list of summaries
+
+	@param sessions []persistence.ChatSessionSummary - the chat sessions to select from
+	@param logtags log.Fields - log tags
+	@return the selected session ID
+*/
+func promptChatSessionSummary(
+	sessions []persistence.ChatSessionSummary, logtags log.Fields,
+) (string, error) {
+	sessionLabels := []string{}
+	for _, oneSession := range sessions {
+		// Prefer the session title if one is set
+		display := strings.TrimSpace(oneSession.Metadata.Title)
+		if display == "" {
+			display = strings.TrimSpace(oneSession.FirstRequest)
 		}
-		displayEntry := chatDisplay{SessionID: sessionID}
-		firstExchange, err := oneSession.FirstExchange(app.ctxt)
-		if err != nil {
-			log.
-				WithError(err).
-				WithFields(logtags).
-				Errorf("Unable to read session '%s' first exchange", sessionID)
-			return "", err
+		if display == "" {
+			display = oneSession.SessionID
 		}
-		displayEntry.FirstRequest = firstExchange.Request
-		displayEntries = append(displayEntries, displayEntry)
-	}
-
-	firstExchanges := []string{}
-	for _, oneChat := range displayEntries {
-		display := strings.TrimSpace(oneChat.FirstRequest)
-		displayLen := 80
-		if len(display) < displayLen {
-			displayLen = len(display)
+		display = strings.Join(strings.Fields(display), " ")
+		if runes := []rune(display); len(runes) > 80 {
+			display = string(runes[:80])
 		}
-		firstExchanges = append(firstExchanges, display[:displayLen])
+		sessionLabels = append(sessionLabels, display)
 	}
 
-	sessionPrompt := promptui.Select{Label: "Select chat session", Items: firstExchanges}
+	sessionPrompt := promptui.Select{
+		Label: "Select chat session (/ to search)",
+		Items: sessionLabels,
+		Searcher: func(input string, index int) bool {
+			return strings.Contains(
+				strings.ToLower(sessionLabels[index]), strings.ToLower(strings.TrimSpace(input)),
+			)
+		},
+	}
 	selected, _, err := sessionPrompt.Run()
 	if err != nil {
 		log.WithError(err).WithFields(logtags).Error("Chat session selection failure")
 		return "", err
 	}
 
-	return displayEntries[selected].SessionID, nil
+	return sessions[selected].SessionID, nil
 }
 
 // ================================================================================
@@ -301,10 +424,17 @@ func interactiveChatSessionSelection(
 // startNewChatActionCLIArgs standard cli arguments when starting a new chat session
 type startNewChatActionCLIArgs struct {
 	commonCLIArgs
-	// Model model to use
-	Model string `validate:"required,oneof=turbo davinci curie babbage ada"`
+	chatDisplayArgs
+	// Model model to use. The user's default model is used if not given.
+	Model string `validate:"omitempty,oneof=turbo davinci curie babbage ada"`
 	// SetAsActive whether to make this new chat the active chat session
 	SetAsActive bool
+	// ForkFrom ID of the chat session to fork the new chat session from
+	ForkFrom string
+	// AtExchange number of exchanges to copy from the forked chat session
+	AtExchange int
+	// Preset name of the chat session preset to start the new chat session with
+	Preset string
 }
 
 func (c *startNewChatActionCLIArgs) getCLIFlags() []cli.Flag {
@@ -315,11 +445,9 @@ func (c *startNewChatActionCLIArgs) getCLIFlags() []cli.Flag {
 	cliFlags = append(cliFlags, []cli.Flag{
 		&cli.StringFlag{
 			Name:        "model",
-			Usage:       "Text generation model: [turbo davinci curie babbage ada]",
+			Usage:       "Text generation model: [turbo davinci curie babbage ada]. Defaults to the user's default model.",
 			Aliases:     []string{"m"},
 			EnvVars:     []string{"TEXT_COMPLETION_MODEL"},
-			Value:       "turbo",
-			DefaultText: "turbo",
 			Destination: &c.Model,
 			Required:    false,
 		},
@@ -332,7 +460,29 @@ func (c *startNewChatActionCLIArgs) getCLIFlags() []cli.Flag {
 			Destination: &c.SetAsActive,
 			Required:    false,
 		},
+		&cli.StringFlag{
+			Name:        "fork-from",
+			Usage:       "Start the new chat session as a copy of this chat session",
+			Aliases:     []string{"f"},
+			Destination: &c.ForkFrom,
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "at-exchange",
+			Usage:       "When forking, only copy the first N exchanges. All exchanges are copied by default.",
+			Aliases:     []string{"n"},
+			Destination: &c.AtExchange,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "preset",
+			Usage:       "Start the new chat session with the request settings of this preset, without prompting",
+			Aliases:     []string{"p"},
+			Destination: &c.Preset,
+			Required:    false,
+		},
 	}...)
+	cliFlags = append(cliFlags, c.chatDisplayArgs.getCLIFlags()...)
 
 	return cliFlags
 }
@@ -340,7 +490,7 @@ func (c *startNewChatActionCLIArgs) getCLIFlags() []cli.Flag {
 var startNewChatParams startNewChatActionCLIArgs
 
 /*
-actionStartNewChat start a new chat session
+actionStartNewChat start a new chat session, or fork one from an existing chat session
 
 	@param args *startNewChatActionCLIArgs - CLI arguments
 	@return the CLI action
@@ -354,17 +504,23 @@ func actionStartNewChat(args *startNewChatActionCLIArgs) cli.ActionFunc {
 			return err
 		}
 
-		// Get chat session request parameters
-		newSetting, err := askUserForChatRequestOptions(persistence.GetDefaultChatSessionParams("turbo"))
+		output, err := args.responseWriter()
 		if err != nil {
-			log.WithError(err).WithFields(logtags).Error("Failed to prompt user for parameters")
+			log.WithError(err).WithFields(logtags).Error("Invalid output display options")
 			return err
 		}
 
-		// Create new chat session
-		session, err := chatManager.NewSession(app.ctxt, args.Model)
+		if args.ForkFrom != "" && args.Preset != "" {
+			return fmt.Errorf("--preset can not be used with --fork-from")
+		}
+
+		var session persistence.ChatSession
+		if args.ForkFrom != "" {
+			session, err = forkChatSession(ctx, app, chatManager, args, logtags)
+		} else {
+			session, err = startChatSession(app, chatManager, args, logtags)
+		}
 		if err != nil {
-			log.WithError(err).WithFields(logtags).Error("Unable to start new chat session")
 			return err
 		}
 		sessionID, err := session.SessionID(app.ctxt)
@@ -373,25 +529,6 @@ func actionStartNewChat(args *startNewChatActionCLIArgs) cli.ActionFunc {
 			return err
 		}
 
-		// Get current settings
-		currentSetting, err := session.Settings(app.ctxt)
-		if err != nil {
-			log.
-				WithError(err).
-				WithFields(logtags).
-				Errorf("Unable to read chat session '%s' settings", sessionID)
-			return err
-		}
-
-		// Merge the new setting into the existing setting
-		currentSetting.MergeWithNewSettings(newSetting)
-
-		// Store the updated setting
-		if err := session.ChangeSettings(app.ctxt, currentSetting); err != nil {
-			log.WithError(err).WithFields(logtags).Error("Failed to apply new session setting")
-			return err
-		}
-
 		if args.SetAsActive {
 			if err := app.currentUser.SetActiveSessionID(app.ctxt, sessionID); err != nil {
 				log.
@@ -402,20 +539,187 @@ func actionStartNewChat(args *startNewChatActionCLIArgs) cli.ActionFunc {
 			}
 		}
 
-		// Make the first exchange
-		return processOneChatExchange(app, session, logtags)
+		// Make the first new exchange
+		return processOneChatExchange(app, session, nil, output, logtags)
+	}
+}
+
+/*
+startChatSession start a new chat session with request settings provided by the user
+
+The settings are taken from the preset if one is given, otherwise the user is prompted for them.
+
+	@param app *applicationContext - application context
+	@param chatManager persistence.ChatSessionManager - chat session manager
+	@param args *startNewChatActionCLIArgs - CLI arguments
+	@param logtags log.Fields - logging tags
+	@return the new chat session
+*/
+func startChatSession(
+	app *applicationContext,
+	chatManager persistence.ChatSessionManager,
+	args *startNewChatActionCLIArgs,
+	logtags log.Fields,
+) (persistence.ChatSession, error) {
+	// Get chat session request parameters
+	var newSetting persistence.ChatSessionParameters
+	if args.Preset != "" {
+		preset, err := chatManager.GetPreset(app.ctxt, args.Preset)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Unable to read preset '%s'", args.Preset)
+			return nil, err
+		}
+		newSetting = preset.Settings
+	} else {
+		defaultSetting, err := app.currentUser.GetDefaultChatSettings(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to read user's default chat settings")
+			return nil, err
+		}
+		if args.Model != "" {
+			defaultSetting.Model = args.Model
+		}
+		newSetting, err = askUserForChatRequestOptions(defaultSetting)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to prompt user for parameters")
+			return nil, err
+		}
+	}
+
+	// Create new chat session
+	session, err := chatManager.NewSession(app.ctxt, args.Model)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to start new chat session")
+		return nil, err
+	}
+
+	// Get current settings
+	currentSetting, err := session.Settings(app.ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to read new chat session settings")
+		return nil, err
+	}
+
+	// Merge the new setting into the existing setting
+	currentSetting.MergeWithNewSettings(newSetting)
+
+	// Store the updated setting
+	if err := session.ChangeSettings(app.ctxt, currentSetting); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to apply new session setting")
+		return nil, err
+	}
+
+	return session, nil
+}
+
+/*
+forkChatSession start a new chat session as a copy of an existing chat session
+
+	@param ctx *cli.Context - CLI context
+	@param app *applicationContext - application context
+	@param chatManager persistence.ChatSessionManager - chat session manager
+	@param args *startNewChatActionCLIArgs - CLI arguments
+	@param logtags log.Fields - logging tags
+	@return the new chat session
+*/
+func forkChatSession(
+	ctx *cli.Context,
+	app *applicationContext,
+	chatManager persistence.ChatSessionManager,
+	args *startNewChatActionCLIArgs,
+	logtags log.Fields,
+) (persistence.ChatSession, error) {
+	exchangeCount := -1
+	if ctx.IsSet("at-exchange") {
+		if args.AtExchange < 0 {
+			return nil, fmt.Errorf("--at-exchange can not be negative")
+		}
+		exchangeCount = args.AtExchange
+	}
+
+	session, err := chatManager.ForkSession(app.ctxt, args.ForkFrom, exchangeCount)
+	if err != nil {
+		log.
+			WithError(err).
+			WithFields(logtags).
+			Errorf("Unable to fork chat session '%s'", args.ForkFrom)
+		return nil, err
 	}
+
+	return session, nil
 }
 
 // ================================================================================
 
+// listChatSessionsCLIArgs cli arguments to list chat sessions
+type listChatSessionsCLIArgs struct {
+	commonCLIArgs
+	// Tag only list chat sessions with this tag
+	Tag string
+	// Archived whether to also list archived chat sessions
+	Archived bool
+	// Limit max number of chat sessions to list
+	Limit int `validate:"gte=0"`
+	// After only list chat sessions created after this one
+	After string
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *listChatSessionsCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.StringFlag{
+			Name:        "tag",
+			Usage:       "Only list chat sessions with this tag",
+			Aliases:     []string{"t"},
+			Destination: &c.Tag,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "archived",
+			Usage:       "Also list archived chat sessions",
+			Aliases:     []string{"a"},
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.Archived,
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "limit",
+			Usage:       "Max number of chat sessions to list. All are listed if 0",
+			Aliases:     []string{"n"},
+			Value:       0,
+			DefaultText: "0",
+			Destination: &c.Limit,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "after",
+			Usage:       "Only list chat sessions created after this one. Use the reported 'next' to page",
+			Destination: &c.After,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var listChatSessionsParams listChatSessionsCLIArgs
+
 /*
 actionListChatSession list chat sessions associated with the active user
 
-	@param args *commonCLIArgs - CLI arguments
+	@param args *listChatSessionsCLIArgs - CLI arguments
 	@return the CLI action
 */
-func actionListChatSession(args *commonCLIArgs) cli.ActionFunc {
+func actionListChatSession(args *listChatSessionsCLIArgs) cli.ActionFunc {
 	return func(ctx *cli.Context) error {
 		// Initialize application
 		app, logtags, chatManager, err := baseChatAppInitialization(args)
@@ -424,9 +728,21 @@ func actionListChatSession(args *commonCLIArgs) cli.ActionFunc {
 			return err
 		}
 
-		sessions, err := chatManager.ListSessions(app.ctxt)
+		if err := validator.New().Struct(args); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid listing options")
+			return err
+		}
+
+		query := persistence.ChatSessionListQuery{Tag: args.Tag, After: args.After, Limit: args.Limit}
+		if !args.Archived {
+			query.States = []persistence.ChatSessionState{
+				persistence.ChatSessionStateOpen, persistence.ChatSessionStateClose,
+			}
+		}
+		page, err := chatManager.ListSessionSummaries(app.ctxt, query)
 		if err != nil {
 			log.WithError(err).WithFields(logtags).Error("Unable to list user's chat sessions")
+			return err
 		}
 
 		activeSession, err := app.currentUser.GetActiveSessionID(app.ctxt)
@@ -435,53 +751,43 @@ func actionListChatSession(args *commonCLIArgs) cli.ActionFunc {
 			return err
 		}
 
-		if len(sessions) > 0 {
+		if len(page.Sessions) > 0 {
 			type chatDisplay struct {
-				SessionID       string `yaml:"id"`
-				CurrentlyActive bool   `yaml:"in-focus"`
-				SessionState    string `yaml:"state"`
-				Model           string `yaml:"model"`
-				FirstRequest    string `yaml:"request"`
+				SessionID       string   `yaml:"id"`
+				CurrentlyActive bool     `yaml:"in-focus"`
+				SessionState    string   `yaml:"state"`
+				Model           string   `yaml:"model"`
+				Title           string   `yaml:"title,omitempty"`
+				Tags            []string `yaml:"tags,omitempty"`
+				ExchangeCount   int      `yaml:"exchanges"`
+				FirstRequest    string   `yaml:"request"`
 			}
 			displayEntries := []chatDisplay{}
 
 			// Go through the sessions
-			for _, oneSession := range sessions {
-				sessionID, err := oneSession.SessionID(app.ctxt)
-				if err != nil {
-					log.WithError(err).WithFields(logtags).Error("Session ID read failed")
-					return err
-				}
-				sessionState, err := oneSession.SessionState(app.ctxt)
-				if err != nil {
-					log.WithError(err).WithFields(logtags).Error("Session state read failed")
-					return err
-				}
-				setting, err := oneSession.Settings(app.ctxt)
-				if err != nil {
-					log.WithError(err).WithFields(logtags).Error("Session setting read failed")
-					return err
-				}
+			for _, oneSession := range page.Sessions {
 				displayEntry := chatDisplay{
-					SessionID:    sessionID,
-					SessionState: string(sessionState),
-					Model:        setting.Model,
+					SessionID:     oneSession.SessionID,
+					SessionState:  string(oneSession.State),
+					Model:         oneSession.Model,
+					Title:         oneSession.Metadata.Title,
+					Tags:          oneSession.Metadata.Tags,
+					ExchangeCount: oneSession.ExchangeCount,
+					FirstRequest:  oneSession.FirstRequest,
 				}
 				if activeSession != nil {
-					if sessionID == *activeSession {
+					if oneSession.SessionID == *activeSession {
 						displayEntry.CurrentlyActive = true
 					}
 				}
-				if firstExchange, err := oneSession.FirstExchange(app.ctxt); err == nil {
-					displayEntry.FirstRequest = firstExchange.Request
-				}
 				displayEntries = append(displayEntries, displayEntry)
 			}
 
 			type toDisplay struct {
 				AllSessions []chatDisplay `yaml:"sessions"`
+				Next        string        `yaml:"next,omitempty"`
 			}
-			display := toDisplay{AllSessions: displayEntries}
+			display := toDisplay{AllSessions: displayEntries, Next: page.NextCursor}
 
 			// Display as YAML
 			t, _ := yaml.Marshal(&display)
@@ -498,10 +804,13 @@ func actionListChatSession(args *commonCLIArgs) cli.ActionFunc {
 // describeChatActionCLIArgs cli arguments to print one specific chat session
 type describeChatActionCLIArgs struct {
 	commonCLIArgs
+	chatDisplayArgs
 	// SessionID the chat session ID
 	SessionID string
 	// Detailed view
 	Detailed bool
+	// Last only show this many of the newest exchanges
+	Last int `validate:"gte=0"`
 }
 
 /*
@@ -532,7 +841,17 @@ func (c *describeChatActionCLIArgs) getCLIFlags() []cli.Flag {
 			Destination: &c.Detailed,
 			Required:    false,
 		},
+		&cli.IntFlag{
+			Name:        "last",
+			Usage:       "Only show this many of the newest exchanges. All are shown if 0",
+			Aliases:     []string{"n"},
+			Value:       0,
+			DefaultText: "0",
+			Destination: &c.Last,
+			Required:    false,
+		},
 	}...)
+	cliFlags = append(cliFlags, c.chatDisplayArgs.getCLIFlags()...)
 
 	return cliFlags
 }
@@ -558,6 +877,11 @@ func actionGetChatSessionDetails(args *describeChatActionCLIArgs) cli.ActionFunc
 			return err
 		}
 
+		if err := validator.New().Struct(args); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid describe options")
+			return err
+		}
+
 		activeSession, err := app.currentUser.GetActiveSessionID(app.ctxt)
 		if err != nil {
 			log.WithError(err).WithFields(logtags).Error("Unable to query user's active session")
@@ -581,7 +905,12 @@ func actionGetChatSessionDetails(args *describeChatActionCLIArgs) cli.ActionFunc
 			return err
 		}
 
-		exchanges, err := session.Exchanges(app.ctxt)
+		var exchanges []persistence.ChatExchange
+		if args.Last > 0 {
+			exchanges, err = session.LatestExchanges(app.ctxt, args.Last)
+		} else {
+			exchanges, err = session.Exchanges(app.ctxt)
+		}
 		if err != nil {
 			log.WithError(err).WithFields(logtags).Error("Session exchanges read failed")
 			return err
@@ -589,21 +918,54 @@ func actionGetChatSessionDetails(args *describeChatActionCLIArgs) cli.ActionFunc
 
 		// Print only the chat exchanges
 		if !args.Detailed {
+			outputFilter, err := args.outputFilterPipeline()
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Error("Invalid output filters")
+				return err
+			}
+			renderer, err := args.markdownRenderer()
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Error("Failed to define markdown renderer")
+				return err
+			}
 			builder := strings.Builder{}
 			for _, oneExchange := range exchanges {
+				// Attached files are summarized after the request
+				for idx, attachment := range oneExchange.Attachments {
+					separator := "\n"
+					if idx == 0 {
+						separator = "\n\n"
+					}
+					oneExchange.Request += separator + "attached: " + describeAttachment(attachment)
+				}
+				oneExchange.Response = outputFilter.Apply(oneExchange.Response)
+				if renderer != nil {
+					if oneExchange.Response, err = renderer.Render(oneExchange.Response); err != nil {
+						log.WithError(err).WithFields(logtags).Error("Failed to render response")
+						return err
+					}
+				}
 				_, _ = builder.WriteString(oneExchange.String())
 			}
-			print(builder.String())
+			fmt.Print(builder.String())
 			return nil
 		}
 
 		// Create the display
+		type exchangeDisplay struct {
+			persistence.ChatExchange `yaml:",inline"`
+			// Attached summary of the attached files, in place of their content
+			Attached []string `yaml:"attached,omitempty"`
+		}
 		type sessionDisplay struct {
-			SessionID       string                            `yaml:"id"`
-			CurrentlyActive bool                              `yaml:"in-focus"`
-			SessionState    string                            `yaml:"state"`
-			Settings        persistence.ChatSessionParameters `yaml:"settings"`
-			Exchanges       []persistence.ChatExchange        `yaml:"exchanges"`
+			SessionID       string                                `yaml:"id"`
+			CurrentlyActive bool                                  `yaml:"in-focus"`
+			SessionState    string                                `yaml:"state"`
+			Metadata        persistence.ChatSessionMetadata       `yaml:",inline"`
+			Settings        persistence.ChatSessionParameters     `yaml:"settings"`
+			Pinned          []persistence.ChatSessionNote         `yaml:"pinned,omitempty"`
+			Exchanges       []exchangeDisplay                     `yaml:"exchanges"`
+			Audit           []persistence.ChatExchangeAuditRecord `yaml:"audit,omitempty"`
 		}
 		display := sessionDisplay{SessionID: args.SessionID}
 		if activeSession != nil {
@@ -619,13 +981,39 @@ func actionGetChatSessionDetails(args *describeChatActionCLIArgs) cli.ActionFunc
 		}
 		display.SessionState = string(state)
 
+		display.Metadata, err = session.Metadata(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Session metadata read failed")
+			return err
+		}
+
 		display.Settings, err = session.Settings(app.ctxt)
 		if err != nil {
 			log.WithError(err).WithFields(logtags).Error("Session setting read failed")
 			return err
 		}
 
-		display.Exchanges = exchanges
+		display.Pinned, err = session.PinnedNotes(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Session pinned notes read failed")
+			return err
+		}
+
+		display.Exchanges = []exchangeDisplay{}
+		for _, oneExchange := range exchanges {
+			oneDisplay := exchangeDisplay{ChatExchange: oneExchange}
+			for _, attachment := range oneExchange.Attachments {
+				oneDisplay.Attached = append(oneDisplay.Attached, describeAttachment(attachment))
+			}
+			oneDisplay.ChatExchange.Attachments = nil
+			display.Exchanges = append(display.Exchanges, oneDisplay)
+		}
+
+		display.Audit, err = session.ExchangeAuditRecords(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Session exchange audit read failed")
+			return err
+		}
 
 		// Display as YAML
 		t, _ := yaml.Marshal(&display)
@@ -671,13 +1059,71 @@ func (c *standardChatActionCLIArgs) getCLIFlags() []cli.Flag {
 
 var standardChatActionParams standardChatActionCLIArgs
 
+// updateChatActionCLIArgs cli arguments to update a chat session
+type updateChatActionCLIArgs struct {
+	standardChatActionCLIArgs
+	// Title new chat session title
+	Title string
+	// Description new chat session description
+	Description string
+	// Tags tags to add to the chat session
+	Tags cli.StringSlice
+	// Untags tags to remove from the chat session
+	Untags cli.StringSlice
+}
+
 /*
-actionUpdateChatSessionSettings update the chat session settings
+getCLIFlags fetch the list of CLI arguments
 
-	@param args *standardChatActionCLIArgs - CLI arguments
+	@return the list of CLI arguments
+*/
+func (c *updateChatActionCLIArgs) getCLIFlags() []cli.Flag {
+	cliFlags := c.standardChatActionCLIArgs.getCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.StringFlag{
+			Name:        "title",
+			Usage:       "Set the chat session title",
+			Destination: &c.Title,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "description",
+			Usage:       "Set the chat session description",
+			Destination: &c.Description,
+			Required:    false,
+		},
+		&cli.StringSliceFlag{
+			Name:        "tag",
+			Usage:       "Add a tag to the chat session. Can be repeated.",
+			Aliases:     []string{"t"},
+			Destination: &c.Tags,
+			Required:    false,
+		},
+		&cli.StringSliceFlag{
+			Name:        "untag",
+			Usage:       "Remove a tag from the chat session. Can be repeated.",
+			Destination: &c.Untags,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var updateChatActionParams updateChatActionCLIArgs
+
+/*
+actionUpdateChatSession update the chat session
+
+If any of the title, description, or tag options are given, only the session metadata is
+updated. Otherwise, the user is prompted for new session request settings.
+
+	@param args *updateChatActionCLIArgs - CLI arguments
 	@return the CLI action
 */
-func actionUpdateChatSessionSettings(args *standardChatActionCLIArgs) cli.ActionFunc {
+func actionUpdateChatSession(args *updateChatActionCLIArgs) cli.ActionFunc {
 	return func(ctx *cli.Context) error {
 		// Initialize application
 		app, logtags, chatManager, err := baseChatAppInitialization(args)
@@ -703,6 +1149,16 @@ func actionUpdateChatSessionSettings(args *standardChatActionCLIArgs) cli.Action
 			return err
 		}
 
+		updateMetadata := false
+		for _, flag := range []string{"title", "description", "tag", "untag"} {
+			if ctx.IsSet(flag) {
+				updateMetadata = true
+			}
+		}
+		if updateMetadata {
+			return updateChatSessionMetadata(ctx, app, session, args, logtags)
+		}
+
 		// Get current settings
 		currentSetting, err := session.Settings(app.ctxt)
 		if err != nil {
@@ -733,6 +1189,58 @@ func actionUpdateChatSessionSettings(args *standardChatActionCLIArgs) cli.Action
 	}
 }
 
+/*
+updateChatSessionMetadata apply the title, description, and tag changes given on the CLI
+
+	@param ctx *cli.Context - CLI context
+	@param app *applicationContext - application context
+	@param session persistence.ChatSession - the chat session
+	@param args *updateChatActionCLIArgs - CLI arguments
+	@param logtags log.Fields - logging tags
+*/
+func updateChatSessionMetadata(
+	ctx *cli.Context,
+	app *applicationContext,
+	session persistence.ChatSession,
+	args *updateChatActionCLIArgs,
+	logtags log.Fields,
+) error {
+	metadata, err := session.Metadata(app.ctxt)
+	if err != nil {
+		log.
+			WithError(err).
+			WithFields(logtags).
+			Errorf("Unable to read chat session '%s' metadata", args.SessionID)
+		return err
+	}
+
+	if ctx.IsSet("title") {
+		metadata.Title = strings.TrimSpace(args.Title)
+	}
+	if ctx.IsSet("description") {
+		metadata.Description = strings.TrimSpace(args.Description)
+	}
+
+	removed := map[string]bool{}
+	for _, tag := range args.Untags.Value() {
+		removed[strings.TrimSpace(tag)] = true
+	}
+	tags := []string{}
+	for _, tag := range append(metadata.Tags, args.Tags.Value()...) {
+		if !removed[strings.TrimSpace(tag)] {
+			tags = append(tags, tag)
+		}
+	}
+	metadata.Tags = tags
+
+	if err := session.ChangeMetadata(app.ctxt, metadata); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to apply new session metadata")
+		return err
+	}
+
+	return nil
+}
+
 // ================================================================================
 
 /*
@@ -755,14 +1263,30 @@ func actionChangeActiveChatSession(args *standardChatActionCLIArgs) cli.ActionFu
 		}
 
 		if args.SessionID == "" {
-			args.SessionID, err = interactiveChatSessionSelection(app, chatManager, logtags)
+			args.SessionID, err = interactiveChatSessionSelection(
+				app,
+				chatManager,
+				logtags,
+				persistence.ChatSessionStateOpen,
+				persistence.ChatSessionStateClose,
+			)
 			if err != nil {
 				log.WithError(err).WithFields(logtags).Error("Session selection failure")
 				return err
 			}
 		}
 
-		if err := app.currentUser.SetActiveSessionID(app.ctxt, args.SessionID); err != nil {
+		session, err := chatManager.GetSession(app.ctxt, args.SessionID)
+		if err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Could not fetch chat session '%s'", args.SessionID)
+			return err
+		}
+
+		// Archived chat sessions can not be made active
+		if err := chatManager.SetActiveSession(app.ctxt, session); err != nil {
 			log.
 				WithError(err).
 				WithFields(logtags).
@@ -777,12 +1301,15 @@ func actionChangeActiveChatSession(args *standardChatActionCLIArgs) cli.ActionFu
 // ================================================================================
 
 /*
-actionCloseChatSession close the chat session
+actionChangeChatSessionState move the chat session to a new state
 
 	@param args *standardChatActionCLIArgs - CLI arguments
+	@param newState persistence.ChatSessionState - the new session state
 	@return the CLI action
 */
-func actionCloseChatSession(args *standardChatActionCLIArgs) cli.ActionFunc {
+func actionChangeChatSessionState(
+	args *standardChatActionCLIArgs, newState persistence.ChatSessionState,
+) cli.ActionFunc {
 	return func(ctx *cli.Context) error {
 		// Initialize application
 		app, logtags, chatManager, err := baseChatAppInitialization(args)
@@ -792,7 +1319,20 @@ func actionCloseChatSession(args *standardChatActionCLIArgs) cli.ActionFunc {
 		}
 
 		if args.SessionID == "" {
-			args.SessionID, err = interactiveChatSessionSelection(app, chatManager, logtags)
+			// Only offer the sessions which can move to the new state
+			candidateStates := []persistence.ChatSessionState{}
+			for _, oneState := range []persistence.ChatSessionState{
+				persistence.ChatSessionStateOpen,
+				persistence.ChatSessionStateClose,
+				persistence.ChatSessionStateArchived,
+			} {
+				if persistence.ValidateChatSessionStateTransition(oneState, newState) == nil {
+					candidateStates = append(candidateStates, oneState)
+				}
+			}
+			args.SessionID, err = interactiveChatSessionSelection(
+				app, chatManager, logtags, candidateStates...,
+			)
 			if err != nil {
 				log.WithError(err).WithFields(logtags).Error("Session selection failure")
 				return err
@@ -808,11 +1348,11 @@ func actionCloseChatSession(args *standardChatActionCLIArgs) cli.ActionFunc {
 			return err
 		}
 
-		if err := session.CloseSession(app.ctxt); err != nil {
+		if err := session.ChangeState(app.ctxt, newState); err != nil {
 			log.
 				WithError(err).
 				WithFields(logtags).
-				Errorf("Unable to close chat session '%s'", args.SessionID)
+				Errorf("Unable to change chat session '%s' state to '%s'", args.SessionID, newState)
 			return err
 		}
 		return nil
@@ -956,13 +1496,51 @@ func actionDeleteLatestExchange(args *standardChatActionCLIArgs) cli.ActionFunc
 
 // ================================================================================
 
+// appendChatActionCLIArgs cli arguments when appending to the active chat session
+type appendChatActionCLIArgs struct {
+	commonCLIArgs
+	chatDisplayArgs
+	// Attach files to send along with the request
+	Attach cli.StringSlice
+}
+
+/*
+GetCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *appendChatActionCLIArgs) GetCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, c.chatDisplayArgs.getCLIFlags()...)
+	cliFlags = append(cliFlags, &cli.StringSliceFlag{
+		Name: "attach",
+		Usage: fmt.Sprintf(
+			"Send this file along with the request. Can be repeated, and globs are allowed. "+
+				"Each file can be up to %s, and all files up to %s.",
+			formatByteSize(maxAttachedFileSize),
+			formatByteSize(maxAttachedTotalSize),
+		),
+		Aliases:     []string{"a"},
+		Destination: &c.Attach,
+		Required:    false,
+	})
+
+	return cliFlags
+}
+
+// AppendChatParams CLI arguments for appending to the active chat session
+var AppendChatParams appendChatActionCLIArgs
+
 /*
 ActionAppendToChatSession append new exchange to active chat session
 
-	@param args *commonCLIArgs - CLI arguments
+	@param args *appendChatActionCLIArgs - CLI arguments
 	@return the CLI action
 */
-func ActionAppendToChatSession(args *commonCLIArgs) cli.ActionFunc {
+func ActionAppendToChatSession(args *appendChatActionCLIArgs) cli.ActionFunc {
 	return func(ctx *cli.Context) error {
 		// Initialize application
 		app, logtags, chatManager, err := baseChatAppInitialization(args)
@@ -971,6 +1549,18 @@ func ActionAppendToChatSession(args *commonCLIArgs) cli.ActionFunc {
 			return err
 		}
 
+		output, err := args.responseWriter()
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid output display options")
+			return err
+		}
+
+		attachments, err := readAttachments(args.Attach.Value())
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to read attached files")
+			return err
+		}
+
 		session, err := chatManager.CurrentActiveSession(app.ctxt)
 		if err != nil {
 			log.
@@ -980,6 +1570,6 @@ func ActionAppendToChatSession(args *commonCLIArgs) cli.ActionFunc {
 			return err
 		}
 
-		return processOneChatExchange(app, session, logtags)
+		return processOneChatExchange(app, session, attachments, output, logtags)
 	}
 }
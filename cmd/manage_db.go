@@ -0,0 +1,636 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/apex/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+dbMaintenanceSetup perform basic setup for DB maintenance actions
+
+Unlike initialSetup, this works against a DB which is not at the latest schema version.
+
+	@param validate *validator.Validate - validation engine
+	@return the schema migrator
+*/
+func (c *commonCLIArgs) dbMaintenanceSetup(
+	validate *validator.Validate,
+) (persistence.SchemaMigrator, error) {
+	if err := validate.Struct(c); err != nil {
+		return nil, err
+	}
+	sqlLogLevel := c.Logging.setupLogging()
+	if c.Config.Ephemeral {
+		return nil, fmt.Errorf("DB maintenance not supported in ephemeral mode")
+	}
+	if err := c.Config.initialize(); err != nil {
+		log.WithError(err).Error("Config file setup failed")
+		return nil, err
+	}
+	return persistence.GetSQLSchemaMigrator(
+		persistence.GetSqliteDialector(c.Config.SqliteDB), sqlLogLevel,
+	)
+}
+
+// dbMigrateCLIArgs cli arguments to migrate the DB schema
+type dbMigrateCLIArgs struct {
+	commonCLIArgs
+	// TargetVersion target schema version. Negative means the latest version.
+	TargetVersion int
+	// SkipBackup whether to skip backing up the DB before migrating
+	SkipBackup bool
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *dbMigrateCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.IntFlag{
+			Name:        "to",
+			Usage:       "Target schema version. Negative for the latest version",
+			Value:       -1,
+			DefaultText: "-1",
+			Destination: &c.TargetVersion,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "skip-backup",
+			Usage:       "Do not backup the sqlite DB file before migrating",
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.SkipBackup,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var dbMigrateParams dbMigrateCLIArgs
+
+/*
+actionMigrateDB migrate the DB schema
+
+	@param args *dbMigrateCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionMigrateDB(args *dbMigrateCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		migrator, err := args.dbMaintenanceSetup(validator.New())
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		ctxt := context.Background()
+
+		currentVersion, err := migrator.SchemaVersion(ctxt)
+		if err != nil {
+			log.WithError(err).Error("Failed to read current schema version")
+			return err
+		}
+		targetVersion := args.TargetVersion
+		if targetVersion < 0 {
+			targetVersion = persistence.LatestSQLSchemaVersion()
+		}
+		if currentVersion == targetVersion {
+			fmt.Printf("Schema already at version %d\n", currentVersion)
+			return nil
+		}
+
+		if !args.SkipBackup {
+			backupFile, err := backupSqliteDB(ctxt, args.Config.SqliteDB, args.Logging.setupLogging())
+			if err != nil {
+				log.WithError(err).Errorf("Unable to backup '%s'", args.Config.SqliteDB)
+				return err
+			}
+			fmt.Printf("Backup written to '%s'\n", backupFile)
+		}
+
+		if err := migrator.MigrateTo(ctxt, targetVersion); err != nil {
+			log.WithError(err).Errorf("Failed to migrate schema to version %d", targetVersion)
+			return err
+		}
+		fmt.Printf("Schema migrated from version %d to %d\n", currentVersion, targetVersion)
+
+		return nil
+	}
+}
+
+/*
+actionDBStatus print the DB schema migration status
+
+	@param args *commonCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionDBStatus(args *commonCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		migrator, err := args.dbMaintenanceSetup(validator.New())
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		ctxt := context.Background()
+
+		currentVersion, err := migrator.SchemaVersion(ctxt)
+		if err != nil {
+			log.WithError(err).Error("Failed to read current schema version")
+			return err
+		}
+		migrations, err := migrator.MigrationStatus(ctxt)
+		if err != nil {
+			log.WithError(err).Error("Failed to read schema migration status")
+			return err
+		}
+
+		type toDisplay struct {
+			CurrentVersion   int                                 `yaml:"current_version"`
+			SupportedVersion int                                 `yaml:"supported_version"`
+			Migrations       []persistence.SchemaMigrationStatus `yaml:"migrations"`
+		}
+
+		t, _ := yaml.Marshal(&toDisplay{
+			CurrentVersion:   currentVersion,
+			SupportedVersion: persistence.LatestSQLSchemaVersion(),
+			Migrations:       migrations,
+		})
+		fmt.Printf("%s", t)
+
+		return nil
+	}
+}
+
+// dbRekeyCLIArgs cli arguments to change the API token passphrase
+type dbRekeyCLIArgs struct {
+	commonCLIArgs
+	// NewPassphraseFile file containing the new passphrase
+	NewPassphraseFile string
+}
+
+// newTokenPassphraseEnvVar ENV variable holding the new passphrase when changing passphrase
+const newTokenPassphraseEnvVar = "CLI_GPT_NEW_PASSPHRASE"
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *dbRekeyCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.StringFlag{
+			Name: "new-passphrase-file",
+			Usage: fmt.Sprintf(
+				"File containing the new passphrase. "+
+					"The new passphrase can also be provided through %s, or is prompted for",
+				newTokenPassphraseEnvVar,
+			),
+			Aliases:     []string{"npf"},
+			Destination: &c.NewPassphraseFile,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var dbRekeyParams dbRekeyCLIArgs
+
+/*
+actionRekeyDB re-encrypt all stored API tokens with a new passphrase
+
+API tokens which were stored unencrypted are encrypted as well.
+
+	@param args *dbRekeyCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionRekeyDB(args *dbRekeyCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		migrator, err := args.dbMaintenanceSetup(validator.New())
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		ctxt := context.Background()
+
+		currentVersion, err := migrator.SchemaVersion(ctxt)
+		if err != nil {
+			log.WithError(err).Error("Failed to read current schema version")
+			return err
+		}
+		if currentVersion != persistence.LatestSQLSchemaVersion() {
+			return fmt.Errorf(
+				"schema at version %d, run 'db migrate' to update it to version %d first",
+				currentVersion,
+				persistence.LatestSQLSchemaVersion(),
+			)
+		}
+
+		newCipher := persistence.DefineSecretCipher(func() (string, error) {
+			return readPassphrase(
+				newTokenPassphraseEnvVar, args.NewPassphraseFile, "New API token passphrase", true,
+			)
+		})
+
+		updated, err := persistence.RekeySQLUserSecrets(
+			ctxt,
+			persistence.GetSqliteDialector(args.Config.SqliteDB),
+			args.Logging.setupLogging(),
+			args.Config.secretCipher(),
+			newCipher,
+		)
+		if err != nil {
+			log.WithError(err).Error("Failed to re-encrypt API tokens")
+			return err
+		}
+		fmt.Printf("Re-encrypted %d API tokens\n", updated)
+
+		return nil
+	}
+}
+
+// backupPassphraseEnvVar ENV variable holding the passphrase for encrypting DB backups
+const backupPassphraseEnvVar = "CLI_GPT_BACKUP_PASSPHRASE"
+
+// dbBackupCLIArgs cli arguments to backup the DB
+type dbBackupCLIArgs struct {
+	commonCLIArgs
+	// Output file to write the backup to
+	Output string `validate:"required"`
+	// Compress whether to gzip compress the backup
+	Compress bool
+	// Encrypt whether to encrypt the backup with a passphrase
+	Encrypt bool
+	// BackupPassphraseFile file containing the backup passphrase
+	BackupPassphraseFile string
+}
+
+/*
+backupPassphraseFlag define the CLI flag for the backup passphrase file
+
+	@param destination *string - flag value destination
+	@return the CLI flag
+*/
+func backupPassphraseFlag(destination *string) cli.Flag {
+	return &cli.StringFlag{
+		Name: "backup-passphrase-file",
+		Usage: fmt.Sprintf(
+			"File containing the backup passphrase. "+
+				"The passphrase can also be provided through %s, or is prompted for",
+			backupPassphraseEnvVar,
+		),
+		Aliases:     []string{"bpf"},
+		Destination: destination,
+		Required:    false,
+	}
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *dbBackupCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.StringFlag{
+			Name:        "out",
+			Usage:       "File to write the backup to. It must not exist.",
+			Aliases:     []string{"o"},
+			Destination: &c.Output,
+			Required:    true,
+		},
+		&cli.BoolFlag{
+			Name:        "compress",
+			Usage:       "Gzip compress the backup",
+			Aliases:     []string{"z"},
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.Compress,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "encrypt",
+			Usage:       "Encrypt the backup with a passphrase",
+			Aliases:     []string{"e"},
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.Encrypt,
+			Required:    false,
+		},
+		backupPassphraseFlag(&c.BackupPassphraseFile),
+	}...)
+
+	return cliFlags
+}
+
+var dbBackupParams dbBackupCLIArgs
+
+/*
+actionBackupDB write a verified copy of the DB, which is safe to take while the DB is in use
+
+	@param args *dbBackupCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionBackupDB(args *dbBackupCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		if _, err := args.dbMaintenanceSetup(validator.New()); err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+		if err := validator.New().Struct(args); err != nil {
+			log.WithError(err).Error("Invalid backup options")
+			return err
+		}
+		if _, err := os.Stat(args.Output); err == nil {
+			return fmt.Errorf("'%s' already exists", args.Output)
+		}
+
+		ctxt := context.Background()
+
+		workDir, err := os.MkdirTemp("", "cli-gpt-backup-*")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = os.RemoveAll(workDir)
+		}()
+
+		// Take a consistent copy of the DB, and verify it
+		dbCopy := filepath.Join(workDir, "backup.db")
+		version, err := persistence.BackupSQLiteDB(
+			ctxt, args.Config.SqliteDB, dbCopy, args.Logging.setupLogging(),
+		)
+		if err != nil {
+			log.WithError(err).Errorf("Unable to backup '%s'", args.Config.SqliteDB)
+			return err
+		}
+		dbImage, err := os.ReadFile(dbCopy)
+		if err != nil {
+			return err
+		}
+
+		encoding := persistence.BackupEncoding{Compress: args.Compress}
+		if args.Encrypt {
+			encoding.Passphrase = func() (string, error) {
+				return readPassphrase(
+					backupPassphraseEnvVar, args.BackupPassphraseFile, "Backup passphrase", true,
+				)
+			}
+		}
+		encoded, err := persistence.EncodeBackup(dbImage, encoding)
+		if err != nil {
+			log.WithError(err).Error("Unable to encode backup")
+			return err
+		}
+
+		// Write to a temporary file first, so an interrupted backup leaves no partial output
+		output, err := os.CreateTemp(filepath.Dir(args.Output), ".cli-gpt-backup-*")
+		if err != nil {
+			return err
+		}
+		if _, err := output.Write(encoded); err != nil {
+			_ = output.Close()
+			_ = os.Remove(output.Name())
+			return err
+		}
+		if err := output.Close(); err != nil {
+			_ = os.Remove(output.Name())
+			return err
+		}
+		if err := os.Rename(output.Name(), args.Output); err != nil {
+			_ = os.Remove(output.Name())
+			return err
+		}
+
+		fmt.Printf("Backup of schema version %d written to '%s'\n", version, args.Output)
+		return nil
+	}
+}
+
+// dbRestoreCLIArgs cli arguments to restore the DB from a backup
+type dbRestoreCLIArgs struct {
+	commonCLIArgs
+	// SkipBackup whether to skip backing up the DB before restoring
+	SkipBackup bool
+	// BackupPassphraseFile file containing the backup passphrase
+	BackupPassphraseFile string
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *dbRestoreCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "skip-backup",
+			Usage:       "Do not backup the sqlite DB file before restoring",
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.SkipBackup,
+			Required:    false,
+		},
+		backupPassphraseFlag(&c.BackupPassphraseFile),
+	}...)
+
+	return cliFlags
+}
+
+var dbRestoreParams dbRestoreCLIArgs
+
+/*
+repointUserContext make sure the user context file refers to a user in the DB
+
+If the active user no longer exists, the first known user becomes active. The user context is
+cleared if there are no users.
+
+	@param ctxt context.Context - query context
+	@param config configFileArgs - application configuration related parameters
+	@param userManager persistence.UserManager - user manager of the DB
+	@return the active user ID, if any
+*/
+func repointUserContext(
+	ctxt context.Context, config configFileArgs, userManager persistence.UserManager,
+) (string, error) {
+	contextContent, err := os.ReadFile(config.UserContext)
+	if err != nil {
+		return "", err
+	}
+	if len(contextContent) > 0 {
+		var contextParam userContext
+		if err := json.Unmarshal(contextContent, &contextParam); err == nil {
+			if _, err := userManager.GetUser(ctxt, contextParam.CurrentUserID); err == nil {
+				return contextParam.CurrentUserID, nil
+			}
+		}
+	}
+
+	app := defineApplicationContext(ctxt, config, "db-restore")
+	app.userManager = userManager
+	users, err := userManager.ListUsers(ctxt)
+	if err != nil {
+		return "", err
+	}
+	activeUserID := ""
+	if len(users) > 0 {
+		app.currentUser = users[0]
+		if activeUserID, err = users[0].GetID(ctxt); err != nil {
+			return "", err
+		}
+	}
+	return activeUserID, app.record()
+}
+
+/*
+actionRestoreDB replace the DB with one restored from a backup
+
+The backup is verified before it replaces the DB, and the current DB is backed up first.
+
+	@param args *dbRestoreCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionRestoreDB(args *dbRestoreCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		if _, err := args.dbMaintenanceSetup(validator.New()); err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+		if ctx.Args().Len() != 1 {
+			return fmt.Errorf("exactly one backup file to restore must be given")
+		}
+		backupFile := ctx.Args().First()
+
+		ctxt := context.Background()
+		sqlLogLevel := args.Logging.setupLogging()
+
+		backup, err := os.ReadFile(backupFile)
+		if err != nil {
+			log.WithError(err).Errorf("Unable to read '%s'", backupFile)
+			return err
+		}
+		dbImage, err := persistence.DecodeBackup(backup, func() (string, error) {
+			return readPassphrase(
+				backupPassphraseEnvVar, args.BackupPassphraseFile, "Backup passphrase", false,
+			)
+		})
+		if err != nil {
+			log.WithError(err).Errorf("Unable to decode '%s'", backupFile)
+			return err
+		}
+
+		// Stage the restored DB next to the DB, so it can be swapped in with a rename
+		staged, err := os.CreateTemp(filepath.Dir(args.Config.SqliteDB), ".cli-gpt-restore-*.db")
+		if err != nil {
+			return err
+		}
+		stagedFile := staged.Name()
+		defer func() {
+			_ = os.Remove(stagedFile)
+		}()
+		if _, err := staged.Write(dbImage); err != nil {
+			_ = staged.Close()
+			return err
+		}
+		if err := staged.Close(); err != nil {
+			return err
+		}
+		version, err := persistence.VerifySQLiteDB(ctxt, stagedFile, sqlLogLevel)
+		if err != nil {
+			log.WithError(err).Errorf("'%s' failed verification", backupFile)
+			return err
+		}
+
+		if !args.SkipBackup {
+			previous, err := backupSqliteDB(ctxt, args.Config.SqliteDB, sqlLogLevel)
+			if err != nil {
+				log.WithError(err).Errorf("Unable to backup '%s'", args.Config.SqliteDB)
+				return err
+			}
+			fmt.Printf("Previous DB backed up to '%s'\n", previous)
+		}
+		// WAL files left behind by the replaced DB must not be applied to the restored DB
+		for _, suffix := range []string{"-wal", "-shm"} {
+			walFile := args.Config.SqliteDB + suffix
+			if err := os.Remove(walFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.WithError(err).Errorf("Unable to remove '%s'", walFile)
+				return err
+			}
+		}
+		if err := os.Rename(stagedFile, args.Config.SqliteDB); err != nil {
+			log.WithError(err).Errorf("Unable to replace '%s'", args.Config.SqliteDB)
+			return err
+		}
+		fmt.Printf("Restored schema version %d from '%s'\n", version, backupFile)
+
+		// An older restored DB is migrated to the schema version this build supports
+		if version < persistence.LatestSQLSchemaVersion() {
+			migrator, err := persistence.GetSQLSchemaMigrator(
+				persistence.GetSqliteDialector(args.Config.SqliteDB), sqlLogLevel,
+			)
+			if err != nil {
+				log.WithError(err).Errorf("Unable to open restored DB '%s'", args.Config.SqliteDB)
+				return err
+			}
+			if err := migrator.MigrateTo(ctxt, persistence.LatestSQLSchemaVersion()); err != nil {
+				log.
+					WithError(err).
+					Errorf("Failed to migrate schema to version %d", persistence.LatestSQLSchemaVersion())
+				return err
+			}
+			fmt.Printf(
+				"Schema migrated from version %d to %d\n", version, persistence.LatestSQLSchemaVersion(),
+			)
+		}
+
+		userManager, err := persistence.GetSQLUserManager(
+			persistence.GetSqliteDialector(args.Config.SqliteDB), sqlLogLevel, args.Config.secretCipher(),
+		)
+		if err != nil {
+			log.WithError(err).Errorf("Unable to open restored DB '%s'", args.Config.SqliteDB)
+			return err
+		}
+		activeUserID, err := repointUserContext(ctxt, args.Config, userManager)
+		if err != nil {
+			log.WithError(err).Error("Unable to update user context")
+			return err
+		}
+		if activeUserID == "" {
+			fmt.Println("No users in restored DB, user context cleared")
+		} else {
+			fmt.Printf("Active user '%s'\n", activeUserID)
+		}
+
+		return nil
+	}
+}
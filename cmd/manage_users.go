@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/alwitt/cli-gpt/persistence"
 	"github.com/apex/log"
 	"github.com/go-playground/validator/v10"
 	"github.com/manifoldco/promptui"
@@ -55,9 +56,9 @@ func interactiveUserSelection(app *applicationContext) (string, error) {
 }
 
 // Helper function to ask for user parameters
-func askForUserParameters(app *applicationContext, oldUsername, oldAPIToken *string) (
-	string, string, error,
-) {
+func askForUserParameters(
+	app *applicationContext, oldUsername, oldAPIToken *string, oldSource *persistence.APITokenSource,
+) (string, persistence.APITokenSource, string, error) {
 	logtags := app.GetLogTagsForContext(app.ctxt)
 
 	usernamePrompt := promptui.Prompt{Label: "Username"}
@@ -67,7 +68,46 @@ func askForUserParameters(app *applicationContext, oldUsername, oldAPIToken *str
 	username, err := usernamePrompt.Run()
 	if err != nil {
 		log.WithError(err).WithFields(logtags).Error("Unable to query for username")
-		return "", "", err
+		return "", persistence.APITokenSource{}, "", err
+	}
+
+	sourceKinds := persistence.SupportedAPITokenSourceKinds()
+	sourceLabels := []string{
+		"Store the API token",
+		"Read the API token from an ENV variable",
+		"Run a command which prints the API token",
+	}
+	sourcePrompt := promptui.Select{Label: "API Token Source", Items: sourceLabels}
+	if oldSource != nil {
+		for idx, kind := range sourceKinds {
+			if kind == oldSource.Kind {
+				sourcePrompt.CursorPos = idx
+			}
+		}
+	}
+	selected, _, err := sourcePrompt.Run()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to query for API token source")
+		return "", persistence.APITokenSource{}, "", err
+	}
+	source := persistence.APITokenSource{Kind: sourceKinds[selected]}
+
+	// External API token source
+	if source.Kind != persistence.APITokenFromLiteral {
+		label := "ENV Variable"
+		if source.Kind == persistence.APITokenFromCommand {
+			label = "Command"
+		}
+		referencePrompt := promptui.Prompt{Label: label}
+		if oldSource != nil && oldSource.Kind == source.Kind {
+			referencePrompt.Default = oldSource.Reference
+		}
+		source.Reference, err = referencePrompt.Run()
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to query for API token source")
+			return "", persistence.APITokenSource{}, "", err
+		}
+		return username, source, "", source.Validate()
 	}
 
 	apiTokenPrompt := promptui.Prompt{Label: "API Token", HideEntered: true}
@@ -77,10 +117,30 @@ func askForUserParameters(app *applicationContext, oldUsername, oldAPIToken *str
 	apiToken, err := apiTokenPrompt.Run()
 	if err != nil {
 		log.WithError(err).WithFields(logtags).Error("Unable to query for API token")
-		return "", "", err
+		return "", persistence.APITokenSource{}, "", err
 	}
 
-	return username, apiToken, nil
+	return username, source, apiToken, nil
+}
+
+/*
+installAPIToken record the user's API token, or where to obtain it
+
+	@param app *applicationContext - application context
+	@param userEntry persistence.User - the user
+	@param source persistence.APITokenSource - the API token source
+	@param apiToken string - the API token, if the source is literal
+*/
+func installAPIToken(
+	app *applicationContext,
+	userEntry persistence.User,
+	source persistence.APITokenSource,
+	apiToken string,
+) error {
+	if source.Kind == persistence.APITokenFromLiteral {
+		return userEntry.SetAPIToken(app.ctxt, apiToken)
+	}
+	return userEntry.SetAPITokenSource(app.ctxt, source)
 }
 
 // ================================================================================
@@ -103,7 +163,7 @@ func actionCreateUser(args *commonCLIArgs) cli.ActionFunc {
 		logtags := app.GetLogTagsForContext(app.ctxt)
 
 		// Prompt for user info
-		username, apiToken, err := askForUserParameters(app, nil, nil)
+		username, tokenSource, apiToken, err := askForUserParameters(app, nil, nil, nil)
 		if err != nil {
 			log.WithError(err).WithFields(logtags).Error("User parameter prompt failed")
 			return err
@@ -116,7 +176,7 @@ func actionCreateUser(args *commonCLIArgs) cli.ActionFunc {
 		}
 
 		// Install user API token
-		if err := userEntry.SetAPIToken(app.ctxt, apiToken); err != nil {
+		if err := installAPIToken(app, userEntry, tokenSource, apiToken); err != nil {
 			log.
 				WithError(err).
 				WithFields(logtags).
@@ -294,13 +354,46 @@ func actionChangeActiveUser(args *specifyUserCLIArgs) cli.ActionFunc {
 
 // ================================================================================
 
+// updateUserCLIArgs cli arguments to update a user
+type updateUserCLIArgs struct {
+	specifyUserCLIArgs
+	chatSettingsCLIArgs
+	// ChatSettings prompt for the default chat session settings of the user
+	ChatSettings bool
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *updateUserCLIArgs) getCLIFlags() []cli.Flag {
+	cliFlags := c.specifyUserCLIArgs.getCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, &cli.BoolFlag{
+		Name:        "chat-settings",
+		Usage:       "Update the default request settings of new chat sessions, prompting for them",
+		Destination: &c.ChatSettings,
+		Required:    false,
+	})
+	cliFlags = append(cliFlags, c.chatSettingsCLIArgs.getCLIFlags()...)
+
+	return cliFlags
+}
+
+var updateUserParams updateUserCLIArgs
+
 /*
 actionUpdateUser update parameters of a user
 
-	@param args *specifyUserCLIArgs - CLI arguments
+If --chat-settings or any request setting is given, only the default chat session settings of
+the user are updated. Otherwise, the user is prompted for a new name and API token.
+
+	@param args *updateUserCLIArgs - CLI arguments
 	@return the CLI action
 */
-func actionUpdateUser(args *specifyUserCLIArgs) cli.ActionFunc {
+func actionUpdateUser(args *updateUserCLIArgs) cli.ActionFunc {
 	return func(ctx *cli.Context) error {
 		// Initialize application
 		app, err := args.initialSetup(validator.New(), "delete-user")
@@ -325,20 +418,40 @@ func actionUpdateUser(args *specifyUserCLIArgs) cli.ActionFunc {
 			return err
 		}
 
+		if args.ChatSettings || args.chatSettingsCLIArgs.isSet(ctx) {
+			return updateUserDefaultChatSettings(ctx, app, userEntry, args, logtags)
+		}
+
 		currentUsername, err := userEntry.GetName(app.ctxt)
 		if err != nil {
 			log.WithError(err).WithFields(logtags).Errorf("Unable to read user '%s' name", args.UserID)
 			return err
 		}
 
-		currentAPIToken, err := userEntry.GetAPIToken(app.ctxt)
+		currentSource, err := userEntry.GetAPITokenSource(app.ctxt)
 		if err != nil {
-			log.WithError(err).WithFields(logtags).Errorf("Unable to read user '%s' token", args.UserID)
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Unable to read user '%s' token source", args.UserID)
 			return err
 		}
 
+		// Only stored API tokens are offered as default, external sources are not resolved
+		var currentAPIToken *string
+		if currentSource.Kind == persistence.APITokenFromLiteral {
+			apiToken, err := userEntry.GetAPIToken(app.ctxt)
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Errorf("Unable to read user '%s' token", args.UserID)
+				return err
+			}
+			currentAPIToken = &apiToken
+		}
+
 		// Prompt for user info
-		newUsername, newAPIToken, err := askForUserParameters(app, &currentUsername, &currentAPIToken)
+		newUsername, newSource, newAPIToken, err := askForUserParameters(
+			app, &currentUsername, currentAPIToken, &currentSource,
+		)
 		if err != nil {
 			log.WithError(err).WithFields(logtags).Error("User parameter prompt failed")
 			return err
@@ -348,7 +461,7 @@ func actionUpdateUser(args *specifyUserCLIArgs) cli.ActionFunc {
 			log.WithError(err).WithFields(logtags).Errorf("Unable to update user '%s' name", args.UserID)
 			return err
 		}
-		if err := userEntry.SetAPIToken(app.ctxt, newAPIToken); err != nil {
+		if err := installAPIToken(app, userEntry, newSource, newAPIToken); err != nil {
 			log.WithError(err).WithFields(logtags).Errorf("Unable to update user '%s' token", args.UserID)
 			return err
 		}
@@ -357,6 +470,56 @@ func actionUpdateUser(args *specifyUserCLIArgs) cli.ActionFunc {
 	}
 }
 
+/*
+updateUserDefaultChatSettings update the default chat session settings of a user from the
+CLI, or by prompting for them
+
+	@param ctx *cli.Context - CLI context
+	@param app *applicationContext - application context
+	@param userEntry persistence.User - the user
+	@param args *updateUserCLIArgs - CLI arguments
+	@param logtags log.Fields - logging tags
+*/
+func updateUserDefaultChatSettings(
+	ctx *cli.Context,
+	app *applicationContext,
+	userEntry persistence.User,
+	args *updateUserCLIArgs,
+	logtags log.Fields,
+) error {
+	currentSetting, err := userEntry.GetDefaultChatSettings(app.ctxt)
+	if err != nil {
+		log.
+			WithError(err).
+			WithFields(logtags).
+			Errorf("Unable to read user '%s' default chat settings", args.UserID)
+		return err
+	}
+
+	newSetting, err := args.resolve(ctx, currentSetting)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to prompt user for parameters")
+		return err
+	}
+
+	if err := userEntry.SetDefaultChatSettings(app.ctxt, newSetting); err != nil {
+		log.
+			WithError(err).
+			WithFields(logtags).
+			Errorf("Unable to update user '%s' default chat settings", args.UserID)
+		return err
+	}
+
+	// Display as YAML
+	t, _ := yaml.Marshal(&struct {
+		Settings persistence.ChatSessionParameters `yaml:"default_chat_settings"`
+	}{Settings: newSetting})
+
+	fmt.Printf("%s\n", t)
+
+	return nil
+}
+
 // ================================================================================
 
 /*
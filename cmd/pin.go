@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/apex/log"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// maxPinnedFileSize largest file which can be pinned to a chat session. Pinned notes are sent
+// with every request.
+const maxPinnedFileSize = 64 * 1024
+
+// pinSessionArgs cli arguments to select the chat session to manage pinned notes of
+type pinSessionArgs struct {
+	// SessionID the chat session ID. The active chat session is used if not given.
+	SessionID string
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *pinSessionArgs) getCLIFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "session-id",
+			Usage:       "Target chat session ID. Defaults to the currently active chat session.",
+			Aliases:     []string{"i"},
+			EnvVars:     []string{"TARGET_SESSION_ID"},
+			Destination: &c.SessionID,
+			Required:    false,
+		},
+	}
+}
+
+/*
+readTextFile read a text file to send to the model
+
+	@param fileName string - the file
+	@param maxSize int64 - the largest file allowed
+	@return the file content
+*/
+func readTextFile(fileName string, maxSize int64) (string, error) {
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		return "", err
+	}
+	if fileInfo.IsDir() {
+		return "", fmt.Errorf("'%s' is a directory", fileName)
+	}
+	if fileInfo.Size() > maxSize {
+		return "", fmt.Errorf(
+			"'%s' is %s, larger than the %s limit",
+			fileName,
+			formatByteSize(fileInfo.Size()),
+			formatByteSize(maxSize),
+		)
+	}
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content) {
+		return "", fmt.Errorf("'%s' is not a text file", fileName)
+	}
+	return string(content), nil
+}
+
+// ================================================================================
+
+// pinAddCLIArgs cli arguments to pin a note to a chat session
+type pinAddCLIArgs struct {
+	commonCLIArgs
+	pinSessionArgs
+	// File pin the content of this file
+	File string
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *pinAddCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, c.pinSessionArgs.getCLIFlags()...)
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:        "file",
+		Usage:       "Pin the current content of this text file",
+		Aliases:     []string{"f"},
+		Destination: &c.File,
+		Required:    false,
+	})
+
+	return cliFlags
+}
+
+var pinAddParams pinAddCLIArgs
+
+/*
+actionPinNote pin a note to a chat session
+
+The note is given on the command line, read from a file, or entered at a prompt.
+
+	@param args *pinAddCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionPinNote(args *pinAddCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		var note persistence.ChatSessionNote
+		switch {
+		case args.File != "" && ctx.Args().Len() > 0:
+			return fmt.Errorf("give either a note or --file, not both")
+		case args.File != "":
+			content, err := readTextFile(args.File, maxPinnedFileSize)
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Errorf("Unable to read '%s'", args.File)
+				return err
+			}
+			note = persistence.ChatSessionNote{Content: content, Source: filepath.Clean(args.File)}
+		case ctx.Args().Len() > 0:
+			note = persistence.ChatSessionNote{Content: strings.Join(ctx.Args().Slice(), " ")}
+		default:
+			content, err := multilinePrompt(app.ctxt)
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Error("Failed to prompt for note")
+				return err
+			}
+			note = persistence.ChatSessionNote{Content: strings.TrimSpace(content)}
+		}
+
+		session, err := selectedOrActiveSession(app, chatManager, args.SessionID)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Could not fetch chat session")
+			return err
+		}
+
+		noteID, err := session.PinNote(app.ctxt, note)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to pin note")
+			return err
+		}
+		fmt.Printf("Pinned note '%s'\n", noteID)
+		return nil
+	}
+}
+
+// ================================================================================
+
+// pinListCLIArgs cli arguments to list the notes pinned to a chat session
+type pinListCLIArgs struct {
+	commonCLIArgs
+	pinSessionArgs
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *pinListCLIArgs) getCLIFlags() []cli.Flag {
+	return append(c.GetCommonCLIFlags(), c.pinSessionArgs.getCLIFlags()...)
+}
+
+var pinListParams pinListCLIArgs
+
+/*
+actionListPinnedNotes list the notes pinned to a chat session
+
+	@param args *pinListCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionListPinnedNotes(args *pinListCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		session, err := selectedOrActiveSession(app, chatManager, args.SessionID)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Could not fetch chat session")
+			return err
+		}
+
+		notes, err := session.PinnedNotes(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to list pinned notes")
+			return err
+		}
+
+		if len(notes) > 0 {
+			type noteDisplay struct {
+				NoteID   string `yaml:"id"`
+				Source   string `yaml:"source,omitempty"`
+				PinnedAt string `yaml:"pinned_at"`
+				Content  string `yaml:"content"`
+			}
+			displayEntries := []noteDisplay{}
+			for _, oneNote := range notes {
+				displayEntries = append(displayEntries, noteDisplay{
+					NoteID:   oneNote.ID,
+					Source:   oneNote.Source,
+					PinnedAt: oneNote.CreatedAt.Local().Format(time.RFC3339),
+					Content:  oneNote.Content,
+				})
+			}
+
+			type toDisplay struct {
+				Notes []noteDisplay `yaml:"pinned"`
+			}
+
+			// Display as YAML
+			t, _ := yaml.Marshal(&toDisplay{Notes: displayEntries})
+
+			fmt.Printf("%s\n", t)
+		}
+
+		return nil
+	}
+}
+
+// ================================================================================
+
+// pinRemoveCLIArgs cli arguments to remove notes pinned to a chat session
+type pinRemoveCLIArgs struct {
+	commonCLIArgs
+	pinSessionArgs
+	// NoteIDs the pinned note IDs
+	NoteIDs cli.StringSlice
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *pinRemoveCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, c.pinSessionArgs.getCLIFlags()...)
+	cliFlags = append(cliFlags, &cli.StringSliceFlag{
+		Name:        "id",
+		Usage:       "Pinned note ID, as shown by 'pin list'",
+		Destination: &c.NoteIDs,
+		Required:    true,
+	})
+
+	return cliFlags
+}
+
+var pinRemoveParams pinRemoveCLIArgs
+
+/*
+actionUnpinNotes remove notes pinned to a chat session
+
+	@param args *pinRemoveCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionUnpinNotes(args *pinRemoveCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		session, err := selectedOrActiveSession(app, chatManager, args.SessionID)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Could not fetch chat session")
+			return err
+		}
+
+		for _, noteID := range args.NoteIDs.Value() {
+			if err := session.UnpinNote(app.ctxt, noteID); err != nil {
+				log.WithError(err).WithFields(logtags).Errorf("Failed to unpin note '%s'", noteID)
+				return err
+			}
+			fmt.Printf("Unpinned note '%s'\n", noteID)
+		}
+		return nil
+	}
+}
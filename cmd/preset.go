@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/apex/log"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// chatSettingsCLIArgs cli arguments to give chat session request settings without prompting
+type chatSettingsCLIArgs struct {
+	// Model text generation model
+	Model string
+	// MaxTokens max tokens per response
+	MaxTokens int
+	// Temperature request temperature
+	Temperature float64
+	// TopP request TopP
+	TopP float64
+	// PresencePenalty request presence penalty
+	PresencePenalty float64
+	// FrequencyPenalty request frequency penalty
+	FrequencyPenalty float64
+	// Stop request stop sequences
+	Stop cli.StringSlice
+}
+
+// chatSettingsFlagNames names of the flags defined by chatSettingsCLIArgs
+var chatSettingsFlagNames = []string{
+	"model", "max-tokens", "temperature", "top-p", "presence-penalty", "frequency-penalty", "stop",
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *chatSettingsCLIArgs) getCLIFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "model",
+			Usage:       "Text generation model: [turbo davinci curie babbage ada]",
+			Aliases:     []string{"m"},
+			Destination: &c.Model,
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "max-tokens",
+			Usage:       "Max tokens per response",
+			Destination: &c.MaxTokens,
+			Required:    false,
+		},
+		&cli.Float64Flag{
+			Name:        "temperature",
+			Usage:       "Request temperature",
+			Destination: &c.Temperature,
+			Required:    false,
+		},
+		&cli.Float64Flag{
+			Name:        "top-p",
+			Usage:       "Request TopP",
+			Destination: &c.TopP,
+			Required:    false,
+		},
+		&cli.Float64Flag{
+			Name:        "presence-penalty",
+			Usage:       "Request presence penalty",
+			Destination: &c.PresencePenalty,
+			Required:    false,
+		},
+		&cli.Float64Flag{
+			Name:        "frequency-penalty",
+			Usage:       "Request frequency penalty",
+			Destination: &c.FrequencyPenalty,
+			Required:    false,
+		},
+		&cli.StringSliceFlag{
+			Name:        "stop",
+			Usage:       "Request stop sequence. Can be repeated, up to 4 times.",
+			Destination: &c.Stop,
+			Required:    false,
+		},
+	}
+}
+
+/*
+isSet whether any request setting was given on the CLI
+
+	@param ctx *cli.Context - CLI context
+	@return whether any request setting was given
+*/
+func (c *chatSettingsCLIArgs) isSet(ctx *cli.Context) bool {
+	for _, flag := range chatSettingsFlagNames {
+		if ctx.IsSet(flag) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+applyTo change the request settings given on the CLI, leaving the others as they are
+
+	@param ctx *cli.Context - CLI context
+	@param settings *persistence.ChatSessionParameters - the settings to change
+*/
+func (c *chatSettingsCLIArgs) applyTo(
+	ctx *cli.Context, settings *persistence.ChatSessionParameters,
+) {
+	float32Setting := func(value float64) *float32 {
+		result := float32(value)
+		return &result
+	}
+	if ctx.IsSet("model") {
+		settings.Model = c.Model
+	}
+	if ctx.IsSet("max-tokens") {
+		settings.MaxTokens = c.MaxTokens
+	}
+	if ctx.IsSet("temperature") {
+		settings.Temperature = float32Setting(c.Temperature)
+	}
+	if ctx.IsSet("top-p") {
+		settings.TopP = float32Setting(c.TopP)
+	}
+	if ctx.IsSet("presence-penalty") {
+		settings.PresencePenalty = float32Setting(c.PresencePenalty)
+	}
+	if ctx.IsSet("frequency-penalty") {
+		settings.FrequencyPenalty = float32Setting(c.FrequencyPenalty)
+	}
+	if ctx.IsSet("stop") {
+		settings.Stop = c.Stop.Value()
+	}
+}
+
+/*
+resolve determine the request settings from the CLI, or by prompting the user if none were
+given on the CLI
+
+	@param ctx *cli.Context - CLI context
+	@param currentSetting persistence.ChatSessionParameters - the settings to start from
+	@return the new settings
+*/
+func (c *chatSettingsCLIArgs) resolve(
+	ctx *cli.Context, currentSetting persistence.ChatSessionParameters,
+) (persistence.ChatSessionParameters, error) {
+	if c.isSet(ctx) {
+		c.applyTo(ctx, &currentSetting)
+		return currentSetting, nil
+	}
+	newSetting, err := askUserForChatRequestOptions(currentSetting)
+	if err != nil {
+		return currentSetting, err
+	}
+	currentSetting.MergeWithNewSettings(newSetting)
+	return currentSetting, nil
+}
+
+/*
+printPreset print a chat session preset as YAML
+
+	@param preset persistence.ChatSessionPreset - the preset
+*/
+func printPreset(preset persistence.ChatSessionPreset) {
+	t, _ := yaml.Marshal(&preset)
+	fmt.Printf("%s\n", t)
+}
+
+// ================================================================================
+
+// presetCLIArgs cli arguments to create or update a chat session preset
+type presetCLIArgs struct {
+	commonCLIArgs
+	chatSettingsCLIArgs
+	// Name preset name
+	Name string
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *presetCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:        "name",
+		Usage:       "Preset name",
+		Aliases:     []string{"n"},
+		Destination: &c.Name,
+		Required:    true,
+	})
+	cliFlags = append(cliFlags, c.chatSettingsCLIArgs.getCLIFlags()...)
+
+	return cliFlags
+}
+
+var createPresetParams presetCLIArgs
+
+/*
+actionCreatePreset record a new chat session preset
+
+The request settings are given on the CLI, starting from the user's default chat settings.
+Without any settings on the CLI, the user is prompted for them.
+
+	@param args *presetCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionCreatePreset(args *presetCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		defaultSetting, err := app.currentUser.GetDefaultChatSettings(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to read user's default chat settings")
+			return err
+		}
+
+		settings, err := args.resolve(ctx, defaultSetting)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to prompt user for parameters")
+			return err
+		}
+
+		preset := persistence.ChatSessionPreset{Name: args.Name, Settings: settings}
+		if err := chatManager.RecordPreset(app.ctxt, preset); err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Unable to record preset '%s'", args.Name)
+			return err
+		}
+		printPreset(preset)
+
+		return nil
+	}
+}
+
+var updatePresetParams presetCLIArgs
+
+/*
+actionUpdatePreset change the request settings of a chat session preset
+
+Only the request settings given on the CLI are changed. Without any settings on the CLI, the
+user is prompted for them.
+
+	@param args *presetCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionUpdatePreset(args *presetCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		preset, err := chatManager.GetPreset(app.ctxt, args.Name)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Unable to read preset '%s'", args.Name)
+			return err
+		}
+
+		if preset.Settings, err = args.resolve(ctx, preset.Settings); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to prompt user for parameters")
+			return err
+		}
+
+		if err := chatManager.UpdatePreset(app.ctxt, preset); err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Unable to update preset '%s'", args.Name)
+			return err
+		}
+		printPreset(preset)
+
+		return nil
+	}
+}
+
+// ================================================================================
+
+/*
+actionListPresets list the chat session presets of the active user
+
+	@param args *commonCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionListPresets(args *commonCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		presets, err := chatManager.ListPresets(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to list presets")
+			return err
+		}
+
+		// Display as YAML
+		t, _ := yaml.Marshal(&struct {
+			Presets []persistence.ChatSessionPreset `yaml:"presets"`
+		}{Presets: presets})
+
+		fmt.Printf("%s\n", t)
+
+		return nil
+	}
+}
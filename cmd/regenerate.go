@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alwitt/cli-gpt/api"
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/apex/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/manifoldco/promptui"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// regenerateChatActionCLIArgs cli arguments to regenerate the latest response of a chat session
+type regenerateChatActionCLIArgs struct {
+	commonCLIArgs
+	chatDisplayArgs
+	// SessionID the chat session ID. The active chat session is used if not given.
+	SessionID string
+	// Model model to use in place of the session model
+	Model string
+	// Temperature request temperature to use in place of the session temperature
+	Temperature float64
+}
+
+/*
+GetCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *regenerateChatActionCLIArgs) GetCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.StringFlag{
+			Name:        "session-id",
+			Usage:       "Target chat session ID. Defaults to the currently active chat session.",
+			Aliases:     []string{"i"},
+			EnvVars:     []string{"TARGET_SESSION_ID"},
+			Destination: &c.SessionID,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "model",
+			Usage:       "Use this model instead of the session model: [turbo davinci curie babbage ada]",
+			Aliases:     []string{"m"},
+			Destination: &c.Model,
+			Required:    false,
+		},
+		&cli.Float64Flag{
+			Name:        "temperature",
+			Usage:       "Use this request temperature instead of the session temperature",
+			Aliases:     []string{"t"},
+			DefaultText: "session temperature",
+			Destination: &c.Temperature,
+			Required:    false,
+		},
+	}...)
+	cliFlags = append(cliFlags, c.chatDisplayArgs.getCLIFlags()...)
+
+	return cliFlags
+}
+
+// RegenerateChatParams CLI arguments for regenerating the latest response of a chat session
+var RegenerateChatParams regenerateChatActionCLIArgs
+
+/*
+ActionRegenerateLatestResponse send the latest request of a chat session again, and record the
+response as a new variant of the latest exchange
+
+	@param args *regenerateChatActionCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func ActionRegenerateLatestResponse(args *regenerateChatActionCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		output, err := args.responseWriter()
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid output display options")
+			return err
+		}
+
+		session, err := selectedOrActiveSession(app, chatManager, args.SessionID)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Could not fetch chat session")
+			return err
+		}
+
+		// Apply the request parameter overrides
+		settings, err := session.Settings(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Session setting read failed")
+			return err
+		}
+		if ctx.IsSet("model") {
+			settings.Model = args.Model
+		}
+		if ctx.IsSet("temperature") {
+			temperature := float32(args.Temperature)
+			settings.Temperature = &temperature
+		}
+		if err := validator.New().Struct(&settings); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Request parameter overrides not valid")
+			return err
+		}
+
+		return streamChatRequest(
+			app, session, output, logtags,
+			func(chatHandler api.ChatSessionHandler, respChan chan string) error {
+				return chatHandler.RegenerateLatestResponse(app.ctxt, settings, respChan)
+			},
+		)
+	}
+}
+
+// ================================================================================
+
+// exchangeVariantCLIArgs cli arguments to work with the response variants of the latest exchange
+type exchangeVariantCLIArgs struct {
+	commonCLIArgs
+	// SessionID the chat session ID. The active chat session is used if not given.
+	SessionID string
+	// Variant the variant number, starting from 1
+	Variant int
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@param selection bool - whether a variant can be selected
+	@return the list of CLI arguments
+*/
+func (c *exchangeVariantCLIArgs) getCLIFlags(selection bool) []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:        "session-id",
+		Usage:       "Target chat session ID. Defaults to the currently active chat session.",
+		Aliases:     []string{"i"},
+		EnvVars:     []string{"TARGET_SESSION_ID"},
+		Destination: &c.SessionID,
+		Required:    false,
+	})
+	if selection {
+		cliFlags = append(cliFlags, &cli.IntFlag{
+			Name:        "variant",
+			Usage:       "Response variant number, as listed by 'get variants'",
+			Aliases:     []string{"n"},
+			DefaultText: "interactive selection",
+			Destination: &c.Variant,
+			Required:    false,
+		})
+	}
+
+	return cliFlags
+}
+
+var exchangeVariantParams exchangeVariantCLIArgs
+
+/*
+actionListExchangeVariants list the response variants of the latest exchange of a chat session
+
+	@param args *exchangeVariantCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionListExchangeVariants(args *exchangeVariantCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		session, err := selectedOrActiveSession(app, chatManager, args.SessionID)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Could not fetch chat session")
+			return err
+		}
+
+		variants, err := session.LatestExchangeVariants(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to read response variants")
+			return err
+		}
+
+		type variantDisplay struct {
+			Number                          int `yaml:"variant"`
+			persistence.ChatExchangeVariant `yaml:",inline"`
+		}
+		type toDisplay struct {
+			Variants []variantDisplay `yaml:"variants"`
+		}
+		display := toDisplay{Variants: []variantDisplay{}}
+		for idx, variant := range variants {
+			display.Variants = append(
+				display.Variants, variantDisplay{Number: idx + 1, ChatExchangeVariant: variant},
+			)
+		}
+
+		// Display as YAML
+		t, _ := yaml.Marshal(&display)
+
+		fmt.Printf("%s\n", t)
+
+		return nil
+	}
+}
+
+/*
+actionSelectExchangeVariant select the response variant of the latest exchange of a chat
+session, which is used as context for future requests
+
+	@param args *exchangeVariantCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionSelectExchangeVariant(args *exchangeVariantCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		session, err := selectedOrActiveSession(app, chatManager, args.SessionID)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Could not fetch chat session")
+			return err
+		}
+
+		selected := args.Variant - 1
+		if args.Variant == 0 {
+			variants, err := session.LatestExchangeVariants(app.ctxt)
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Error("Unable to read response variants")
+				return err
+			}
+			items := []string{}
+			for idx, variant := range variants {
+				response := strings.Join(strings.Fields(variant.Response), " ")
+				if runes := []rune(response); len(runes) > 80 {
+					response = string(runes[:80])
+				}
+				items = append(items, fmt.Sprintf("%d: %s", idx+1, response))
+			}
+			variantPrompt := promptui.Select{Label: "Select response variant", Items: items}
+			selected, _, err = variantPrompt.Run()
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Error("Response variant selection failure")
+				return err
+			}
+		}
+
+		if err := session.SelectLatestExchangeVariant(app.ctxt, selected); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to select response variant")
+			return err
+		}
+
+		return nil
+	}
+}
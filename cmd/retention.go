@@ -0,0 +1,511 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/alwitt/cli-gpt/transcript"
+	"github.com/apex/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// byteSizeUnits supported byte size units, largest first
+var byteSizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+/*
+parseByteSize parse a byte size such as "512", "64KB", or "1.5GB". Units are powers of 1024.
+
+	@param size string - the byte size
+	@return number of bytes
+*/
+func parseByteSize(size string) (int64, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(size))
+	scale := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(normalized, unit.suffix) {
+			normalized = strings.TrimSpace(strings.TrimSuffix(normalized, unit.suffix))
+			scale = unit.scale
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(normalized, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("'%s' is not a valid byte size", size)
+	}
+	return int64(value * float64(scale)), nil
+}
+
+/*
+formatByteSize format a number of bytes for display, e.g. "3.2 KB"
+
+	@param size int64 - number of bytes
+	@return the byte size for display
+*/
+func formatByteSize(size int64) string {
+	for _, unit := range byteSizeUnits {
+		if unit.scale > 1 && size >= unit.scale {
+			return fmt.Sprintf("%.1f %s", float64(size)/float64(unit.scale), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+/*
+printRetentionPolicy print a retention policy as YAML
+
+	@param policy persistence.RetentionPolicy - the retention policy
+*/
+func printRetentionPolicy(policy persistence.RetentionPolicy) {
+	type policyDisplay struct {
+		MaxAge      string `yaml:"max_age"`
+		MaxSessions string `yaml:"max_sessions"`
+		MaxDBSize   string `yaml:"max_db_size"`
+	}
+	display := policyDisplay{MaxAge: "none", MaxSessions: "none", MaxDBSize: "none"}
+	if policy.MaxAge > 0 {
+		display.MaxAge = policy.MaxAge.String()
+	}
+	if policy.MaxSessions > 0 {
+		display.MaxSessions = fmt.Sprintf("%d", policy.MaxSessions)
+	}
+	if policy.MaxDBSize > 0 {
+		display.MaxDBSize = formatByteSize(policy.MaxDBSize)
+	}
+
+	// Display as YAML
+	t, _ := yaml.Marshal(&struct {
+		Policy policyDisplay `yaml:"retention"`
+	}{Policy: display})
+
+	fmt.Printf("%s\n", t)
+}
+
+/*
+sessionsToPrune find the chat sessions of the active user which exceed their retention policy
+
+	@param chatManager persistence.ChatSessionManager - chat session manager
+	@return the chat sessions to prune, least recently used first
+*/
+func (c *applicationContext) sessionsToPrune(
+	chatManager persistence.ChatSessionManager,
+) ([]persistence.ChatSessionPruneCandidate, error) {
+	policy, err := c.currentUser.GetRetentionPolicy(c.ctxt)
+	if err != nil {
+		return nil, err
+	}
+	if !policy.IsEnforced() {
+		return nil, nil
+	}
+	// The DB size limit is not enforced without a DB file
+	var dbSize int64
+	if !c.config.Ephemeral {
+		fileInfo, err := os.Stat(c.config.SqliteDB)
+		if err != nil {
+			return nil, err
+		}
+		dbSize = fileInfo.Size()
+	}
+	return chatManager.SessionsToPrune(c.ctxt, policy, dbSize)
+}
+
+/*
+pruneSessions permanently delete chat sessions, or their old exchanges, then compact the DB
+file
+
+	@param chatManager persistence.ChatSessionManager - chat session manager
+	@param candidates []persistence.ChatSessionPruneCandidate - the chat sessions to prune
+*/
+func (c *applicationContext) pruneSessions(
+	chatManager persistence.ChatSessionManager,
+	candidates []persistence.ChatSessionPruneCandidate,
+) error {
+	if len(candidates) == 0 {
+		return nil
+	}
+	// Sessions still in use only have their old exchanges pruned
+	sessionIDs := []string{}
+	exchangeIDs := []string{}
+	for _, candidate := range candidates {
+		if len(candidate.ExchangeIDs) > 0 {
+			exchangeIDs = append(exchangeIDs, candidate.ExchangeIDs...)
+		} else {
+			sessionIDs = append(sessionIDs, candidate.SessionID)
+		}
+	}
+	if len(sessionIDs) > 0 {
+		if err := chatManager.PurgeSessions(c.ctxt, sessionIDs); err != nil {
+			return err
+		}
+	}
+	if len(exchangeIDs) > 0 {
+		if err := chatManager.PurgeExchanges(c.ctxt, exchangeIDs); err != nil {
+			return err
+		}
+	}
+	if c.config.Ephemeral {
+		return nil
+	}
+	return persistence.CompactSQLiteDB(c.ctxt, c.config.SqliteDB, c.sqlLogLevel)
+}
+
+// autoPrune prune the chat sessions of the active user which exceed their retention policy
+func (c *applicationContext) autoPrune() error {
+	logtags := c.GetLogTagsForContext(c.ctxt)
+
+	chatManager, err := c.currentUser.ChatSessionManager(c.ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Could not define chat session manager")
+		return err
+	}
+	candidates, err := c.sessionsToPrune(chatManager)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to find chat sessions to prune")
+		return err
+	}
+	if err := c.pruneSessions(chatManager, candidates); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to prune chat sessions")
+		return err
+	}
+	if len(candidates) > 0 {
+		log.WithFields(logtags).Infof("Pruned %s", describePruned(candidates))
+	}
+	return nil
+}
+
+/*
+describePruned summary of what pruning the chat sessions removes, e.g. "2 chat sessions and
+5 exchanges"
+
+	@param candidates []persistence.ChatSessionPruneCandidate - the chat sessions to prune
+	@return the summary
+*/
+func describePruned(candidates []persistence.ChatSessionPruneCandidate) string {
+	sessionCount := 0
+	exchangeCount := 0
+	for _, candidate := range candidates {
+		if len(candidate.ExchangeIDs) > 0 {
+			exchangeCount += len(candidate.ExchangeIDs)
+		} else {
+			sessionCount++
+		}
+	}
+	switch {
+	case exchangeCount == 0:
+		return fmt.Sprintf("%d chat sessions", sessionCount)
+	case sessionCount == 0:
+		return fmt.Sprintf("%d exchanges", exchangeCount)
+	default:
+		return fmt.Sprintf("%d chat sessions and %d exchanges", sessionCount, exchangeCount)
+	}
+}
+
+// ================================================================================
+
+/*
+actionGetRetentionPolicy print the retention policy of the active user
+
+	@param args *commonCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionGetRetentionPolicy(args *commonCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, err := args.initialSetup(validator.New(), "get-retention")
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		logtags := app.GetLogTagsForContext(app.ctxt)
+
+		if app.currentUser == nil {
+			return fmt.Errorf("no active user selected")
+		}
+
+		policy, err := app.currentUser.GetRetentionPolicy(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to read user's retention policy")
+			return err
+		}
+		printRetentionPolicy(policy)
+
+		return nil
+	}
+}
+
+// ================================================================================
+
+// updateRetentionCLIArgs cli arguments to update the retention policy of the active user
+type updateRetentionCLIArgs struct {
+	commonCLIArgs
+	// MaxAge prune chat exchanges made longer ago than this. Not enforced if zero.
+	MaxAge time.Duration `validate:"gte=0"`
+	// MaxSessions prune the least recently used chat sessions beyond this many. Not enforced
+	// if zero.
+	MaxSessions int `validate:"gte=0"`
+	// MaxDBSize prune the least recently used chat sessions while the DB is larger than this.
+	// Not enforced if zero.
+	MaxDBSize string
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *updateRetentionCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.DurationFlag{
+			Name:        "max-age",
+			Usage:       "Prune chat exchanges made longer ago than this, e.g. 2160h. Not enforced if 0",
+			Destination: &c.MaxAge,
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "max-sessions",
+			Usage:       "Prune the least recently used chat sessions beyond this many. Not enforced if 0",
+			Destination: &c.MaxSessions,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "max-db-size",
+			Usage:       "Prune the least recently used chat sessions while the DB is larger than this, e.g. 500MB. Not enforced if 0",
+			Destination: &c.MaxDBSize,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var updateRetentionParams updateRetentionCLIArgs
+
+/*
+actionUpdateRetentionPolicy update the retention policy of the active user
+
+	@param args *updateRetentionCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionUpdateRetentionPolicy(args *updateRetentionCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, err := args.initialSetup(validator.New(), "update-retention")
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		logtags := app.GetLogTagsForContext(app.ctxt)
+
+		if err := validator.New().Struct(args); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid retention policy")
+			return err
+		}
+
+		if app.currentUser == nil {
+			return fmt.Errorf("no active user selected")
+		}
+
+		policy, err := app.currentUser.GetRetentionPolicy(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to read user's retention policy")
+			return err
+		}
+		if ctx.IsSet("max-age") {
+			policy.MaxAge = args.MaxAge
+		}
+		if ctx.IsSet("max-sessions") {
+			policy.MaxSessions = args.MaxSessions
+		}
+		if ctx.IsSet("max-db-size") {
+			if policy.MaxDBSize, err = parseByteSize(args.MaxDBSize); err != nil {
+				log.WithError(err).WithFields(logtags).Error("Invalid retention policy")
+				return err
+			}
+		}
+
+		if err := app.currentUser.SetRetentionPolicy(app.ctxt, policy); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to update user's retention policy")
+			return err
+		}
+		printRetentionPolicy(policy)
+
+		return nil
+	}
+}
+
+// ================================================================================
+
+// dbPruneCLIArgs cli arguments to prune chat history exceeding the retention policy
+type dbPruneCLIArgs struct {
+	commonCLIArgs
+	// DryRun only list the chat sessions which would be pruned
+	DryRun bool
+	// Export file to export the pruned chat sessions to before they are deleted
+	Export string
+	// Format the export format
+	Format string `validate:"required,oneof=markdown json html"`
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *dbPruneCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "dry-run",
+			Usage:       "Only list the chat sessions which would be pruned",
+			Value:       false,
+			DefaultText: "false",
+			Destination: &c.DryRun,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "export",
+			Usage:       "Export the pruned chat sessions to this file before deleting them",
+			Aliases:     []string{"o"},
+			Destination: &c.Export,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name: "format",
+			Usage: fmt.Sprintf(
+				"Export format: [%s]", strings.Join(transcript.SupportedFormats(), " "),
+			),
+			Aliases:     []string{"f"},
+			Value:       string(transcript.FormatJSON),
+			DefaultText: string(transcript.FormatJSON),
+			Destination: &c.Format,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var dbPruneParams dbPruneCLIArgs
+
+/*
+actionPruneDB prune the chat sessions of the active user which exceed their retention policy
+
+	@param args *dbPruneCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionPruneDB(args *dbPruneCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		if err := validator.New().Struct(args); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid prune options")
+			return err
+		}
+
+		candidates, err := app.sessionsToPrune(chatManager)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to find chat sessions to prune")
+			return err
+		}
+		if len(candidates) == 0 {
+			fmt.Println("No chat sessions to prune")
+			return nil
+		}
+
+		type pruneDisplay struct {
+			SessionID    string `yaml:"id"`
+			LastActivity string `yaml:"last_activity"`
+			Size         string `yaml:"size"`
+			Reason       string `yaml:"reason"`
+			Trashed      bool   `yaml:"trashed,omitempty"`
+			Exchanges    int    `yaml:"exchanges,omitempty"`
+		}
+		displayEntries := []pruneDisplay{}
+		for _, candidate := range candidates {
+			displayEntries = append(displayEntries, pruneDisplay{
+				SessionID:    candidate.SessionID,
+				LastActivity: candidate.LastActivity.Local().Format(time.RFC3339),
+				Size:         formatByteSize(candidate.Size),
+				Reason:       string(candidate.Reason),
+				Trashed:      candidate.Trashed,
+				Exchanges:    len(candidate.ExchangeIDs),
+			})
+		}
+		t, _ := yaml.Marshal(&struct {
+			Sessions []pruneDisplay `yaml:"prune"`
+		}{Sessions: displayEntries})
+		fmt.Printf("%s\n", t)
+
+		if args.DryRun {
+			return nil
+		}
+
+		// Sessions in the trash were deleted by the user, so they are not exported. Only the
+		// pruned exchanges of sessions still in use are exported.
+		if args.Export != "" {
+			sessions := []persistence.ChatSession{}
+			for _, candidate := range candidates {
+				if candidate.Trashed {
+					continue
+				}
+				session, err := chatManager.GetSession(app.ctxt, candidate.SessionID)
+				if err != nil {
+					log.
+						WithError(err).
+						WithFields(logtags).
+						Errorf("Could not fetch chat session '%s'", candidate.SessionID)
+					return err
+				}
+				sessions = append(sessions, session)
+			}
+			export, err := transcript.DefineTranscript(app.ctxt, sessions)
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Error("Failed to read chat sessions for export")
+				return err
+			}
+			for _, candidate := range candidates {
+				if len(candidate.ExchangeIDs) > 0 {
+					export = export.OnlyExchanges(candidate.SessionID, candidate.ExchangeIDs)
+				}
+			}
+			if err := writeTranscript(
+				app, export, transcript.Format(args.Format), args.Export,
+			); err != nil {
+				log.WithError(err).WithFields(logtags).Error("Failed to export chat sessions to prune")
+				return err
+			}
+		}
+
+		if err := app.pruneSessions(chatManager, candidates); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to prune chat sessions")
+			return err
+		}
+		fmt.Printf("Pruned %s\n", describePruned(candidates))
+
+		return nil
+	}
+}
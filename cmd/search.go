@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alwitt/cli-gpt/display"
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/apex/log"
+	"github.com/urfave/cli/v2"
+)
+
+// searchExchangesCLIArgs cli arguments to search through recorded chat exchanges
+type searchExchangesCLIArgs struct {
+	commonCLIArgs
+	// SessionID only search this chat session
+	SessionID string
+	// Since only search exchanges made since this time
+	Since string
+	// Model only search chat sessions using this model
+	Model string
+	// Limit max number of results
+	Limit int
+}
+
+/*
+GetCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *searchExchangesCLIArgs) GetCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.StringFlag{
+			Name:        "session-id",
+			Usage:       "Only search this chat session",
+			Aliases:     []string{"i"},
+			Destination: &c.SessionID,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "since",
+			Usage:       "Only search exchanges since a date (2006-01-02), a time (RFC3339), or a duration ago (72h)",
+			Aliases:     []string{"s"},
+			Destination: &c.Since,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "model",
+			Usage:       "Only search chat sessions using this model",
+			Aliases:     []string{"m"},
+			Destination: &c.Model,
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "limit",
+			Usage:       "Max number of results",
+			Aliases:     []string{"n"},
+			Value:       persistence.DefaultSearchResultLimit,
+			DefaultText: fmt.Sprintf("%d", persistence.DefaultSearchResultLimit),
+			Destination: &c.Limit,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+// SearchExchangesParams CLI arguments for searching through chat exchanges
+var SearchExchangesParams searchExchangesCLIArgs
+
+/*
+parseSinceTime parse the user provided start time for a search
+
+	@param since string - a date, a RFC3339 time, or a duration before now
+	@return the start time
+*/
+func parseSinceTime(since string) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, since); err == nil {
+		return ts, nil
+	}
+	if ts, err := time.ParseInLocation("2006-01-02", since, time.Local); err == nil {
+		return ts, nil
+	}
+	if ago, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+	return time.Time{}, fmt.Errorf("unable to parse '%s' as a date, a time, or a duration", since)
+}
+
+/*
+ActionSearchExchanges search through recorded chat exchanges
+
+	@param args *searchExchangesCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func ActionSearchExchanges(args *searchExchangesCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		terms := strings.Join(ctx.Args().Slice(), " ")
+		if strings.TrimSpace(terms) == "" {
+			return fmt.Errorf("no search terms given")
+		}
+
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		query := persistence.ChatExchangeSearchQuery{
+			Terms: terms, Limit: args.Limit, HighlightStart: "**", HighlightEnd: "**",
+		}
+		if display.IsTerminal(os.Stdout) {
+			query.HighlightStart = "\x1b[1;33m"
+			query.HighlightEnd = "\x1b[0m"
+		}
+		if args.SessionID != "" {
+			query.SessionID = &args.SessionID
+		}
+		if args.Since != "" {
+			since, err := parseSinceTime(args.Since)
+			if err != nil {
+				return err
+			}
+			query.Since = &since
+		}
+		if args.Model != "" {
+			query.Model = &args.Model
+		}
+
+		results, err := chatManager.SearchExchanges(app.ctxt, query)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Chat exchange search failed")
+			return err
+		}
+
+		for _, oneResult := range results {
+			fmt.Printf(
+				"%s  [%s]\n  REQUEST:  %s\n  RESPONSE: %s\n\n",
+				oneResult.SessionID,
+				oneResult.RequestTimestamp.Local().Format("02 Jan 2006, 15:04:05"),
+				strings.Join(strings.Fields(oneResult.RequestSnippet), " "),
+				strings.Join(strings.Fields(oneResult.ResponseSnippet), " "),
+			)
+		}
+		if len(results) == 0 {
+			fmt.Println("No matching exchanges found")
+		}
+
+		return nil
+	}
+}
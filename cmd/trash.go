@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultPurgeTrashAfter how long deleted chat sessions stay in the trash by default
+const defaultPurgeTrashAfter = time.Hour * 24 * 30
+
+/*
+actionListTrash list chat sessions in the trash of the active user
+
+	@param args *commonCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionListTrash(args *commonCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		trash, err := chatManager.ListTrash(app.ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to list chat sessions in the trash")
+			return err
+		}
+
+		if len(trash) > 0 {
+			type trashDisplay struct {
+				SessionID     string `yaml:"id"`
+				Title         string `yaml:"title,omitempty"`
+				ExchangeCount int    `yaml:"exchanges"`
+				FirstRequest  string `yaml:"request"`
+				DeletedAt     string `yaml:"deleted_at"`
+			}
+			displayEntries := []trashDisplay{}
+			for _, oneSession := range trash {
+				displayEntry := trashDisplay{
+					SessionID:     oneSession.SessionID,
+					Title:         oneSession.Metadata.Title,
+					ExchangeCount: oneSession.ExchangeCount,
+					FirstRequest:  oneSession.FirstRequest,
+				}
+				if oneSession.DeletedAt != nil {
+					displayEntry.DeletedAt = oneSession.DeletedAt.Local().Format(time.RFC3339)
+				}
+				displayEntries = append(displayEntries, displayEntry)
+			}
+
+			type toDisplay struct {
+				AllSessions []trashDisplay `yaml:"trash"`
+			}
+
+			// Display as YAML
+			t, _ := yaml.Marshal(&toDisplay{AllSessions: displayEntries})
+
+			fmt.Printf("%s\n", t)
+		}
+
+		return nil
+	}
+}
+
+// ================================================================================
+
+// restoreChatSessionsCLIArgs cli arguments to restore chat sessions from the trash
+type restoreChatSessionsCLIArgs struct {
+	commonCLIArgs
+	// SessionIDs the chat session IDs to restore
+	SessionIDs cli.StringSlice
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *restoreChatSessionsCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "session-id",
+			Usage:       "Chat session ID to restore. Selected from the trash interactively if not given",
+			Aliases:     []string{"i"},
+			EnvVars:     []string{"TARGET_SESSION_ID"},
+			Destination: &c.SessionIDs,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var restoreChatSessionsParams restoreChatSessionsCLIArgs
+
+/*
+actionRestoreChatSession move chat sessions out of the trash
+
+	@param args *restoreChatSessionsCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionRestoreChatSession(args *restoreChatSessionsCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		sessionIDs := args.SessionIDs.Value()
+		if len(sessionIDs) == 0 {
+			trash, err := chatManager.ListTrash(app.ctxt)
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Error("Unable to list chat sessions in the trash")
+				return err
+			}
+			if len(trash) == 0 {
+				return fmt.Errorf("trash is empty")
+			}
+			sessionID, err := promptChatSessionSummary(trash, logtags)
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Error("Session selection failure")
+				return err
+			}
+			sessionIDs = []string{sessionID}
+		}
+
+		for _, sessionID := range sessionIDs {
+			if err := chatManager.RestoreSession(app.ctxt, sessionID); err != nil {
+				t, _ := json.Marshal(&sessionIDs)
+				log.
+					WithError(err).
+					WithFields(logtags).
+					Errorf("Unable to restore sessions %s", t)
+				return err
+			}
+			fmt.Printf("Restored chat session '%s'\n", sessionID)
+		}
+		return nil
+	}
+}
+
+// ================================================================================
+
+// emptyTrashCLIArgs cli arguments to permanently delete chat sessions in the trash
+type emptyTrashCLIArgs struct {
+	commonCLIArgs
+	// OlderThan only delete chat sessions which were in the trash for this long
+	OlderThan time.Duration `validate:"gte=0"`
+}
+
+/*
+getCLIFlags fetch the list of CLI arguments
+
+	@return the list of CLI arguments
+*/
+func (c *emptyTrashCLIArgs) getCLIFlags() []cli.Flag {
+	// Get the common CLI flags
+	cliFlags := c.GetCommonCLIFlags()
+
+	// Attach CLI arguments needed for this action
+	cliFlags = append(cliFlags, []cli.Flag{
+		&cli.DurationFlag{
+			Name:        "older-than",
+			Usage:       "Only delete chat sessions which were in the trash for this long, e.g. 168h",
+			Value:       0,
+			DefaultText: "0",
+			Destination: &c.OlderThan,
+			Required:    false,
+		},
+	}...)
+
+	return cliFlags
+}
+
+var emptyTrashParams emptyTrashCLIArgs
+
+/*
+actionEmptyTrash permanently delete chat sessions in the trash
+
+	@param args *emptyTrashCLIArgs - CLI arguments
+	@return the CLI action
+*/
+func actionEmptyTrash(args *emptyTrashCLIArgs) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		// Initialize application
+		app, logtags, chatManager, err := baseChatAppInitialization(args)
+		if err != nil {
+			log.WithError(err).Error("Failed to prepare new application")
+			return err
+		}
+
+		if err := validator.New().Struct(args); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid trash age")
+			return err
+		}
+
+		purged, err := chatManager.EmptyTrash(app.ctxt, args.OlderThan)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to empty the trash")
+			return err
+		}
+		fmt.Printf("Permanently deleted %d chat sessions\n", len(purged))
+		return nil
+	}
+}
@@ -0,0 +1,155 @@
+package display
+
+import (
+	"strings"
+)
+
+/*
+CodeBlock one fenced code block found in a markdown text
+*/
+type CodeBlock struct {
+	// Language the language named in the code fence info string
+	Language string
+	// Content the contents of the code block
+	Content string
+}
+
+// codeBlockFileExtensions file extensions associated with code fence languages
+var codeBlockFileExtensions = map[string]string{
+	"bash":       "sh",
+	"c":          "c",
+	"c++":        "cpp",
+	"cpp":        "cpp",
+	"csharp":     "cs",
+	"cs":         "cs",
+	"css":        "css",
+	"dockerfile": "dockerfile",
+	"go":         "go",
+	"golang":     "go",
+	"html":       "html",
+	"java":       "java",
+	"javascript": "js",
+	"js":         "js",
+	"json":       "json",
+	"kotlin":     "kt",
+	"makefile":   "mk",
+	"markdown":   "md",
+	"md":         "md",
+	"php":        "php",
+	"python":     "py",
+	"py":         "py",
+	"ruby":       "rb",
+	"rust":       "rs",
+	"scala":      "scala",
+	"sh":         "sh",
+	"shell":      "sh",
+	"sql":        "sql",
+	"swift":      "swift",
+	"toml":       "toml",
+	"ts":         "ts",
+	"typescript": "ts",
+	"xml":        "xml",
+	"yaml":       "yaml",
+	"yml":        "yaml",
+	"zsh":        "sh",
+}
+
+// DefaultCodeBlockFileExtension file extension for code blocks of unknown language
+const DefaultCodeBlockFileExtension = "txt"
+
+/*
+FileExtension infer the file extension of the code block from its language
+
+	@return file extension without the leading "."
+*/
+func (b CodeBlock) FileExtension() string {
+	if ext, ok := codeBlockFileExtensions[strings.ToLower(b.Language)]; ok {
+		return ext
+	}
+	return DefaultCodeBlockFileExtension
+}
+
+/*
+parseCodeFence parse a line as a code fence
+
+	@param line string - markdown line
+	@return the fence marker and the info string, or empty marker if line is not a code fence
+*/
+func parseCodeFence(line string) (string, string) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return "", ""
+	}
+	for _, fenceChar := range []string{"`", "~"} {
+		fenceLen := 0
+		for strings.HasPrefix(trimmed[fenceLen:], fenceChar) {
+			fenceLen++
+		}
+		if fenceLen >= 3 {
+			return trimmed[:fenceLen], strings.TrimSpace(trimmed[fenceLen:])
+		}
+	}
+	return "", ""
+}
+
+/*
+closesCodeFence check whether a markdown line closes an open code fence
+
+A closing fence must use the same character as the opening fence, be at least as long, and
+have no info string.
+
+	@param openFence string - the marker of the open code fence
+	@param line string - markdown line
+	@return whether the line closes the code fence
+*/
+func closesCodeFence(openFence string, line string) bool {
+	marker, info := parseCodeFence(line)
+	return marker != "" && info == "" && marker[0] == openFence[0] && len(marker) >= len(openFence)
+}
+
+/*
+ExtractCodeBlocks extract the fenced code blocks from a markdown text
+
+An unterminated code block is closed by the end of the text.
+
+	@param text string - markdown text
+	@return the code blocks in the order they appear in the text
+*/
+func ExtractCodeBlocks(text string) []CodeBlock {
+	result := []CodeBlock{}
+
+	var openFence string
+	var current CodeBlock
+	contentLines := []string{}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		marker, info := parseCodeFence(line)
+		if openFence == "" {
+			if marker != "" {
+				// Start of new code block
+				openFence = marker
+				current = CodeBlock{}
+				if fields := strings.Fields(info); len(fields) > 0 {
+					current.Language = fields[0]
+				}
+				contentLines = []string{}
+			}
+			continue
+		}
+		if closesCodeFence(openFence, line) {
+			current.Content = strings.Join(contentLines, "\n") + "\n"
+			result = append(result, current)
+			openFence = ""
+			continue
+		}
+		contentLines = append(contentLines, line)
+	}
+	if openFence != "" {
+		current.Content = strings.Join(contentLines, "\n")
+		if !strings.HasSuffix(current.Content, "\n") {
+			current.Content += "\n"
+		}
+		result = append(result, current)
+	}
+
+	return result
+}
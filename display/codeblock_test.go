@@ -0,0 +1,56 @@
+package display
+
+import (
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractCodeBlocks(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	// Case 0: no code blocks
+	assert.Len(ExtractCodeBlocks("Hello world\n\nNothing here"), 0)
+
+	// Case 1: multiple code blocks
+	{
+		text := "Here is the code:\n\n" +
+			"```go\npackage main\n\nfunc main() {}\n```\n\n" +
+			"And to run it:\n\n" +
+			"~~~~ shell\ngo run main.go\n~~~\n~~~~\n\n" +
+			"```\nplain text\n```\n"
+		blocks := ExtractCodeBlocks(text)
+		assert.Len(blocks, 3)
+
+		assert.Equal("go", blocks[0].Language)
+		assert.Equal("package main\n\nfunc main() {}\n", blocks[0].Content)
+		assert.Equal("go", blocks[0].FileExtension())
+
+		// A shorter fence does not close the block
+		assert.Equal("shell", blocks[1].Language)
+		assert.Equal("go run main.go\n~~~\n", blocks[1].Content)
+		assert.Equal("sh", blocks[1].FileExtension())
+
+		assert.Equal("", blocks[2].Language)
+		assert.Equal("plain text\n", blocks[2].Content)
+		assert.Equal(DefaultCodeBlockFileExtension, blocks[2].FileExtension())
+	}
+
+	// Case 2: unterminated code block
+	{
+		blocks := ExtractCodeBlocks("```Python\nprint('hello')")
+		assert.Len(blocks, 1)
+		assert.Equal("Python", blocks[0].Language)
+		assert.Equal("print('hello')\n", blocks[0].Content)
+		assert.Equal("py", blocks[0].FileExtension())
+	}
+
+	// Case 3: file extensions are lower case
+	{
+		blocks := ExtractCodeBlocks("```Dockerfile\nFROM scratch\n```\n")
+		assert.Len(blocks, 1)
+		assert.Equal("dockerfile", blocks[0].FileExtension())
+	}
+}
@@ -0,0 +1,156 @@
+package display
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// OutputFilterCollapseNewlines ENUM for output filter which collapses repeated newlines
+	OutputFilterCollapseNewlines = "collapse-newlines"
+	// OutputFilterTrimSpace ENUM for output filter which trims leading and trailing whitespace
+	OutputFilterTrimSpace = "trim-space"
+)
+
+/*
+OutputFilter transform model output before it is displayed to the user.
+
+Filters are only applied for display purposes. The output stored in persistence is always the
+raw model output.
+*/
+type OutputFilter func(text string) string
+
+// collapseNewlinesRegex matches repeated newlines
+var collapseNewlinesRegex = regexp.MustCompile(`(\r\n?|\n){2,}`)
+
+/*
+collapseNewlines collapse repeated newlines into a single newline
+
+	@param text string - text to process
+	@return processed text
+*/
+func collapseNewlines(text string) string {
+	return collapseNewlinesRegex.ReplaceAllString(text, "$1")
+}
+
+/*
+SupportedOutputFilters list the names of the supported output filters
+
+	@return list of output filter names
+*/
+func SupportedOutputFilters() []string {
+	return []string{OutputFilterCollapseNewlines, OutputFilterTrimSpace}
+}
+
+/*
+GetOutputFilter fetch an output filter by name
+
+	@param name string - output filter name
+	@return the output filter
+*/
+func GetOutputFilter(name string) (OutputFilter, error) {
+	switch name {
+	case OutputFilterCollapseNewlines:
+		return collapseNewlines, nil
+	case OutputFilterTrimSpace:
+		return strings.TrimSpace, nil
+	default:
+		return nil, fmt.Errorf("unknown output filter '%s'", name)
+	}
+}
+
+/*
+OutputFilterPipeline ordered list of output filters applied one after another
+*/
+type OutputFilterPipeline []OutputFilter
+
+/*
+DefineOutputFilterPipeline define an output filter pipeline from a list of filter names
+
+	@param names []string - output filter names, in the order they should be applied
+	@return the output filter pipeline
+*/
+func DefineOutputFilterPipeline(names []string) (OutputFilterPipeline, error) {
+	pipeline := OutputFilterPipeline{}
+	for _, name := range names {
+		filter, err := GetOutputFilter(name)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, filter)
+	}
+	return pipeline, nil
+}
+
+/*
+Apply run the text through all the filters in the pipeline
+
+	@param text string - text to process
+	@return processed text
+*/
+func (p OutputFilterPipeline) Apply(text string) string {
+	for _, filter := range p {
+		text = filter(text)
+	}
+	return text
+}
+
+/*
+streamFilter apply an output filter pipeline to a response as it is being streamed
+
+The filters apply to the whole response, so a segment can not be filtered on its own: trimming
+a segment would remove the spaces between words, and a run of newlines may be split across
+segments. Instead, the response received so far is filtered, and only the filtered text not yet
+written is returned. The supported filters only change whitespace, so the trailing whitespace
+is held back until more of the response is received.
+*/
+type streamFilter struct {
+	filter   OutputFilterPipeline
+	received strings.Builder
+	written  int
+}
+
+/*
+next filter the next response segment
+
+	@param segment string - response segment
+	@return the filtered text which can be written
+*/
+func (f *streamFilter) next(segment string) string {
+	if len(f.filter) == 0 {
+		return segment
+	}
+	f.received.WriteString(segment)
+	return f.unwritten(
+		strings.TrimRightFunc(f.filter.Apply(f.received.String()), unicode.IsSpace),
+	)
+}
+
+/*
+flush signal the response is complete
+
+	@return the remaining filtered text which was held back
+*/
+func (f *streamFilter) flush() string {
+	if len(f.filter) == 0 {
+		return ""
+	}
+	return f.unwritten(f.filter.Apply(f.received.String()))
+}
+
+/*
+unwritten helper function to return the part of the filtered response not yet written
+
+	@param filtered string - the filtered response received so far
+	@return the filtered text not yet written
+*/
+func (f *streamFilter) unwritten(filtered string) string {
+	if len(filtered) <= f.written {
+		return ""
+	}
+	result := filtered[f.written:]
+	f.written = len(filtered)
+	return result
+}
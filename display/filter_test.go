@@ -0,0 +1,43 @@
+package display
+
+import (
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputFilterPipeline(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	// Case 0: unknown filter
+	{
+		_, err := DefineOutputFilterPipeline([]string{"not-a-filter"})
+		assert.NotNil(err)
+	}
+
+	// Case 1: empty pipeline returns the text verbatim
+	{
+		uut, err := DefineOutputFilterPipeline([]string{})
+		assert.Nil(err)
+		testText := "\n```go\nfunc main() {\n\n\tprint(\"hello\")\n}\n```\n\n"
+		assert.Equal(testText, uut.Apply(testText))
+	}
+
+	// Case 2: collapse newlines
+	{
+		uut, err := DefineOutputFilterPipeline([]string{OutputFilterCollapseNewlines})
+		assert.Nil(err)
+		assert.Equal("a\nb\r\nc\n", uut.Apply("a\n\n\nb\r\n\r\nc\n"))
+	}
+
+	// Case 3: multiple filters are applied in order
+	{
+		uut, err := DefineOutputFilterPipeline(
+			[]string{OutputFilterCollapseNewlines, OutputFilterTrimSpace},
+		)
+		assert.Nil(err)
+		assert.Equal("a\nb", uut.Apply("\n\na\n\nb\n\n"))
+	}
+}
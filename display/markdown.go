@@ -0,0 +1,94 @@
+package display
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+)
+
+/*
+TextRenderer render text for display on a terminal
+*/
+type TextRenderer interface {
+	/*
+		Render render the text
+
+			@param text string - text to render
+			@return the rendered text
+	*/
+	Render(text string) (string, error)
+}
+
+// markdownRenderer render markdown for terminal display
+type markdownRenderer struct {
+	renderer *glamour.TermRenderer
+}
+
+/*
+DefineMarkdownRenderer define a terminal markdown renderer
+
+The renderer supports code fence syntax highlighting and tables, and will wrap the text
+to the terminal width.
+
+	@param width int - terminal width to wrap the rendered text to
+	@return markdown renderer
+*/
+func DefineMarkdownRenderer(width int) (TextRenderer, error) {
+	renderer, err := glamour.NewTermRenderer(
+		glamour.WithAutoStyle(), glamour.WithWordWrap(width),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &markdownRenderer{renderer: renderer}, nil
+}
+
+/*
+Render render the text
+
+	@param text string - markdown text to render
+	@return the rendered text
+*/
+func (r *markdownRenderer) Render(text string) (string, error) {
+	return r.renderer.Render(text)
+}
+
+/*
+splitCompletedBlocks split streamed markdown text into the portion made up of complete
+markdown blocks, and the remainder which is still being streamed.
+
+A block is complete once it is followed by a blank line outside of a code fence, or when
+its code fence is closed.
+
+	@param text string - streamed markdown text
+	@return the completed blocks, and the remaining text
+*/
+func splitCompletedBlocks(text string) (string, string) {
+	var openFence string
+	completedEnd := 0
+	offset := 0
+	for {
+		lineEnd := strings.IndexByte(text[offset:], '\n')
+		if lineEnd < 0 {
+			// Last line is not complete yet
+			break
+		}
+		line := text[offset : offset+lineEnd]
+		offset += lineEnd + 1
+		if openFence != "" {
+			if closesCodeFence(openFence, line) {
+				openFence = ""
+				completedEnd = offset
+			}
+			continue
+		}
+		if marker, _ := parseCodeFence(line); marker != "" {
+			openFence = marker
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			completedEnd = offset
+		}
+	}
+	return text[:completedEnd], text[completedEnd:]
+}
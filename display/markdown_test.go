@@ -0,0 +1,201 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCompletedMarkdownBlocks(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	type testCase struct {
+		input     string
+		completed string
+		remainder string
+	}
+
+	testCases := []testCase{
+		// Nothing complete
+		{input: "Hello wor", completed: "", remainder: "Hello wor"},
+		{input: "Hello world\nsecond line", completed: "", remainder: "Hello world\nsecond line"},
+		// Paragraph complete
+		{input: "Hello world\n\nNext", completed: "Hello world\n\n", remainder: "Next"},
+		// Blank lines inside code fence do not complete the block
+		{
+			input:     "```go\nfunc main() {\n\n\tprint(1)\n",
+			completed: "",
+			remainder: "```go\nfunc main() {\n\n\tprint(1)\n",
+		},
+		// Closing fence completes the block
+		{
+			input:     "```go\nfunc main() {\n\n}\n```\nAfter",
+			completed: "```go\nfunc main() {\n\n}\n```\n",
+			remainder: "After",
+		},
+		// A fence with an info string inside an open fence does not close it
+		{
+			input:     "````markdown\nExample:\n```go\n\nfunc main() {}\n```\n\nMore",
+			completed: "",
+			remainder: "````markdown\nExample:\n```go\n\nfunc main() {}\n```\n\nMore",
+		},
+		{
+			input:     "````markdown\n```go\nfunc main() {}\n```\n````\nAfter",
+			completed: "````markdown\n```go\nfunc main() {}\n```\n````\n",
+			remainder: "After",
+		},
+		{
+			input:     "```\n```go\nfunc main() {}\n```\nAfter",
+			completed: "```\n```go\nfunc main() {}\n```\n",
+			remainder: "After",
+		},
+	}
+
+	for idx, oneCase := range testCases {
+		completed, remainder := splitCompletedBlocks(oneCase.input)
+		assert.Equalf(oneCase.completed, completed, "case %d", idx)
+		assert.Equalf(oneCase.remainder, remainder, "case %d", idx)
+	}
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	uut, err := DefineMarkdownRenderer(60)
+	assert.Nil(err)
+
+	rendered, err := uut.Render("# Title\n\n```go\nfunc main() {}\n```\n\n| a | b |\n|---|---|\n| 1 | 2 |\n")
+	assert.Nil(err)
+	assert.Contains(rendered, "Title")
+	assert.Contains(rendered, "main")
+	for _, oneLine := range strings.Split(rendered, "\n") {
+		assert.LessOrEqual(terminalRows(stripANSI(oneLine), 60), 1)
+	}
+}
+
+// testRenderer dummy renderer which marks the rendered text
+type testRenderer struct{}
+
+func (r testRenderer) Render(text string) (string, error) {
+	return fmt.Sprintf("<%s>", text), nil
+}
+
+// stripANSI remove ANSI escape sequences from a string
+func stripANSI(text string) string {
+	builder := strings.Builder{}
+	inEscape := false
+	for _, char := range text {
+		if char == '\x1b' {
+			inEscape = true
+			continue
+		}
+		if inEscape {
+			if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') {
+				inEscape = false
+			}
+			continue
+		}
+		builder.WriteRune(char)
+	}
+	return builder.String()
+}
+
+func TestMarkdownResponseWriter(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	output := bytes.Buffer{}
+	uut := DefineMarkdownResponseWriter(&output, OutputFilterPipeline{}, testRenderer{}, 80)
+
+	// Case 0: incomplete block is echoed
+	assert.Nil(uut.WriteSegment("Hello "))
+	assert.Equal("Hello ", output.String())
+	output.Reset()
+
+	// Case 1: block completes, echo is replaced by the rendered block
+	assert.Nil(uut.WriteSegment("world\n\nNext"))
+	assert.Equal("\r\x1b[J<Hello world\n\n>Next", output.String())
+	output.Reset()
+
+	// Case 2: closing renders the remainder
+	assert.Nil(uut.Close())
+	assert.Equal("\r\x1b[J<Next>", output.String())
+	output.Reset()
+
+	// Case 3: multi-line echo is erased
+	uut = DefineMarkdownResponseWriter(&output, OutputFilterPipeline{}, testRenderer{}, 80)
+	assert.Nil(uut.WriteSegment("```\nline 1\n\n"))
+	assert.Nil(uut.WriteSegment("```\n"))
+	assert.Equal("```\nline 1\n\n\r\x1b[3A\x1b[J<```\nline 1\n\n```\n>", output.String())
+}
+
+func TestRawResponseWriter(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	output := bytes.Buffer{}
+	filter, err := DefineOutputFilterPipeline([]string{OutputFilterCollapseNewlines})
+	assert.Nil(err)
+	uut := DefineRawResponseWriter(&output, filter)
+
+	assert.Nil(uut.WriteSegment("a\n\n\nb"))
+	assert.Nil(uut.Close())
+	assert.Equal("a\nb", output.String())
+}
+
+func TestResponseWriterFilterStreamedSegments(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	// The filters apply to the whole response, not to each segment
+	filter, err := DefineOutputFilterPipeline(
+		[]string{OutputFilterCollapseNewlines, OutputFilterTrimSpace},
+	)
+	assert.Nil(err)
+	segments := []string{"\n\n", "Hello", " ", "world", "\n", "\n\n", "Next", " line", "\n\n"}
+
+	// Case 0: raw output
+	{
+		output := bytes.Buffer{}
+		uut := DefineRawResponseWriter(&output, filter)
+		for _, segment := range segments {
+			assert.Nil(uut.WriteSegment(segment))
+		}
+		assert.Equal("Hello world\nNext line", output.String())
+		assert.Nil(uut.Close())
+		assert.Equal("Hello world\nNext line", output.String())
+	}
+
+	// Case 1: trailing whitespace is written once the response is complete
+	{
+		collapseFilter, err := DefineOutputFilterPipeline([]string{OutputFilterCollapseNewlines})
+		assert.Nil(err)
+		output := bytes.Buffer{}
+		uut := DefineRawResponseWriter(&output, collapseFilter)
+		for _, segment := range segments {
+			assert.Nil(uut.WriteSegment(segment))
+		}
+		assert.Equal("\nHello world\nNext line", output.String())
+		assert.Nil(uut.Close())
+		assert.Equal("\nHello world\nNext line\n", output.String())
+	}
+
+	// Case 2: markdown output
+	{
+		output := bytes.Buffer{}
+		uut := DefineMarkdownResponseWriter(&output, filter, testRenderer{}, 80)
+		for _, segment := range segments {
+			assert.Nil(uut.WriteSegment(segment))
+		}
+		assert.Equal("Hello world\nNext line", output.String())
+		output.Reset()
+		assert.Nil(uut.Close())
+		assert.Equal("\r\x1b[1A\x1b[J<Hello world\nNext line>", output.String())
+	}
+}
@@ -0,0 +1,227 @@
+package display
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// DefaultTerminalWidth terminal width to use if it can not be determined
+const DefaultTerminalWidth = 80
+
+/*
+IsTerminal check whether a file is a terminal
+
+	@param file *os.File - the file to check
+	@return whether the file is a terminal
+*/
+func IsTerminal(file *os.File) bool {
+	return term.IsTerminal(int(file.Fd()))
+}
+
+/*
+TerminalWidth get the width of the terminal
+
+	@param file *os.File - the terminal file
+	@return terminal width, or DefaultTerminalWidth if it can not be determined
+*/
+func TerminalWidth(file *os.File) int {
+	width, _, err := term.GetSize(int(file.Fd()))
+	if err != nil || width <= 0 {
+		return DefaultTerminalWidth
+	}
+	return width
+}
+
+/*
+ResponseWriter write a model response to the user as it is being streamed
+*/
+type ResponseWriter interface {
+	/*
+		WriteSegment write the next response segment
+
+			@param segment string - response segment
+	*/
+	WriteSegment(segment string) error
+
+	/*
+		Close signal the response is complete, and flush any remaining output
+	*/
+	Close() error
+}
+
+// rawResponseWriter writes the response segments as is
+type rawResponseWriter struct {
+	out    io.Writer
+	filter streamFilter
+}
+
+/*
+DefineRawResponseWriter define a response writer which outputs the response segments as is
+
+	@param out io.Writer - output to write to
+	@param filter OutputFilterPipeline - output filters to apply to the response
+	@return response writer
+*/
+func DefineRawResponseWriter(out io.Writer, filter OutputFilterPipeline) ResponseWriter {
+	return &rawResponseWriter{out: out, filter: streamFilter{filter: filter}}
+}
+
+/*
+WriteSegment write the next response segment
+
+	@param segment string - response segment
+*/
+func (w *rawResponseWriter) WriteSegment(segment string) error {
+	_, err := io.WriteString(w.out, w.filter.next(segment))
+	return err
+}
+
+/*
+Close signal the response is complete, and flush any remaining output
+*/
+func (w *rawResponseWriter) Close() error {
+	_, err := io.WriteString(w.out, w.filter.flush())
+	return err
+}
+
+/*
+markdownResponseWriter renders the response as markdown while it is being streamed.
+
+Segments are echoed as is when received. Once a markdown block is complete, the echoed text
+is erased and replaced with the rendered block.
+*/
+type markdownResponseWriter struct {
+	out      io.Writer
+	filter   streamFilter
+	renderer TextRenderer
+	width    int
+	pending  string
+}
+
+/*
+DefineMarkdownResponseWriter define a response writer which renders the response as markdown
+
+The output is expected to be a terminal which supports ANSI escape sequences.
+
+	@param out io.Writer - terminal to write to
+	@param filter OutputFilterPipeline - output filters to apply to the response
+	@param renderer TextRenderer - markdown renderer
+	@param width int - terminal width
+	@return response writer
+*/
+func DefineMarkdownResponseWriter(
+	out io.Writer, filter OutputFilterPipeline, renderer TextRenderer, width int,
+) ResponseWriter {
+	if width <= 0 {
+		width = DefaultTerminalWidth
+	}
+	return &markdownResponseWriter{
+		out: out, filter: streamFilter{filter: filter}, renderer: renderer, width: width,
+	}
+}
+
+/*
+terminalRows count the number of terminal rows the text occupies once printed
+
+	@param text string - printed text
+	@param width int - terminal width
+	@return number of terminal rows
+*/
+func terminalRows(text string, width int) int {
+	rows := 0
+	for _, line := range strings.Split(text, "\n") {
+		lineWidth := runewidth.StringWidth(strings.ReplaceAll(line, "\t", "        "))
+		if lineWidth == 0 {
+			rows++
+		} else {
+			rows += (lineWidth + width - 1) / width
+		}
+	}
+	return rows
+}
+
+// erasePending erase the echoed text which has not been rendered yet
+func (w *markdownResponseWriter) erasePending() error {
+	if w.pending == "" {
+		return nil
+	}
+	builder := strings.Builder{}
+	builder.WriteString("\r")
+	if rows := terminalRows(w.pending, w.width); rows > 1 {
+		builder.WriteString(fmt.Sprintf("\x1b[%dA", rows-1))
+	}
+	builder.WriteString("\x1b[J")
+	_, err := io.WriteString(w.out, builder.String())
+	return err
+}
+
+/*
+WriteSegment write the next response segment
+
+	@param segment string - response segment
+*/
+func (w *markdownResponseWriter) WriteSegment(segment string) error {
+	return w.writeFiltered(w.filter.next(segment))
+}
+
+/*
+writeFiltered write the next part of the filtered response
+
+	@param segment string - filtered response segment
+*/
+func (w *markdownResponseWriter) writeFiltered(segment string) error {
+	if segment == "" {
+		return nil
+	}
+
+	completed, remainder := splitCompletedBlocks(w.pending + segment)
+	if completed == "" {
+		// Echo the segment until the block is complete
+		if _, err := io.WriteString(w.out, segment); err != nil {
+			return err
+		}
+		w.pending += segment
+		return nil
+	}
+
+	// Replace the echoed text with the rendered blocks
+	if err := w.erasePending(); err != nil {
+		return err
+	}
+	rendered, err := w.renderer.Render(completed)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w.out, rendered+remainder); err != nil {
+		return err
+	}
+	w.pending = remainder
+	return nil
+}
+
+/*
+Close signal the response is complete, and flush any remaining output
+*/
+func (w *markdownResponseWriter) Close() error {
+	if err := w.writeFiltered(w.filter.flush()); err != nil {
+		return err
+	}
+	if strings.TrimSpace(w.pending) == "" {
+		return nil
+	}
+	if err := w.erasePending(); err != nil {
+		return err
+	}
+	rendered, err := w.renderer.Render(w.pending)
+	if err != nil {
+		return err
+	}
+	w.pending = ""
+	_, err = io.WriteString(w.out, rendered)
+	return err
+}
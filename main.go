@@ -50,6 +50,48 @@ func main() {
 				Description: "Delete recorded resources",
 				Subcommands: cmd.GenerateDeleteSubcommands(),
 			},
+			{
+				Name:        "restore",
+				Usage:       "Restore resources",
+				Description: "Restore deleted resources",
+				Subcommands: cmd.GenerateRestoreSubcommands(),
+			},
+			{
+				Name:        "empty",
+				Usage:       "Empty the trash",
+				Description: "Permanently delete resources in the trash",
+				Subcommands: cmd.GenerateEmptySubcommands(),
+			},
+			{
+				Name:        "extract",
+				Usage:       "Extract content",
+				Description: "Extract content from recorded resources",
+				Subcommands: cmd.GenerateExtractSubcommands(),
+			},
+			{
+				Name:        "export",
+				Usage:       "Export content",
+				Description: "Export recorded resources for sharing",
+				Subcommands: cmd.GenerateExportSubcommands(),
+			},
+			{
+				Name:        "import",
+				Usage:       "Import content",
+				Description: "Import resources recorded elsewhere",
+				Subcommands: cmd.GenerateImportSubcommands(),
+			},
+			{
+				Name:        "pin",
+				Usage:       "Pinned notes",
+				Description: "Manage notes pinned to a chat session",
+				Subcommands: cmd.GeneratePinSubcommands(),
+			},
+			{
+				Name:        "db",
+				Usage:       "DB maintenance",
+				Description: "Persistence DB maintenance",
+				Subcommands: cmd.GenerateDBSubcommands(),
+			},
 			{
 				Name:        "context",
 				Usage:       "Context settings",
@@ -61,8 +103,30 @@ func main() {
 				Name:        "chat",
 				Usage:       "Append to currently active chat session",
 				Description: "Append new exchange to currently active chat session of selected user",
-				Flags:       cmd.CommonParams.GetCommonCLIFlags(),
-				Action:      cmd.ActionAppendToChatSession(&cmd.CommonParams),
+				Flags:       cmd.AppendChatParams.GetCLIFlags(),
+				Action:      cmd.ActionAppendToChatSession(&cmd.AppendChatParams),
+			},
+			{
+				Name:        "amend",
+				Usage:       "Amend and resend the latest request",
+				Description: "Edit the latest request of a chat session in $EDITOR, or inline, and resend it in place of the latest exchange",
+				Flags:       cmd.AmendChatParams.GetCLIFlags(),
+				Action:      cmd.ActionAmendLatestRequest(&cmd.AmendChatParams),
+			},
+			{
+				Name:        "regenerate",
+				Usage:       "Regenerate the latest response",
+				Description: "Send the latest request again, and keep the new response as a variant of the latest exchange",
+				Flags:       cmd.RegenerateChatParams.GetCLIFlags(),
+				Action:      cmd.ActionRegenerateLatestResponse(&cmd.RegenerateChatParams),
+			},
+			{
+				Name:        "search",
+				Usage:       "Search chat exchanges",
+				Description: "Search through the exchanges of all chat sessions of the selected user",
+				ArgsUsage:   "\"search terms\"",
+				Flags:       cmd.SearchExchangesParams.GetCLIFlags(),
+				Action:      cmd.ActionSearchExchanges(&cmd.SearchExchangesParams),
 			},
 		},
 	}
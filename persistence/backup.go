@@ -0,0 +1,301 @@
+package persistence
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apex/log"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	// encryptedBackupMagic prefix marking an encrypted backup
+	encryptedBackupMagic = "cli-gpt-backup-enc:v1\n"
+	// gzipMagic prefix marking a gzip compressed backup
+	gzipMagic = "\x1f\x8b"
+	// sqliteMagic prefix of every sqlite DB file
+	sqliteMagic = "SQLite format 3\x00"
+)
+
+/*
+BackupSQLiteDB write a consistent copy of a sqlite DB to a new file, and verify the copy
+
+The copy is made with "VACUUM INTO", so it is safe to take while the DB is in use.
+
+	@param ctxt context.Context - query context
+	@param dbFile string - sqlite DB file to backup
+	@param backupFile string - file to write the copy to. It must not exist.
+	@param logLevel logger.LogLevel - SQL log level
+	@return schema version of the copy
+*/
+func BackupSQLiteDB(
+	ctxt context.Context, dbFile, backupFile string, logLevel logger.LogLevel,
+) (int, error) {
+	logtags := log.Fields{"module": "persistence", "component": "backup", "instance": "sqlite"}
+
+	db, err := openSQLDB(GetSqliteDialector(dbFile), logLevel)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Unable to open '%s'", dbFile)
+		return 0, err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer func() {
+			_ = sqlDB.Close()
+		}()
+	}
+	if tmp := db.WithContext(ctxt).Exec("VACUUM INTO ?", backupFile); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Errorf("Unable to copy '%s'", dbFile)
+		return 0, tmp.Error
+	}
+
+	return VerifySQLiteDB(ctxt, backupFile, logLevel)
+}
+
+/*
+CompactSQLiteDB rebuild a sqlite DB file to return the space of deleted records to the
+file system
+
+	@param ctxt context.Context - query context
+	@param dbFile string - sqlite DB file
+	@param logLevel logger.LogLevel - SQL log level
+*/
+func CompactSQLiteDB(ctxt context.Context, dbFile string, logLevel logger.LogLevel) error {
+	logtags := log.Fields{"module": "persistence", "component": "backup", "instance": "sqlite"}
+
+	db, err := openSQLDB(GetSqliteDialector(dbFile), logLevel)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Unable to open '%s'", dbFile)
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer func() {
+			_ = sqlDB.Close()
+		}()
+	}
+	if tmp := db.WithContext(ctxt).Exec("VACUUM"); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Errorf("Unable to compact '%s'", dbFile)
+		return tmp.Error
+	}
+	return nil
+}
+
+/*
+CheckpointSQLiteDB move the content of the write-ahead log into the sqlite DB file, so the
+DB file alone holds all the data
+
+	@param ctxt context.Context - query context
+	@param dbFile string - sqlite DB file
+	@param logLevel logger.LogLevel - SQL log level
+*/
+func CheckpointSQLiteDB(ctxt context.Context, dbFile string, logLevel logger.LogLevel) error {
+	logtags := log.Fields{"module": "persistence", "component": "backup", "instance": "sqlite"}
+
+	db, err := openSQLDB(GetSqliteDialector(dbFile), logLevel)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Unable to open '%s'", dbFile)
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer func() {
+			_ = sqlDB.Close()
+		}()
+	}
+	if tmp := db.WithContext(ctxt).Exec("PRAGMA wal_checkpoint(TRUNCATE)"); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Errorf("Unable to checkpoint '%s'", dbFile)
+		return tmp.Error
+	}
+	return nil
+}
+
+/*
+VerifySQLiteDB verify a sqlite DB file is an intact persistence DB which this build supports
+
+	@param ctxt context.Context - query context
+	@param dbFile string - sqlite DB file
+	@param logLevel logger.LogLevel - SQL log level
+	@return schema version of the DB
+*/
+func VerifySQLiteDB(ctxt context.Context, dbFile string, logLevel logger.LogLevel) (int, error) {
+	logtags := log.Fields{"module": "persistence", "component": "backup", "instance": "sqlite"}
+
+	db, err := openSQLDB(GetSqliteDialector(dbFile), logLevel)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Unable to open '%s'", dbFile)
+		return 0, err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer func() {
+			_ = sqlDB.Close()
+		}()
+	}
+	db = db.WithContext(ctxt)
+
+	var problems []string
+	if tmp := db.Raw("PRAGMA integrity_check").Scan(&problems); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Errorf("Integrity check of '%s' failed", dbFile)
+		return 0, tmp.Error
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return 0, fmt.Errorf("'%s' is corrupted: %s", dbFile, strings.Join(problems, "; "))
+	}
+
+	// Do not create the migration table in a file which is not a persistence DB
+	if !db.Migrator().HasTable(&sqlSchemaMigrationEntry{}) {
+		return 0, fmt.Errorf("'%s' is not a persistence DB", dbFile)
+	}
+	migrator, err := defineSQLSchemaMigrator(db)
+	if err != nil {
+		return 0, err
+	}
+	version, err := migrator.SchemaVersion(ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Unable to read '%s' schema version", dbFile)
+		return 0, err
+	}
+	if version > LatestSQLSchemaVersion() {
+		return version, fmt.Errorf(
+			"'%s' schema version %d is newer than the supported version %d",
+			dbFile,
+			version,
+			LatestSQLSchemaVersion(),
+		)
+	}
+	return version, nil
+}
+
+/*
+BackupEncoding how a backup is encoded before it is written out
+*/
+type BackupEncoding struct {
+	// Compress whether to gzip compress the backup
+	Compress bool
+	// Passphrase encrypt the backup with a key derived from this passphrase. The backup is not
+	// encrypted if nil.
+	Passphrase PassphraseSource
+}
+
+/*
+EncodeBackup compress and encrypt a sqlite DB image
+
+The DB image is compressed first, then encrypted with AES-256-GCM, using a key derived with
+scrypt from the passphrase and a random salt.
+
+	@param dbImage []byte - contents of the sqlite DB file
+	@param encoding BackupEncoding - how to encode the backup
+	@return the encoded backup
+*/
+func EncodeBackup(dbImage []byte, encoding BackupEncoding) ([]byte, error) {
+	result := dbImage
+
+	if encoding.Compress {
+		compressed := bytes.Buffer{}
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(result); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		result = compressed.Bytes()
+	}
+
+	if encoding.Passphrase != nil {
+		passphrase, err := encoding.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if passphrase == "" {
+			return nil, fmt.Errorf("backup passphrase can not be empty")
+		}
+		salt := make([]byte, secretSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		aead, err := derivePassphraseKey(passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		encrypted := append([]byte(encryptedBackupMagic), salt...)
+		encrypted = append(encrypted, nonce...)
+		result = aead.Seal(encrypted, nonce, result, []byte(encryptedBackupMagic))
+	}
+
+	return result, nil
+}
+
+/*
+IsEncryptedBackup check whether a backup is encrypted
+
+	@param backup []byte - the backup
+	@return whether the backup is encrypted
+*/
+func IsEncryptedBackup(backup []byte) bool {
+	return bytes.HasPrefix(backup, []byte(encryptedBackupMagic))
+}
+
+/*
+DecodeBackup decrypt and decompress a backup written by EncodeBackup
+
+	@param backup []byte - the backup
+	@param passphrase PassphraseSource - source of the backup passphrase. Only queried if the
+	    backup is encrypted.
+	@return contents of the sqlite DB file
+*/
+func DecodeBackup(backup []byte, passphrase PassphraseSource) ([]byte, error) {
+	result := backup
+
+	if IsEncryptedBackup(result) {
+		if passphrase == nil {
+			return nil, fmt.Errorf("backup is encrypted, but no passphrase given")
+		}
+		thePassphrase, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		payload := result[len(encryptedBackupMagic):]
+		if len(payload) < secretSaltLen {
+			return nil, fmt.Errorf("malformed encrypted backup")
+		}
+		aead, err := derivePassphraseKey(thePassphrase, payload[:secretSaltLen])
+		if err != nil {
+			return nil, err
+		}
+		payload = payload[secretSaltLen:]
+		if len(payload) < aead.NonceSize() {
+			return nil, fmt.Errorf("malformed encrypted backup")
+		}
+		result, err = aead.Open(
+			nil,
+			payload[:aead.NonceSize()],
+			payload[aead.NonceSize():],
+			[]byte(encryptedBackupMagic),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt backup, wrong passphrase?")
+		}
+	}
+
+	if bytes.HasPrefix(result, []byte(gzipMagic)) {
+		reader, err := gzip.NewReader(bytes.NewReader(result))
+		if err != nil {
+			return nil, err
+		}
+		if result, err = io.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
+
+	if !bytes.HasPrefix(result, []byte(sqliteMagic)) {
+		return nil, fmt.Errorf("backup is not a sqlite DB")
+	}
+	return result, nil
+}
@@ -0,0 +1,169 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/logger"
+)
+
+func TestSQLiteBackup(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	utContext := context.Background()
+
+	testDB := fmt.Sprintf("/tmp/ut-%s.db", uuid.NewString())
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+	userName := uuid.NewString()
+	user, err := userManager.RecordNewUser(utContext, userName)
+	assert.Nil(err)
+	chatManager, err := user.ChatSessionManager(utContext)
+	assert.Nil(err)
+	session, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	sessionID, err := session.SessionID(utContext)
+	assert.Nil(err)
+	currentTime := time.Now()
+	assert.Nil(session.RecordOneExchange(utContext, ChatExchange{
+		RequestTimestamp:  currentTime,
+		Request:           "hello",
+		ResponseTimestamp: currentTime.Add(time.Second),
+		Response:          "world",
+	}))
+
+	// Case 0: backup while the DB is open
+	backupDB := fmt.Sprintf("/tmp/ut-%s.db", uuid.NewString())
+	{
+		version, err := BackupSQLiteDB(utContext, testDB, backupDB, logger.Info)
+		assert.Nil(err)
+		assert.Equal(LatestSQLSchemaVersion(), version)
+	}
+
+	// Case 1: backup can not overwrite an existing file
+	{
+		_, err := BackupSQLiteDB(utContext, testDB, backupDB, logger.Info)
+		assert.NotNil(err)
+	}
+
+	dbImage, err := os.ReadFile(backupDB)
+	assert.Nil(err)
+
+	// Case 2: encode and decode with every option
+	passphrase := func() (string, error) { return "correct horse", nil }
+	for _, encoding := range []BackupEncoding{
+		{},
+		{Compress: true},
+		{Passphrase: passphrase},
+		{Compress: true, Passphrase: passphrase},
+	} {
+		encoded, err := EncodeBackup(dbImage, encoding)
+		assert.Nil(err)
+		assert.Equal(encoding.Passphrase != nil, IsEncryptedBackup(encoded))
+		if encoding.Compress {
+			assert.Less(len(encoded), len(dbImage))
+		}
+		decoded, err := DecodeBackup(encoded, passphrase)
+		assert.Nil(err)
+		assert.Equal(dbImage, decoded)
+	}
+
+	// Case 3: wrong or missing passphrase
+	{
+		encoded, err := EncodeBackup(dbImage, BackupEncoding{Passphrase: passphrase})
+		assert.Nil(err)
+		_, err = DecodeBackup(encoded, func() (string, error) { return "wrong", nil })
+		assert.NotNil(err)
+		_, err = DecodeBackup(encoded, nil)
+		assert.NotNil(err)
+		_, err = EncodeBackup(dbImage, BackupEncoding{
+			Passphrase: func() (string, error) { return "", nil },
+		})
+		assert.NotNil(err)
+	}
+
+	// Case 4: not a sqlite DB
+	{
+		_, err := DecodeBackup([]byte("not a DB"), nil)
+		assert.NotNil(err)
+		garbage := fmt.Sprintf("/tmp/ut-%s.db", uuid.NewString())
+		assert.Nil(os.WriteFile(garbage, []byte("SQLite format 3\x00 but truncated"), 0600))
+		_, err = VerifySQLiteDB(utContext, garbage, logger.Info)
+		assert.NotNil(err)
+	}
+
+	// Case 5: sqlite DB which is not a persistence DB
+	{
+		otherDB := fmt.Sprintf("/tmp/ut-%s.db", uuid.NewString())
+		db, err := openSQLDB(GetSqliteDialector(otherDB), logger.Info)
+		assert.Nil(err)
+		assert.Nil(db.Exec("CREATE TABLE other (id integer)").Error)
+		_, err = VerifySQLiteDB(utContext, otherDB, logger.Info)
+		assert.NotNil(err)
+	}
+
+	// Case 6: the copy is usable
+	{
+		restored, err := GetSQLUserManager(GetSqliteDialector(backupDB), logger.Info, nil)
+		assert.Nil(err)
+		restoredUser, err := restored.GetUserByName(utContext, userName)
+		assert.Nil(err)
+		restoredChats, err := restoredUser.ChatSessionManager(utContext)
+		assert.Nil(err)
+		restoredSession, err := restoredChats.GetSession(utContext, sessionID)
+		assert.Nil(err)
+		exchanges, err := restoredSession.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 1)
+		assert.Equal("world", exchanges[0].Response)
+	}
+
+	// Case 7: schema version newer than supported
+	{
+		db, err := openSQLDB(GetSqliteDialector(backupDB), logger.Info)
+		assert.Nil(err)
+		assert.Nil(db.Create(&sqlSchemaMigrationEntry{
+			Version:     LatestSQLSchemaVersion() + 1,
+			Description: "from the future",
+			AppliedAt:   time.Now(),
+		}).Error)
+		_, err = VerifySQLiteDB(utContext, backupDB, logger.Info)
+		assert.NotNil(err)
+	}
+}
+
+func TestSQLiteCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	utContext := context.Background()
+
+	testDB := fmt.Sprintf("/tmp/ut-%s.db", uuid.NewString())
+
+	// The DB stays open, so nothing moves out of the write-ahead log on its own
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+	userName := uuid.NewString()
+	_, err = userManager.RecordNewUser(utContext, userName)
+	assert.Nil(err)
+
+	assert.Nil(CheckpointSQLiteDB(utContext, testDB, logger.Info))
+
+	// A copy of only the DB file has all the data
+	dbImage, err := os.ReadFile(testDB)
+	assert.Nil(err)
+	copyDB := fmt.Sprintf("/tmp/ut-%s.db", uuid.NewString())
+	assert.Nil(os.WriteFile(copyDB, dbImage, 0600))
+	copied, err := GetSQLUserManager(GetSqliteDialector(copyDB), logger.Info, nil)
+	assert.Nil(err)
+	_, err = copied.GetUserByName(utContext, userName)
+	assert.Nil(err)
+}
@@ -2,7 +2,9 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -11,6 +13,8 @@ import (
 type ChatSessionState string
 
 const (
+	// DefaultChatModel default chat session model
+	DefaultChatModel = "turbo"
 	// DefaultChatMaxResponseTokens default max token count for chat session response
 	DefaultChatMaxResponseTokens = 2048
 	// DefaultChatRequestTemperature default chat request temperature
@@ -22,8 +26,40 @@ const (
 	ChatSessionStateOpen ChatSessionState = "session-open"
 	// ChatSessionStateClose ENUM for chat session state "CLOSE"
 	ChatSessionStateClose ChatSessionState = "session-close"
+	// ChatSessionStateArchived ENUM for chat session state "ARCHIVED"
+	ChatSessionStateArchived ChatSessionState = "session-archived"
 )
 
+// ErrChatSessionModified the session history was changed by another process since the session
+// handle last loaded it. Call Refresh on the handle to load the changes before trying again.
+var ErrChatSessionModified = errors.New("chat session was modified by another process")
+
+// chatSessionStateTransitions allowed chat session state transitions, keyed by current state
+var chatSessionStateTransitions = map[ChatSessionState][]ChatSessionState{
+	ChatSessionStateOpen:     {ChatSessionStateClose, ChatSessionStateArchived},
+	ChatSessionStateClose:    {ChatSessionStateOpen, ChatSessionStateArchived},
+	ChatSessionStateArchived: {ChatSessionStateOpen},
+}
+
+/*
+ValidateChatSessionStateTransition verify a chat session can move from one state to another
+
+	@param current ChatSessionState - current session state
+	@param next ChatSessionState - new session state
+*/
+func ValidateChatSessionStateTransition(current, next ChatSessionState) error {
+	allowed, ok := chatSessionStateTransitions[current]
+	if !ok {
+		return fmt.Errorf("unknown chat session state '%s'", current)
+	}
+	for _, oneState := range allowed {
+		if oneState == next {
+			return nil
+		}
+	}
+	return fmt.Errorf("chat session can not change from '%s' to '%s'", current, next)
+}
+
 /*
 ChatSessionParameters common API request parameters used for one chat session
 
@@ -57,6 +93,19 @@ func GetDefaultChatSessionParams(model string) ChatSessionParameters {
 	}
 }
 
+/*
+userDefaultChatSettings the chat session request params a user starts new sessions with
+
+	@param stored ChatSessionParameters - the default params stored for the user
+	@return the stored params, or the package defaults if the user has not stored any
+*/
+func userDefaultChatSettings(stored ChatSessionParameters) ChatSessionParameters {
+	if stored.Model == "" {
+		return GetDefaultChatSessionParams(DefaultChatModel)
+	}
+	return stored
+}
+
 /*
 MergeWithNewSettings merge the contents of the new setting into current setting
 
@@ -87,16 +136,243 @@ func (s *ChatSessionParameters) MergeWithNewSettings(newSetting ChatSessionParam
 	}
 }
 
+// MaxChatSessionTagLength max length of a chat session tag
+const MaxChatSessionTagLength = 64
+
+/*
+ChatSessionMetadata descriptive information used to organize chat sessions
+*/
+type ChatSessionMetadata struct {
+	// Title short chat session title
+	Title string `yaml:"title,omitempty" json:"title,omitempty"`
+	// Description longer chat session description
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Tags chat session tags, sorted
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+/*
+NormalizeSessionTags verify, de-duplicate, and sort a list of chat session tags
+
+	@param tags []string - chat session tags
+	@return normalized tags
+*/
+func NormalizeSessionTags(tags []string) ([]string, error) {
+	unique := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return nil, fmt.Errorf("chat session tag can not be empty")
+		}
+		if strings.ContainsAny(tag, " \t\r\n") {
+			return nil, fmt.Errorf("chat session tag '%s' can not contain whitespace", tag)
+		}
+		if len(tag) > MaxChatSessionTagLength {
+			return nil, fmt.Errorf(
+				"chat session tag '%s' longer than %d characters", tag, MaxChatSessionTagLength,
+			)
+		}
+		unique[tag] = true
+	}
+	result := []string{}
+	for tag := range unique {
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
 /*
 ChatExchange defines one exchange during a chat session.
 
 An exchange is defined as a request and its associated response
 */
 type ChatExchange struct {
+	// ID exchange ID. Assigned when the exchange is recorded.
+	ID                string    `yaml:"id,omitempty" json:"id,omitempty"`
 	RequestTimestamp  time.Time `yaml:"request_ts" json:"request_ts" validate:"required"`
 	Request           string    `yaml:"request" json:"request" validate:"required"`
 	ResponseTimestamp time.Time `yaml:"response_ts" json:"response_ts" validate:"required"`
 	Response          string    `yaml:"response" json:"response" validate:"required"`
+	// Attachments files sent along with the request, in the order they were attached
+	Attachments []ChatExchangeAttachment `yaml:"attachments,omitempty" json:"attachments,omitempty"`
+}
+
+/*
+ChatExchangeAttachment a file sent along with the request of a chat exchange
+
+The attachment is kept apart from the request text, and added to the request whenever the
+exchange is sent to the model.
+*/
+type ChatExchangeAttachment struct {
+	// Name the file name
+	Name string `yaml:"name" json:"name"`
+	// Content the file content when it was attached
+	Content string `yaml:"content" json:"content"`
+}
+
+/*
+Size the size of the attachment content
+
+	@return number of bytes
+*/
+func (a ChatExchangeAttachment) Size() int64 {
+	return int64(len(a.Content))
+}
+
+/*
+validate verify the attachment is named
+
+	@return nil if valid
+*/
+func (a ChatExchangeAttachment) validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("attachment name can not be empty")
+	}
+	return nil
+}
+
+// ChatExchangeAuditAction a change made to a recorded chat exchange
+type ChatExchangeAuditAction string
+
+const (
+	// ChatExchangeDeleted ENUM for chat exchange audit action "exchange deleted"
+	ChatExchangeDeleted ChatExchangeAuditAction = "exchange-deleted"
+	// ChatExchangeRequestEdited ENUM for chat exchange audit action "request edited"
+	ChatExchangeRequestEdited ChatExchangeAuditAction = "request-edited"
+	// ChatExchangeResponseEdited ENUM for chat exchange audit action "response edited"
+	ChatExchangeResponseEdited ChatExchangeAuditAction = "response-edited"
+	// ChatExchangeVariantsDeleted ENUM for chat exchange audit action "unselected response
+	// variants deleted"
+	ChatExchangeVariantsDeleted ChatExchangeAuditAction = "variants-deleted"
+)
+
+/*
+ChatExchangeAuditRecord records one change made to a recorded chat exchange
+
+The record does not keep the original text, so removed content is gone for good.
+*/
+type ChatExchangeAuditRecord struct {
+	// ExchangeID ID of the changed exchange
+	ExchangeID string `yaml:"exchange_id" json:"exchange_id"`
+	// Action the change made
+	Action ChatExchangeAuditAction `yaml:"action" json:"action"`
+	// RequestTimestamp when the request of the changed exchange was made
+	RequestTimestamp time.Time `yaml:"request_ts" json:"request_ts"`
+	// Reason why the change was made
+	Reason string `yaml:"reason,omitempty" json:"reason,omitempty"`
+	// Timestamp when the change was made
+	Timestamp time.Time `yaml:"timestamp" json:"timestamp"`
+}
+
+/*
+ChatExchangeEdit changes to make to a recorded chat exchange
+*/
+type ChatExchangeEdit struct {
+	// Request the new request text. Unchanged if nil.
+	Request *string
+	// Response the new response text. Unchanged if nil.
+	Response *string
+	// Reason why the change is made
+	Reason string
+}
+
+/*
+validate verify the edit changes something, and leaves no empty text
+
+	@return nil if valid
+*/
+func (e ChatExchangeEdit) validate() error {
+	if e.Request == nil && e.Response == nil {
+		return fmt.Errorf("exchange edit changes nothing")
+	}
+	if e.Request != nil && strings.TrimSpace(*e.Request) == "" {
+		return fmt.Errorf("exchange request can not be empty")
+	}
+	if e.Response != nil && strings.TrimSpace(*e.Response) == "" {
+		return fmt.Errorf("exchange response can not be empty")
+	}
+	return nil
+}
+
+/*
+ChatSessionNote a note pinned to a chat session
+
+Pinned notes are included in every request made in the session.
+*/
+type ChatSessionNote struct {
+	// ID note ID. Assigned when the note is pinned.
+	ID string `yaml:"id,omitempty" json:"id,omitempty"`
+	// Content the note text
+	Content string `yaml:"content" json:"content"`
+	// Source the file the content was read from. Empty if the note was written directly.
+	Source string `yaml:"source,omitempty" json:"source,omitempty"`
+	// CreatedAt when the note was pinned
+	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
+}
+
+/*
+validate verify the note has content
+
+	@return nil if valid
+*/
+func (n ChatSessionNote) validate() error {
+	if strings.TrimSpace(n.Content) == "" {
+		return fmt.Errorf("pinned note can not be empty")
+	}
+	return nil
+}
+
+// MaxChatSessionPresetNameLength max length of a chat session preset name
+const MaxChatSessionPresetNameLength = 64
+
+/*
+ChatSessionPreset a named set of chat session settings, used to start new chat sessions with
+*/
+type ChatSessionPreset struct {
+	// Name preset name, unique for each user
+	Name string `yaml:"name" json:"name"`
+	// Settings the chat session settings
+	Settings ChatSessionParameters `yaml:"settings" json:"settings"`
+}
+
+/*
+validateName verify the preset name is usable on the command line
+
+	@return nil if valid
+*/
+func (p ChatSessionPreset) validateName() error {
+	if p.Name == "" {
+		return fmt.Errorf("chat session preset name can not be empty")
+	}
+	if strings.ContainsAny(p.Name, " \t\r\n") {
+		return fmt.Errorf("chat session preset name '%s' can not contain whitespace", p.Name)
+	}
+	if len(p.Name) > MaxChatSessionPresetNameLength {
+		return fmt.Errorf(
+			"chat session preset name '%s' longer than %d characters",
+			p.Name,
+			MaxChatSessionPresetNameLength,
+		)
+	}
+	return nil
+}
+
+/*
+ChatExchangeVariant one of the alternative responses to the same request
+
+The selected variant is the response of the exchange, and is used as context for future
+requests.
+*/
+type ChatExchangeVariant struct {
+	ResponseTimestamp time.Time `yaml:"response_ts" json:"response_ts" validate:"required"`
+	Response          string    `yaml:"response" json:"response" validate:"required"`
+	// Model the model which generated the response. Empty if not known.
+	Model string `yaml:"model,omitempty" json:"model,omitempty"`
+	// Temperature the request temperature used to generate the response. Nil if not known.
+	Temperature *float32 `yaml:"temperature,omitempty" json:"temperature,omitempty"`
+	// Selected whether this is the selected response of the exchange
+	Selected bool `yaml:"selected" json:"selected"`
 }
 
 /*
@@ -128,6 +404,55 @@ func (c ChatExchange) String() string {
 	return builder.String()
 }
 
+/*
+ChatSessionSummary overview of one chat session, as shown when listing chat sessions
+*/
+type ChatSessionSummary struct {
+	// SessionID chat session ID
+	SessionID string `yaml:"id" json:"id"`
+	// State chat session state
+	State ChatSessionState `yaml:"state" json:"state"`
+	// Model chat session model
+	Model string `yaml:"model" json:"model"`
+	// Metadata chat session title, description, and tags
+	Metadata ChatSessionMetadata `yaml:",inline" json:"metadata"`
+	// FirstRequest request of the first exchange. Empty if the session has no exchanges.
+	FirstRequest string `yaml:"request" json:"request"`
+	// ExchangeCount number of exchanges in the session
+	ExchangeCount int `yaml:"exchanges" json:"exchanges"`
+	// CreatedAt when the session was created
+	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
+	// DeletedAt when the session was moved to the trash. Nil if not in the trash.
+	DeletedAt *time.Time `yaml:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+}
+
+/*
+ChatSessionListQuery filters and pagination parameters for listing chat sessions
+
+Sessions are listed in creation order. To page through the sessions, pass the NextCursor of
+one page as the After of the next query.
+*/
+type ChatSessionListQuery struct {
+	// States only list sessions in one of these states. Sessions in all states are listed if empty.
+	States []ChatSessionState
+	// Tag only list sessions with this tag
+	Tag string
+	// After only list sessions created after the session with this ID
+	After string
+	// Limit max number of sessions to list. All sessions are listed if not positive.
+	Limit int
+}
+
+/*
+ChatSessionSummaryPage one page of chat session summaries
+*/
+type ChatSessionSummaryPage struct {
+	// Sessions the chat session summaries, in creation order
+	Sessions []ChatSessionSummary
+	// NextCursor cursor to fetch the next page with. Empty if there are no more sessions.
+	NextCursor string
+}
+
 /*
 ChatSession define a chat session with a text completion model.
 
@@ -157,6 +482,27 @@ type ChatSession interface {
 	*/
 	CloseSession(ctxt context.Context) error
 
+	/*
+		ChangeState move this chat session to a new state
+
+		Archiving the session also clears it as the user's active session.
+
+			@param ctxt context.Context - query context
+			@param newState ChatSessionState - the new session state
+	*/
+	ChangeState(ctxt context.Context, newState ChatSessionState) error
+
+	/*
+		LastActivity when this chat session was last used
+
+		This is when the latest response was received, or when the session was created if it has
+		no exchanges.
+
+			@param ctxt context.Context - query context
+			@return time of last activity
+	*/
+	LastActivity(ctxt context.Context) (time.Time, error)
+
 	/*
 		User query the associated user for this chat session
 
@@ -181,11 +527,30 @@ type ChatSession interface {
 	*/
 	ChangeSettings(ctxt context.Context, newSettings ChatSessionParameters) error
 
+	/*
+		Metadata returns the session title, description, and tags
+
+			@param ctxt context.Context - query context
+			@return session metadata
+	*/
+	Metadata(ctxt context.Context) (ChatSessionMetadata, error)
+
+	/*
+		ChangeMetadata replace the session title, description, and tags
+
+			@param ctxt context.Context - query context
+			@param newMetadata ChatSessionMetadata - new session metadata
+	*/
+	ChangeMetadata(ctxt context.Context, newMetadata ChatSessionMetadata) error
+
 	/*
 		RecordOneExchange record a single exchange.
 
 		An exchange is defined as a request and its associated response
 
+		Fails with ErrChatSessionModified if the session history changed since the handle last
+		loaded it.
+
 			@param ctxt context.Context - query context
 			@param exchange ChatExchange - the exchange
 	*/
@@ -209,6 +574,16 @@ type ChatSession interface {
 	*/
 	Exchanges(ctxt context.Context) ([]ChatExchange, error)
 
+	/*
+		LatestExchanges fetch the newest exchanges recorded in this session, without loading the
+		whole session history
+
+			@param ctxt context.Context - query context
+			@param count int - max number of exchanges to fetch
+			@return list of exchanges in chronological order
+	*/
+	LatestExchanges(ctxt context.Context, count int) ([]ChatExchange, error)
+
 	/*
 		Refresh helper function to sync the handler with what is stored in persistence
 
@@ -219,9 +594,112 @@ type ChatSession interface {
 	/*
 		DeleteLatestExchange delete the latest exchange in the session
 
+		Fails with ErrChatSessionModified if the session history changed since the handle last
+		loaded it.
+
 			@param ctxt context.Context - query context
 	*/
 	DeleteLatestExchange(ctxt context.Context) error
+
+	/*
+		ReplaceLatestExchange replace the newest exchange with a new exchange in one operation
+
+		Fails with ErrChatSessionModified if the session history changed since the handle last
+		loaded it.
+
+			@param ctxt context.Context - query context
+			@param exchange ChatExchange - the replacement exchange
+	*/
+	ReplaceLatestExchange(ctxt context.Context, exchange ChatExchange) error
+
+	/*
+		RecordLatestExchangeVariant record a new response variant for the newest exchange, and
+		select it as the response of the exchange
+
+		Fails with ErrChatSessionModified if the session history changed since the handle last
+		loaded it.
+
+			@param ctxt context.Context - query context
+			@param variant ChatExchangeVariant - the new response variant
+	*/
+	RecordLatestExchangeVariant(ctxt context.Context, variant ChatExchangeVariant) error
+
+	/*
+		LatestExchangeVariants fetch the response variants of the newest exchange
+
+		An exchange which was never regenerated has one variant, its original response.
+
+			@param ctxt context.Context - query context
+			@return the response variants, oldest first
+	*/
+	LatestExchangeVariants(ctxt context.Context) ([]ChatExchangeVariant, error)
+
+	/*
+		SelectLatestExchangeVariant select one of the response variants as the response of the
+		newest exchange
+
+		Fails with ErrChatSessionModified if the session history changed since the handle last
+		loaded it.
+
+			@param ctxt context.Context - query context
+			@param variantIndex int - index of the variant, as listed by LatestExchangeVariants
+	*/
+	SelectLatestExchangeVariant(ctxt context.Context, variantIndex int) error
+
+	/*
+		DeleteExchanges delete exchanges from the session, and record an audit record for each
+
+			@param ctxt context.Context - query context
+			@param exchangeIDs []string - IDs of the exchanges to delete
+			@param reason string - why the exchanges are deleted
+	*/
+	DeleteExchanges(ctxt context.Context, exchangeIDs []string, reason string) error
+
+	/*
+		EditExchange change the stored request or response text of an exchange, and record an
+		audit record for each change
+
+		If the exchange has response variants, the selected variant is changed, and the other
+		variants are deleted so the original text is not kept anywhere.
+
+			@param ctxt context.Context - query context
+			@param exchangeID string - ID of the exchange to change
+			@param edit ChatExchangeEdit - the changes
+	*/
+	EditExchange(ctxt context.Context, exchangeID string, edit ChatExchangeEdit) error
+
+	/*
+		ExchangeAuditRecords fetch the audit records of changes made to the session exchanges
+
+			@param ctxt context.Context - query context
+			@return the audit records, oldest first
+	*/
+	ExchangeAuditRecords(ctxt context.Context) ([]ChatExchangeAuditRecord, error)
+
+	/*
+		PinNote pin a note to the session
+
+			@param ctxt context.Context - query context
+			@param note ChatSessionNote - the note
+			@return the new note ID
+	*/
+	PinNote(ctxt context.Context, note ChatSessionNote) (string, error)
+
+	/*
+		PinnedNotes fetch the notes pinned to the session
+
+			@param ctxt context.Context - query context
+			@return the pinned notes, oldest first
+	*/
+	PinnedNotes(ctxt context.Context) ([]ChatSessionNote, error)
+
+	/*
+		UnpinNote remove a note pinned to the session
+
+			@param ctxt context.Context - query context
+			@param noteID string - ID of the note
+	*/
+	UnpinNote(ctxt context.Context, noteID string) error
 }
 
 /*
@@ -231,12 +709,27 @@ type ChatSessionManager interface {
 	/*
 		NewSession define a new chat session
 
+		The session starts with the default chat session settings of the associated user.
+
 			@param ctxt context.Context - query context
-			@param model stirng - OpenAI model name
+			@param model stirng - OpenAI model name. The user's default model is used if empty.
 			@return	new chat session
 	*/
 	NewSession(ctxt context.Context, model string) (ChatSession, error)
 
+	/*
+		ForkSession define a new chat session which starts as a copy of an existing session
+
+		The new session copies the settings, the pinned notes, and the first exchanges of the
+		source session.
+
+			@param ctxt context.Context - query context
+			@param sourceSessionID string - ID of the session to fork from
+			@param exchangeCount int - number of leading exchanges to copy. All are copied if negative.
+			@return new chat session
+	*/
+	ForkSession(ctxt context.Context, sourceSessionID string, exchangeCount int) (ChatSession, error)
+
 	/*
 		ListSessions list all sessions
 
@@ -245,6 +738,27 @@ type ChatSessionManager interface {
 	*/
 	ListSessions(ctxt context.Context) ([]ChatSession, error)
 
+	/*
+		ListSessionsWithTag list all sessions with a tag
+
+			@param ctxt context.Context - query context
+			@param tag string - session tag
+			@return all sessions with the tag
+	*/
+	ListSessionsWithTag(ctxt context.Context, tag string) ([]ChatSession, error)
+
+	/*
+		ListSessionSummaries list summaries of the sessions matching a query, one page at a time
+
+		Each summary includes the first request of the session, so listing does not need to
+		query each session individually.
+
+			@param ctxt context.Context - query context
+			@param query ChatSessionListQuery - filters and pagination parameters
+			@return one page of session summaries
+	*/
+	ListSessionSummaries(ctxt context.Context, query ChatSessionListQuery) (ChatSessionSummaryPage, error)
+
 	/*
 		GetSession fetch a session
 
@@ -265,13 +779,26 @@ type ChatSessionManager interface {
 	/*
 	   SetActiveSession set the current active chat session for the associated user
 
+	   Archived sessions can not be made active.
+
 	   	@param ctxt context.Context - query context
 	   	@param session ChatSession - the chat session
 	*/
 	SetActiveSession(ctxt context.Context, session ChatSession) error
 
 	/*
-		DeleteSession delete a session
+		ArchiveIdleSessions archive all open or closed sessions which were not used recently
+
+			@param ctxt context.Context - query context
+			@param idleTimeout time.Duration - how long a session can go unused before it is archived
+			@return IDs of the archived sessions
+	*/
+	ArchiveIdleSessions(ctxt context.Context, idleTimeout time.Duration) ([]string, error)
+
+	/*
+		DeleteSession move a session to the trash
+
+		Sessions in the trash are excluded from all other queries, until they are restored.
 
 			@param ctxt context.Context - query context
 			@param sessionID string - session ID
@@ -279,7 +806,7 @@ type ChatSessionManager interface {
 	DeleteSession(ctxt context.Context, sessionID string) error
 
 	/*
-		DeleteMultipleSessions delete multiple sessions
+		DeleteMultipleSessions move multiple sessions to the trash
 
 			@param ctxt context.Context - query context
 			@param sessionIDs []string - session IDs
@@ -287,9 +814,120 @@ type ChatSessionManager interface {
 	DeleteMultipleSessions(ctxt context.Context, sessionIDs []string) error
 
 	/*
-		DeleteMultipleSessions delete all sessions
+		DeleteAllSessions move all sessions to the trash
 
 			@param ctxt context.Context - query context
 	*/
 	DeleteAllSessions(ctxt context.Context) error
+
+	/*
+		ListTrash list summaries of the sessions in the trash
+
+			@param ctxt context.Context - query context
+			@return the session summaries, most recently deleted first
+	*/
+	ListTrash(ctxt context.Context) ([]ChatSessionSummary, error)
+
+	/*
+		RestoreSession move a session out of the trash
+
+		The session keeps the state it had when it was deleted, but is not made active again.
+
+			@param ctxt context.Context - query context
+			@param sessionID string - session ID
+	*/
+	RestoreSession(ctxt context.Context, sessionID string) error
+
+	/*
+		EmptyTrash permanently delete the sessions in the trash
+
+			@param ctxt context.Context - query context
+			@param olderThan time.Duration - only delete sessions which were moved to the trash at
+			    least this long ago. All sessions in the trash are deleted if zero.
+			@return IDs of the deleted sessions
+	*/
+	EmptyTrash(ctxt context.Context, olderThan time.Duration) ([]string, error)
+
+	/*
+		SessionsToPrune find the sessions, including those in the trash, which exceed a retention
+		policy
+
+			@param ctxt context.Context - query context
+			@param policy RetentionPolicy - the retention policy
+			@param dbSize int64 - current DB size in bytes. The DB size limit is not enforced if zero.
+			@return the sessions to prune, least recently used first. A session which is kept, but
+			    has exchanges older than the max age, lists only those exchanges to prune.
+	*/
+	SessionsToPrune(
+		ctxt context.Context, policy RetentionPolicy, dbSize int64,
+	) ([]ChatSessionPruneCandidate, error)
+
+	/*
+		PurgeSessions permanently delete sessions, whether or not they are in the trash
+
+			@param ctxt context.Context - query context
+			@param sessionIDs []string - session IDs
+	*/
+	PurgeSessions(ctxt context.Context, sessionIDs []string) error
+
+	/*
+		PurgeExchanges permanently delete exchanges, along with their response variants and
+		attached files, from the sessions they belong to
+
+			@param ctxt context.Context - query context
+			@param exchangeIDs []string - exchange IDs
+	*/
+	PurgeExchanges(ctxt context.Context, exchangeIDs []string) error
+
+	/*
+		SearchExchanges search through the exchanges of all chat sessions of the associated user
+
+			@param ctxt context.Context - query context
+			@param query ChatExchangeSearchQuery - search parameters
+			@return matching exchanges, best matches first
+	*/
+	SearchExchanges(ctxt context.Context, query ChatExchangeSearchQuery) ([]ChatExchangeSearchResult, error)
+
+	/*
+		ExchangeContents fetch the request time, request, and response of every exchange of the
+		associated user's chat sessions, excluding those in the trash. Nothing else about the
+		exchanges is loaded.
+
+			@param ctxt context.Context - query context
+			@return the exchanges, grouped by session ID
+	*/
+	ExchangeContents(ctxt context.Context) (map[string][]ChatExchange, error)
+
+	/*
+		RecordPreset record a new chat session preset
+
+			@param ctxt context.Context - query context
+			@param preset ChatSessionPreset - the preset. The name must not already be in use.
+	*/
+	RecordPreset(ctxt context.Context, preset ChatSessionPreset) error
+
+	/*
+		ListPresets list all chat session presets
+
+			@param ctxt context.Context - query context
+			@return all presets, sorted by name
+	*/
+	ListPresets(ctxt context.Context) ([]ChatSessionPreset, error)
+
+	/*
+		GetPreset fetch a chat session preset
+
+			@param ctxt context.Context - query context
+			@param name string - preset name
+			@return the preset
+	*/
+	GetPreset(ctxt context.Context, name string) (ChatSessionPreset, error)
+
+	/*
+		UpdatePreset replace the settings of an existing chat session preset
+
+			@param ctxt context.Context - query context
+			@param preset ChatSessionPreset - the preset with its new settings
+	*/
+	UpdatePreset(ctxt context.Context, preset ChatSessionPreset) error
 }
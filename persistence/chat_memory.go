@@ -0,0 +1,1664 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alwitt/goutils"
+	"github.com/apex/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/oklog/ulid/v2"
+)
+
+// memoryChatSessionHandle wrapper object for working with an in-memory chat session record
+type memoryChatSessionHandle struct {
+	goutils.Component
+	driver    *memoryChatPersistence
+	validator *validator.Validate
+	id        string
+	// version of the session history when the handle last loaded it
+	version int64
+}
+
+/*
+entry fetch the chat session record. Caller must hold the store lock.
+
+	@return the chat session record
+*/
+func (h *memoryChatSessionHandle) entry() (*memoryChatSessionEntry, error) {
+	sessionEntry, ok := h.driver.driver.store.sessions[h.id]
+	if !ok || sessionEntry.UserID != h.driver.user.id || sessionEntry.DeletedAt != nil {
+		return nil, fmt.Errorf("chat session '%s' does not exist", h.id)
+	}
+	return sessionEntry, nil
+}
+
+/*
+checkVersion verify the session history did not change since the handle last loaded it.
+Caller must hold the store lock.
+
+	@param sessionEntry *memoryChatSessionEntry - the chat session record
+*/
+func (h *memoryChatSessionHandle) checkVersion(sessionEntry *memoryChatSessionEntry) error {
+	if sessionEntry.Version != h.version {
+		return ErrChatSessionModified
+	}
+	return nil
+}
+
+/*
+historyChanged advance the version of the session history. Caller must hold the store lock.
+
+	@param sessionEntry *memoryChatSessionEntry - the chat session record
+*/
+func (h *memoryChatSessionHandle) historyChanged(sessionEntry *memoryChatSessionEntry) {
+	// Changes made elsewhere which the handle has not loaded must still be detected
+	if sessionEntry.Version == h.version {
+		h.version++
+	}
+	sessionEntry.Version++
+}
+
+/*
+SessionID this chat session ID
+
+	@param ctxt context.Context - query context
+	@return session ID
+*/
+func (h *memoryChatSessionHandle) SessionID(ctxt context.Context) (string, error) {
+	return h.id, nil
+}
+
+/*
+SessionState session's current state
+
+	@param ctxt context.Context - query context
+	@return current session state
+*/
+func (h *memoryChatSessionHandle) SessionState(ctxt context.Context) (ChatSessionState, error) {
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		return "", err
+	}
+	return sessionEntry.State, nil
+}
+
+/*
+CloseSession close this chat session
+
+	@param ctxt context.Context - query context
+*/
+func (h *memoryChatSessionHandle) CloseSession(ctxt context.Context) error {
+	return h.ChangeState(ctxt, ChatSessionStateClose)
+}
+
+/*
+ChangeState move this chat session to a new state
+
+Archiving the session also clears it as the user's active session.
+
+	@param ctxt context.Context - query context
+	@param newState ChatSessionState - the new session state
+*/
+func (h *memoryChatSessionHandle) ChangeState(ctxt context.Context, newState ChatSessionState) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err == nil {
+		err = h.driver.changeSessionState(sessionEntry, newState)
+	}
+	if err != nil {
+		log.
+			WithError(err).
+			WithFields(logtags).
+			Errorf("Failed to update session state to '%s'", newState)
+		return err
+	}
+	return nil
+}
+
+/*
+LastActivity when this chat session was last used
+
+This is when the latest response was received, or when the session was created if it has
+no exchanges.
+
+	@param ctxt context.Context - query context
+	@return time of last activity
+*/
+func (h *memoryChatSessionHandle) LastActivity(ctxt context.Context) (time.Time, error) {
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return sessionEntry.lastActivity(), nil
+}
+
+/*
+User query the associated user for this chat session
+
+	@param ctxt context.Context - query context
+	@return the associated User
+*/
+func (h *memoryChatSessionHandle) User(ctxt context.Context) (User, error) {
+	return h.driver.user, nil
+}
+
+/*
+Settings returns the current session wide API request parameters
+
+	@param ctxt context.Context - query context
+	@return session wide parameters
+*/
+func (h *memoryChatSessionHandle) Settings(ctxt context.Context) (ChatSessionParameters, error) {
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		return ChatSessionParameters{}, err
+	}
+	return sessionEntry.CommonSettings, nil
+}
+
+/*
+ChangeSettings update the session wide API request parameters
+
+	@param ctxt context.Context - query context
+	@param newSettings ChatSessionParameters - new session wide API request parameters
+*/
+func (h *memoryChatSessionHandle) ChangeSettings(
+	ctxt context.Context, newSettings ChatSessionParameters,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := h.validator.Struct(&newSettings); err != nil {
+		log.WithError(err).WithFields(logtags).Error("New setting not valid")
+		return err
+	}
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to update session common settings")
+		return err
+	}
+	sessionEntry.CommonSettings = newSettings
+	sessionEntry.UpdatedAt = time.Now()
+	return nil
+}
+
+/*
+Metadata returns the session title, description, and tags
+
+	@param ctxt context.Context - query context
+	@return session metadata
+*/
+func (h *memoryChatSessionHandle) Metadata(ctxt context.Context) (ChatSessionMetadata, error) {
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		return ChatSessionMetadata{}, err
+	}
+	result := sessionEntry.Metadata
+	result.Tags = append([]string(nil), sessionEntry.Metadata.Tags...)
+	return result, nil
+}
+
+/*
+ChangeMetadata replace the session title, description, and tags
+
+	@param ctxt context.Context - query context
+	@param newMetadata ChatSessionMetadata - new session metadata
+*/
+func (h *memoryChatSessionHandle) ChangeMetadata(
+	ctxt context.Context, newMetadata ChatSessionMetadata,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	tags, err := NormalizeSessionTags(newMetadata.Tags)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("New metadata not valid")
+		return err
+	}
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to update session metadata")
+		return err
+	}
+	newMetadata.Tags = tags
+	sessionEntry.Metadata = newMetadata
+	sessionEntry.UpdatedAt = time.Now()
+	return nil
+}
+
+/*
+RecordOneExchange record a single exchange.
+
+An exchange is defined as a request and its associated response
+
+	@param ctxt context.Context - query context
+	@param exchange ChatExchange - the exchange
+*/
+func (h *memoryChatSessionHandle) RecordOneExchange(
+	ctxt context.Context, exchange ChatExchange,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	for _, oneAttachment := range exchange.Attachments {
+		if err := oneAttachment.validate(); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid chat exchange attachment")
+			return err
+		}
+	}
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to define new entry for chat exchange")
+		return err
+	}
+	if err := h.checkVersion(sessionEntry); err != nil {
+		return err
+	}
+
+	exchangeID := sessionEntry.insertExchange(exchange)
+	h.historyChanged(sessionEntry)
+
+	log.WithFields(logtags).Debugf("Defined new chat exchange '%s'", exchangeID)
+
+	return nil
+}
+
+/*
+FirstExchange get the first session exchange
+
+	@param ctxt context.Context - query context
+	@return chat exchange
+*/
+func (h *memoryChatSessionHandle) FirstExchange(ctxt context.Context) (ChatExchange, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to get first session exchange")
+		return ChatExchange{}, err
+	}
+	if len(sessionEntry.Exchanges) == 0 {
+		err := fmt.Errorf("chat session '%s' has no exchanges", h.id)
+		log.WithError(err).WithFields(logtags).Error("Failed to get first session exchange")
+		return ChatExchange{}, err
+	}
+	return sessionEntry.Exchanges[0].ChatExchange, nil
+}
+
+/*
+Exchanges fetch the list of exchanges recorded in this session.
+
+The exchanges are sorted by chronological order.
+
+	@param ctxt context.Context - query context
+	@return list of exchanges in chronological order
+*/
+func (h *memoryChatSessionHandle) Exchanges(ctxt context.Context) ([]ChatExchange, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to get session exchanges")
+		return nil, err
+	}
+	result := []ChatExchange{}
+	for _, oneExchange := range sessionEntry.Exchanges {
+		result = append(result, oneExchange.ChatExchange)
+	}
+	return result, nil
+}
+
+/*
+LatestExchanges fetch the newest exchanges recorded in this session, without loading the whole
+session history
+
+	@param ctxt context.Context - query context
+	@param count int - max number of exchanges to fetch
+	@return list of exchanges in chronological order
+*/
+func (h *memoryChatSessionHandle) LatestExchanges(
+	ctxt context.Context, count int,
+) ([]ChatExchange, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if count <= 0 {
+		return nil, fmt.Errorf("exchange count must be positive")
+	}
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to get latest session exchanges")
+		return nil, err
+	}
+	exchanges := sessionEntry.Exchanges
+	if len(exchanges) > count {
+		exchanges = exchanges[len(exchanges)-count:]
+	}
+	result := []ChatExchange{}
+	for _, oneExchange := range exchanges {
+		result = append(result, oneExchange.ChatExchange)
+	}
+	return result, nil
+}
+
+/*
+DeleteLatestExchange delete the latest exchange in the session
+
+	@param ctxt context.Context - query context
+*/
+func (h *memoryChatSessionHandle) DeleteLatestExchange(ctxt context.Context) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to find newest session exchange")
+		return err
+	}
+	if err := h.checkVersion(sessionEntry); err != nil {
+		return err
+	}
+	if len(sessionEntry.Exchanges) == 0 {
+		err := fmt.Errorf("chat session '%s' has no exchanges", h.id)
+		log.WithError(err).WithFields(logtags).Error("Failed to find newest session exchange")
+		return err
+	}
+	sessionEntry.Exchanges = sessionEntry.Exchanges[:len(sessionEntry.Exchanges)-1]
+	h.historyChanged(sessionEntry)
+	return nil
+}
+
+/*
+ReplaceLatestExchange replace the newest exchange with a new exchange in one operation
+
+	@param ctxt context.Context - query context
+	@param exchange ChatExchange - the replacement exchange
+*/
+func (h *memoryChatSessionHandle) ReplaceLatestExchange(
+	ctxt context.Context, exchange ChatExchange,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	for _, oneAttachment := range exchange.Attachments {
+		if err := oneAttachment.validate(); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Invalid chat exchange attachment")
+			return err
+		}
+	}
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to find newest session exchange")
+		return err
+	}
+	if err := h.checkVersion(sessionEntry); err != nil {
+		return err
+	}
+	if len(sessionEntry.Exchanges) == 0 {
+		err := fmt.Errorf("chat session '%s' has no exchanges", h.id)
+		log.WithError(err).WithFields(logtags).Error("Failed to find newest session exchange")
+		return err
+	}
+	replaced := sessionEntry.Exchanges[len(sessionEntry.Exchanges)-1].ID
+	sessionEntry.Exchanges = sessionEntry.Exchanges[:len(sessionEntry.Exchanges)-1]
+	exchangeID := sessionEntry.insertExchange(exchange)
+	h.historyChanged(sessionEntry)
+
+	log.WithFields(logtags).Debugf("Replaced chat exchange '%s' with '%s'", replaced, exchangeID)
+
+	return nil
+}
+
+/*
+latestExchange helper function to fetch the newest exchange. Store lock must be held.
+
+	@return the newest exchange entry
+*/
+func (h *memoryChatSessionHandle) latestExchange() (*memoryChatExchangeEntry, error) {
+	sessionEntry, err := h.entry()
+	if err != nil {
+		return nil, err
+	}
+	if len(sessionEntry.Exchanges) == 0 {
+		return nil, fmt.Errorf("chat session '%s' has no exchanges", h.id)
+	}
+	return &sessionEntry.Exchanges[len(sessionEntry.Exchanges)-1], nil
+}
+
+/*
+RecordLatestExchangeVariant record a new response variant for the newest exchange, and
+select it as the response of the exchange
+
+	@param ctxt context.Context - query context
+	@param variant ChatExchangeVariant - the new response variant
+*/
+func (h *memoryChatSessionHandle) RecordLatestExchangeVariant(
+	ctxt context.Context, variant ChatExchangeVariant,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read newest exchange variants")
+		return err
+	}
+	if err := h.checkVersion(sessionEntry); err != nil {
+		return err
+	}
+	exchange, err := h.latestExchange()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read newest exchange variants")
+		return err
+	}
+
+	// Keep the original response as the first variant
+	if len(exchange.Variants) == 0 {
+		exchange.Variants = append(exchange.Variants, ChatExchangeVariant{
+			ResponseTimestamp: exchange.ResponseTimestamp, Response: exchange.Response,
+		})
+	}
+	for idx := range exchange.Variants {
+		exchange.Variants[idx].Selected = false
+	}
+	variant.Selected = true
+	exchange.Variants = append(exchange.Variants, variant)
+	exchange.Response = variant.Response
+	exchange.ResponseTimestamp = variant.ResponseTimestamp
+	h.historyChanged(sessionEntry)
+
+	log.WithFields(logtags).Debugf("Recorded response variant of exchange '%s'", exchange.ID)
+
+	return nil
+}
+
+/*
+LatestExchangeVariants fetch the response variants of the newest exchange
+
+An exchange which was never regenerated has one variant, its original response.
+
+	@param ctxt context.Context - query context
+	@return the response variants, oldest first
+*/
+func (h *memoryChatSessionHandle) LatestExchangeVariants(
+	ctxt context.Context,
+) ([]ChatExchangeVariant, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	exchange, err := h.latestExchange()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read newest exchange variants")
+		return nil, err
+	}
+	if len(exchange.Variants) == 0 {
+		return []ChatExchangeVariant{{
+			ResponseTimestamp: exchange.ResponseTimestamp,
+			Response:          exchange.Response,
+			Selected:          true,
+		}}, nil
+	}
+	return append([]ChatExchangeVariant{}, exchange.Variants...), nil
+}
+
+/*
+SelectLatestExchangeVariant select one of the response variants as the response of the
+newest exchange
+
+	@param ctxt context.Context - query context
+	@param variantIndex int - index of the variant, as listed by LatestExchangeVariants
+*/
+func (h *memoryChatSessionHandle) SelectLatestExchangeVariant(
+	ctxt context.Context, variantIndex int,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read newest exchange variants")
+		return err
+	}
+	if err := h.checkVersion(sessionEntry); err != nil {
+		return err
+	}
+	exchange, err := h.latestExchange()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read newest exchange variants")
+		return err
+	}
+	variantCount := len(exchange.Variants)
+	if variantCount == 0 {
+		variantCount = 1
+	}
+	if variantIndex < 0 || variantIndex >= variantCount {
+		return fmt.Errorf(
+			"variant %d does not exist, newest exchange has %d variants", variantIndex, variantCount,
+		)
+	}
+	// The exchange was never regenerated, so the only variant is already selected
+	if len(exchange.Variants) == 0 {
+		return nil
+	}
+	for idx := range exchange.Variants {
+		exchange.Variants[idx].Selected = idx == variantIndex
+	}
+	exchange.Response = exchange.Variants[variantIndex].Response
+	exchange.ResponseTimestamp = exchange.Variants[variantIndex].ResponseTimestamp
+	h.historyChanged(sessionEntry)
+	return nil
+}
+
+/*
+DeleteExchanges delete exchanges from the session, and record an audit record for each
+
+	@param ctxt context.Context - query context
+	@param exchangeIDs []string - IDs of the exchanges to delete
+	@param reason string - why the exchanges are deleted
+*/
+func (h *memoryChatSessionHandle) DeleteExchanges(
+	ctxt context.Context, exchangeIDs []string, reason string,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to find session exchanges")
+		return err
+	}
+
+	toDelete := map[string]bool{}
+	for _, exchangeID := range exchangeIDs {
+		toDelete[exchangeID] = false
+	}
+	for _, oneExchange := range sessionEntry.Exchanges {
+		if _, ok := toDelete[oneExchange.ID]; ok {
+			toDelete[oneExchange.ID] = true
+		}
+	}
+	for exchangeID, found := range toDelete {
+		if !found {
+			return fmt.Errorf("exchange '%s' does not exist in session '%s'", exchangeID, h.id)
+		}
+	}
+
+	currentTime := time.Now()
+	remaining := []memoryChatExchangeEntry{}
+	for _, oneExchange := range sessionEntry.Exchanges {
+		if !toDelete[oneExchange.ID] {
+			remaining = append(remaining, oneExchange)
+			continue
+		}
+		sessionEntry.AuditRecords = append(sessionEntry.AuditRecords, ChatExchangeAuditRecord{
+			ExchangeID:       oneExchange.ID,
+			Action:           ChatExchangeDeleted,
+			RequestTimestamp: oneExchange.RequestTimestamp,
+			Reason:           reason,
+			Timestamp:        currentTime,
+		})
+	}
+	sessionEntry.Exchanges = remaining
+	h.historyChanged(sessionEntry)
+
+	log.WithFields(logtags).Debugf("Deleted %d exchanges", len(toDelete))
+
+	return nil
+}
+
+/*
+EditExchange change the stored request or response text of an exchange, and record an
+audit record for each change
+
+If the exchange has response variants, only the selected variant is changed.
+
+	@param ctxt context.Context - query context
+	@param exchangeID string - ID of the exchange to change
+	@param edit ChatExchangeEdit - the changes
+*/
+func (h *memoryChatSessionHandle) EditExchange(
+	ctxt context.Context, exchangeID string, edit ChatExchangeEdit,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := edit.validate(); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Exchange edit not valid")
+		return err
+	}
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to find exchange '%s'", exchangeID)
+		return err
+	}
+
+	var exchange *memoryChatExchangeEntry
+	for idx := range sessionEntry.Exchanges {
+		if sessionEntry.Exchanges[idx].ID == exchangeID {
+			exchange = &sessionEntry.Exchanges[idx]
+		}
+	}
+	if exchange == nil {
+		return fmt.Errorf("exchange '%s' does not exist in session '%s'", exchangeID, h.id)
+	}
+
+	audit := func(action ChatExchangeAuditAction) {
+		sessionEntry.AuditRecords = append(sessionEntry.AuditRecords, ChatExchangeAuditRecord{
+			ExchangeID:       exchangeID,
+			Action:           action,
+			RequestTimestamp: exchange.RequestTimestamp,
+			Reason:           edit.Reason,
+			Timestamp:        time.Now(),
+		})
+	}
+	if edit.Request != nil {
+		exchange.Request = *edit.Request
+		audit(ChatExchangeRequestEdited)
+	}
+	if edit.Response != nil {
+		exchange.Response = *edit.Response
+		audit(ChatExchangeResponseEdited)
+		// The other variants may hold the same text the edit removes
+		selected := []ChatExchangeVariant{}
+		for _, variant := range exchange.Variants {
+			if variant.Selected {
+				variant.Response = *edit.Response
+				selected = append(selected, variant)
+			}
+		}
+		if len(selected) != len(exchange.Variants) {
+			exchange.Variants = selected
+			audit(ChatExchangeVariantsDeleted)
+		}
+	}
+	h.historyChanged(sessionEntry)
+
+	return nil
+}
+
+/*
+ExchangeAuditRecords fetch the audit records of changes made to the session exchanges
+
+	@param ctxt context.Context - query context
+	@return the audit records, oldest first
+*/
+func (h *memoryChatSessionHandle) ExchangeAuditRecords(
+	ctxt context.Context,
+) ([]ChatExchangeAuditRecord, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read exchange audit records")
+		return nil, err
+	}
+	return append([]ChatExchangeAuditRecord{}, sessionEntry.AuditRecords...), nil
+}
+
+/*
+PinNote pin a note to the session
+
+	@param ctxt context.Context - query context
+	@param note ChatSessionNote - the note
+	@return the new note ID
+*/
+func (h *memoryChatSessionHandle) PinNote(
+	ctxt context.Context, note ChatSessionNote,
+) (string, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := note.validate(); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Pinned note not valid")
+		return "", err
+	}
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to pin note")
+		return "", err
+	}
+	note.ID = ulid.Make().String()
+	note.CreatedAt = time.Now()
+	sessionEntry.PinnedNotes = append(sessionEntry.PinnedNotes, note)
+
+	log.WithFields(logtags).Debugf("Pinned note '%s'", note.ID)
+
+	return note.ID, nil
+}
+
+/*
+PinnedNotes fetch the notes pinned to the session
+
+	@param ctxt context.Context - query context
+	@return the pinned notes, oldest first
+*/
+func (h *memoryChatSessionHandle) PinnedNotes(ctxt context.Context) ([]ChatSessionNote, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read pinned notes")
+		return nil, err
+	}
+	return append([]ChatSessionNote{}, sessionEntry.PinnedNotes...), nil
+}
+
+/*
+UnpinNote remove a note pinned to the session
+
+	@param ctxt context.Context - query context
+	@param noteID string - ID of the note
+*/
+func (h *memoryChatSessionHandle) UnpinNote(ctxt context.Context, noteID string) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.Lock()
+	defer h.driver.driver.store.lock.Unlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to unpin note '%s'", noteID)
+		return err
+	}
+	for idx, oneNote := range sessionEntry.PinnedNotes {
+		if oneNote.ID == noteID {
+			sessionEntry.PinnedNotes = append(
+				sessionEntry.PinnedNotes[:idx], sessionEntry.PinnedNotes[idx+1:]...,
+			)
+			return nil
+		}
+	}
+	return fmt.Errorf("pinned note '%s' does not exist in session '%s'", noteID, h.id)
+}
+
+/*
+Refresh helper function to sync the handler with what is stored in persistence
+
+	@param ctxt context.Context - query context
+*/
+func (h *memoryChatSessionHandle) Refresh(ctxt context.Context) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.driver.store.lock.RLock()
+	defer h.driver.driver.store.lock.RUnlock()
+	sessionEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to refresh chat session '%s' info", h.id)
+		return err
+	}
+	h.version = sessionEntry.Version
+	return nil
+}
+
+// ============================================================================================
+// In-memory Chat Session Manager implementation
+
+// defineSessionHandle helper function for defining new session handle object. Caller must
+// hold the store lock.
+func (c *memoryChatPersistence) defineSessionHandle(
+	ctxt context.Context, sessionID string,
+) *memoryChatSessionHandle {
+	logtags := c.GetLogTagsForContext(ctxt)
+	logtags["session"] = sessionID
+	return &memoryChatSessionHandle{
+		Component: goutils.Component{
+			LogTags:         logtags,
+			LogTagModifiers: []goutils.LogMetadataModifier{},
+		},
+		driver:    c,
+		validator: validator.New(),
+		id:        sessionID,
+		version:   c.driver.store.sessions[sessionID].Version,
+	}
+}
+
+/*
+ownedSession fetch a chat session record owned by the associated user. Caller must hold
+the store lock.
+
+	@param sessionID string - session ID
+	@return the chat session record
+*/
+func (c *memoryChatPersistence) ownedSession(sessionID string) (*memoryChatSessionEntry, error) {
+	sessionEntry, ok := c.driver.store.sessions[sessionID]
+	if !ok || sessionEntry.UserID != c.user.id || sessionEntry.DeletedAt != nil {
+		return nil, fmt.Errorf("chat session '%s' does not exist", sessionID)
+	}
+	return sessionEntry, nil
+}
+
+/*
+trashedSession fetch a chat session in the trash, if it is owned by the associated user.
+Caller must hold the store lock.
+
+	@param sessionID string - session ID
+	@return the chat session record
+*/
+func (c *memoryChatPersistence) trashedSession(sessionID string) (*memoryChatSessionEntry, error) {
+	sessionEntry, ok := c.driver.store.sessions[sessionID]
+	if !ok || sessionEntry.UserID != c.user.id || sessionEntry.DeletedAt == nil {
+		return nil, fmt.Errorf("chat session '%s' is not in the trash", sessionID)
+	}
+	return sessionEntry, nil
+}
+
+/*
+changeSessionState move a chat session to a new state. Caller must hold the store lock.
+
+	@param sessionEntry *memoryChatSessionEntry - the chat session entry
+	@param newState ChatSessionState - the new session state
+*/
+func (c *memoryChatPersistence) changeSessionState(
+	sessionEntry *memoryChatSessionEntry, newState ChatSessionState,
+) error {
+	if err := ValidateChatSessionStateTransition(sessionEntry.State, newState); err != nil {
+		return err
+	}
+	sessionEntry.State = newState
+	sessionEntry.UpdatedAt = time.Now()
+	// An archived session can not be the active session
+	if newState == ChatSessionStateArchived {
+		if userEntry, err := c.user.entry(); err == nil {
+			if userEntry.ActiveSessionID != nil && *userEntry.ActiveSessionID == sessionEntry.ID {
+				userEntry.ActiveSessionID = nil
+			}
+		}
+	}
+	return nil
+}
+
+/*
+deleteSessions move chat sessions owned by the associated user to the trash. Sessions not
+owned by the user are ignored. Caller must hold the store lock.
+
+	@param sessionIDs []string - session IDs
+*/
+func (c *memoryChatPersistence) deleteSessions(sessionIDs []string) {
+	currentTime := time.Now()
+	for _, sessionID := range sessionIDs {
+		sessionEntry, err := c.ownedSession(sessionID)
+		if err != nil {
+			continue
+		}
+		deletedAt := currentTime
+		sessionEntry.DeletedAt = &deletedAt
+		// In case the deleted session was the current active session for the user
+		if userEntry, err := c.user.entry(); err == nil {
+			if userEntry.ActiveSessionID != nil && *userEntry.ActiveSessionID == sessionID {
+				userEntry.ActiveSessionID = nil
+			}
+		}
+	}
+}
+
+/*
+NewSession define a new chat session
+
+	@param ctxt context.Context - query context
+	@param model stirng - OpenAI model name
+	@return	new chat session
+*/
+func (c *memoryChatPersistence) NewSession(ctxt context.Context, model string) (ChatSession, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+
+	userEntry, err := c.user.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to get associated user")
+		return nil, err
+	}
+	settings := userDefaultChatSettings(userEntry.DefaultChatSettings)
+	if model != "" {
+		settings.Model = model
+	}
+
+	sessionID := ulid.Make().String()
+	currentTime := time.Now()
+	c.driver.store.sessions[sessionID] = &memoryChatSessionEntry{
+		ID:             sessionID,
+		State:          ChatSessionStateOpen,
+		UserID:         c.user.id,
+		CommonSettings: settings,
+		Exchanges:      []memoryChatExchangeEntry{},
+		CreatedAt:      currentTime,
+		UpdatedAt:      currentTime,
+	}
+	c.driver.store.sessionOrder = append(c.driver.store.sessionOrder, sessionID)
+
+	log.WithFields(logtags).Debugf("Defined new chat session '%s'", sessionID)
+
+	return c.defineSessionHandle(ctxt, sessionID), nil
+}
+
+/*
+ForkSession define a new chat session which starts as a copy of an existing session
+
+The new session copies the settings, the pinned notes, and the first exchanges of the
+source session.
+
+	@param ctxt context.Context - query context
+	@param sourceSessionID string - ID of the session to fork from
+	@param exchangeCount int - number of leading exchanges to copy. All are copied if negative.
+	@return new chat session
+*/
+func (c *memoryChatPersistence) ForkSession(
+	ctxt context.Context, sourceSessionID string, exchangeCount int,
+) (ChatSession, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	sourceEntry, err := c.ownedSession(sourceSessionID)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to query entry for session '%s'", sourceSessionID)
+		return nil, err
+	}
+	sourceExchanges := sourceEntry.Exchanges
+	if exchangeCount > len(sourceExchanges) {
+		return nil, fmt.Errorf(
+			"session '%s' only has %d exchanges", sourceSessionID, len(sourceExchanges),
+		)
+	}
+	if exchangeCount >= 0 {
+		sourceExchanges = sourceExchanges[:exchangeCount]
+	}
+
+	sessionID := ulid.Make().String()
+	currentTime := time.Now()
+	newEntry := &memoryChatSessionEntry{
+		ID:             sessionID,
+		State:          ChatSessionStateOpen,
+		UserID:         c.user.id,
+		CommonSettings: sourceEntry.CommonSettings,
+		Exchanges:      []memoryChatExchangeEntry{},
+		CreatedAt:      currentTime,
+		UpdatedAt:      currentTime,
+	}
+	for _, oneExchange := range sourceExchanges {
+		newEntry.insertExchange(oneExchange.ChatExchange)
+	}
+	for _, oneNote := range sourceEntry.PinnedNotes {
+		oneNote.ID = ulid.Make().String()
+		oneNote.CreatedAt = currentTime
+		newEntry.PinnedNotes = append(newEntry.PinnedNotes, oneNote)
+	}
+	c.driver.store.sessions[sessionID] = newEntry
+	c.driver.store.sessionOrder = append(c.driver.store.sessionOrder, sessionID)
+
+	log.
+		WithFields(logtags).
+		Debugf(
+			"Forked chat session '%s' from '%s' with %d exchanges",
+			sessionID,
+			sourceSessionID,
+			len(sourceExchanges),
+		)
+
+	return c.defineSessionHandle(ctxt, sessionID), nil
+}
+
+/*
+ListSessions list all sessions
+
+	@param ctxt context.Context - query context
+	@return all known sessions
+*/
+func (c *memoryChatPersistence) ListSessions(ctxt context.Context) ([]ChatSession, error) {
+	c.driver.store.lock.RLock()
+	defer c.driver.store.lock.RUnlock()
+	result := []ChatSession{}
+	for _, sessionID := range c.driver.store.sessionOrder {
+		if _, err := c.ownedSession(sessionID); err == nil {
+			result = append(result, c.defineSessionHandle(ctxt, sessionID))
+		}
+	}
+	return result, nil
+}
+
+/*
+ListSessionsWithTag list all sessions with a tag
+
+	@param ctxt context.Context - query context
+	@param tag string - session tag
+	@return all sessions with the tag
+*/
+func (c *memoryChatPersistence) ListSessionsWithTag(
+	ctxt context.Context, tag string,
+) ([]ChatSession, error) {
+	c.driver.store.lock.RLock()
+	defer c.driver.store.lock.RUnlock()
+	result := []ChatSession{}
+	for _, sessionID := range c.driver.store.sessionOrder {
+		sessionEntry, err := c.ownedSession(sessionID)
+		if err != nil {
+			continue
+		}
+		for _, oneTag := range sessionEntry.Metadata.Tags {
+			if oneTag == tag {
+				result = append(result, c.defineSessionHandle(ctxt, sessionID))
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+/*
+ListSessionSummaries list summaries of the sessions matching a query, one page at a time
+
+	@param ctxt context.Context - query context
+	@param query ChatSessionListQuery - filters and pagination parameters
+	@return one page of session summaries
+*/
+func (c *memoryChatPersistence) ListSessionSummaries(
+	ctxt context.Context, query ChatSessionListQuery,
+) (ChatSessionSummaryPage, error) {
+	c.driver.store.lock.RLock()
+	defer c.driver.store.lock.RUnlock()
+	result := ChatSessionSummaryPage{Sessions: []ChatSessionSummary{}}
+	for _, sessionID := range c.driver.store.sessionOrder {
+		sessionEntry, err := c.ownedSession(sessionID)
+		if err != nil {
+			continue
+		}
+		if query.After != "" && sessionID <= query.After {
+			continue
+		}
+		if len(query.States) > 0 {
+			matched := false
+			for _, oneState := range query.States {
+				if sessionEntry.State == oneState {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		if query.Tag != "" {
+			matched := false
+			for _, oneTag := range sessionEntry.Metadata.Tags {
+				if oneTag == query.Tag {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		if query.Limit > 0 && len(result.Sessions) == query.Limit {
+			result.NextCursor = result.Sessions[len(result.Sessions)-1].SessionID
+			break
+		}
+		result.Sessions = append(result.Sessions, sessionEntry.summary())
+	}
+	return result, nil
+}
+
+/*
+GetSession fetch a session
+
+	@param ctxt context.Context - query context
+	@param sessionID string - session ID
+	@return session entry
+*/
+func (c *memoryChatPersistence) GetSession(
+	ctxt context.Context, sessionID string,
+) (ChatSession, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	c.driver.store.lock.RLock()
+	defer c.driver.store.lock.RUnlock()
+	if _, err := c.ownedSession(sessionID); err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to query entry for session '%s'", sessionID)
+		return nil, err
+	}
+	return c.defineSessionHandle(ctxt, sessionID), nil
+}
+
+/*
+CurrentActiveSession get the current active chat session for the associated user
+
+	@param ctxt context.Context - query context
+	@return session entry
+*/
+func (c *memoryChatPersistence) CurrentActiveSession(ctxt context.Context) (ChatSession, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	activeSessionID, err := c.user.GetActiveSessionID(ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read user's active session ID")
+		return nil, err
+	}
+	if activeSessionID == nil {
+		// The user has no active sessions
+		err := fmt.Errorf("user has not set an active session")
+		log.WithError(err).WithFields(logtags).Debug("Failed to read active session ID")
+		return nil, err
+	}
+	return c.GetSession(ctxt, *activeSessionID)
+}
+
+/*
+SetActiveSession set the current active chat session for the associated user
+
+	@param ctxt context.Context - query context
+	@param session ChatSession - the chat session
+*/
+func (c *memoryChatPersistence) SetActiveSession(ctxt context.Context, session ChatSession) error {
+	logtags := c.GetLogTagsForContext(ctxt)
+	sessionID, err := session.SessionID(ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read session ID")
+		return err
+	}
+	c.driver.store.lock.RLock()
+	sessionEntry, err := c.ownedSession(sessionID)
+	if err == nil && sessionEntry.State == ChatSessionStateArchived {
+		err = fmt.Errorf("chat session '%s' is archived", sessionID)
+	}
+	c.driver.store.lock.RUnlock()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Session '%s' can not be made active", sessionID)
+		return err
+	}
+	return c.user.SetActiveSessionID(ctxt, sessionID)
+}
+
+/*
+ArchiveIdleSessions archive all open or closed sessions which were not used recently
+
+	@param ctxt context.Context - query context
+	@param idleTimeout time.Duration - how long a session can go unused before it is archived
+	@return IDs of the archived sessions
+*/
+func (c *memoryChatPersistence) ArchiveIdleSessions(
+	ctxt context.Context, idleTimeout time.Duration,
+) ([]string, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	if idleTimeout <= 0 {
+		return nil, fmt.Errorf("idle timeout must be positive")
+	}
+	cutoff := time.Now().Add(-idleTimeout)
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	archived := []string{}
+	for _, sessionID := range c.driver.store.sessionOrder {
+		sessionEntry, err := c.ownedSession(sessionID)
+		if err != nil || sessionEntry.State == ChatSessionStateArchived {
+			continue
+		}
+		if !sessionEntry.lastActivity().Before(cutoff) {
+			continue
+		}
+		if err := c.changeSessionState(sessionEntry, ChatSessionStateArchived); err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Failed to archive idle session '%s'", sessionID)
+			return nil, err
+		}
+		archived = append(archived, sessionID)
+	}
+	return archived, nil
+}
+
+/*
+DeleteSession move a session to the trash
+
+	@param ctxt context.Context - query context
+	@param sessionID string - session ID
+*/
+func (c *memoryChatPersistence) DeleteSession(ctxt context.Context, sessionID string) error {
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	c.deleteSessions([]string{sessionID})
+	return nil
+}
+
+/*
+DeleteMultipleSessions move multiple sessions to the trash
+
+	@param ctxt context.Context - query context
+	@param sessionIDs []string - session IDs
+*/
+func (c *memoryChatPersistence) DeleteMultipleSessions(
+	ctxt context.Context, sessionIDs []string,
+) error {
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	c.deleteSessions(sessionIDs)
+	return nil
+}
+
+/*
+DeleteAllSessions move all sessions to the trash
+
+	@param ctxt context.Context - query context
+*/
+func (c *memoryChatPersistence) DeleteAllSessions(ctxt context.Context) error {
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	sessionIDs := []string{}
+	for _, sessionID := range c.driver.store.sessionOrder {
+		if _, err := c.ownedSession(sessionID); err == nil {
+			sessionIDs = append(sessionIDs, sessionID)
+		}
+	}
+	c.deleteSessions(sessionIDs)
+	return nil
+}
+
+/*
+ListTrash list summaries of the sessions in the trash
+
+	@param ctxt context.Context - query context
+	@return the session summaries, most recently deleted first
+*/
+func (c *memoryChatPersistence) ListTrash(ctxt context.Context) ([]ChatSessionSummary, error) {
+	c.driver.store.lock.RLock()
+	defer c.driver.store.lock.RUnlock()
+	result := []ChatSessionSummary{}
+	for _, sessionID := range c.driver.store.sessionOrder {
+		sessionEntry, err := c.trashedSession(sessionID)
+		if err != nil {
+			continue
+		}
+		summary := sessionEntry.summary()
+		deletedAt := *sessionEntry.DeletedAt
+		summary.DeletedAt = &deletedAt
+		result = append(result, summary)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].DeletedAt.After(*result[j].DeletedAt)
+	})
+	return result, nil
+}
+
+/*
+RestoreSession move a session out of the trash
+
+	@param ctxt context.Context - query context
+	@param sessionID string - session ID
+*/
+func (c *memoryChatPersistence) RestoreSession(ctxt context.Context, sessionID string) error {
+	logtags := c.GetLogTagsForContext(ctxt)
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	sessionEntry, err := c.trashedSession(sessionID)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Unable to restore chat session '%s'", sessionID)
+		return err
+	}
+	sessionEntry.DeletedAt = nil
+	return nil
+}
+
+/*
+EmptyTrash permanently delete the sessions in the trash
+
+	@param ctxt context.Context - query context
+	@param olderThan time.Duration - only delete sessions which were moved to the trash at least
+	    this long ago. All sessions in the trash are deleted if zero.
+	@return IDs of the deleted sessions
+*/
+func (c *memoryChatPersistence) EmptyTrash(
+	ctxt context.Context, olderThan time.Duration,
+) ([]string, error) {
+	if olderThan < 0 {
+		return nil, fmt.Errorf("trash age can not be negative")
+	}
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	cutoff := time.Now().Add(-olderThan)
+	result := []string{}
+	for _, sessionID := range c.driver.store.sessionOrder {
+		sessionEntry, err := c.trashedSession(sessionID)
+		if err != nil || sessionEntry.DeletedAt.After(cutoff) {
+			continue
+		}
+		result = append(result, sessionID)
+	}
+	for _, sessionID := range result {
+		delete(c.driver.store.sessions, sessionID)
+		c.driver.store.sessionOrder = removeFromOrder(c.driver.store.sessionOrder, sessionID)
+	}
+	return result, nil
+}
+
+/*
+SessionsToPrune find the sessions, including those in the trash, which exceed a retention
+policy
+
+	@param ctxt context.Context - query context
+	@param policy RetentionPolicy - the retention policy
+	@param dbSize int64 - current DB size in bytes. The DB size limit is not enforced if zero.
+	@return the sessions to prune, least recently used first. A session which is kept, but
+	    has exchanges older than the max age, lists only those exchanges to prune.
+*/
+func (c *memoryChatPersistence) SessionsToPrune(
+	ctxt context.Context, policy RetentionPolicy, dbSize int64,
+) ([]ChatSessionPruneCandidate, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	if err := policy.Validate(); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Invalid retention policy")
+		return nil, err
+	}
+	c.driver.store.lock.RLock()
+	defer c.driver.store.lock.RUnlock()
+	currentTime := time.Now()
+	sessions := []ChatSessionPruneCandidate{}
+	for _, sessionID := range c.driver.store.sessionOrder {
+		sessionEntry, ok := c.driver.store.sessions[sessionID]
+		if !ok || sessionEntry.UserID != c.user.id {
+			continue
+		}
+		candidate := ChatSessionPruneCandidate{
+			SessionID:    sessionID,
+			LastActivity: sessionEntry.lastActivity(),
+			Trashed:      sessionEntry.DeletedAt != nil,
+		}
+		for _, exchange := range sessionEntry.Exchanges {
+			size := int64(len(exchange.Request) + len(exchange.Response))
+			for _, oneAttachment := range exchange.Attachments {
+				size += oneAttachment.Size()
+			}
+			for _, variant := range exchange.Variants {
+				size += int64(len(variant.Response))
+			}
+			candidate.Size += size
+			if policy.MaxAge > 0 &&
+				exchange.RequestTimestamp.Before(currentTime.Add(-policy.MaxAge)) {
+				candidate.expired = append(
+					candidate.expired, expiredChatExchange{ID: exchange.ID, Size: size},
+				)
+			}
+		}
+		sessions = append(sessions, candidate)
+	}
+	return selectSessionsToPrune(sessions, policy, dbSize, currentTime), nil
+}
+
+/*
+PurgeSessions permanently delete sessions, whether or not they are in the trash
+
+	@param ctxt context.Context - query context
+	@param sessionIDs []string - session IDs
+*/
+func (c *memoryChatPersistence) PurgeSessions(ctxt context.Context, sessionIDs []string) error {
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	for _, sessionID := range sessionIDs {
+		sessionEntry, ok := c.driver.store.sessions[sessionID]
+		if !ok || sessionEntry.UserID != c.user.id {
+			continue
+		}
+		delete(c.driver.store.sessions, sessionID)
+		c.driver.store.sessionOrder = removeFromOrder(c.driver.store.sessionOrder, sessionID)
+		// In case the deleted session was the current active session for the user
+		if userEntry, ok := c.driver.store.users[c.user.id]; ok {
+			if userEntry.ActiveSessionID != nil && *userEntry.ActiveSessionID == sessionID {
+				userEntry.ActiveSessionID = nil
+			}
+		}
+	}
+	return nil
+}
+
+/*
+PurgeExchanges permanently delete exchanges, along with their response variants and attached
+files, from the sessions they belong to
+
+	@param ctxt context.Context - query context
+	@param exchangeIDs []string - exchange IDs
+*/
+func (c *memoryChatPersistence) PurgeExchanges(ctxt context.Context, exchangeIDs []string) error {
+	purge := map[string]bool{}
+	for _, exchangeID := range exchangeIDs {
+		purge[exchangeID] = true
+	}
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	for _, sessionEntry := range c.driver.store.sessions {
+		if sessionEntry.UserID != c.user.id {
+			continue
+		}
+		kept := []memoryChatExchangeEntry{}
+		for _, exchange := range sessionEntry.Exchanges {
+			if !purge[exchange.ID] {
+				kept = append(kept, exchange)
+			}
+		}
+		if len(kept) != len(sessionEntry.Exchanges) {
+			sessionEntry.Exchanges = kept
+			sessionEntry.Version++
+		}
+	}
+	return nil
+}
+
+/*
+ExchangeContents fetch the request time, request, and response of every exchange of the
+associated user's chat sessions, excluding those in the trash. Nothing else about the
+exchanges is loaded.
+
+	@param ctxt context.Context - query context
+	@return the exchanges, grouped by session ID
+*/
+func (c *memoryChatPersistence) ExchangeContents(
+	ctxt context.Context,
+) (map[string][]ChatExchange, error) {
+	c.driver.store.lock.RLock()
+	defer c.driver.store.lock.RUnlock()
+	result := map[string][]ChatExchange{}
+	for sessionID, sessionEntry := range c.driver.store.sessions {
+		if sessionEntry.UserID != c.user.id || sessionEntry.DeletedAt != nil {
+			continue
+		}
+		for _, exchange := range sessionEntry.Exchanges {
+			result[sessionID] = append(result[sessionID], ChatExchange{
+				RequestTimestamp: exchange.RequestTimestamp,
+				Request:          exchange.Request,
+				Response:         exchange.Response,
+			})
+		}
+	}
+	return result, nil
+}
+
+/*
+SearchExchanges search through the exchanges of all chat sessions of the associated user
+
+An exchange matches if its request or response contains every search term, ignoring case.
+Results are ordered newest first.
+
+	@param ctxt context.Context - query context
+	@param query ChatExchangeSearchQuery - search parameters
+	@return matching exchanges, best matches first
+*/
+func (c *memoryChatPersistence) SearchExchanges(
+	ctxt context.Context, query ChatExchangeSearchQuery,
+) ([]ChatExchangeSearchResult, error) {
+	terms := searchTerms(query.Terms)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("no search terms given")
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultSearchResultLimit
+	}
+
+	c.driver.store.lock.RLock()
+	defer c.driver.store.lock.RUnlock()
+
+	containsAll := func(exchange ChatExchange) bool {
+		request := strings.ToLower(exchange.Request)
+		response := strings.ToLower(exchange.Response)
+		for _, term := range terms {
+			lowered := strings.ToLower(term)
+			if !strings.Contains(request, lowered) && !strings.Contains(response, lowered) {
+				return false
+			}
+		}
+		return true
+	}
+
+	result := []ChatExchangeSearchResult{}
+	for _, sessionID := range c.driver.store.sessionOrder {
+		sessionEntry, err := c.ownedSession(sessionID)
+		if err != nil {
+			continue
+		}
+		if query.SessionID != nil && *query.SessionID != sessionID {
+			continue
+		}
+		if query.Model != nil && *query.Model != sessionEntry.CommonSettings.Model {
+			continue
+		}
+		for _, exchange := range sessionEntry.Exchanges {
+			if query.Since != nil && exchange.RequestTimestamp.Before(*query.Since) {
+				continue
+			}
+			if !containsAll(exchange.ChatExchange) {
+				continue
+			}
+			result = append(result, ChatExchangeSearchResult{
+				SessionID:        sessionID,
+				RequestTimestamp: exchange.RequestTimestamp,
+				RequestSnippet: highlightSnippet(
+					exchange.Request, terms, query.HighlightStart, query.HighlightEnd, searchSnippetTokens,
+				),
+				ResponseSnippet: highlightSnippet(
+					exchange.Response, terms, query.HighlightStart, query.HighlightEnd, searchSnippetTokens,
+				),
+			})
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].RequestTimestamp.After(result[j].RequestTimestamp)
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+/*
+RecordPreset record a new chat session preset
+
+	@param ctxt context.Context - query context
+	@param preset ChatSessionPreset - the preset. The name must not already be in use.
+*/
+func (c *memoryChatPersistence) RecordPreset(ctxt context.Context, preset ChatSessionPreset) error {
+	logtags := c.GetLogTagsForContext(ctxt)
+	if err := preset.validateName(); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Preset name not valid")
+		return err
+	}
+	if err := validator.New().Struct(&preset.Settings); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Preset settings not valid")
+		return err
+	}
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	userEntry, err := c.user.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to get associated user")
+		return err
+	}
+	if _, ok := userEntry.Presets[preset.Name]; ok {
+		return fmt.Errorf("chat session preset '%s' already exists", preset.Name)
+	}
+	if userEntry.Presets == nil {
+		userEntry.Presets = map[string]ChatSessionParameters{}
+	}
+	userEntry.Presets[preset.Name] = preset.Settings
+	return nil
+}
+
+/*
+ListPresets list all chat session presets
+
+	@param ctxt context.Context - query context
+	@return all presets, sorted by name
+*/
+func (c *memoryChatPersistence) ListPresets(ctxt context.Context) ([]ChatSessionPreset, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	c.driver.store.lock.RLock()
+	defer c.driver.store.lock.RUnlock()
+	userEntry, err := c.user.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to get associated user")
+		return nil, err
+	}
+	result := []ChatSessionPreset{}
+	for name, settings := range userEntry.Presets {
+		result = append(result, ChatSessionPreset{Name: name, Settings: settings})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+/*
+GetPreset fetch a chat session preset
+
+	@param ctxt context.Context - query context
+	@param name string - preset name
+	@return the preset
+*/
+func (c *memoryChatPersistence) GetPreset(ctxt context.Context, name string) (ChatSessionPreset, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	c.driver.store.lock.RLock()
+	defer c.driver.store.lock.RUnlock()
+	userEntry, err := c.user.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to get associated user")
+		return ChatSessionPreset{}, err
+	}
+	settings, ok := userEntry.Presets[name]
+	if !ok {
+		return ChatSessionPreset{}, fmt.Errorf("chat session preset '%s' does not exist", name)
+	}
+	return ChatSessionPreset{Name: name, Settings: settings}, nil
+}
+
+/*
+UpdatePreset replace the settings of an existing chat session preset
+
+	@param ctxt context.Context - query context
+	@param preset ChatSessionPreset - the preset with its new settings
+*/
+func (c *memoryChatPersistence) UpdatePreset(ctxt context.Context, preset ChatSessionPreset) error {
+	logtags := c.GetLogTagsForContext(ctxt)
+	if err := validator.New().Struct(&preset.Settings); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Preset settings not valid")
+		return err
+	}
+	c.driver.store.lock.Lock()
+	defer c.driver.store.lock.Unlock()
+	userEntry, err := c.user.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to get associated user")
+		return err
+	}
+	if _, ok := userEntry.Presets[preset.Name]; !ok {
+		return fmt.Errorf("chat session preset '%s' does not exist", preset.Name)
+	}
+	userEntry.Presets[preset.Name] = preset.Settings
+	return nil
+}
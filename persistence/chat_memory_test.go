@@ -0,0 +1,233 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryChatManager(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatManager(t, userManager)
+}
+
+func TestMemoryUserActiveSessionSet(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testUserActiveSessionSet(t, userManager)
+}
+
+func TestMemoryChatSession(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatSession(t, userManager)
+}
+
+func TestMemoryChatExchange(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatExchange(t, userManager)
+}
+
+func TestMemoryMutlChatSessionDelete(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testMultiChatSessionDelete(t, userManager)
+}
+
+func TestMemoryConcurrentExchanges(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	utContext := context.Background()
+
+	// Create test user
+	user0, err := userManager.RecordNewUser(utContext, "unit-tester-0")
+	assert.Nil(err)
+
+	// Create chat manager
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	uut, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+
+	// Record exchanges from multiple threads
+	currentTime := time.Now()
+	wg := sync.WaitGroup{}
+	for workerItr := 0; workerItr < 4; workerItr++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			for exItr := 0; exItr < 25; exItr++ {
+				requestTime := currentTime.Add(time.Second * time.Duration(workerID*100+exItr))
+				assert.Nil(uut.RecordOneExchange(utContext, ChatExchange{
+					RequestTimestamp:  requestTime,
+					Request:           fmt.Sprintf("req-%d-%d-%s", workerID, exItr, uuid.NewString()),
+					ResponseTimestamp: requestTime.Add(time.Millisecond),
+					Response:          fmt.Sprintf("resp-%d-%d-%s", workerID, exItr, uuid.NewString()),
+				}))
+				_, err := uut.Exchanges(utContext)
+				assert.Nil(err)
+			}
+		}(workerItr)
+	}
+	wg.Wait()
+
+	exchanges, err := uut.Exchanges(utContext)
+	assert.Nil(err)
+	assert.Len(exchanges, 100)
+	for idx := 1; idx < len(exchanges); idx++ {
+		assert.True(exchanges[idx-1].RequestTimestamp.Before(exchanges[idx].RequestTimestamp))
+	}
+}
+
+func TestMemoryChatSessionMetadata(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatSessionMetadata(t, userManager)
+}
+
+func TestMemoryForkChatSession(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testForkChatSession(t, userManager)
+}
+
+func TestMemoryChatExchangeVariants(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatExchangeVariants(t, userManager)
+}
+
+func TestMemoryEditExchanges(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testEditExchanges(t, userManager)
+}
+
+func TestMemoryChatSessionLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatSessionLifecycle(t, userManager)
+}
+
+func TestMemoryChatSessionSummaries(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatSessionSummaries(t, userManager)
+}
+
+func TestMemoryChatSessionTrash(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatSessionTrash(t, userManager)
+}
+
+func TestMemoryChatSessionRetention(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatSessionRetention(t, userManager)
+}
+
+func TestMemoryChatSessionConcurrentChange(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatSessionConcurrentChange(t, userManager)
+}
+
+func TestMemoryChatSessionPinnedNotes(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatSessionPinnedNotes(t, userManager)
+}
+
+func TestMemoryChatSessionPresets(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatSessionPresets(t, userManager)
+}
+
+func TestMemoryChatExchangeAttachments(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatExchangeAttachments(t, userManager)
+}
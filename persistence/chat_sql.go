@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/alwitt/goutils"
@@ -23,10 +25,20 @@ type sqlChatSessionEntry struct {
 	UserID string       `gorm:"not null;index:chat_session_user_id"`
 	User   sqlUserEntry `gorm:"constraint:OnDelete:CASCADE;foreignKey:UserID"`
 	// CommonSettings common session parameters
-	CommonSettings ChatSessionParameters  `gorm:"not null;type:text;serializer:json"`
-	Exchanges      []sqlChatExchangeEntry `gorm:"foreignKey:SessionID"`
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	CommonSettings ChatSessionParameters `gorm:"not null;type:text;serializer:json"`
+	// Version of the session history, advanced by every change to the exchanges
+	Version int64 `gorm:"not null;default:0"`
+	// Title chat session title
+	Title string `gorm:"not null;default:''"`
+	// Description chat session description
+	Description string                   `gorm:"not null;default:''"`
+	Exchanges   []sqlChatExchangeEntry   `gorm:"foreignKey:SessionID"`
+	Tags        []sqlChatSessionTagEntry `gorm:"foreignKey:SessionID"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	// DeletedAt when the chat session was moved to the trash. Sessions in the trash are
+	// excluded from normal queries.
+	DeletedAt gorm.DeletedAt `gorm:"index:chat_session_deleted_at"`
 }
 
 // TableName hard code table name
@@ -34,6 +46,19 @@ func (sqlChatSessionEntry) TableName() string {
 	return "chat_sessions"
 }
 
+// sqlChatSessionTagEntry SQL table representing one chat session tag
+type sqlChatSessionTagEntry struct {
+	// SessionID ID of the tagged chat session
+	SessionID string `gorm:"primaryKey"`
+	// Tag the tag
+	Tag string `gorm:"primaryKey;type:varchar(64);index:chat_session_tag"`
+}
+
+// TableName hard code table name
+func (sqlChatSessionTagEntry) TableName() string {
+	return "chat_session_tags"
+}
+
 /*
 sqlChatExchangeEntry SQL table representing one chat session exchange
 
@@ -43,12 +68,12 @@ type sqlChatExchangeEntry struct {
 	// ID chat exchange entry ID
 	ID string `gorm:"primaryKey"`
 	// SessionID ID of the session this exchange is attached to
-	SessionID string              `gorm:"not null;index:chat_exchange_session_id"`
+	SessionID string              `gorm:"not null;index:chat_exchange_session_id;index:chat_exchange_session_request_ts,priority:1"`
 	Session   sqlChatSessionEntry `gorm:"constraint:OnDelete:CASCADE;foreignKey:SessionID"`
 	// Request the user request
 	Request string `gorm:"not null;type:text"`
 	// RequestTimestamp when the request was made
-	RequestTimestamp time.Time `gorm:"not null"`
+	RequestTimestamp time.Time `gorm:"not null;index:chat_exchange_session_request_ts,priority:2"`
 	// Response the model response
 	Response string `gorm:"not null;type:text"`
 	// ResponseTimestamp when the response was received
@@ -62,6 +87,187 @@ func (sqlChatExchangeEntry) TableName() string {
 	return "chat_session_exchanges"
 }
 
+// sqlChatExchangeAttachmentEntry SQL table representing one file attached to a chat exchange
+type sqlChatExchangeAttachmentEntry struct {
+	// ID attachment entry ID
+	ID string `gorm:"primaryKey"`
+	// ExchangeID ID of the exchange the file is attached to
+	ExchangeID string               `gorm:"not null;index:chat_exchange_attachment_exchange_id"`
+	Exchange   sqlChatExchangeEntry `gorm:"constraint:OnDelete:CASCADE;foreignKey:ExchangeID"`
+	// Name the file name
+	Name string `gorm:"not null"`
+	// Content the file content
+	Content   string `gorm:"not null;type:text"`
+	CreatedAt time.Time
+}
+
+// TableName hard code table name
+func (sqlChatExchangeAttachmentEntry) TableName() string {
+	return "chat_exchange_attachments"
+}
+
+/*
+recordExchangeAttachments record the files attached to a chat exchange
+
+	@param tx *gorm.DB - DB transaction
+	@param exchangeID string - ID of the exchange
+	@param attachments []ChatExchangeAttachment - the attached files
+*/
+func recordExchangeAttachments(
+	tx *gorm.DB, exchangeID string, attachments []ChatExchangeAttachment,
+) error {
+	for _, oneAttachment := range attachments {
+		if err := oneAttachment.validate(); err != nil {
+			return err
+		}
+		entry := sqlChatExchangeAttachmentEntry{
+			ID:         ulid.Make().String(),
+			ExchangeID: exchangeID,
+			Name:       oneAttachment.Name,
+			Content:    oneAttachment.Content,
+		}
+		if tmp := tx.Create(&entry); tmp.Error != nil {
+			return tmp.Error
+		}
+	}
+	return nil
+}
+
+/*
+chatExchangesFromEntries convert exchange entries into chat exchanges, along with the files
+attached to them
+
+	@param tx *gorm.DB - DB transaction
+	@param entries []sqlChatExchangeEntry - the exchange entries
+	@return the chat exchanges, in the same order as the entries
+*/
+func chatExchangesFromEntries(
+	tx *gorm.DB, entries []sqlChatExchangeEntry,
+) ([]ChatExchange, error) {
+	result := []ChatExchange{}
+	if len(entries) == 0 {
+		return result, nil
+	}
+	exchangeIDs := []string{}
+	for _, entry := range entries {
+		exchangeIDs = append(exchangeIDs, entry.ID)
+	}
+	var attachmentEntries []sqlChatExchangeAttachmentEntry
+	if tmp := tx.
+		Where("exchange_id IN ?", exchangeIDs).
+		Order("id").
+		Find(&attachmentEntries); tmp.Error != nil {
+		return nil, tmp.Error
+	}
+	attachments := map[string][]ChatExchangeAttachment{}
+	for _, oneAttachment := range attachmentEntries {
+		attachments[oneAttachment.ExchangeID] = append(
+			attachments[oneAttachment.ExchangeID],
+			ChatExchangeAttachment{Name: oneAttachment.Name, Content: oneAttachment.Content},
+		)
+	}
+	for _, entry := range entries {
+		result = append(result, ChatExchange{
+			ID:                entry.ID,
+			RequestTimestamp:  entry.RequestTimestamp,
+			Request:           entry.Request,
+			ResponseTimestamp: entry.ResponseTimestamp,
+			Response:          entry.Response,
+			Attachments:       attachments[entry.ID],
+		})
+	}
+	return result, nil
+}
+
+/*
+sqlChatExchangeVariantEntry SQL table representing one response variant of a chat exchange
+
+Variants are only recorded once an exchange is regenerated.
+*/
+type sqlChatExchangeVariantEntry struct {
+	// ID variant entry ID
+	ID string `gorm:"primaryKey"`
+	// ExchangeID ID of the exchange this variant is attached to
+	ExchangeID string               `gorm:"not null;index:chat_exchange_variant_exchange_id"`
+	Exchange   sqlChatExchangeEntry `gorm:"constraint:OnDelete:CASCADE;foreignKey:ExchangeID"`
+	// Response the model response
+	Response string `gorm:"not null;type:text"`
+	// ResponseTimestamp when the response was received
+	ResponseTimestamp time.Time `gorm:"not null"`
+	// Model the model which generated the response
+	Model string `gorm:"not null;type:varchar(64);default:''"`
+	// Temperature the request temperature used to generate the response
+	Temperature *float32
+	// Selected whether this is the selected response of the exchange
+	Selected  bool `gorm:"not null;default:false"`
+	CreatedAt time.Time
+}
+
+// TableName hard code table name
+func (sqlChatExchangeVariantEntry) TableName() string {
+	return "chat_exchange_variants"
+}
+
+// sqlChatExchangeAuditEntry SQL table representing one change made to a chat exchange
+type sqlChatExchangeAuditEntry struct {
+	// ID audit entry ID
+	ID string `gorm:"primaryKey"`
+	// SessionID ID of the session the changed exchange belongs to
+	SessionID string              `gorm:"not null;index:chat_exchange_audit_session_id"`
+	Session   sqlChatSessionEntry `gorm:"constraint:OnDelete:CASCADE;foreignKey:SessionID"`
+	// ExchangeID ID of the changed exchange
+	ExchangeID string `gorm:"not null"`
+	// Action the change made
+	Action ChatExchangeAuditAction `gorm:"not null;type:varchar(32)"`
+	// RequestTimestamp when the request of the changed exchange was made
+	RequestTimestamp time.Time `gorm:"not null"`
+	// Reason why the change was made
+	Reason    string `gorm:"not null;default:''"`
+	CreatedAt time.Time
+}
+
+// TableName hard code table name
+func (sqlChatExchangeAuditEntry) TableName() string {
+	return "chat_exchange_audit"
+}
+
+// sqlChatSessionNoteEntry SQL table representing one note pinned to a chat session
+type sqlChatSessionNoteEntry struct {
+	// ID note entry ID
+	ID string `gorm:"primaryKey"`
+	// SessionID ID of the session the note is pinned to
+	SessionID string              `gorm:"not null;index:chat_session_note_session_id"`
+	Session   sqlChatSessionEntry `gorm:"constraint:OnDelete:CASCADE;foreignKey:SessionID"`
+	// Content the note text
+	Content string `gorm:"not null"`
+	// Source the file the content was read from
+	Source    string `gorm:"not null;default:''"`
+	CreatedAt time.Time
+}
+
+// TableName hard code table name
+func (sqlChatSessionNoteEntry) TableName() string {
+	return "chat_session_notes"
+}
+
+// sqlChatSessionPresetEntry SQL table representing one chat session preset
+type sqlChatSessionPresetEntry struct {
+	// UserID ID of the user owning the preset
+	UserID string       `gorm:"primaryKey"`
+	User   sqlUserEntry `gorm:"constraint:OnDelete:CASCADE;foreignKey:UserID"`
+	// Name preset name
+	Name string `gorm:"primaryKey;type:varchar(64)"`
+	// Settings the chat session settings
+	Settings  ChatSessionParameters `gorm:"not null;type:text;serializer:json"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName hard code table name
+func (sqlChatSessionPresetEntry) TableName() string {
+	return "chat_session_presets"
+}
+
 // sqlChatSessionHandle wrapper object for working with the "chat_sessions" table
 type sqlChatSessionHandle struct {
 	goutils.Component
@@ -96,21 +302,120 @@ CloseSession close this chat session
 	@param ctxt context.Context - query context
 */
 func (h *sqlChatSessionHandle) CloseSession(ctxt context.Context) error {
+	return h.ChangeState(ctxt, ChatSessionStateClose)
+}
+
+/*
+changeSessionState helper function to move a chat session to a new state
+
+	@param tx *gorm.DB - the current transaction
+	@param entry *sqlChatSessionEntry - the chat session entry
+	@param newState ChatSessionState - the new session state
+*/
+func changeSessionState(tx *gorm.DB, entry *sqlChatSessionEntry, newState ChatSessionState) error {
+	if err := ValidateChatSessionStateTransition(entry.State, newState); err != nil {
+		return err
+	}
+	if tmp := tx.
+		Model(entry).
+		Updates(&sqlChatSessionEntry{State: newState}).
+		First(entry); tmp.Error != nil {
+		return tmp.Error
+	}
+	// An archived session can not be the active session
+	if newState == ChatSessionStateArchived {
+		if tmp := tx.
+			Model(&sqlUserEntry{}).
+			Where("active_session_id = ?", entry.ID).
+			Update("active_session_id", nil); tmp.Error != nil {
+			return tmp.Error
+		}
+	}
+	return nil
+}
+
+/*
+ChangeState move this chat session to a new state
+
+Archiving the session also clears it as the user's active session.
+
+	@param ctxt context.Context - query context
+	@param newState ChatSessionState - the new session state
+*/
+func (h *sqlChatSessionHandle) ChangeState(ctxt context.Context, newState ChatSessionState) error {
 	logtags := h.GetLogTagsForContext(ctxt)
-	return h.driver.db.Transaction(func(tx *gorm.DB) error {
-		tmp := tx.
-			Model(&h.sqlChatSessionEntry).
-			Updates(&sqlChatSessionEntry{State: ChatSessionStateClose}).
-			First(&h.sqlChatSessionEntry)
-		if tmp.Error != nil {
-			log.
-				WithError(tmp.Error).
-				WithFields(logtags).
-				Errorf("Failed to update session state to '%s'", ChatSessionStateClose)
+	// Work against the current state of the session. Only the state is reloaded into the
+	// handle, as the history version must only advance on Refresh.
+	var entry sqlChatSessionEntry
+	if err := h.driver.db.Transaction(func(tx *gorm.DB) error {
+		if tmp := tx.
+			Where(&sqlChatSessionEntry{ID: h.ID}).
+			First(&entry); tmp.Error != nil {
 			return tmp.Error
 		}
-		return nil
-	})
+		return changeSessionState(tx, &entry, newState)
+	}); err != nil {
+		log.
+			WithError(err).
+			WithFields(logtags).
+			Errorf("Failed to update session state to '%s'", newState)
+		return err
+	}
+	h.State = entry.State
+	h.UpdatedAt = entry.UpdatedAt
+	if newState == ChatSessionStateArchived {
+		// In case the archived session was the current active session for the user
+		if err := h.driver.user.Refresh(ctxt); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to refresh user entry after archiving")
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+sessionLastActivity helper function to find when a chat session was last used
+
+	@param tx *gorm.DB - the current transaction
+	@param entry sqlChatSessionEntry - the chat session entry
+	@return time of last activity
+*/
+func sessionLastActivity(tx *gorm.DB, entry sqlChatSessionEntry) (time.Time, error) {
+	var latest []sqlChatExchangeEntry
+	if tmp := tx.
+		Where(&sqlChatExchangeEntry{SessionID: entry.ID}).
+		Order("response_timestamp desc").
+		Limit(1).
+		Find(&latest); tmp.Error != nil {
+		return time.Time{}, tmp.Error
+	}
+	if len(latest) == 0 {
+		return entry.CreatedAt, nil
+	}
+	return latest[0].ResponseTimestamp, nil
+}
+
+/*
+LastActivity when this chat session was last used
+
+This is when the latest response was received, or when the session was created if it has
+no exchanges.
+
+	@param ctxt context.Context - query context
+	@return time of last activity
+*/
+func (h *sqlChatSessionHandle) LastActivity(ctxt context.Context) (time.Time, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	var result time.Time
+	if err := h.driver.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = sessionLastActivity(tx, h.sqlChatSessionEntry)
+		return err
+	}); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read session last activity")
+		return time.Time{}, err
+	}
+	return result, nil
 }
 
 /*
@@ -147,20 +452,178 @@ func (h *sqlChatSessionHandle) ChangeSettings(
 		log.WithError(err).WithFields(logtags).Error("New setting not valid")
 		return err
 	}
-	return h.driver.db.Transaction(func(tx *gorm.DB) error {
-		tmp := tx.
-			Model(&h.sqlChatSessionEntry).
-			Updates(&sqlChatSessionEntry{CommonSettings: newSettings}).
-			First(&h.sqlChatSessionEntry)
-		if tmp.Error != nil {
+	// Only the changed columns are reloaded, as the history version must only advance on Refresh
+	var updated sqlChatSessionEntry
+	if err := h.driver.db.Transaction(func(tx *gorm.DB) error {
+		if tmp := tx.
+			Model(&sqlChatSessionEntry{}).
+			Where(&sqlChatSessionEntry{ID: h.ID}).
+			Updates(&sqlChatSessionEntry{CommonSettings: newSettings}); tmp.Error != nil {
+			return tmp.Error
+		}
+		return tx.
+			Select("common_settings", "updated_at").
+			Where(&sqlChatSessionEntry{ID: h.ID}).
+			First(&updated).
+			Error
+	}); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to update session common settings")
+		return err
+	}
+	h.CommonSettings = updated.CommonSettings
+	h.UpdatedAt = updated.UpdatedAt
+	return nil
+}
+
+/*
+Metadata returns the session title, description, and tags
+
+	@param ctxt context.Context - query context
+	@return session metadata
+*/
+func (h *sqlChatSessionHandle) Metadata(ctxt context.Context) (ChatSessionMetadata, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	result := ChatSessionMetadata{Title: h.Title, Description: h.Description}
+	var tags []sqlChatSessionTagEntry
+	if tmp := h.driver.db.
+		Where(&sqlChatSessionTagEntry{SessionID: h.ID}).
+		Order("tag").
+		Find(&tags); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Error("Failed to read session tags")
+		return result, tmp.Error
+	}
+	for _, tag := range tags {
+		result.Tags = append(result.Tags, tag.Tag)
+	}
+	return result, nil
+}
+
+/*
+ChangeMetadata replace the session title, description, and tags
+
+	@param ctxt context.Context - query context
+	@param newMetadata ChatSessionMetadata - new session metadata
+*/
+func (h *sqlChatSessionHandle) ChangeMetadata(
+	ctxt context.Context, newMetadata ChatSessionMetadata,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	tags, err := NormalizeSessionTags(newMetadata.Tags)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("New metadata not valid")
+		return err
+	}
+	// Only the changed columns are reloaded, as the history version must only advance on Refresh
+	var updated sqlChatSessionEntry
+	if err := h.driver.db.Transaction(func(tx *gorm.DB) error {
+		if tmp := tx.
+			Model(&sqlChatSessionEntry{}).
+			Where(&sqlChatSessionEntry{ID: h.ID}).
+			Updates(map[string]interface{}{
+				"title": newMetadata.Title, "description": newMetadata.Description,
+			}); tmp.Error != nil {
 			log.
 				WithError(tmp.Error).
 				WithFields(logtags).
-				Error("Failed to update session common settings")
+				Error("Failed to update session title and description")
+			return tmp.Error
+		}
+		if tmp := tx.
+			Select("title", "description", "updated_at").
+			Where(&sqlChatSessionEntry{ID: h.ID}).
+			First(&updated); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to read session title")
+			return tmp.Error
+		}
+		if tmp := tx.
+			Where(&sqlChatSessionTagEntry{SessionID: h.ID}).
+			Delete(&sqlChatSessionTagEntry{}); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to clear session tags")
 			return tmp.Error
 		}
+		for _, tag := range tags {
+			if tmp := tx.Create(&sqlChatSessionTagEntry{SessionID: h.ID, Tag: tag}); tmp.Error != nil {
+				log.WithError(tmp.Error).WithFields(logtags).Errorf("Failed to tag session with '%s'", tag)
+				return tmp.Error
+			}
+		}
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+	h.Title = updated.Title
+	h.Description = updated.Description
+	h.UpdatedAt = updated.UpdatedAt
+	return nil
+}
+
+/*
+currentVersion helper function to read the current version of the session history
+
+	@param tx *gorm.DB - the current transaction
+	@return the session history version
+*/
+func (h *sqlChatSessionHandle) currentVersion(tx *gorm.DB) (int64, error) {
+	var versions []int64
+	if tmp := tx.
+		Model(&sqlChatSessionEntry{}).
+		Where(&sqlChatSessionEntry{ID: h.ID}).
+		Pluck("version", &versions); tmp.Error != nil {
+		return 0, tmp.Error
+	}
+	// Also the case if the session was moved to the trash since the handle was fetched
+	if len(versions) == 0 {
+		return 0, fmt.Errorf("chat session '%s' does not exist", h.ID)
+	}
+	return versions[0], nil
+}
+
+/*
+changeHistory helper function to change the session history in one transaction, and advance
+the version of the session history
+
+	@param ctxt context.Context - query context
+	@param strict bool - fail with ErrChatSessionModified if the session history changed since
+	    the handle last loaded it
+	@param change func(tx *gorm.DB) error - makes the change
+*/
+func (h *sqlChatSessionHandle) changeHistory(
+	ctxt context.Context, strict bool, change func(tx *gorm.DB) error,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	var newVersion int64
+	if err := h.driver.db.Transaction(func(tx *gorm.DB) error {
+		currentVersion, err := h.currentVersion(tx)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to read session history version")
+			return err
+		}
+		if strict && currentVersion != h.Version {
+			log.
+				WithFields(logtags).
+				Debugf("Session history at version %d, handle loaded version %d", currentVersion, h.Version)
+			return ErrChatSessionModified
+		}
+		if err := change(tx); err != nil {
+			return err
+		}
+		if tmp := tx.
+			Model(&sqlChatSessionEntry{}).
+			Where(&sqlChatSessionEntry{ID: h.ID}).
+			UpdateColumn("version", gorm.Expr("version + 1")); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to advance session history version")
+			return tmp.Error
+		}
+		newVersion = currentVersion + 1
+		return nil
+	}); err != nil {
+		return err
+	}
+	// Changes made elsewhere which the handle has not loaded must still be detected
+	if newVersion == h.Version+1 {
+		h.Version = newVersion
+	}
+	return nil
 }
 
 /*
@@ -173,7 +636,7 @@ An exchange is defined as a request and its associated response
 */
 func (h *sqlChatSessionHandle) RecordOneExchange(ctxt context.Context, exchange ChatExchange) error {
 	logtags := h.GetLogTagsForContext(ctxt)
-	return h.driver.db.Transaction(func(tx *gorm.DB) error {
+	return h.changeHistory(ctxt, true, func(tx *gorm.DB) error {
 		exchangeID := ulid.Make().String()
 
 		log.WithFields(logtags).Debugf("Define new chat exchange '%s'", exchangeID)
@@ -194,6 +657,20 @@ func (h *sqlChatSessionHandle) RecordOneExchange(ctxt context.Context, exchange
 				Errorf("Failed to define new entry for chat exchange '%s'", exchangeID)
 			return tmp.Error
 		}
+		if err := recordExchangeAttachments(tx, exchangeID, exchange.Attachments); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Failed to record attachments of chat exchange '%s'", exchangeID)
+			return err
+		}
+		if err := h.driver.updateSearchIndex(tx, []string{exchangeID}); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Failed to index chat exchange '%s'", exchangeID)
+			return err
+		}
 
 		log.WithFields(logtags).Debugf("Defined new chat exchange '%s'", exchangeID)
 
@@ -221,12 +698,12 @@ func (h *sqlChatSessionHandle) FirstExchange(ctxt context.Context) (ChatExchange
 			return tmp.Error
 		}
 
-		result = ChatExchange{
-			RequestTimestamp:  entry.RequestTimestamp,
-			Request:           entry.Request,
-			ResponseTimestamp: entry.ResponseTimestamp,
-			Response:          entry.Response,
+		exchanges, err := chatExchangesFromEntries(tx, []sqlChatExchangeEntry{entry})
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to get first exchange attachments")
+			return err
 		}
+		result = exchanges[0]
 		return nil
 	})
 }
@@ -241,8 +718,8 @@ The exchanges are sorted by chronological order.
 */
 func (h *sqlChatSessionHandle) Exchanges(ctxt context.Context) ([]ChatExchange, error) {
 	logtags := h.GetLogTagsForContext(ctxt)
-	result := []ChatExchange{}
-	return result, h.driver.db.Transaction(func(tx *gorm.DB) error {
+	var result []ChatExchange
+	if err := h.driver.db.Transaction(func(tx *gorm.DB) error {
 		var entries []sqlChatExchangeEntry
 
 		if tmp := tx.
@@ -253,136 +730,1445 @@ func (h *sqlChatSessionHandle) Exchanges(ctxt context.Context) ([]ChatExchange,
 			return tmp.Error
 		}
 
-		for _, entry := range entries {
-			result = append(result, ChatExchange{
-				RequestTimestamp:  entry.RequestTimestamp,
-				Request:           entry.Request,
-				ResponseTimestamp: entry.ResponseTimestamp,
-				Response:          entry.Response,
-			})
+		var err error
+		if result, err = chatExchangesFromEntries(tx, entries); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to get session exchange attachments")
+			return err
 		}
 		return nil
-	})
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 /*
-DeleteLatestExchange delete the latest exchange in the session
+LatestExchanges fetch the newest exchanges recorded in this session, without loading the whole
+session history
 
 	@param ctxt context.Context - query context
+	@param count int - max number of exchanges to fetch
+	@return list of exchanges in chronological order
 */
-func (h *sqlChatSessionHandle) DeleteLatestExchange(ctxt context.Context) error {
+func (h *sqlChatSessionHandle) LatestExchanges(ctxt context.Context, count int) ([]ChatExchange, error) {
 	logtags := h.GetLogTagsForContext(ctxt)
-	return h.driver.db.Transaction(func(tx *gorm.DB) error {
-		var entry sqlChatExchangeEntry
+	if count <= 0 {
+		return nil, fmt.Errorf("exchange count must be positive")
+	}
+	var result []ChatExchange
+	if err := h.driver.db.Transaction(func(tx *gorm.DB) error {
+		var entries []sqlChatExchangeEntry
+
 		if tmp := tx.
 			Where(&sqlChatExchangeEntry{SessionID: h.ID}).
-			Order("request_timestamp desc").
-			First(&entry); tmp.Error != nil {
-			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to find newest session exchange")
+			Order("request_timestamp DESC").
+			Limit(count).
+			Find(&entries); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to get latest session exchanges")
 			return tmp.Error
 		}
-		if tmp := tx.Delete(&entry); tmp.Error != nil {
-			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to delete newest session exchange")
-			return tmp.Error
+
+		// Back to chronological order
+		for left, right := 0, len(entries)-1; left < right; left, right = left+1, right-1 {
+			entries[left], entries[right] = entries[right], entries[left]
+		}
+		var err error
+		if result, err = chatExchangesFromEntries(tx, entries); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to get session exchange attachments")
+			return err
 		}
 		return nil
-	})
-}
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
 /*
-Refresh helper function to sync the handler with what is stored in persistence
+DeleteLatestExchange delete the latest exchange in the session
 
 	@param ctxt context.Context - query context
 */
-func (h *sqlChatSessionHandle) Refresh(ctxt context.Context) error {
+func (h *sqlChatSessionHandle) DeleteLatestExchange(ctxt context.Context) error {
 	logtags := h.GetLogTagsForContext(ctxt)
-	return h.driver.db.Transaction(func(tx *gorm.DB) error {
+	return h.changeHistory(ctxt, true, func(tx *gorm.DB) error {
+		var entry sqlChatExchangeEntry
 		if tmp := tx.
-			Where(&sqlChatSessionEntry{ID: h.ID}).
-			First(&h.sqlChatSessionEntry); tmp.Error != nil {
+			Where(&sqlChatExchangeEntry{SessionID: h.ID}).
+			Order("request_timestamp desc").
+			First(&entry); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to find newest session exchange")
+			return tmp.Error
+		}
+		if tmp := tx.Delete(&entry); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to delete newest session exchange")
+			return tmp.Error
+		}
+		if err := h.driver.updateSearchIndex(tx, []string{entry.ID}); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to unindex newest session exchange")
+			return err
+		}
+		return nil
+	})
+}
+
+/*
+ReplaceLatestExchange replace the newest exchange with a new exchange in one operation
+
+	@param ctxt context.Context - query context
+	@param exchange ChatExchange - the replacement exchange
+*/
+func (h *sqlChatSessionHandle) ReplaceLatestExchange(
+	ctxt context.Context, exchange ChatExchange,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	return h.changeHistory(ctxt, true, func(tx *gorm.DB) error {
+		var entry sqlChatExchangeEntry
+		if tmp := tx.
+			Where(&sqlChatExchangeEntry{SessionID: h.ID}).
+			Order("request_timestamp desc").
+			First(&entry); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to find newest session exchange")
+			return tmp.Error
+		}
+		if tmp := tx.Delete(&entry); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to delete newest session exchange")
+			return tmp.Error
+		}
+
+		exchangeID := ulid.Make().String()
+		newEntry := sqlChatExchangeEntry{
+			ID:                exchangeID,
+			SessionID:         h.ID,
+			Request:           exchange.Request,
+			RequestTimestamp:  exchange.RequestTimestamp,
+			Response:          exchange.Response,
+			ResponseTimestamp: exchange.ResponseTimestamp,
+		}
+		if tmp := tx.Create(&newEntry); tmp.Error != nil {
 			log.
 				WithError(tmp.Error).
 				WithFields(logtags).
-				Errorf("Failed to refresh chat session '%s' info", h.ID)
+				Errorf("Failed to define new entry for chat exchange '%s'", exchangeID)
 			return tmp.Error
 		}
+		if err := recordExchangeAttachments(tx, exchangeID, exchange.Attachments); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Failed to record attachments of chat exchange '%s'", exchangeID)
+			return err
+		}
+		if err := h.driver.updateSearchIndex(tx, []string{entry.ID, exchangeID}); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Failed to index chat exchange '%s'", exchangeID)
+			return err
+		}
+
+		log.
+			WithFields(logtags).
+			Debugf("Replaced chat exchange '%s' with '%s'", entry.ID, exchangeID)
+
 		return nil
 	})
 }
 
-// ============================================================================================
-// SQL Chat Session Manager implementation
+/*
+latestExchangeVariants helper function to fetch the newest exchange, and its response variants
 
-// defineSessionHandle helper function for defining new session handle object
-func (c *sqlChatPersistence) defineSessionHandle(ctxt context.Context, sessionEntry sqlChatSessionEntry) sqlChatSessionHandle {
-	logtags := c.GetLogTagsForContext(ctxt)
-	logtags["session"] = sessionEntry.ID
-	return sqlChatSessionHandle{
-		Component: goutils.Component{
-			LogTags:         logtags,
-			LogTagModifiers: []goutils.LogMetadataModifier{},
-		},
-		driver:              c,
-		validator:           validator.New(),
-		sqlChatSessionEntry: sessionEntry,
+If the exchange has no recorded variants, its original response is returned as the only
+variant, with an empty ID.
+
+	@param tx *gorm.DB - DB transaction
+	@return the newest exchange, and its variants oldest first
+*/
+func (h *sqlChatSessionHandle) latestExchangeVariants(
+	tx *gorm.DB,
+) (sqlChatExchangeEntry, []sqlChatExchangeVariantEntry, error) {
+	var exchange sqlChatExchangeEntry
+	if _, err := h.currentVersion(tx); err != nil {
+		return exchange, nil, err
+	}
+	if tmp := tx.
+		Where(&sqlChatExchangeEntry{SessionID: h.ID}).
+		Order("request_timestamp desc").
+		First(&exchange); tmp.Error != nil {
+		return exchange, nil, tmp.Error
 	}
+	var variants []sqlChatExchangeVariantEntry
+	if tmp := tx.
+		Where(&sqlChatExchangeVariantEntry{ExchangeID: exchange.ID}).
+		Order("id").
+		Find(&variants); tmp.Error != nil {
+		return exchange, nil, tmp.Error
+	}
+	if len(variants) == 0 {
+		variants = append(variants, sqlChatExchangeVariantEntry{
+			ExchangeID:        exchange.ID,
+			Response:          exchange.Response,
+			ResponseTimestamp: exchange.ResponseTimestamp,
+			Selected:          true,
+		})
+	}
+	return exchange, variants, nil
 }
 
 /*
-NewSession define a new chat session
+selectExchangeVariant helper function to make a variant the response of its exchange
 
-	@param ctxt context.Context - query context
-	@param model stirng - OpenAI model name
-	@return	new chat session
+	@param tx *gorm.DB - DB transaction
+	@param exchange *sqlChatExchangeEntry - the exchange
+	@param variant sqlChatExchangeVariantEntry - the variant to select
 */
-func (c *sqlChatPersistence) NewSession(ctxt context.Context, model string) (ChatSession, error) {
-	logtags := c.GetLogTagsForContext(ctxt)
-	var result sqlChatSessionHandle
-	return &result, c.db.Transaction(func(tx *gorm.DB) error {
-		sessionID := ulid.Make().String()
+func (h *sqlChatSessionHandle) selectExchangeVariant(
+	tx *gorm.DB, exchange *sqlChatExchangeEntry, variant sqlChatExchangeVariantEntry,
+) error {
+	if tmp := tx.
+		Model(&sqlChatExchangeVariantEntry{}).
+		Where(&sqlChatExchangeVariantEntry{ExchangeID: exchange.ID}).
+		Update("selected", gorm.Expr("id = ?", variant.ID)); tmp.Error != nil {
+		return tmp.Error
+	}
+	if tmp := tx.
+		Model(exchange).
+		Updates(map[string]interface{}{
+			"response": variant.Response, "response_timestamp": variant.ResponseTimestamp,
+		}); tmp.Error != nil {
+		return tmp.Error
+	}
+	return h.driver.updateSearchIndex(tx, []string{exchange.ID})
+}
 
-		log.WithFields(logtags).Debugf("Defining new chat session '%s'", sessionID)
+/*
+RecordLatestExchangeVariant record a new response variant for the newest exchange, and
+select it as the response of the exchange
 
-		userID, err := c.user.GetID(ctxt)
+	@param ctxt context.Context - query context
+	@param variant ChatExchangeVariant - the new response variant
+*/
+func (h *sqlChatSessionHandle) RecordLatestExchangeVariant(
+	ctxt context.Context, variant ChatExchangeVariant,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	return h.changeHistory(ctxt, true, func(tx *gorm.DB) error {
+		exchange, variants, err := h.latestExchangeVariants(tx)
 		if err != nil {
-			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			log.WithError(err).WithFields(logtags).Error("Failed to read newest exchange variants")
 			return err
 		}
 
-		// Define a new session entry
-		newEntry := sqlChatSessionEntry{
-			ID:             sessionID,
-			State:          ChatSessionStateOpen,
-			UserID:         userID,
-			CommonSettings: GetDefaultChatSessionParams(model),
+		// Keep the original response as the first variant
+		if variants[0].ID == "" {
+			variants[0].ID = ulid.Make().String()
+			if tmp := tx.Create(&variants[0]); tmp.Error != nil {
+				log.
+					WithError(tmp.Error).
+					WithFields(logtags).
+					Errorf("Failed to record original response of exchange '%s'", exchange.ID)
+				return tmp.Error
+			}
+		}
+
+		newEntry := sqlChatExchangeVariantEntry{
+			ID:                ulid.Make().String(),
+			ExchangeID:        exchange.ID,
+			Response:          variant.Response,
+			ResponseTimestamp: variant.ResponseTimestamp,
+			Model:             variant.Model,
+			Temperature:       variant.Temperature,
 		}
 		if tmp := tx.Create(&newEntry); tmp.Error != nil {
 			log.
 				WithError(tmp.Error).
 				WithFields(logtags).
-				Errorf("Failed to define new entry for session '%s'", sessionID)
+				Errorf("Failed to record new response variant of exchange '%s'", exchange.ID)
 			return tmp.Error
 		}
 
-		log.WithFields(logtags).Debugf("Defined new chat session '%s'", sessionID)
+		if err := h.selectExchangeVariant(tx, &exchange, newEntry); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Failed to select response variant '%s'", newEntry.ID)
+			return err
+		}
+
+		log.
+			WithFields(logtags).
+			Debugf("Recorded response variant '%s' of exchange '%s'", newEntry.ID, exchange.ID)
 
-		// Prepare wrapper object
-		result = c.defineSessionHandle(ctxt, newEntry)
 		return nil
 	})
 }
 
 /*
-ListSessions list all sessions
+LatestExchangeVariants fetch the response variants of the newest exchange
+
+An exchange which was never regenerated has one variant, its original response.
 
 	@param ctxt context.Context - query context
-	@return all known sessions
+	@return the response variants, oldest first
 */
-func (c *sqlChatPersistence) ListSessions(ctxt context.Context) ([]ChatSession, error) {
+func (h *sqlChatSessionHandle) LatestExchangeVariants(
+	ctxt context.Context,
+) ([]ChatExchangeVariant, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	result := []ChatExchangeVariant{}
+	if err := h.driver.db.Transaction(func(tx *gorm.DB) error {
+		_, variants, err := h.latestExchangeVariants(tx)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to read newest exchange variants")
+			return err
+		}
+		for _, variant := range variants {
+			result = append(result, ChatExchangeVariant{
+				ResponseTimestamp: variant.ResponseTimestamp,
+				Response:          variant.Response,
+				Model:             variant.Model,
+				Temperature:       variant.Temperature,
+				Selected:          variant.Selected,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+SelectLatestExchangeVariant select one of the response variants as the response of the
+newest exchange
+
+	@param ctxt context.Context - query context
+	@param variantIndex int - index of the variant, as listed by LatestExchangeVariants
+*/
+func (h *sqlChatSessionHandle) SelectLatestExchangeVariant(
+	ctxt context.Context, variantIndex int,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	return h.changeHistory(ctxt, true, func(tx *gorm.DB) error {
+		exchange, variants, err := h.latestExchangeVariants(tx)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to read newest exchange variants")
+			return err
+		}
+		if variantIndex < 0 || variantIndex >= len(variants) {
+			return fmt.Errorf(
+				"variant %d does not exist, newest exchange has %d variants", variantIndex, len(variants),
+			)
+		}
+		// The exchange was never regenerated, so the only variant is already selected
+		if variants[variantIndex].ID == "" {
+			return nil
+		}
+		if err := h.selectExchangeVariant(tx, &exchange, variants[variantIndex]); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Failed to select response variant '%s'", variants[variantIndex].ID)
+			return err
+		}
+		return nil
+	})
+}
+
+/*
+recordExchangeAudit helper function to record an audit record for a change to an exchange
+
+	@param tx *gorm.DB - DB transaction
+	@param exchange sqlChatExchangeEntry - the changed exchange
+	@param action ChatExchangeAuditAction - the change made
+	@param reason string - why the change was made
+*/
+func recordExchangeAudit(
+	tx *gorm.DB, exchange sqlChatExchangeEntry, action ChatExchangeAuditAction, reason string,
+) error {
+	return tx.Create(&sqlChatExchangeAuditEntry{
+		ID:               ulid.Make().String(),
+		SessionID:        exchange.SessionID,
+		ExchangeID:       exchange.ID,
+		Action:           action,
+		RequestTimestamp: exchange.RequestTimestamp,
+		Reason:           reason,
+	}).Error
+}
+
+/*
+DeleteExchanges delete exchanges from the session, and record an audit record for each
+
+	@param ctxt context.Context - query context
+	@param exchangeIDs []string - IDs of the exchanges to delete
+	@param reason string - why the exchanges are deleted
+*/
+func (h *sqlChatSessionHandle) DeleteExchanges(
+	ctxt context.Context, exchangeIDs []string, reason string,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	unique := map[string]bool{}
+	for _, exchangeID := range exchangeIDs {
+		unique[exchangeID] = true
+	}
+	return h.changeHistory(ctxt, false, func(tx *gorm.DB) error {
+		var entries []sqlChatExchangeEntry
+		if tmp := tx.
+			Where(&sqlChatExchangeEntry{SessionID: h.ID}).
+			Where("id in ?", exchangeIDs).
+			Find(&entries); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to find session exchanges")
+			return tmp.Error
+		}
+		if len(entries) != len(unique) {
+			for _, entry := range entries {
+				delete(unique, entry.ID)
+			}
+			for exchangeID := range unique {
+				return fmt.Errorf("exchange '%s' does not exist in session '%s'", exchangeID, h.ID)
+			}
+		}
+
+		for _, entry := range entries {
+			if err := recordExchangeAudit(tx, entry, ChatExchangeDeleted, reason); err != nil {
+				log.
+					WithError(err).
+					WithFields(logtags).
+					Errorf("Failed to record audit of exchange '%s' delete", entry.ID)
+				return err
+			}
+			if tmp := tx.Delete(&entry); tmp.Error != nil {
+				log.
+					WithError(tmp.Error).
+					WithFields(logtags).
+					Errorf("Failed to delete exchange '%s'", entry.ID)
+				return tmp.Error
+			}
+		}
+
+		deletedIDs := []string{}
+		for _, entry := range entries {
+			deletedIDs = append(deletedIDs, entry.ID)
+		}
+		if err := h.driver.updateSearchIndex(tx, deletedIDs); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to unindex deleted exchanges")
+			return err
+		}
+
+		log.WithFields(logtags).Debugf("Deleted %d exchanges", len(entries))
+
+		return nil
+	})
+}
+
+/*
+EditExchange change the stored request or response text of an exchange, and record an
+audit record for each change
+
+If the exchange has response variants, only the selected variant is changed.
+
+	@param ctxt context.Context - query context
+	@param exchangeID string - ID of the exchange to change
+	@param edit ChatExchangeEdit - the changes
+*/
+func (h *sqlChatSessionHandle) EditExchange(
+	ctxt context.Context, exchangeID string, edit ChatExchangeEdit,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := edit.validate(); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Exchange edit not valid")
+		return err
+	}
+	return h.changeHistory(ctxt, false, func(tx *gorm.DB) error {
+		var entry sqlChatExchangeEntry
+		if tmp := tx.
+			Where(&sqlChatExchangeEntry{SessionID: h.ID, ID: exchangeID}).
+			First(&entry); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to find exchange '%s'", exchangeID)
+			return tmp.Error
+		}
+
+		changes := map[string]interface{}{}
+		if edit.Request != nil {
+			changes["request"] = *edit.Request
+			if err := recordExchangeAudit(tx, entry, ChatExchangeRequestEdited, edit.Reason); err != nil {
+				log.
+					WithError(err).
+					WithFields(logtags).
+					Errorf("Failed to record audit of exchange '%s' edit", exchangeID)
+				return err
+			}
+		}
+		if edit.Response != nil {
+			changes["response"] = *edit.Response
+			if err := recordExchangeAudit(tx, entry, ChatExchangeResponseEdited, edit.Reason); err != nil {
+				log.
+					WithError(err).
+					WithFields(logtags).
+					Errorf("Failed to record audit of exchange '%s' edit", exchangeID)
+				return err
+			}
+			if tmp := tx.
+				Model(&sqlChatExchangeVariantEntry{}).
+				Where(&sqlChatExchangeVariantEntry{ExchangeID: exchangeID, Selected: true}).
+				Update("response", *edit.Response); tmp.Error != nil {
+				log.
+					WithError(tmp.Error).
+					WithFields(logtags).
+					Errorf("Failed to edit selected response variant of exchange '%s'", exchangeID)
+				return tmp.Error
+			}
+			// The other variants may hold the same text the edit removes
+			tmp := tx.
+				Where("exchange_id = ? AND selected = ?", exchangeID, false).
+				Delete(&sqlChatExchangeVariantEntry{})
+			if tmp.Error != nil {
+				log.
+					WithError(tmp.Error).
+					WithFields(logtags).
+					Errorf("Failed to delete response variants of exchange '%s'", exchangeID)
+				return tmp.Error
+			}
+			if tmp.RowsAffected > 0 {
+				if err := recordExchangeAudit(
+					tx, entry, ChatExchangeVariantsDeleted, edit.Reason,
+				); err != nil {
+					log.
+						WithError(err).
+						WithFields(logtags).
+						Errorf("Failed to record audit of exchange '%s' edit", exchangeID)
+					return err
+				}
+			}
+		}
+		if tmp := tx.Model(&entry).Updates(changes); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to edit exchange '%s'", exchangeID)
+			return tmp.Error
+		}
+		if err := h.driver.updateSearchIndex(tx, []string{exchangeID}); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Failed to index edited exchange '%s'", exchangeID)
+			return err
+		}
+
+		return nil
+	})
+}
+
+/*
+ExchangeAuditRecords fetch the audit records of changes made to the session exchanges
+
+	@param ctxt context.Context - query context
+	@return the audit records, oldest first
+*/
+func (h *sqlChatSessionHandle) ExchangeAuditRecords(
+	ctxt context.Context,
+) ([]ChatExchangeAuditRecord, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	var entries []sqlChatExchangeAuditEntry
+	if tmp := h.driver.db.
+		Where(&sqlChatExchangeAuditEntry{SessionID: h.ID}).
+		Order("id").
+		Find(&entries); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Error("Failed to read exchange audit records")
+		return nil, tmp.Error
+	}
+	result := []ChatExchangeAuditRecord{}
+	for _, entry := range entries {
+		result = append(result, ChatExchangeAuditRecord{
+			ExchangeID:       entry.ExchangeID,
+			Action:           entry.Action,
+			RequestTimestamp: entry.RequestTimestamp,
+			Reason:           entry.Reason,
+			Timestamp:        entry.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+/*
+PinNote pin a note to the session
+
+	@param ctxt context.Context - query context
+	@param note ChatSessionNote - the note
+	@return the new note ID
+*/
+func (h *sqlChatSessionHandle) PinNote(ctxt context.Context, note ChatSessionNote) (string, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := note.validate(); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Pinned note not valid")
+		return "", err
+	}
+	noteID := ulid.Make().String()
+	if err := h.driver.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := h.currentVersion(tx); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to pin note")
+			return err
+		}
+		entry := sqlChatSessionNoteEntry{
+			ID: noteID, SessionID: h.ID, Content: note.Content, Source: note.Source,
+		}
+		if tmp := tx.Create(&entry); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to record pinned note")
+			return tmp.Error
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	log.WithFields(logtags).Debugf("Pinned note '%s'", noteID)
+
+	return noteID, nil
+}
+
+/*
+PinnedNotes fetch the notes pinned to the session
+
+	@param ctxt context.Context - query context
+	@return the pinned notes, oldest first
+*/
+func (h *sqlChatSessionHandle) PinnedNotes(ctxt context.Context) ([]ChatSessionNote, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	var entries []sqlChatSessionNoteEntry
+	if tmp := h.driver.db.
+		Where(&sqlChatSessionNoteEntry{SessionID: h.ID}).
+		Order("id").
+		Find(&entries); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Error("Failed to read pinned notes")
+		return nil, tmp.Error
+	}
+	result := []ChatSessionNote{}
+	for _, entry := range entries {
+		result = append(result, ChatSessionNote{
+			ID: entry.ID, Content: entry.Content, Source: entry.Source, CreatedAt: entry.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+/*
+UnpinNote remove a note pinned to the session
+
+	@param ctxt context.Context - query context
+	@param noteID string - ID of the note
+*/
+func (h *sqlChatSessionHandle) UnpinNote(ctxt context.Context, noteID string) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	tmp := h.driver.db.
+		Where(&sqlChatSessionNoteEntry{ID: noteID, SessionID: h.ID}).
+		Delete(&sqlChatSessionNoteEntry{})
+	if tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Errorf("Failed to unpin note '%s'", noteID)
+		return tmp.Error
+	}
+	if tmp.RowsAffected == 0 {
+		return fmt.Errorf("pinned note '%s' does not exist in session '%s'", noteID, h.ID)
+	}
+	return nil
+}
+
+/*
+Refresh helper function to sync the handler with what is stored in persistence
+
+	@param ctxt context.Context - query context
+*/
+func (h *sqlChatSessionHandle) Refresh(ctxt context.Context) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	return h.driver.db.Transaction(func(tx *gorm.DB) error {
+		if tmp := tx.
+			Where(&sqlChatSessionEntry{ID: h.ID}).
+			First(&h.sqlChatSessionEntry); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to refresh chat session '%s' info", h.ID)
+			return tmp.Error
+		}
+		return nil
+	})
+}
+
+// ============================================================================================
+// SQL Chat Session Manager implementation
+
+// defineSessionHandle helper function for defining new session handle object
+func (c *sqlChatPersistence) defineSessionHandle(ctxt context.Context, sessionEntry sqlChatSessionEntry) sqlChatSessionHandle {
+	logtags := c.GetLogTagsForContext(ctxt)
+	logtags["session"] = sessionEntry.ID
+	return sqlChatSessionHandle{
+		Component: goutils.Component{
+			LogTags:         logtags,
+			LogTagModifiers: []goutils.LogMetadataModifier{},
+		},
+		driver:              c,
+		validator:           validator.New(),
+		sqlChatSessionEntry: sessionEntry,
+	}
+}
+
+/*
+NewSession define a new chat session
+
+	@param ctxt context.Context - query context
+	@param model stirng - OpenAI model name
+	@return	new chat session
+*/
+func (c *sqlChatPersistence) NewSession(ctxt context.Context, model string) (ChatSession, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	var result sqlChatSessionHandle
+	return &result, c.db.Transaction(func(tx *gorm.DB) error {
+		sessionID := ulid.Make().String()
+
+		log.WithFields(logtags).Debugf("Defining new chat session '%s'", sessionID)
+
+		userID, err := c.user.GetID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			return err
+		}
+
+		settings, err := c.user.GetDefaultChatSettings(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get user's default chat settings")
+			return err
+		}
+		if model != "" {
+			settings.Model = model
+		}
+
+		// Define a new session entry
+		newEntry := sqlChatSessionEntry{
+			ID:             sessionID,
+			State:          ChatSessionStateOpen,
+			UserID:         userID,
+			CommonSettings: settings,
+		}
+		if tmp := tx.Create(&newEntry); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to define new entry for session '%s'", sessionID)
+			return tmp.Error
+		}
+
+		log.WithFields(logtags).Debugf("Defined new chat session '%s'", sessionID)
+
+		// Prepare wrapper object
+		result = c.defineSessionHandle(ctxt, newEntry)
+		return nil
+	})
+}
+
+/*
+ForkSession define a new chat session which starts as a copy of an existing session
+
+The new session copies the settings, the pinned notes, and the first exchanges of the
+source session.
+
+	@param ctxt context.Context - query context
+	@param sourceSessionID string - ID of the session to fork from
+	@param exchangeCount int - number of leading exchanges to copy. All are copied if negative.
+	@return new chat session
+*/
+func (c *sqlChatPersistence) ForkSession(
+	ctxt context.Context, sourceSessionID string, exchangeCount int,
+) (ChatSession, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	var result sqlChatSessionHandle
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		userID, err := c.user.GetID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			return err
+		}
+
+		var sourceEntry sqlChatSessionEntry
+		if tmp := tx.
+			Where(&sqlChatSessionEntry{UserID: userID, ID: sourceSessionID}).
+			First(&sourceEntry); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to query entry for session '%s'", sourceSessionID)
+			return tmp.Error
+		}
+
+		var sourceExchanges []sqlChatExchangeEntry
+		if tmp := tx.
+			Where(&sqlChatExchangeEntry{SessionID: sourceSessionID}).
+			Order("request_timestamp").
+			Find(&sourceExchanges); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to read exchanges of session '%s'", sourceSessionID)
+			return tmp.Error
+		}
+		if exchangeCount > len(sourceExchanges) {
+			return fmt.Errorf(
+				"session '%s' only has %d exchanges", sourceSessionID, len(sourceExchanges),
+			)
+		}
+		if exchangeCount >= 0 {
+			sourceExchanges = sourceExchanges[:exchangeCount]
+		}
+
+		sessionID := ulid.Make().String()
+		newEntry := sqlChatSessionEntry{
+			ID:             sessionID,
+			State:          ChatSessionStateOpen,
+			UserID:         userID,
+			CommonSettings: sourceEntry.CommonSettings,
+		}
+		if tmp := tx.Create(&newEntry); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to define new entry for session '%s'", sessionID)
+			return tmp.Error
+		}
+
+		copiedIDs := []string{}
+		for _, oneExchange := range sourceExchanges {
+			copied := sqlChatExchangeEntry{
+				ID:                ulid.Make().String(),
+				SessionID:         sessionID,
+				Request:           oneExchange.Request,
+				RequestTimestamp:  oneExchange.RequestTimestamp,
+				Response:          oneExchange.Response,
+				ResponseTimestamp: oneExchange.ResponseTimestamp,
+			}
+			if tmp := tx.Create(&copied); tmp.Error != nil {
+				log.
+					WithError(tmp.Error).
+					WithFields(logtags).
+					Errorf("Failed to copy exchange '%s' into session '%s'", oneExchange.ID, sessionID)
+				return tmp.Error
+			}
+			copiedIDs = append(copiedIDs, copied.ID)
+			var attachments []sqlChatExchangeAttachmentEntry
+			if tmp := tx.
+				Where(&sqlChatExchangeAttachmentEntry{ExchangeID: oneExchange.ID}).
+				Order("id").
+				Find(&attachments); tmp.Error != nil {
+				log.
+					WithError(tmp.Error).
+					WithFields(logtags).
+					Errorf("Failed to read attachments of exchange '%s'", oneExchange.ID)
+				return tmp.Error
+			}
+			for _, oneAttachment := range attachments {
+				attachmentCopy := sqlChatExchangeAttachmentEntry{
+					ID:         ulid.Make().String(),
+					ExchangeID: copied.ID,
+					Name:       oneAttachment.Name,
+					Content:    oneAttachment.Content,
+				}
+				if tmp := tx.Create(&attachmentCopy); tmp.Error != nil {
+					log.
+						WithError(tmp.Error).
+						WithFields(logtags).
+						Errorf("Failed to copy attachments of exchange '%s'", oneExchange.ID)
+					return tmp.Error
+				}
+			}
+		}
+
+		if err := c.updateSearchIndex(tx, copiedIDs); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Failed to index exchanges copied into session '%s'", sessionID)
+			return err
+		}
+
+		var sourceNotes []sqlChatSessionNoteEntry
+		if tmp := tx.
+			Where(&sqlChatSessionNoteEntry{SessionID: sourceSessionID}).
+			Order("id").
+			Find(&sourceNotes); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to read pinned notes of session '%s'", sourceSessionID)
+			return tmp.Error
+		}
+		for _, oneNote := range sourceNotes {
+			copied := sqlChatSessionNoteEntry{
+				ID:        ulid.Make().String(),
+				SessionID: sessionID,
+				Content:   oneNote.Content,
+				Source:    oneNote.Source,
+			}
+			if tmp := tx.Create(&copied); tmp.Error != nil {
+				log.
+					WithError(tmp.Error).
+					WithFields(logtags).
+					Errorf("Failed to copy pinned note '%s' into session '%s'", oneNote.ID, sessionID)
+				return tmp.Error
+			}
+		}
+
+		log.
+			WithFields(logtags).
+			Debugf(
+				"Forked chat session '%s' from '%s' with %d exchanges",
+				sessionID,
+				sourceSessionID,
+				len(sourceExchanges),
+			)
+
+		// Prepare wrapper object
+		result = c.defineSessionHandle(ctxt, newEntry)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+/*
+ListSessions list all sessions
+
+	@param ctxt context.Context - query context
+	@return all known sessions
+*/
+func (c *sqlChatPersistence) ListSessions(ctxt context.Context) ([]ChatSession, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	result := []ChatSession{}
+	return result, c.db.Transaction(func(tx *gorm.DB) error {
+		var dbEntries []sqlChatSessionEntry
+
+		userID, err := c.user.GetID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			return err
+		}
+
+		if tmp := tx.Where(&sqlChatSessionEntry{UserID: userID}).Find(&dbEntries); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Error("Failed to list all chat sessions")
+			return tmp.Error
+		}
+
+		// Create the wrapper objects
+		for _, sessionEntry := range dbEntries {
+			handleObject := c.defineSessionHandle(ctxt, sessionEntry)
+			result = append(result, &handleObject)
+		}
+
+		return nil
+	})
+}
+
+/*
+ListSessionsWithTag list all sessions with a tag
+
+	@param ctxt context.Context - query context
+	@param tag string - session tag
+	@return all sessions with the tag
+*/
+func (c *sqlChatPersistence) ListSessionsWithTag(
+	ctxt context.Context, tag string,
+) ([]ChatSession, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	result := []ChatSession{}
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		var dbEntries []sqlChatSessionEntry
+
+		userID, err := c.user.GetID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			return err
+		}
+
+		if tmp := tx.
+			Where(&sqlChatSessionEntry{UserID: userID}).
+			Where(
+				"id IN (?)",
+				tx.Model(&sqlChatSessionTagEntry{}).Select("session_id").Where("tag = ?", tag),
+			).
+			Find(&dbEntries); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to list chat sessions tagged '%s'", tag)
+			return tmp.Error
+		}
+
+		// Create the wrapper objects
+		for _, sessionEntry := range dbEntries {
+			handleObject := c.defineSessionHandle(ctxt, sessionEntry)
+			result = append(result, &handleObject)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sqlChatSessionSummaryRow one row of the chat session summary query
+type sqlChatSessionSummaryRow struct {
+	ID             string
+	State          ChatSessionState
+	CommonSettings string
+	Title          string
+	Description    string
+	CreatedAt      time.Time
+	DeletedAt      *time.Time
+	FirstRequest   *string
+	ExchangeCount  int
+	// TagList space separated session tags, in no particular order
+	TagList *string
+}
+
+/*
+sessionSummaryQuery helper function to define the chat session summary query
+
+The per session details are gathered with correlated sub-queries, so one query is enough.
+
+	@param tx *gorm.DB - the current transaction
+	@param userID string - ID of the user owning the sessions
+	@return the query, which can be refined further
+*/
+func sessionSummaryQuery(tx *gorm.DB, userID string) *gorm.DB {
+	return tx.
+		Model(&sqlChatSessionEntry{}).
+		Select(
+			"id, state, common_settings, title, description, created_at, deleted_at, "+
+				"(?) AS first_request, (?) AS exchange_count, (?) AS tag_list",
+			tx.Model(&sqlChatExchangeEntry{}).
+				Select("request").
+				Where("session_id = chat_sessions.id").
+				Order("request_timestamp").
+				Limit(1),
+			tx.Model(&sqlChatExchangeEntry{}).
+				Select("count(*)").
+				Where("session_id = chat_sessions.id"),
+			tx.Model(&sqlChatSessionTagEntry{}).
+				Select("group_concat(tag, ' ')").
+				Where("session_id = chat_sessions.id"),
+		).
+		Where("user_id = ?", userID)
+}
+
+/*
+sessionSummariesFromRows helper function to convert chat session summary query rows
+
+	@param rows []sqlChatSessionSummaryRow - the query rows
+	@return the chat session summaries
+*/
+func sessionSummariesFromRows(rows []sqlChatSessionSummaryRow) ([]ChatSessionSummary, error) {
+	result := []ChatSessionSummary{}
+	for _, oneRow := range rows {
+		var settings ChatSessionParameters
+		if err := json.Unmarshal([]byte(oneRow.CommonSettings), &settings); err != nil {
+			return nil, fmt.Errorf("session '%s' settings not valid: %w", oneRow.ID, err)
+		}
+		summary := ChatSessionSummary{
+			SessionID: oneRow.ID,
+			State:     oneRow.State,
+			Model:     settings.Model,
+			Metadata: ChatSessionMetadata{
+				Title: oneRow.Title, Description: oneRow.Description,
+			},
+			ExchangeCount: oneRow.ExchangeCount,
+			CreatedAt:     oneRow.CreatedAt,
+			DeletedAt:     oneRow.DeletedAt,
+		}
+		if oneRow.FirstRequest != nil {
+			summary.FirstRequest = *oneRow.FirstRequest
+		}
+		if oneRow.TagList != nil {
+			summary.Metadata.Tags = strings.Fields(*oneRow.TagList)
+			sort.Strings(summary.Metadata.Tags)
+		}
+		result = append(result, summary)
+	}
+	return result, nil
+}
+
+/*
+ListSessionSummaries list summaries of the sessions matching a query, one page at a time
+
+	@param ctxt context.Context - query context
+	@param query ChatSessionListQuery - filters and pagination parameters
+	@return one page of session summaries
+*/
+func (c *sqlChatPersistence) ListSessionSummaries(
+	ctxt context.Context, query ChatSessionListQuery,
+) (ChatSessionSummaryPage, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	result := ChatSessionSummaryPage{Sessions: []ChatSessionSummary{}}
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		var rows []sqlChatSessionSummaryRow
+
+		userID, err := c.user.GetID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			return err
+		}
+
+		stmt := sessionSummaryQuery(tx, userID)
+		if len(query.States) > 0 {
+			stmt = stmt.Where("state IN ?", query.States)
+		}
+		if query.Tag != "" {
+			stmt = stmt.Where(
+				"id IN (?)",
+				tx.Model(&sqlChatSessionTagEntry{}).Select("session_id").Where("tag = ?", query.Tag),
+			)
+		}
+		if query.After != "" {
+			stmt = stmt.Where("id > ?", query.After)
+		}
+		stmt = stmt.Order("id")
+		if query.Limit > 0 {
+			// Fetch one more to learn whether there is another page
+			stmt = stmt.Limit(query.Limit + 1)
+		}
+		if tmp := stmt.Find(&rows); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to list chat session summaries")
+			return tmp.Error
+		}
+
+		if query.Limit > 0 && len(rows) > query.Limit {
+			rows = rows[:query.Limit]
+			result.NextCursor = rows[len(rows)-1].ID
+		}
+		result.Sessions, err = sessionSummariesFromRows(rows)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to parse chat session summaries")
+			return err
+		}
+		return nil
+	}); err != nil {
+		return ChatSessionSummaryPage{}, err
+	}
+	return result, nil
+}
+
+/*
+GetSession fetch a session
+
+	@param ctxt context.Context - query context
+	@param sessionID string - session ID
+	@return session entry
+*/
+func (c *sqlChatPersistence) GetSession(ctxt context.Context, sessionID string) (ChatSession, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	var result sqlChatSessionHandle
+	return &result, c.db.Transaction(func(tx *gorm.DB) error {
+		var entry sqlChatSessionEntry
+
+		userID, err := c.user.GetID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			return err
+		}
+
+		if tmp := tx.
+			Where(&sqlChatSessionEntry{UserID: userID, ID: sessionID}).
+			First(&entry); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to query entry for session '%s'", sessionID)
+			return tmp.Error
+		}
+
+		// Prepare wrapper object
+		result = c.defineSessionHandle(ctxt, entry)
+		return nil
+	})
+}
+
+/*
+CurrentActiveSession get the current active chat session for the associated user
+
+	@param ctxt context.Context - query context
+	@return session entry
+*/
+func (c *sqlChatPersistence) CurrentActiveSession(ctxt context.Context) (ChatSession, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	var result *sqlChatSessionHandle = nil
+	return result, c.db.Transaction(func(tx *gorm.DB) error {
+		var entry sqlChatSessionEntry
+
+		activeSessionID, err := c.user.GetActiveSessionID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to read user's active session ID")
+		}
+
+		if activeSessionID == nil {
+			// The user has no active sessions
+			err := fmt.Errorf("user has not set an active session")
+			log.WithError(err).WithFields(logtags).Debug("Failed to read active session ID")
+			return err
+		}
+
+		userID, err := c.user.GetID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			return err
+		}
+
+		if tmp := tx.
+			Where(&sqlChatSessionEntry{UserID: userID, ID: *activeSessionID}).
+			First(&entry); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to query entry for session '%s'", *activeSessionID)
+			return tmp.Error
+		}
+
+		// Prepare wrapper object
+		tmp := c.defineSessionHandle(ctxt, entry)
+		result = &tmp
+		return nil
+	})
+}
+
+/*
+SetActiveSession set the current active chat session for the associated user
+
+	@param ctxt context.Context - query context
+	@param session ChatSession - the chat session
+*/
+func (c *sqlChatPersistence) SetActiveSession(ctxt context.Context, session ChatSession) error {
+	logtags := c.GetLogTagsForContext(ctxt)
+	sessionID, err := session.SessionID(ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read session ID")
+		return err
+	}
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		var entry sqlChatSessionEntry
+		if tmp := tx.Where(&sqlChatSessionEntry{ID: sessionID}).First(&entry); tmp.Error != nil {
+			return tmp.Error
+		}
+		if entry.State == ChatSessionStateArchived {
+			return fmt.Errorf("chat session '%s' is archived", sessionID)
+		}
+		return nil
+	}); err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Session '%s' can not be made active", sessionID)
+		return err
+	}
+	return c.user.SetActiveSessionID(ctxt, sessionID)
+}
+
+/*
+ArchiveIdleSessions archive all open or closed sessions which were not used recently
+
+	@param ctxt context.Context - query context
+	@param idleTimeout time.Duration - how long a session can go unused before it is archived
+	@return IDs of the archived sessions
+*/
+func (c *sqlChatPersistence) ArchiveIdleSessions(
+	ctxt context.Context, idleTimeout time.Duration,
+) ([]string, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	if idleTimeout <= 0 {
+		return nil, fmt.Errorf("idle timeout must be positive")
+	}
+	cutoff := time.Now().Add(-idleTimeout)
+	archived := []string{}
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		userID, err := c.user.GetID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			return err
+		}
+
+		// Find the idle sessions in one query, rather than reading the last activity of each
+		// session. A session without exchanges was last used when it was created.
+		if tmp := tx.
+			Table("chat_sessions AS s").
+			Select("s.id").
+			Joins("LEFT JOIN chat_session_exchanges AS e ON e.session_id = s.id").
+			Where("s.user_id = ? AND s.deleted_at IS NULL AND s.state IN ?", userID, []ChatSessionState{
+				ChatSessionStateOpen, ChatSessionStateClose,
+			}).
+			Group("s.id").
+			Having(
+				"coalesce(max(julianday(e.response_timestamp)), julianday(s.created_at)) < julianday(?)",
+				cutoff.UTC(),
+			).
+			Order("s.id").
+			Pluck("s.id", &archived); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to find idle sessions")
+			return tmp.Error
+		}
+		if len(archived) == 0 {
+			return nil
+		}
+
+		if tmp := tx.
+			Model(&sqlChatSessionEntry{}).
+			Where("id IN ?", archived).
+			Update("state", ChatSessionStateArchived); tmp.Error != nil {
+			t, _ := json.Marshal(&archived)
+			log.WithError(tmp.Error).WithFields(logtags).Errorf("Failed to archive idle sessions %s", t)
+			return tmp.Error
+		}
+		// An archived session can not be the active session
+		if tmp := tx.
+			Model(&sqlUserEntry{}).
+			Where("active_session_id IN ?", archived).
+			Update("active_session_id", nil); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to clear archived active session")
+			return tmp.Error
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(archived) > 0 {
+		// In case an archived session was the current active session for the user
+		if err := c.user.Refresh(ctxt); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to refresh user entry after archiving")
+			return nil, err
+		}
+	}
+	return archived, nil
+}
+
+/*
+trashSessions helper function to move chat sessions of a user to the trash
+
+	@param tx *gorm.DB - the current transaction
+	@param userID string - ID of the user owning the sessions
+	@param sessionIDs []string - session IDs. All sessions of the user are moved if nil.
+*/
+func trashSessions(tx *gorm.DB, userID string, sessionIDs []string) error {
+	stmt := tx.Where(&sqlChatSessionEntry{UserID: userID})
+	if sessionIDs != nil {
+		stmt = stmt.Where("id in ?", sessionIDs)
+	}
+	if tmp := stmt.Delete(&sqlChatSessionEntry{}); tmp.Error != nil {
+		return tmp.Error
+	}
+	// A session in the trash can not be the active session
+	if tmp := tx.
+		Model(&sqlUserEntry{}).
+		Where("id = ?", userID).
+		Where(
+			"active_session_id IN (?)",
+			tx.Unscoped().
+				Model(&sqlChatSessionEntry{}).
+				Select("id").
+				Where("user_id = ? AND deleted_at IS NOT NULL", userID),
+		).
+		Update("active_session_id", nil); tmp.Error != nil {
+		return tmp.Error
+	}
+	return nil
+}
+
+/*
+DeleteSession move a session to the trash
+
+	@param ctxt context.Context - query context
+	@param sessionID string - session ID
+*/
+func (c *sqlChatPersistence) DeleteSession(ctxt context.Context, sessionID string) error {
+	return c.DeleteMultipleSessions(ctxt, []string{sessionID})
+}
+
+/*
+DeleteMultipleSessions move multiple sessions to the trash
+
+	@param ctxt context.Context - query context
+	@param sessionIDs []string - session IDs
+*/
+func (c *sqlChatPersistence) DeleteMultipleSessions(ctxt context.Context, sessionIDs []string) error {
+	logtags := c.GetLogTagsForContext(ctxt)
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		userID, err := c.user.GetID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			return err
+		}
+
+		if err := trashSessions(tx, userID, sessionIDs); err != nil {
+			t, _ := json.Marshal(&sessionIDs)
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Unable to delete chat sessions %s", t)
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	// In case the deleted session was the current active session for the user
+	if err := c.user.Refresh(ctxt); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to refresh user entry after session delete")
+		return err
+	}
+	return nil
+}
+
+/*
+DeleteAllSessions move all sessions to the trash
+
+	@param ctxt context.Context - query context
+*/
+func (c *sqlChatPersistence) DeleteAllSessions(ctxt context.Context) error {
+	logtags := c.GetLogTagsForContext(ctxt)
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		userID, err := c.user.GetID(ctxt)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+			return err
+		}
+
+		if err := trashSessions(tx, userID, nil); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Unable to delete all chat sessions of user '%s'", userID)
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	// In case the deleted session was the current active session for the user
+	if err := c.user.Refresh(ctxt); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to refresh user entry after session delete")
+		return err
+	}
+	return nil
+}
+
+/*
+ListTrash list summaries of the sessions in the trash
+
+	@param ctxt context.Context - query context
+	@return the session summaries, most recently deleted first
+*/
+func (c *sqlChatPersistence) ListTrash(ctxt context.Context) ([]ChatSessionSummary, error) {
 	logtags := c.GetLogTagsForContext(ctxt)
-	result := []ChatSession{}
-	return result, c.db.Transaction(func(tx *gorm.DB) error {
-		var dbEntries []sqlChatSessionEntry
+	result := []ChatSessionSummary{}
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
+		var rows []sqlChatSessionSummaryRow
 
 		userID, err := c.user.GetID(ctxt)
 		if err != nil {
@@ -390,83 +2176,78 @@ func (c *sqlChatPersistence) ListSessions(ctxt context.Context) ([]ChatSession,
 			return err
 		}
 
-		if tmp := tx.Where(&sqlChatSessionEntry{UserID: userID}).Find(&dbEntries); tmp.Error != nil {
-			log.
-				WithError(tmp.Error).
-				WithFields(logtags).
-				Error("Failed to list all chat sessions")
+		if tmp := sessionSummaryQuery(tx, userID).
+			Unscoped().
+			Where("deleted_at IS NOT NULL").
+			Order("deleted_at DESC").
+			Find(&rows); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to list chat sessions in the trash")
 			return tmp.Error
 		}
 
-		// Create the wrapper objects
-		for _, sessionEntry := range dbEntries {
-			handleObject := c.defineSessionHandle(ctxt, sessionEntry)
-			result = append(result, &handleObject)
+		result, err = sessionSummariesFromRows(rows)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to parse chat session summaries")
+			return err
 		}
-
 		return nil
-	})
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 /*
-GetSession fetch a session
+RestoreSession move a session out of the trash
 
 	@param ctxt context.Context - query context
 	@param sessionID string - session ID
-	@return session entry
 */
-func (c *sqlChatPersistence) GetSession(ctxt context.Context, sessionID string) (ChatSession, error) {
+func (c *sqlChatPersistence) RestoreSession(ctxt context.Context, sessionID string) error {
 	logtags := c.GetLogTagsForContext(ctxt)
-	var result sqlChatSessionHandle
-	return &result, c.db.Transaction(func(tx *gorm.DB) error {
-		var entry sqlChatSessionEntry
-
+	return c.db.Transaction(func(tx *gorm.DB) error {
 		userID, err := c.user.GetID(ctxt)
 		if err != nil {
 			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
 			return err
 		}
 
-		if tmp := tx.
-			Where(&sqlChatSessionEntry{UserID: userID, ID: sessionID}).
-			First(&entry); tmp.Error != nil {
+		tmp := tx.
+			Unscoped().
+			Model(&sqlChatSessionEntry{}).
+			Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", sessionID, userID).
+			Update("deleted_at", nil)
+		if tmp.Error != nil {
 			log.
 				WithError(tmp.Error).
 				WithFields(logtags).
-				Errorf("Failed to query entry for session '%s'", sessionID)
+				Errorf("Unable to restore chat session '%s'", sessionID)
 			return tmp.Error
 		}
-
-		// Prepare wrapper object
-		result = c.defineSessionHandle(ctxt, entry)
+		if tmp.RowsAffected == 0 {
+			return fmt.Errorf("chat session '%s' is not in the trash", sessionID)
+		}
 		return nil
 	})
 }
 
 /*
-CurrentActiveSession get the current active chat session for the associated user
+EmptyTrash permanently delete the sessions in the trash
 
 	@param ctxt context.Context - query context
-	@return session entry
+	@param olderThan time.Duration - only delete sessions which were moved to the trash at least
+	    this long ago. All sessions in the trash are deleted if zero.
+	@return IDs of the deleted sessions
 */
-func (c *sqlChatPersistence) CurrentActiveSession(ctxt context.Context) (ChatSession, error) {
+func (c *sqlChatPersistence) EmptyTrash(
+	ctxt context.Context, olderThan time.Duration,
+) ([]string, error) {
 	logtags := c.GetLogTagsForContext(ctxt)
-	var result *sqlChatSessionHandle = nil
-	return result, c.db.Transaction(func(tx *gorm.DB) error {
-		var entry sqlChatSessionEntry
-
-		activeSessionID, err := c.user.GetActiveSessionID(ctxt)
-		if err != nil {
-			log.WithError(err).WithFields(logtags).Error("Failed to read user's active session ID")
-		}
-
-		if activeSessionID == nil {
-			// The user has no active sessions
-			err := fmt.Errorf("user has not set an active session")
-			log.WithError(err).WithFields(logtags).Debug("Failed to read active session ID")
-			return err
-		}
-
+	if olderThan < 0 {
+		return nil, fmt.Errorf("trash age can not be negative")
+	}
+	sessionIDs := []string{}
+	if err := c.db.Transaction(func(tx *gorm.DB) error {
 		userID, err := c.user.GetID(ctxt)
 		if err != nil {
 			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
@@ -474,46 +2255,160 @@ func (c *sqlChatPersistence) CurrentActiveSession(ctxt context.Context) (ChatSes
 		}
 
 		if tmp := tx.
-			Where(&sqlChatSessionEntry{UserID: userID, ID: *activeSessionID}).
-			First(&entry); tmp.Error != nil {
-			log.
-				WithError(tmp.Error).
-				WithFields(logtags).
-				Errorf("Failed to query entry for session '%s'", *activeSessionID)
+			Unscoped().
+			Model(&sqlChatSessionEntry{}).
+			Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+			Where("datetime(deleted_at) <= datetime(?)", time.Now().Add(-olderThan).UTC()).
+			Pluck("id", &sessionIDs); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to list chat sessions in the trash")
 			return tmp.Error
 		}
+		if len(sessionIDs) == 0 {
+			return nil
+		}
 
-		// Prepare wrapper object
-		tmp := c.defineSessionHandle(ctxt, entry)
-		result = &tmp
+		if err := c.purgeSessions(tx, sessionIDs); err != nil {
+			t, _ := json.Marshal(&sessionIDs)
+			log.WithError(err).WithFields(logtags).Errorf("Unable to delete chat sessions %s", t)
+			return err
+		}
 		return nil
-	})
+	}); err != nil {
+		return nil, err
+	}
+	return sessionIDs, nil
 }
 
 /*
-SetActiveSession set the current active chat session for the associated user
+purgeSessions helper function to permanently delete chat sessions
 
-	@param ctxt context.Context - query context
-	@param session ChatSession - the chat session
+	@param tx *gorm.DB - the current transaction
+	@param sessionIDs []string - session IDs
 */
-func (c *sqlChatPersistence) SetActiveSession(ctxt context.Context, session ChatSession) error {
-	logtags := c.GetLogTagsForContext(ctxt)
-	sessionID, err := session.SessionID(ctxt)
-	if err != nil {
-		log.WithError(err).WithFields(logtags).Error("Failed to read session ID")
+func (c *sqlChatPersistence) purgeSessions(tx *gorm.DB, sessionIDs []string) error {
+	// Delete the exchanges first
+	var exchangeIDs []string
+	if tmp := tx.
+		Model(&sqlChatExchangeEntry{}).
+		Where("session_id in ?", sessionIDs).
+		Pluck("id", &exchangeIDs); tmp.Error != nil {
+		return tmp.Error
+	}
+	if tmp := tx.
+		Where("session_id in ?", sessionIDs).
+		Delete(&sqlChatExchangeEntry{}); tmp.Error != nil {
+		return tmp.Error
+	}
+	if err := c.updateSearchIndex(tx, exchangeIDs); err != nil {
 		return err
 	}
-	return c.user.SetActiveSessionID(ctxt, sessionID)
+	// Sessions in the trash are deleted as well
+	return tx.
+		Unscoped().
+		Where("id in ?", sessionIDs).
+		Delete(&sqlChatSessionEntry{}).
+		Error
 }
 
 /*
-DeleteSession delete a session
+sessionStoredSize helper function to approximate the number of bytes of text stored for a
+chat session
 
-	@param ctxt context.Context - query context
+	@param tx *gorm.DB - the current transaction
 	@param sessionID string - session ID
+	@return size in bytes
 */
-func (c *sqlChatPersistence) DeleteSession(ctxt context.Context, sessionID string) error {
+func sessionStoredSize(tx *gorm.DB, sessionID string) (int64, error) {
+	var exchangeSize, variantSize, attachmentSize int64
+	if tmp := tx.
+		Model(&sqlChatExchangeEntry{}).
+		Select("coalesce(sum(length(CAST(request AS BLOB)) + length(CAST(response AS BLOB))), 0)").
+		Where(&sqlChatExchangeEntry{SessionID: sessionID}).
+		Scan(&exchangeSize); tmp.Error != nil {
+		return 0, tmp.Error
+	}
+	if tmp := tx.
+		Model(&sqlChatExchangeVariantEntry{}).
+		Select("coalesce(sum(length(CAST(chat_exchange_variants.response AS BLOB))), 0)").
+		Joins("JOIN chat_session_exchanges AS e ON e.id = chat_exchange_variants.exchange_id").
+		Where("e.session_id = ?", sessionID).
+		Scan(&variantSize); tmp.Error != nil {
+		return 0, tmp.Error
+	}
+	if tmp := tx.
+		Model(&sqlChatExchangeAttachmentEntry{}).
+		Select("coalesce(sum(length(CAST(chat_exchange_attachments.content AS BLOB))), 0)").
+		Joins("JOIN chat_session_exchanges AS e ON e.id = chat_exchange_attachments.exchange_id").
+		Where("e.session_id = ?", sessionID).
+		Scan(&attachmentSize); tmp.Error != nil {
+		return 0, tmp.Error
+	}
+	return exchangeSize + variantSize + attachmentSize, nil
+}
+
+/*
+expiredExchanges helper function to find the exchanges of a user's sessions whose request was
+made before a cutoff time
+
+	@param tx *gorm.DB - the current transaction
+	@param userID string - user ID
+	@param cutoff time.Time - the cutoff time
+	@return the expired exchanges, grouped by session ID
+*/
+func expiredExchanges(
+	tx *gorm.DB, userID string, cutoff time.Time,
+) (map[string][]expiredChatExchange, error) {
+	type expiredEntry struct {
+		ID        string
+		SessionID string
+		Size      int64
+	}
+	var entries []expiredEntry
+	if tmp := tx.
+		Table("chat_session_exchanges AS e").
+		Select(
+			"e.id, e.session_id, "+
+				"length(CAST(e.request AS BLOB)) + length(CAST(e.response AS BLOB)) + "+
+				"coalesce((SELECT sum(length(CAST(v.response AS BLOB))) "+
+				"FROM chat_exchange_variants AS v WHERE v.exchange_id = e.id), 0) + "+
+				"coalesce((SELECT sum(length(CAST(a.content AS BLOB))) "+
+				"FROM chat_exchange_attachments AS a WHERE a.exchange_id = e.id), 0) AS size",
+		).
+		Joins("JOIN chat_sessions AS c ON c.id = e.session_id").
+		Where("c.user_id = ? AND datetime(e.request_timestamp) < datetime(?)", userID, cutoff.UTC()).
+		Order("e.request_timestamp").
+		Scan(&entries); tmp.Error != nil {
+		return nil, tmp.Error
+	}
+	result := map[string][]expiredChatExchange{}
+	for _, entry := range entries {
+		result[entry.SessionID] = append(
+			result[entry.SessionID], expiredChatExchange{ID: entry.ID, Size: entry.Size},
+		)
+	}
+	return result, nil
+}
+
+/*
+SessionsToPrune find the sessions, including those in the trash, which exceed a retention
+policy
+
+	@param ctxt context.Context - query context
+	@param policy RetentionPolicy - the retention policy
+	@param dbSize int64 - current DB size in bytes. The DB size limit is not enforced if zero.
+	@return the sessions to prune, least recently used first. A session which is kept, but
+	    has exchanges older than the max age, lists only those exchanges to prune.
+*/
+func (c *sqlChatPersistence) SessionsToPrune(
+	ctxt context.Context, policy RetentionPolicy, dbSize int64,
+) ([]ChatSessionPruneCandidate, error) {
 	logtags := c.GetLogTagsForContext(ctxt)
+	if err := policy.Validate(); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Invalid retention policy")
+		return nil, err
+	}
+	sessions := []ChatSessionPruneCandidate{}
+	currentTime := time.Now()
 	if err := c.db.Transaction(func(tx *gorm.DB) error {
 		userID, err := c.user.GetID(ctxt)
 		if err != nil {
@@ -521,46 +2416,61 @@ func (c *sqlChatPersistence) DeleteSession(ctxt context.Context, sessionID strin
 			return err
 		}
 
-		// Delete the exchanges first
+		var entries []sqlChatSessionEntry
 		if tmp := tx.
-			Where(&sqlChatExchangeEntry{SessionID: sessionID}).
-			Delete(&sqlChatExchangeEntry{}); tmp.Error != nil {
-			log.
-				WithError(tmp.Error).
-				WithFields(logtags).
-				Errorf("Unable to delete chat exchanges of session '%s'", sessionID)
+			Unscoped().
+			Where(&sqlChatSessionEntry{UserID: userID}).
+			Find(&entries); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to list chat sessions")
 			return tmp.Error
 		}
 
-		// Delete the chat session
-		if tmp := tx.
-			Where(&sqlChatSessionEntry{UserID: userID, ID: sessionID}).
-			Delete(&sqlChatSessionEntry{}); tmp.Error != nil {
-			log.
-				WithError(tmp.Error).
-				WithFields(logtags).
-				Errorf("Unable to delete chat session '%s'", sessionID)
-			return tmp.Error
+		expired := map[string][]expiredChatExchange{}
+		if policy.MaxAge > 0 {
+			if expired, err = expiredExchanges(
+				tx, userID, currentTime.Add(-policy.MaxAge),
+			); err != nil {
+				log.WithError(err).WithFields(logtags).Error("Failed to find expired exchanges")
+				return err
+			}
+		}
+
+		for _, entry := range entries {
+			lastActivity, err := sessionLastActivity(tx, entry)
+			if err != nil {
+				log.
+					WithError(err).
+					WithFields(logtags).
+					Errorf("Failed to read session '%s' last activity", entry.ID)
+				return err
+			}
+			size, err := sessionStoredSize(tx, entry.ID)
+			if err != nil {
+				log.WithError(err).WithFields(logtags).Errorf("Failed to read session '%s' size", entry.ID)
+				return err
+			}
+			sessions = append(sessions, ChatSessionPruneCandidate{
+				SessionID:    entry.ID,
+				LastActivity: lastActivity,
+				Size:         size,
+				Trashed:      entry.DeletedAt.Valid,
+				expired:      expired[entry.ID],
+			})
 		}
 		return nil
 	}); err != nil {
-		return err
-	}
-	// In case the deleted session was the current active session for the user
-	if err := c.user.Refresh(ctxt); err != nil {
-		log.WithError(err).WithFields(logtags).Error("Failed to refresh user entry after session delete")
-		return err
+		return nil, err
 	}
-	return nil
+	return selectSessionsToPrune(sessions, policy, dbSize, currentTime), nil
 }
 
 /*
-DeleteMultipleSessions delete multiple sessions
+PurgeSessions permanently delete sessions, whether or not they are in the trash
 
 	@param ctxt context.Context - query context
 	@param sessionIDs []string - session IDs
 */
-func (c *sqlChatPersistence) DeleteMultipleSessions(ctxt context.Context, sessionIDs []string) error {
+func (c *sqlChatPersistence) PurgeSessions(ctxt context.Context, sessionIDs []string) error {
 	logtags := c.GetLogTagsForContext(ctxt)
 	if err := c.db.Transaction(func(tx *gorm.DB) error {
 		userID, err := c.user.GetID(ctxt)
@@ -569,104 +2479,292 @@ func (c *sqlChatPersistence) DeleteMultipleSessions(ctxt context.Context, sessio
 			return err
 		}
 
-		// Delete the exchanges first
+		// Only sessions owned by the user are deleted
+		var ownedIDs []string
 		if tmp := tx.
-			Where("session_id in ?", sessionIDs).
-			Delete(&sqlChatExchangeEntry{}); tmp.Error != nil {
-			t, _ := json.Marshal(&sessionIDs)
-			log.
-				WithError(tmp.Error).
-				WithFields(logtags).
-				Errorf("Unable to delete chat exchanges of sessions %s", t)
+			Unscoped().
+			Model(&sqlChatSessionEntry{}).
+			Where("user_id = ? AND id in ?", userID, sessionIDs).
+			Pluck("id", &ownedIDs); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to find chat sessions")
 			return tmp.Error
 		}
+		if len(ownedIDs) == 0 {
+			return nil
+		}
 
-		// Delete the chat sessions
-		if tmp := tx.
-			Where(&sqlChatSessionEntry{UserID: userID}).
-			Where("id in ?", sessionIDs).
-			Delete(&sqlChatSessionEntry{}); tmp.Error != nil {
-			t, _ := json.Marshal(&sessionIDs)
-			log.
-				WithError(tmp.Error).
-				WithFields(logtags).
-				Errorf("Unable to delete chat sessions %s", t)
-			return tmp.Error
+		if err := c.purgeSessions(tx, ownedIDs); err != nil {
+			t, _ := json.Marshal(&ownedIDs)
+			log.WithError(err).WithFields(logtags).Errorf("Unable to delete chat sessions %s", t)
+			return err
 		}
 		return nil
 	}); err != nil {
 		return err
 	}
-	// In case the deleted session was the current active session for the user
+	// In case the active session was deleted
 	if err := c.user.Refresh(ctxt); err != nil {
-		log.WithError(err).WithFields(logtags).Error("Failed to refresh user entry after session delete")
+		log.WithError(err).WithFields(logtags).Error("Failed to refresh user entry after purging")
 		return err
 	}
 	return nil
 }
 
 /*
-DeleteMultipleSessions delete all sessions
+PurgeExchanges permanently delete exchanges, along with their response variants and attached
+files, from the sessions they belong to
 
 	@param ctxt context.Context - query context
+	@param exchangeIDs []string - exchange IDs
 */
-func (c *sqlChatPersistence) DeleteAllSessions(ctxt context.Context) error {
+func (c *sqlChatPersistence) PurgeExchanges(ctxt context.Context, exchangeIDs []string) error {
 	logtags := c.GetLogTagsForContext(ctxt)
-	if err := c.db.Transaction(func(tx *gorm.DB) error {
+	return c.db.Transaction(func(tx *gorm.DB) error {
 		userID, err := c.user.GetID(ctxt)
 		if err != nil {
 			log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
 			return err
 		}
 
-		// Find all chat sessions attached to the user
-		var allSessions []sqlChatSessionEntry
-		if tmp := tx.Where(&sqlChatSessionEntry{UserID: userID}).Find(&allSessions); tmp.Error != nil {
-			log.
-				WithError(err).
-				WithFields(logtags).
-				Errorf("Could not get all sessions of user '%s'", userID)
-			return err
+		// Only exchanges of sessions owned by the user are deleted
+		type ownedEntry struct {
+			ID        string
+			SessionID string
+		}
+		var owned []ownedEntry
+		if tmp := tx.
+			Table("chat_session_exchanges AS e").
+			Select("e.id, e.session_id").
+			Joins("JOIN chat_sessions AS c ON c.id = e.session_id").
+			Where("c.user_id = ? AND e.id in ?", userID, exchangeIDs).
+			Scan(&owned); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to find chat exchanges")
+			return tmp.Error
 		}
-		if len(allSessions) < 1 {
+		if len(owned) == 0 {
 			return nil
 		}
-
-		// Extract session IDs
+		ownedIDs := []string{}
 		sessionIDs := []string{}
-		for _, oneSession := range allSessions {
-			sessionIDs = append(sessionIDs, oneSession.ID)
+		for _, entry := range owned {
+			ownedIDs = append(ownedIDs, entry.ID)
+			sessionIDs = append(sessionIDs, entry.SessionID)
 		}
 
-		// Delete the exchanges first
+		// Variants and attached files are deleted along with the exchanges
 		if tmp := tx.
-			Where("session_id in ?", sessionIDs).
+			Where("id in ?", ownedIDs).
 			Delete(&sqlChatExchangeEntry{}); tmp.Error != nil {
-			t, _ := json.Marshal(&sessionIDs)
-			log.
-				WithError(tmp.Error).
-				WithFields(logtags).
-				Errorf("Unable to delete chat exchanges of sessions %s", t)
+			t, _ := json.Marshal(&ownedIDs)
+			log.WithError(tmp.Error).WithFields(logtags).Errorf("Unable to delete chat exchanges %s", t)
 			return tmp.Error
 		}
+		if err := c.updateSearchIndex(tx, ownedIDs); err != nil {
+			log.WithError(err).WithFields(logtags).Error("Failed to unindex purged exchanges")
+			return err
+		}
 
-		// Delete the chat sessions
-		if tmp := tx.Delete(&allSessions); tmp.Error != nil {
-			t, _ := json.Marshal(&sessionIDs)
+		// The history of the affected sessions changed
+		if tmp := tx.
+			Unscoped().
+			Model(&sqlChatSessionEntry{}).
+			Where("id in ?", sessionIDs).
+			UpdateColumn("version", gorm.Expr("version + 1")); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to update chat session versions")
+			return tmp.Error
+		}
+		return nil
+	})
+}
+
+/*
+ExchangeContents fetch the request time, request, and response of every exchange of the
+associated user's chat sessions, excluding those in the trash. Nothing else about the
+exchanges is loaded.
+
+	@param ctxt context.Context - query context
+	@return the exchanges, grouped by session ID
+*/
+func (c *sqlChatPersistence) ExchangeContents(
+	ctxt context.Context,
+) (map[string][]ChatExchange, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	userID, err := c.user.GetID(ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+		return nil, err
+	}
+	type contentEntry struct {
+		SessionID        string
+		RequestTimestamp time.Time
+		Request          string
+		Response         string
+	}
+	var entries []contentEntry
+	if tmp := c.db.
+		Table("chat_session_exchanges AS e").
+		Select("e.session_id, e.request_timestamp, e.request, e.response").
+		Joins("JOIN chat_sessions AS c ON c.id = e.session_id").
+		Where("c.user_id = ? AND c.deleted_at IS NULL", userID).
+		Order("e.request_timestamp").
+		Scan(&entries); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Error("Failed to read exchange contents")
+		return nil, tmp.Error
+	}
+	result := map[string][]ChatExchange{}
+	for _, entry := range entries {
+		result[entry.SessionID] = append(result[entry.SessionID], ChatExchange{
+			RequestTimestamp: entry.RequestTimestamp,
+			Request:          entry.Request,
+			Response:         entry.Response,
+		})
+	}
+	return result, nil
+}
+
+/*
+findPreset helper function to read a chat session preset of the associated user
+
+	@param ctxt context.Context - query context
+	@param tx *gorm.DB - the transaction
+	@param name string - preset name
+	@return the preset entry, and whether it exists
+*/
+func (c *sqlChatPersistence) findPreset(
+	ctxt context.Context, tx *gorm.DB, name string,
+) (sqlChatSessionPresetEntry, bool, error) {
+	var entries []sqlChatSessionPresetEntry
+	userID, err := c.user.GetID(ctxt)
+	if err != nil {
+		return sqlChatSessionPresetEntry{}, false, err
+	}
+	if tmp := tx.
+		Where(&sqlChatSessionPresetEntry{UserID: userID, Name: name}).
+		Limit(1).
+		Find(&entries); tmp.Error != nil {
+		return sqlChatSessionPresetEntry{}, false, tmp.Error
+	}
+	if len(entries) == 0 {
+		return sqlChatSessionPresetEntry{UserID: userID, Name: name}, false, nil
+	}
+	return entries[0], true, nil
+}
+
+/*
+RecordPreset record a new chat session preset
+
+	@param ctxt context.Context - query context
+	@param preset ChatSessionPreset - the preset. The name must not already be in use.
+*/
+func (c *sqlChatPersistence) RecordPreset(ctxt context.Context, preset ChatSessionPreset) error {
+	logtags := c.GetLogTagsForContext(ctxt)
+	if err := preset.validateName(); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Preset name not valid")
+		return err
+	}
+	if err := validator.New().Struct(&preset.Settings); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Preset settings not valid")
+		return err
+	}
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		entry, exists, err := c.findPreset(ctxt, tx, preset.Name)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Failed to query preset '%s'", preset.Name)
+			return err
+		}
+		if exists {
+			return fmt.Errorf("chat session preset '%s' already exists", preset.Name)
+		}
+		entry.Settings = preset.Settings
+		if tmp := tx.Create(&entry); tmp.Error != nil {
 			log.
 				WithError(tmp.Error).
 				WithFields(logtags).
-				Errorf("Unable to delete chat sessions %s", t)
+				Errorf("Failed to record preset '%s'", preset.Name)
 			return tmp.Error
 		}
 		return nil
-	}); err != nil {
-		return err
+	})
+}
+
+/*
+ListPresets list all chat session presets
+
+	@param ctxt context.Context - query context
+	@return all presets, sorted by name
+*/
+func (c *sqlChatPersistence) ListPresets(ctxt context.Context) ([]ChatSessionPreset, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	userID, err := c.user.GetID(ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+		return nil, err
 	}
-	// In case the deleted session was the current active session for the user
-	if err := c.user.Refresh(ctxt); err != nil {
-		log.WithError(err).WithFields(logtags).Error("Failed to refresh user entry after session delete")
+	var entries []sqlChatSessionPresetEntry
+	if tmp := c.db.
+		Where(&sqlChatSessionPresetEntry{UserID: userID}).
+		Order("name").
+		Find(&entries); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Error("Failed to list presets")
+		return nil, tmp.Error
+	}
+	result := []ChatSessionPreset{}
+	for _, entry := range entries {
+		result = append(result, ChatSessionPreset{Name: entry.Name, Settings: entry.Settings})
+	}
+	return result, nil
+}
+
+/*
+GetPreset fetch a chat session preset
+
+	@param ctxt context.Context - query context
+	@param name string - preset name
+	@return the preset
+*/
+func (c *sqlChatPersistence) GetPreset(ctxt context.Context, name string) (ChatSessionPreset, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	entry, exists, err := c.findPreset(ctxt, c.db, name)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to query preset '%s'", name)
+		return ChatSessionPreset{}, err
+	}
+	if !exists {
+		return ChatSessionPreset{}, fmt.Errorf("chat session preset '%s' does not exist", name)
+	}
+	return ChatSessionPreset{Name: entry.Name, Settings: entry.Settings}, nil
+}
+
+/*
+UpdatePreset replace the settings of an existing chat session preset
+
+	@param ctxt context.Context - query context
+	@param preset ChatSessionPreset - the preset with its new settings
+*/
+func (c *sqlChatPersistence) UpdatePreset(ctxt context.Context, preset ChatSessionPreset) error {
+	logtags := c.GetLogTagsForContext(ctxt)
+	if err := validator.New().Struct(&preset.Settings); err != nil {
+		log.WithError(err).WithFields(logtags).Error("Preset settings not valid")
 		return err
 	}
-	return nil
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		entry, exists, err := c.findPreset(ctxt, tx, preset.Name)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Failed to query preset '%s'", preset.Name)
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("chat session preset '%s' does not exist", preset.Name)
+		}
+		if tmp := tx.
+			Model(&entry).
+			Updates(&sqlChatSessionPresetEntry{Settings: preset.Settings}); tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to update preset '%s'", preset.Name)
+			return tmp.Error
+		}
+		return nil
+	})
 }
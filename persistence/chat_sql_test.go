@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,9 +21,16 @@ func TestSQLChatManager(t *testing.T) {
 	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
 	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
 
-	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info)
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
 	assert.Nil(err)
 
+	testChatManager(t, userManager)
+}
+
+// testChatManager test suite for ChatSessionManager
+func testChatManager(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
 	utContext := context.Background()
 
 	// Create test user
@@ -119,9 +127,16 @@ func TestSQLUserActiveSessionSet(t *testing.T) {
 	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
 	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
 
-	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info)
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
 	assert.Nil(err)
 
+	testUserActiveSessionSet(t, userManager)
+}
+
+// testUserActiveSessionSet test suite for setting the active chat session of a user
+func testUserActiveSessionSet(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
 	utContext := context.Background()
 
 	// Create test user
@@ -239,9 +254,16 @@ func TestSQLChatSession(t *testing.T) {
 	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
 	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
 
-	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info)
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
 	assert.Nil(err)
 
+	testChatSession(t, userManager)
+}
+
+// testChatSession test suite for ChatSession
+func testChatSession(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
 	utContext := context.Background()
 
 	// Create test user
@@ -338,9 +360,16 @@ func TestSQLChatExchange(t *testing.T) {
 	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
 	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
 
-	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info)
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
 	assert.Nil(err)
 
+	testChatExchange(t, userManager)
+}
+
+// testChatExchange test suite for recording ChatSession exchanges
+func testChatExchange(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
 	utContext := context.Background()
 
 	// Create test user
@@ -438,10 +467,29 @@ func TestSQLChatExchange(t *testing.T) {
 		assert.Equal(exchange0.Response, exchanges[1].Response)
 	}
 
-	// Case 3: delete session
+	// Case 4: replace latest exchange
+	currentTime = time.Now().Add(timeDelta * 10)
+	exchange3 := ChatExchange{
+		RequestTimestamp:  currentTime,
+		Request:           fmt.Sprintf("req-3-%s", uuid.NewString()),
+		ResponseTimestamp: currentTime.Add(timeDelta),
+		Response:          fmt.Sprintf("resp-3-%s", uuid.NewString()),
+	}
+	assert.Nil(uut.ReplaceLatestExchange(utContext, exchange3))
+	{
+		exchanges, err := uut.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 2)
+		assert.Equal(exchange2.Request, exchanges[0].Request)
+		assert.Equal(exchange3.Request, exchanges[1].Request)
+		assert.Equal(exchange3.Response, exchanges[1].Response)
+	}
+
+	// Case 5: delete session
 	sessionID, err := uut.SessionID(utContext)
 	assert.Nil(err)
 	assert.Nil(chatManager.DeleteSession(utContext, sessionID))
+	assert.NotNil(uut.ReplaceLatestExchange(utContext, exchange3))
 }
 
 func TestSQLMutlChatSessionDelete(t *testing.T) {
@@ -451,9 +499,16 @@ func TestSQLMutlChatSessionDelete(t *testing.T) {
 	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
 	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
 
-	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info)
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
 	assert.Nil(err)
 
+	testMultiChatSessionDelete(t, userManager)
+}
+
+// testMultiChatSessionDelete test suite for deleting multiple chat sessions
+func testMultiChatSessionDelete(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
 	utContext := context.Background()
 
 	// Create test user
@@ -509,3 +564,1764 @@ func TestSQLMutlChatSessionDelete(t *testing.T) {
 		assert.Len(sessions, 0)
 	}
 }
+
+func TestSQLChatSessionMetadata(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatSessionMetadata(t, userManager)
+}
+
+// testChatSessionMetadata test suite for chat session title, description, and tags
+func testChatSessionMetadata(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	user1, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager0, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+	chatManager1, err := user1.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	session0, err := chatManager0.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	session0ID, err := session0.SessionID(utContext)
+	assert.Nil(err)
+	session1, err := chatManager0.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	session1ID, err := session1.SessionID(utContext)
+	assert.Nil(err)
+	session2, err := chatManager1.NewSession(utContext, "turbo")
+	assert.Nil(err)
+
+	sessionIDsOf := func(sessions []ChatSession) []string {
+		result := []string{}
+		for _, oneSession := range sessions {
+			sessionID, err := oneSession.SessionID(utContext)
+			assert.Nil(err)
+			result = append(result, sessionID)
+		}
+		return result
+	}
+
+	// Case 0: new session has no metadata
+	{
+		metadata, err := session0.Metadata(utContext)
+		assert.Nil(err)
+		assert.Equal("", metadata.Title)
+		assert.Equal("", metadata.Description)
+		assert.Empty(metadata.Tags)
+	}
+
+	// Case 1: set metadata
+	assert.Nil(session0.ChangeMetadata(utContext, ChatSessionMetadata{
+		Title:       "Sorting in golang",
+		Description: "How to sort things",
+		Tags:        []string{"golang", " work ", "golang"},
+	}))
+	{
+		metadata, err := session0.Metadata(utContext)
+		assert.Nil(err)
+		assert.Equal("Sorting in golang", metadata.Title)
+		assert.Equal("How to sort things", metadata.Description)
+		assert.Equal([]string{"golang", "work"}, metadata.Tags)
+		// A fresh handle sees the same metadata
+		session, err := chatManager0.GetSession(utContext, session0ID)
+		assert.Nil(err)
+		metadata, err = session.Metadata(utContext)
+		assert.Nil(err)
+		assert.Equal("Sorting in golang", metadata.Title)
+		assert.Equal([]string{"golang", "work"}, metadata.Tags)
+	}
+
+	// Case 2: invalid tags are rejected
+	assert.NotNil(session0.ChangeMetadata(utContext, ChatSessionMetadata{Tags: []string{"two words"}}))
+	assert.NotNil(session0.ChangeMetadata(utContext, ChatSessionMetadata{Tags: []string{""}}))
+	{
+		metadata, err := session0.Metadata(utContext)
+		assert.Nil(err)
+		assert.Equal("Sorting in golang", metadata.Title)
+		assert.Equal([]string{"golang", "work"}, metadata.Tags)
+	}
+
+	// Case 3: filter sessions by tag
+	assert.Nil(session1.ChangeMetadata(utContext, ChatSessionMetadata{Tags: []string{"work"}}))
+	assert.Nil(session2.ChangeMetadata(utContext, ChatSessionMetadata{Tags: []string{"golang"}}))
+	{
+		sessions, err := chatManager0.ListSessionsWithTag(utContext, "golang")
+		assert.Nil(err)
+		assert.Equal([]string{session0ID}, sessionIDsOf(sessions))
+		sessions, err = chatManager0.ListSessionsWithTag(utContext, "work")
+		assert.Nil(err)
+		assert.ElementsMatch([]string{session0ID, session1ID}, sessionIDsOf(sessions))
+		sessions, err = chatManager0.ListSessionsWithTag(utContext, "unknown")
+		assert.Nil(err)
+		assert.Len(sessions, 0)
+	}
+
+	// Case 4: replace the tags
+	assert.Nil(session0.ChangeMetadata(utContext, ChatSessionMetadata{
+		Title: "Sorting in golang", Tags: []string{"golang"},
+	}))
+	{
+		metadata, err := session0.Metadata(utContext)
+		assert.Nil(err)
+		assert.Equal("", metadata.Description)
+		assert.Equal([]string{"golang"}, metadata.Tags)
+		sessions, err := chatManager0.ListSessionsWithTag(utContext, "work")
+		assert.Nil(err)
+		assert.Equal([]string{session1ID}, sessionIDsOf(sessions))
+	}
+
+	// Case 5: deleted sessions are no longer listed
+	assert.Nil(chatManager0.DeleteSession(utContext, session1ID))
+	{
+		sessions, err := chatManager0.ListSessionsWithTag(utContext, "work")
+		assert.Nil(err)
+		assert.Len(sessions, 0)
+	}
+}
+
+func TestSQLForkChatSession(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testForkChatSession(t, userManager)
+}
+
+// testForkChatSession test suite for ChatSessionManager.ForkSession
+func testForkChatSession(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	user1, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager0, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+	chatManager1, err := user1.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	source, err := chatManager0.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	sourceID, err := source.SessionID(utContext)
+	assert.Nil(err)
+	settings, err := source.Settings(utContext)
+	assert.Nil(err)
+	settings.MaxTokens = 100
+	assert.Nil(source.ChangeSettings(utContext, settings))
+
+	currentTime := time.Now()
+	timeDelta := time.Second * 5
+	for itr := 0; itr < 3; itr++ {
+		assert.Nil(source.RecordOneExchange(utContext, ChatExchange{
+			RequestTimestamp:  currentTime,
+			Request:           fmt.Sprintf("req-%d", itr),
+			ResponseTimestamp: currentTime.Add(timeDelta),
+			Response:          fmt.Sprintf("resp-%d", itr),
+		}))
+		currentTime = currentTime.Add(timeDelta * 2)
+	}
+
+	// Case 0: fork at the second exchange
+	fork, err := chatManager0.ForkSession(utContext, sourceID, 2)
+	assert.Nil(err)
+	forkID, err := fork.SessionID(utContext)
+	assert.Nil(err)
+	assert.NotEqual(sourceID, forkID)
+	{
+		forkSettings, err := fork.Settings(utContext)
+		assert.Nil(err)
+		assert.Equal(settings, forkSettings)
+		exchanges, err := fork.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 2)
+		assert.Equal("req-0", exchanges[0].Request)
+		assert.Equal("resp-1", exchanges[1].Response)
+	}
+
+	// Case 1: changing the fork does not change the source
+	assert.Nil(fork.RecordOneExchange(utContext, ChatExchange{
+		RequestTimestamp:  currentTime,
+		Request:           "req-fork",
+		ResponseTimestamp: currentTime.Add(timeDelta),
+		Response:          "resp-fork",
+	}))
+	{
+		exchanges, err := source.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 3)
+		assert.Equal("req-2", exchanges[2].Request)
+	}
+	assert.Nil(chatManager0.DeleteSession(utContext, sourceID))
+	{
+		exchanges, err := fork.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 3)
+		assert.Equal("req-fork", exchanges[2].Request)
+	}
+
+	// Case 2: fork with all exchanges
+	{
+		copied, err := chatManager0.ForkSession(utContext, forkID, -1)
+		assert.Nil(err)
+		exchanges, err := copied.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 3)
+	}
+
+	// Case 3: fork past the last exchange
+	{
+		_, err := chatManager0.ForkSession(utContext, forkID, 4)
+		assert.NotNil(err)
+	}
+
+	// Case 4: fork another user's session
+	{
+		_, err := chatManager1.ForkSession(utContext, forkID, 1)
+		assert.NotNil(err)
+	}
+}
+
+func TestSQLChatExchangeVariants(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatExchangeVariants(t, userManager)
+}
+
+// testChatExchangeVariants test suite for chat exchange response variants
+func testChatExchangeVariants(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+	uut, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+
+	// Case 0: no exchanges
+	{
+		_, err := uut.LatestExchangeVariants(utContext)
+		assert.NotNil(err)
+		assert.NotNil(uut.RecordLatestExchangeVariant(utContext, ChatExchangeVariant{
+			ResponseTimestamp: time.Now(), Response: "resp",
+		}))
+	}
+
+	currentTime := time.Now()
+	timeDelta := time.Second * 5
+	for itr := 0; itr < 2; itr++ {
+		assert.Nil(uut.RecordOneExchange(utContext, ChatExchange{
+			RequestTimestamp:  currentTime,
+			Request:           fmt.Sprintf("req-%d", itr),
+			ResponseTimestamp: currentTime.Add(timeDelta),
+			Response:          fmt.Sprintf("resp-%d", itr),
+		}))
+		currentTime = currentTime.Add(timeDelta * 2)
+	}
+
+	latestResponse := func() string {
+		exchanges, err := uut.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 2)
+		assert.Equal("resp-0", exchanges[0].Response)
+		return exchanges[1].Response
+	}
+
+	// Case 1: exchange which was never regenerated
+	{
+		variants, err := uut.LatestExchangeVariants(utContext)
+		assert.Nil(err)
+		assert.Len(variants, 1)
+		assert.Equal("resp-1", variants[0].Response)
+		assert.True(variants[0].Selected)
+		assert.Nil(uut.SelectLatestExchangeVariant(utContext, 0))
+		assert.NotNil(uut.SelectLatestExchangeVariant(utContext, 1))
+	}
+
+	// Case 2: record new variants
+	temperature := float32(1.2)
+	assert.Nil(uut.RecordLatestExchangeVariant(utContext, ChatExchangeVariant{
+		ResponseTimestamp: currentTime, Response: "resp-1-a", Model: "turbo", Temperature: &temperature,
+	}))
+	assert.Nil(uut.RecordLatestExchangeVariant(utContext, ChatExchangeVariant{
+		ResponseTimestamp: currentTime.Add(timeDelta), Response: "resp-1-b", Model: "davinci",
+	}))
+	assert.Equal("resp-1-b", latestResponse())
+	{
+		variants, err := uut.LatestExchangeVariants(utContext)
+		assert.Nil(err)
+		assert.Len(variants, 3)
+		assert.Equal("resp-1", variants[0].Response)
+		assert.Equal("", variants[0].Model)
+		assert.Equal("resp-1-a", variants[1].Response)
+		assert.Equal("turbo", variants[1].Model)
+		assert.NotNil(variants[1].Temperature)
+		assert.InDelta(temperature, *variants[1].Temperature, 1e-6)
+		assert.Equal("resp-1-b", variants[2].Response)
+		assert.Nil(variants[2].Temperature)
+		assert.Equal([]bool{false, false, true}, []bool{
+			variants[0].Selected, variants[1].Selected, variants[2].Selected,
+		})
+	}
+
+	// Case 3: select a variant
+	assert.Nil(uut.SelectLatestExchangeVariant(utContext, 1))
+	assert.Equal("resp-1-a", latestResponse())
+	assert.Nil(uut.SelectLatestExchangeVariant(utContext, 0))
+	assert.Equal("resp-1", latestResponse())
+	{
+		variants, err := uut.LatestExchangeVariants(utContext)
+		assert.Nil(err)
+		assert.Len(variants, 3)
+		assert.True(variants[0].Selected)
+		assert.False(variants[2].Selected)
+	}
+	assert.NotNil(uut.SelectLatestExchangeVariant(utContext, 3))
+	assert.NotNil(uut.SelectLatestExchangeVariant(utContext, -1))
+
+	// Case 4: variants are removed with the exchange
+	assert.Nil(uut.DeleteLatestExchange(utContext))
+	{
+		variants, err := uut.LatestExchangeVariants(utContext)
+		assert.Nil(err)
+		assert.Len(variants, 1)
+		assert.Equal("resp-0", variants[0].Response)
+	}
+}
+
+func TestSQLEditExchanges(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testEditExchanges(t, userManager)
+}
+
+// testEditExchanges test suite for deleting and editing arbitrary chat exchanges
+func testEditExchanges(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+	uut, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+
+	currentTime := time.Now()
+	timeDelta := time.Second * 5
+	for itr := 0; itr < 5; itr++ {
+		assert.Nil(uut.RecordOneExchange(utContext, ChatExchange{
+			RequestTimestamp:  currentTime,
+			Request:           fmt.Sprintf("req-%d", itr),
+			ResponseTimestamp: currentTime.Add(timeDelta),
+			Response:          fmt.Sprintf("resp-%d", itr),
+		}))
+		currentTime = currentTime.Add(timeDelta * 2)
+	}
+
+	readExchanges := func() []ChatExchange {
+		exchanges, err := uut.Exchanges(utContext)
+		assert.Nil(err)
+		for _, oneExchange := range exchanges {
+			assert.NotEmpty(oneExchange.ID)
+		}
+		return exchanges
+	}
+	exchanges := readExchanges()
+	assert.Len(exchanges, 5)
+
+	// Case 0: delete with an unknown exchange ID
+	{
+		err := uut.DeleteExchanges(
+			utContext, []string{exchanges[0].ID, uuid.NewString()}, "bad",
+		)
+		assert.NotNil(err)
+		assert.Len(readExchanges(), 5)
+		records, err := uut.ExchangeAuditRecords(utContext)
+		assert.Nil(err)
+		assert.Len(records, 0)
+	}
+
+	// Case 1: delete exchanges
+	assert.Nil(uut.DeleteExchanges(
+		utContext, []string{exchanges[1].ID, exchanges[3].ID}, "off topic",
+	))
+	{
+		remaining := readExchanges()
+		assert.Len(remaining, 3)
+		assert.Equal("req-0", remaining[0].Request)
+		assert.Equal("req-2", remaining[1].Request)
+		assert.Equal("req-4", remaining[2].Request)
+		first, err := uut.FirstExchange(utContext)
+		assert.Nil(err)
+		assert.Equal(exchanges[0].ID, first.ID)
+	}
+	{
+		records, err := uut.ExchangeAuditRecords(utContext)
+		assert.Nil(err)
+		assert.Len(records, 2)
+		assert.Equal(exchanges[1].ID, records[0].ExchangeID)
+		assert.Equal(exchanges[3].ID, records[1].ExchangeID)
+		for _, record := range records {
+			assert.Equal(ChatExchangeDeleted, record.Action)
+			assert.Equal("off topic", record.Reason)
+		}
+		assert.Equal(exchanges[1].RequestTimestamp.Unix(), records[0].RequestTimestamp.Unix())
+	}
+
+	// Case 2: deleting an already deleted exchange
+	assert.NotNil(uut.DeleteExchanges(utContext, []string{exchanges[1].ID}, ""))
+
+	// Case 3: invalid edits
+	{
+		empty := " "
+		assert.NotNil(uut.EditExchange(utContext, exchanges[0].ID, ChatExchangeEdit{}))
+		assert.NotNil(uut.EditExchange(utContext, exchanges[0].ID, ChatExchangeEdit{Request: &empty}))
+		request := "new"
+		assert.NotNil(
+			uut.EditExchange(utContext, exchanges[1].ID, ChatExchangeEdit{Request: &request}),
+		)
+	}
+
+	// Case 4: edit the request and response
+	{
+		request := "req-0-edited"
+		response := "resp-0-edited"
+		assert.Nil(uut.EditExchange(utContext, exchanges[0].ID, ChatExchangeEdit{
+			Request: &request, Response: &response, Reason: "typo",
+		}))
+		edited := readExchanges()
+		assert.Equal("req-0-edited", edited[0].Request)
+		assert.Equal("resp-0-edited", edited[0].Response)
+		assert.Equal("req-2", edited[1].Request)
+		assert.Equal("resp-2", edited[1].Response)
+
+		records, err := uut.ExchangeAuditRecords(utContext)
+		assert.Nil(err)
+		assert.Len(records, 4)
+		assert.Equal(ChatExchangeRequestEdited, records[2].Action)
+		assert.Equal(ChatExchangeResponseEdited, records[3].Action)
+		assert.Equal(exchanges[0].ID, records[2].ExchangeID)
+		assert.Equal("typo", records[3].Reason)
+	}
+
+	// Case 5: edit the response of a regenerated exchange
+	assert.Nil(uut.RecordLatestExchangeVariant(utContext, ChatExchangeVariant{
+		ResponseTimestamp: currentTime, Response: "resp-4-a",
+	}))
+	{
+		// Editing only the request keeps the variants
+		request := "req-4-edited"
+		assert.Nil(uut.EditExchange(utContext, exchanges[4].ID, ChatExchangeEdit{
+			Request: &request,
+		}))
+		variants, err := uut.LatestExchangeVariants(utContext)
+		assert.Nil(err)
+		assert.Len(variants, 2)
+
+		response := "resp-4-a-edited"
+		assert.Nil(uut.EditExchange(utContext, exchanges[4].ID, ChatExchangeEdit{
+			Response: &response, Reason: "remove credentials",
+		}))
+		edited := readExchanges()
+		assert.Equal("resp-4-a-edited", edited[2].Response)
+		// The unselected variant is deleted along with its text
+		variants, err = uut.LatestExchangeVariants(utContext)
+		assert.Nil(err)
+		assert.Len(variants, 1)
+		assert.Equal("resp-4-a-edited", variants[0].Response)
+		assert.True(variants[0].Selected)
+
+		records, err := uut.ExchangeAuditRecords(utContext)
+		assert.Nil(err)
+		assert.Len(records, 7)
+		assert.Equal(ChatExchangeRequestEdited, records[4].Action)
+		assert.Equal(ChatExchangeResponseEdited, records[5].Action)
+		assert.Equal(ChatExchangeVariantsDeleted, records[6].Action)
+		assert.Equal(exchanges[4].ID, records[6].ExchangeID)
+		assert.Equal("remove credentials", records[6].Reason)
+
+		// Editing again has no other variants to delete
+		response = "resp-4-a-edited-again"
+		assert.Nil(uut.EditExchange(utContext, exchanges[4].ID, ChatExchangeEdit{
+			Response: &response,
+		}))
+		records, err = uut.ExchangeAuditRecords(utContext)
+		assert.Nil(err)
+		assert.Len(records, 8)
+		assert.Equal(ChatExchangeResponseEdited, records[7].Action)
+	}
+
+	// Case 6: delete the session along with its audit records
+	{
+		sessionID, err := uut.SessionID(utContext)
+		assert.Nil(err)
+		assert.Nil(chatManager.DeleteSession(utContext, sessionID))
+		_, err = chatManager.GetSession(utContext, sessionID)
+		assert.NotNil(err)
+	}
+}
+
+func TestSQLChatSessionLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatSessionLifecycle(t, userManager)
+}
+
+// testChatSessionLifecycle test suite for chat session state transitions and idle archiving
+func testChatSessionLifecycle(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	sessionState := func(session ChatSession) ChatSessionState {
+		sessionID, err := session.SessionID(utContext)
+		assert.Nil(err)
+		current, err := chatManager.GetSession(utContext, sessionID)
+		assert.Nil(err)
+		state, err := current.SessionState(utContext)
+		assert.Nil(err)
+		return state
+	}
+
+	// Case 0: state transitions
+	uut, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	assert.Equal(ChatSessionStateOpen, sessionState(uut))
+	assert.NotNil(uut.ChangeState(utContext, ChatSessionStateOpen))
+	assert.NotNil(uut.ChangeState(utContext, ChatSessionState("unknown")))
+	assert.Nil(uut.CloseSession(utContext))
+	assert.Equal(ChatSessionStateClose, sessionState(uut))
+	assert.NotNil(uut.CloseSession(utContext))
+	assert.Nil(uut.ChangeState(utContext, ChatSessionStateOpen))
+	assert.Equal(ChatSessionStateOpen, sessionState(uut))
+
+	// Case 1: archiving the active session
+	assert.Nil(chatManager.SetActiveSession(utContext, uut))
+	assert.Nil(uut.ChangeState(utContext, ChatSessionStateArchived))
+	assert.Equal(ChatSessionStateArchived, sessionState(uut))
+	{
+		activeSessionID, err := user0.GetActiveSessionID(utContext)
+		assert.Nil(err)
+		assert.Nil(activeSessionID)
+		_, err = chatManager.CurrentActiveSession(utContext)
+		assert.NotNil(err)
+	}
+	assert.NotNil(chatManager.SetActiveSession(utContext, uut))
+	assert.NotNil(uut.CloseSession(utContext))
+	assert.Nil(uut.ChangeState(utContext, ChatSessionStateOpen))
+	assert.Nil(chatManager.SetActiveSession(utContext, uut))
+
+	// Case 2: last activity
+	{
+		lastActivity, err := uut.LastActivity(utContext)
+		assert.Nil(err)
+		assert.WithinDuration(time.Now(), lastActivity, time.Minute)
+	}
+	currentTime := time.Now()
+	assert.Nil(uut.RecordOneExchange(utContext, ChatExchange{
+		RequestTimestamp:  currentTime.Add(-time.Hour * 3),
+		Request:           "req-0",
+		ResponseTimestamp: currentTime.Add(-time.Hour * 2),
+		Response:          "resp-0",
+	}))
+	{
+		lastActivity, err := uut.LastActivity(utContext)
+		assert.Nil(err)
+		assert.Equal(currentTime.Add(-time.Hour*2).Unix(), lastActivity.Unix())
+	}
+
+	// Case 3: archive idle sessions
+	recent, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	assert.Nil(recent.RecordOneExchange(utContext, ChatExchange{
+		RequestTimestamp:  currentTime.Add(-time.Hour * 3),
+		Request:           "req-0",
+		ResponseTimestamp: currentTime.Add(-time.Hour * 3),
+		Response:          "resp-0",
+	}))
+	assert.Nil(recent.RecordOneExchange(utContext, ChatExchange{
+		RequestTimestamp:  currentTime.Add(-time.Minute),
+		Request:           "req-1",
+		ResponseTimestamp: currentTime.Add(-time.Minute),
+		Response:          "resp-1",
+	}))
+	empty, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	closed, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	assert.Nil(closed.RecordOneExchange(utContext, ChatExchange{
+		RequestTimestamp:  currentTime.Add(-time.Hour * 5),
+		Request:           "req-0",
+		ResponseTimestamp: currentTime.Add(-time.Hour * 5),
+		Response:          "resp-0",
+	}))
+	assert.Nil(closed.CloseSession(utContext))
+	{
+		_, err := chatManager.ArchiveIdleSessions(utContext, 0)
+		assert.NotNil(err)
+	}
+	{
+		archived, err := chatManager.ArchiveIdleSessions(utContext, time.Hour)
+		assert.Nil(err)
+		uutID, err := uut.SessionID(utContext)
+		assert.Nil(err)
+		closedID, err := closed.SessionID(utContext)
+		assert.Nil(err)
+		assert.ElementsMatch([]string{uutID, closedID}, archived)
+	}
+	assert.Equal(ChatSessionStateArchived, sessionState(uut))
+	assert.Equal(ChatSessionStateArchived, sessionState(closed))
+	assert.Equal(ChatSessionStateOpen, sessionState(recent))
+	assert.Equal(ChatSessionStateOpen, sessionState(empty))
+	{
+		activeSessionID, err := user0.GetActiveSessionID(utContext)
+		assert.Nil(err)
+		assert.Nil(activeSessionID)
+	}
+	{
+		archived, err := chatManager.ArchiveIdleSessions(utContext, time.Hour)
+		assert.Nil(err)
+		assert.Len(archived, 0)
+	}
+}
+
+func TestSQLChatSessionSummaries(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatSessionSummaries(t, userManager)
+}
+
+// testChatSessionSummaries test suite for paginated chat session listing
+func testChatSessionSummaries(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	// Sessions of another user must not be listed
+	user1, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	otherManager, err := user1.ChatSessionManager(utContext)
+	assert.Nil(err)
+	_, err = otherManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+
+	// Prepare sessions with a varying number of exchanges
+	sessionIDs := []string{}
+	currentTime := time.Now()
+	for itr := 0; itr < 5; itr++ {
+		session, err := chatManager.NewSession(utContext, "davinci")
+		assert.Nil(err)
+		sessionID, err := session.SessionID(utContext)
+		assert.Nil(err)
+		sessionIDs = append(sessionIDs, sessionID)
+		for exchange := 0; exchange < itr; exchange++ {
+			assert.Nil(session.RecordOneExchange(utContext, ChatExchange{
+				RequestTimestamp:  currentTime,
+				Request:           fmt.Sprintf("req-%d-%d", itr, exchange),
+				ResponseTimestamp: currentTime.Add(time.Second),
+				Response:          fmt.Sprintf("resp-%d-%d", itr, exchange),
+			}))
+			currentTime = currentTime.Add(time.Second * 2)
+		}
+		if itr%2 == 0 {
+			assert.Nil(session.ChangeMetadata(utContext, ChatSessionMetadata{
+				Title: fmt.Sprintf("title-%d", itr), Tags: []string{"work", "even"},
+			}))
+		}
+	}
+	closed, err := chatManager.GetSession(utContext, sessionIDs[1])
+	assert.Nil(err)
+	assert.Nil(closed.CloseSession(utContext))
+	archived, err := chatManager.GetSession(utContext, sessionIDs[3])
+	assert.Nil(err)
+	assert.Nil(archived.ChangeState(utContext, ChatSessionStateArchived))
+
+	// Case 0: list everything in one page
+	{
+		page, err := chatManager.ListSessionSummaries(utContext, ChatSessionListQuery{})
+		assert.Nil(err)
+		assert.Empty(page.NextCursor)
+		assert.Len(page.Sessions, 5)
+		for idx, summary := range page.Sessions {
+			assert.Equal(sessionIDs[idx], summary.SessionID)
+			assert.Equal("davinci", summary.Model)
+			assert.Equal(idx, summary.ExchangeCount)
+			if idx > 0 {
+				assert.Equal(fmt.Sprintf("req-%d-0", idx), summary.FirstRequest)
+			} else {
+				assert.Empty(summary.FirstRequest)
+			}
+			if idx%2 == 0 {
+				assert.Equal(fmt.Sprintf("title-%d", idx), summary.Metadata.Title)
+				assert.Equal([]string{"even", "work"}, summary.Metadata.Tags)
+			} else {
+				assert.Empty(summary.Metadata.Title)
+				assert.Empty(summary.Metadata.Tags)
+			}
+		}
+		assert.Equal(ChatSessionStateOpen, page.Sessions[0].State)
+		assert.Equal(ChatSessionStateClose, page.Sessions[1].State)
+		assert.Equal(ChatSessionStateArchived, page.Sessions[3].State)
+	}
+
+	// Case 1: page through the sessions
+	{
+		listed := []string{}
+		query := ChatSessionListQuery{Limit: 2}
+		pages := 0
+		for {
+			page, err := chatManager.ListSessionSummaries(utContext, query)
+			assert.Nil(err)
+			assert.LessOrEqual(len(page.Sessions), 2)
+			for _, summary := range page.Sessions {
+				listed = append(listed, summary.SessionID)
+			}
+			pages++
+			if page.NextCursor == "" {
+				break
+			}
+			query.After = page.NextCursor
+		}
+		assert.Equal(3, pages)
+		assert.Equal(sessionIDs, listed)
+	}
+
+	// Case 2: the last page is exactly full
+	{
+		page, err := chatManager.ListSessionSummaries(
+			utContext, ChatSessionListQuery{Limit: 2, After: sessionIDs[2]},
+		)
+		assert.Nil(err)
+		assert.Len(page.Sessions, 2)
+		assert.Empty(page.NextCursor)
+	}
+
+	// Case 3: filter by state and tag
+	{
+		page, err := chatManager.ListSessionSummaries(utContext, ChatSessionListQuery{
+			States: []ChatSessionState{ChatSessionStateOpen, ChatSessionStateClose},
+		})
+		assert.Nil(err)
+		listed := []string{}
+		for _, summary := range page.Sessions {
+			listed = append(listed, summary.SessionID)
+		}
+		assert.Equal([]string{sessionIDs[0], sessionIDs[1], sessionIDs[2], sessionIDs[4]}, listed)
+
+		page, err = chatManager.ListSessionSummaries(utContext, ChatSessionListQuery{
+			States: []ChatSessionState{ChatSessionStateOpen}, Tag: "even", Limit: 1,
+		})
+		assert.Nil(err)
+		assert.Len(page.Sessions, 1)
+		assert.Equal(sessionIDs[0], page.Sessions[0].SessionID)
+		assert.Equal(sessionIDs[0], page.NextCursor)
+		page, err = chatManager.ListSessionSummaries(utContext, ChatSessionListQuery{
+			States: []ChatSessionState{ChatSessionStateOpen}, Tag: "even", After: page.NextCursor,
+		})
+		assert.Nil(err)
+		assert.Len(page.Sessions, 2)
+		assert.Equal(sessionIDs[2], page.Sessions[0].SessionID)
+		assert.Equal(sessionIDs[4], page.Sessions[1].SessionID)
+	}
+
+	// Case 4: latest exchanges
+	{
+		session, err := chatManager.GetSession(utContext, sessionIDs[4])
+		assert.Nil(err)
+		latest, err := session.LatestExchanges(utContext, 2)
+		assert.Nil(err)
+		assert.Len(latest, 2)
+		assert.Equal("req-4-2", latest[0].Request)
+		assert.Equal("req-4-3", latest[1].Request)
+		assert.NotEmpty(latest[1].ID)
+
+		latest, err = session.LatestExchanges(utContext, 10)
+		assert.Nil(err)
+		assert.Len(latest, 4)
+		assert.Equal("req-4-0", latest[0].Request)
+
+		_, err = session.LatestExchanges(utContext, 0)
+		assert.NotNil(err)
+
+		empty, err := chatManager.GetSession(utContext, sessionIDs[0])
+		assert.Nil(err)
+		latest, err = empty.LatestExchanges(utContext, 3)
+		assert.Nil(err)
+		assert.Len(latest, 0)
+	}
+}
+
+func TestSQLChatSessionTrash(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatSessionTrash(t, userManager)
+}
+
+// testChatSessionTrash test suite for deleting, restoring, and purging chat sessions
+func testChatSessionTrash(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	userName := uuid.NewString()
+	user0, err := userManager.RecordNewUser(utContext, userName)
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	// Prepare sessions, each with one exchange
+	sessionIDs := []string{}
+	currentTime := time.Now()
+	for itr := 0; itr < 4; itr++ {
+		session, err := chatManager.NewSession(utContext, "turbo")
+		assert.Nil(err)
+		sessionID, err := session.SessionID(utContext)
+		assert.Nil(err)
+		sessionIDs = append(sessionIDs, sessionID)
+		assert.Nil(session.RecordOneExchange(utContext, ChatExchange{
+			RequestTimestamp:  currentTime,
+			Request:           fmt.Sprintf("trashable request %d", itr),
+			ResponseTimestamp: currentTime.Add(time.Second),
+			Response:          fmt.Sprintf("response %d", itr),
+		}))
+	}
+	active, err := chatManager.GetSession(utContext, sessionIDs[0])
+	assert.Nil(err)
+	assert.Nil(chatManager.SetActiveSession(utContext, active))
+
+	// Case 0: nothing in the trash
+	{
+		trash, err := chatManager.ListTrash(utContext)
+		assert.Nil(err)
+		assert.Len(trash, 0)
+		err = chatManager.RestoreSession(utContext, sessionIDs[0])
+		assert.NotNil(err)
+	}
+
+	// Case 1: deleted sessions are hidden
+	{
+		assert.Nil(chatManager.DeleteSession(utContext, sessionIDs[0]))
+		assert.Nil(chatManager.DeleteMultipleSessions(utContext, sessionIDs[1:3]))
+		_, err := chatManager.GetSession(utContext, sessionIDs[0])
+		assert.NotNil(err)
+		sessions, err := chatManager.ListSessions(utContext)
+		assert.Nil(err)
+		assert.Len(sessions, 1)
+		page, err := chatManager.ListSessionSummaries(utContext, ChatSessionListQuery{})
+		assert.Nil(err)
+		assert.Len(page.Sessions, 1)
+		assert.Equal(sessionIDs[3], page.Sessions[0].SessionID)
+		results, err := chatManager.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "trashable"},
+		)
+		assert.Nil(err)
+		assert.Len(results, 1)
+		assert.Equal(sessionIDs[3], results[0].SessionID)
+		// The active session was deleted
+		_, err = chatManager.CurrentActiveSession(utContext)
+		assert.NotNil(err)
+		activeID, err := user0.GetActiveSessionID(utContext)
+		assert.Nil(err)
+		assert.Nil(activeID)
+		// A deleted session can not be made active, or changed through an existing handle
+		assert.NotNil(chatManager.SetActiveSession(utContext, active))
+		assert.NotNil(active.RecordOneExchange(utContext, ChatExchange{
+			RequestTimestamp:  currentTime,
+			Request:           "too late",
+			ResponseTimestamp: currentTime.Add(time.Second),
+			Response:          "too late",
+		}))
+	}
+
+	// Case 2: list the trash
+	{
+		trash, err := chatManager.ListTrash(utContext)
+		assert.Nil(err)
+		assert.Len(trash, 3)
+		trashed := map[string]ChatSessionSummary{}
+		for _, summary := range trash {
+			assert.NotNil(summary.DeletedAt)
+			trashed[summary.SessionID] = summary
+		}
+		for idx, sessionID := range sessionIDs[:3] {
+			assert.Contains(trashed, sessionID)
+			assert.Equal(1, trashed[sessionID].ExchangeCount)
+			assert.Equal(fmt.Sprintf("trashable request %d", idx), trashed[sessionID].FirstRequest)
+		}
+	}
+
+	// Case 3: restore a session
+	{
+		assert.Nil(chatManager.RestoreSession(utContext, sessionIDs[0]))
+		restored, err := chatManager.GetSession(utContext, sessionIDs[0])
+		assert.Nil(err)
+		exchanges, err := restored.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 1)
+		// Restoring does not make the session active again
+		activeID, err := user0.GetActiveSessionID(utContext)
+		assert.Nil(err)
+		assert.Nil(activeID)
+		assert.Nil(chatManager.SetActiveSession(utContext, restored))
+		// Not in the trash anymore
+		assert.NotNil(chatManager.RestoreSession(utContext, sessionIDs[0]))
+		assert.NotNil(chatManager.RestoreSession(utContext, uuid.NewString()))
+		trash, err := chatManager.ListTrash(utContext)
+		assert.Nil(err)
+		assert.Len(trash, 2)
+	}
+
+	// Case 4: purge only old sessions
+	{
+		_, err := chatManager.EmptyTrash(utContext, -time.Hour)
+		assert.NotNil(err)
+		purged, err := chatManager.EmptyTrash(utContext, time.Hour)
+		assert.Nil(err)
+		assert.Len(purged, 0)
+		trash, err := chatManager.ListTrash(utContext)
+		assert.Nil(err)
+		assert.Len(trash, 2)
+	}
+
+	// Case 5: purge everything
+	{
+		purged, err := chatManager.EmptyTrash(utContext, 0)
+		assert.Nil(err)
+		assert.ElementsMatch(sessionIDs[1:3], purged)
+		trash, err := chatManager.ListTrash(utContext)
+		assert.Nil(err)
+		assert.Len(trash, 0)
+		assert.NotNil(chatManager.RestoreSession(utContext, sessionIDs[1]))
+	}
+
+	// Case 6: delete the user while the trash is not empty
+	{
+		assert.Nil(chatManager.DeleteAllSessions(utContext))
+		trash, err := chatManager.ListTrash(utContext)
+		assert.Nil(err)
+		assert.Len(trash, 2)
+		userID, err := user0.GetID(utContext)
+		assert.Nil(err)
+		assert.Nil(userManager.DeleteUser(utContext, userID))
+		_, err = userManager.GetUserByName(utContext, userName)
+		assert.NotNil(err)
+	}
+}
+
+func TestSQLChatSessionRetention(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatSessionRetention(t, userManager)
+}
+
+// testChatSessionRetention test suite for retention policies and pruning chat sessions
+func testChatSessionRetention(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	userName := uuid.NewString()
+	user0, err := userManager.RecordNewUser(utContext, userName)
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	// Sessions of another user must not be pruned
+	user1, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	otherManager, err := user1.ChatSessionManager(utContext)
+	assert.Nil(err)
+	otherSession, err := otherManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	otherSessionID, err := otherSession.SessionID(utContext)
+	assert.Nil(err)
+
+	// Case 0: retention policy
+	{
+		policy, err := user0.GetRetentionPolicy(utContext)
+		assert.Nil(err)
+		assert.False(policy.IsEnforced())
+		assert.NotNil(user0.SetRetentionPolicy(utContext, RetentionPolicy{MaxSessions: -1}))
+		policy = RetentionPolicy{MaxAge: time.Hour * 24 * 90, MaxSessions: 10}
+		assert.Nil(user0.SetRetentionPolicy(utContext, policy))
+		reloaded, err := userManager.GetUserByName(utContext, userName)
+		assert.Nil(err)
+		readBack, err := reloaded.GetRetentionPolicy(utContext)
+		assert.Nil(err)
+		assert.Equal(policy, readBack)
+		// Clear the limits again
+		assert.Nil(user0.SetRetentionPolicy(utContext, RetentionPolicy{}))
+		reloaded, err = userManager.GetUserByName(utContext, userName)
+		assert.Nil(err)
+		readBack, err = reloaded.GetRetentionPolicy(utContext)
+		assert.Nil(err)
+		assert.False(readBack.IsEnforced())
+	}
+
+	// Prepare sessions last used 100, 50, and 10 days ago, and one without exchanges
+	day := time.Hour * 24
+	currentTime := time.Now()
+	sessionIDs := []string{}
+	for idx, age := range []time.Duration{day * 100, day * 50, day * 10} {
+		session, err := chatManager.NewSession(utContext, "turbo")
+		assert.Nil(err)
+		sessionID, err := session.SessionID(utContext)
+		assert.Nil(err)
+		sessionIDs = append(sessionIDs, sessionID)
+		assert.Nil(session.RecordOneExchange(utContext, ChatExchange{
+			RequestTimestamp:  currentTime.Add(-age),
+			Request:           fmt.Sprintf("req-%d", idx),
+			ResponseTimestamp: currentTime.Add(-age).Add(time.Second),
+			Response:          fmt.Sprintf("resp-%d", idx),
+		}))
+	}
+	{
+		session, err := chatManager.NewSession(utContext, "turbo")
+		assert.Nil(err)
+		sessionID, err := session.SessionID(utContext)
+		assert.Nil(err)
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	assert.Nil(chatManager.DeleteSession(utContext, sessionIDs[1]))
+
+	// Case 1: no limits
+	{
+		candidates, err := chatManager.SessionsToPrune(utContext, RetentionPolicy{}, 1<<30)
+		assert.Nil(err)
+		assert.Len(candidates, 0)
+		_, err = chatManager.SessionsToPrune(utContext, RetentionPolicy{MaxAge: -day}, 0)
+		assert.NotNil(err)
+	}
+
+	// Case 2: max age
+	var oldestSize int64
+	{
+		candidates, err := chatManager.SessionsToPrune(
+			utContext, RetentionPolicy{MaxAge: day * 90}, 0,
+		)
+		assert.Nil(err)
+		assert.Len(candidates, 1)
+		assert.Equal(sessionIDs[0], candidates[0].SessionID)
+		assert.Equal(RetentionMaxAge, candidates[0].Reason)
+		assert.Equal(int64(len("req-0")+len("resp-0")), candidates[0].Size)
+		assert.False(candidates[0].Trashed)
+		oldestSize = candidates[0].Size
+	}
+
+	// Case 3: max age and max session count, sessions in the trash included
+	{
+		candidates, err := chatManager.SessionsToPrune(
+			utContext, RetentionPolicy{MaxAge: day * 90, MaxSessions: 2}, 0,
+		)
+		assert.Nil(err)
+		assert.Len(candidates, 2)
+		assert.Equal(sessionIDs[0], candidates[0].SessionID)
+		assert.Equal(RetentionMaxAge, candidates[0].Reason)
+		assert.Equal(sessionIDs[1], candidates[1].SessionID)
+		assert.Equal(RetentionMaxSessions, candidates[1].Reason)
+		assert.True(candidates[1].Trashed)
+	}
+
+	// Case 4: max DB size
+	{
+		policy := RetentionPolicy{MaxDBSize: 1000}
+		candidates, err := chatManager.SessionsToPrune(utContext, policy, 1000)
+		assert.Nil(err)
+		assert.Len(candidates, 0)
+		candidates, err = chatManager.SessionsToPrune(utContext, policy, 1001)
+		assert.Nil(err)
+		assert.Len(candidates, 1)
+		assert.Equal(sessionIDs[0], candidates[0].SessionID)
+		assert.Equal(RetentionMaxDBSize, candidates[0].Reason)
+		candidates, err = chatManager.SessionsToPrune(utContext, policy, 1001+oldestSize)
+		assert.Nil(err)
+		assert.Len(candidates, 2)
+		// DB size not known
+		candidates, err = chatManager.SessionsToPrune(utContext, policy, 0)
+		assert.Nil(err)
+		assert.Len(candidates, 0)
+	}
+
+	// Case 5: purge sessions
+	{
+		active, err := chatManager.GetSession(utContext, sessionIDs[0])
+		assert.Nil(err)
+		assert.Nil(chatManager.SetActiveSession(utContext, active))
+		assert.Nil(chatManager.PurgeSessions(
+			utContext, []string{sessionIDs[0], sessionIDs[1], otherSessionID},
+		))
+		_, err = chatManager.GetSession(utContext, sessionIDs[0])
+		assert.NotNil(err)
+		activeID, err := user0.GetActiveSessionID(utContext)
+		assert.Nil(err)
+		assert.Nil(activeID)
+		trash, err := chatManager.ListTrash(utContext)
+		assert.Nil(err)
+		assert.Len(trash, 0)
+		sessions, err := chatManager.ListSessions(utContext)
+		assert.Nil(err)
+		assert.Len(sessions, 2)
+		_, err = otherManager.GetSession(utContext, otherSessionID)
+		assert.Nil(err)
+	}
+
+	// Case 6: a session still in use has only its exchanges older than the max age pruned
+	{
+		session, err := chatManager.NewSession(utContext, "turbo")
+		assert.Nil(err)
+		sessionID, err := session.SessionID(utContext)
+		assert.Nil(err)
+		for idx, age := range []time.Duration{day * 120, day} {
+			exchange := ChatExchange{
+				RequestTimestamp:  currentTime.Add(-age),
+				Request:           fmt.Sprintf("live-req-%d", idx),
+				ResponseTimestamp: currentTime.Add(-age).Add(time.Second),
+				Response:          fmt.Sprintf("live-resp-%d", idx),
+			}
+			if idx == 0 {
+				exchange.Attachments = []ChatExchangeAttachment{{Name: "a.txt", Content: "hello"}}
+			}
+			assert.Nil(session.RecordOneExchange(utContext, exchange))
+		}
+		exchanges, err := session.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 2)
+		assert.Nil(otherSession.RecordOneExchange(utContext, ChatExchange{
+			RequestTimestamp:  currentTime.Add(-day * 120),
+			Request:           "other-req",
+			ResponseTimestamp: currentTime.Add(-day * 120).Add(time.Second),
+			Response:          "other-resp",
+		}))
+		otherExchanges, err := otherSession.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(otherExchanges, 1)
+
+		candidates, err := chatManager.SessionsToPrune(
+			utContext, RetentionPolicy{MaxAge: day * 90}, 0,
+		)
+		assert.Nil(err)
+		assert.Len(candidates, 1)
+		assert.Equal(sessionID, candidates[0].SessionID)
+		assert.Equal(RetentionMaxAge, candidates[0].Reason)
+		assert.Equal([]string{exchanges[0].ID}, candidates[0].ExchangeIDs)
+		assert.Equal(
+			int64(len("live-req-0")+len("live-resp-0")+len("hello")), candidates[0].Size,
+		)
+
+		// Exchanges of another user are not deleted
+		assert.Nil(chatManager.PurgeExchanges(
+			utContext, []string{exchanges[0].ID, otherExchanges[0].ID},
+		))
+		assert.Nil(session.Refresh(utContext))
+		exchanges, err = session.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 1)
+		assert.Equal("live-req-1", exchanges[0].Request)
+		otherExchanges, err = otherSession.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(otherExchanges, 1)
+
+		candidates, err = chatManager.SessionsToPrune(
+			utContext, RetentionPolicy{MaxAge: day * 90}, 0,
+		)
+		assert.Nil(err)
+		assert.Len(candidates, 0)
+	}
+}
+
+func TestSQLChatSessionConcurrentChange(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatSessionConcurrentChange(t, userManager)
+}
+
+func TestSQLConcurrentWriters(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.InfoLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	utContext := context.Background()
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Warn, nil)
+	assert.Nil(err)
+	userName := uuid.NewString()
+	_, err = userManager.RecordNewUser(utContext, userName)
+	assert.Nil(err)
+
+	// Each writer has its own DB connection, as separate processes would
+	writerCount := 4
+	exchangeCount := 10
+	sessionIDs := make([]string, writerCount)
+	wg := sync.WaitGroup{}
+	for writerIdx := 0; writerIdx < writerCount; writerIdx++ {
+		writerManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Warn, nil)
+		assert.Nil(err)
+		writer, err := writerManager.GetUserByName(utContext, userName)
+		assert.Nil(err)
+		chatManager, err := writer.ChatSessionManager(utContext)
+		assert.Nil(err)
+		session, err := chatManager.NewSession(utContext, "turbo")
+		assert.Nil(err)
+		sessionIDs[writerIdx], err = session.SessionID(utContext)
+		assert.Nil(err)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := 0; idx < exchangeCount; idx++ {
+				currentTime := time.Now()
+				assert.Nil(session.RecordOneExchange(utContext, ChatExchange{
+					RequestTimestamp:  currentTime,
+					Request:           uuid.NewString(),
+					ResponseTimestamp: currentTime.Add(time.Millisecond),
+					Response:          uuid.NewString(),
+				}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	user, err := userManager.GetUserByName(utContext, userName)
+	assert.Nil(err)
+	chatManager, err := user.ChatSessionManager(utContext)
+	assert.Nil(err)
+	for _, sessionID := range sessionIDs {
+		session, err := chatManager.GetSession(utContext, sessionID)
+		assert.Nil(err)
+		exchanges, err := session.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, exchangeCount)
+	}
+}
+
+// testChatSessionConcurrentChange test suite for changing a chat session through several handles
+func testChatSessionConcurrentChange(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	handle0, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	sessionID, err := handle0.SessionID(utContext)
+	assert.Nil(err)
+	handle1, err := chatManager.GetSession(utContext, sessionID)
+	assert.Nil(err)
+
+	currentTime := time.Now()
+	newExchange := func(offset int) ChatExchange {
+		return ChatExchange{
+			RequestTimestamp:  currentTime.Add(time.Second * time.Duration(offset)),
+			Request:           uuid.NewString(),
+			ResponseTimestamp: currentTime.Add(time.Second*time.Duration(offset) + time.Millisecond),
+			Response:          uuid.NewString(),
+		}
+	}
+
+	// Case 0: the handle making the change can keep making changes
+	{
+		assert.Nil(handle0.RecordOneExchange(utContext, newExchange(0)))
+		assert.Nil(handle0.RecordOneExchange(utContext, newExchange(1)))
+	}
+
+	// Case 1: the other handle sees the session changed
+	{
+		err := handle1.RecordOneExchange(utContext, newExchange(2))
+		assert.ErrorIs(err, ErrChatSessionModified)
+		assert.ErrorIs(handle1.DeleteLatestExchange(utContext), ErrChatSessionModified)
+		assert.ErrorIs(
+			handle1.ReplaceLatestExchange(utContext, newExchange(2)), ErrChatSessionModified,
+		)
+		assert.ErrorIs(
+			handle1.RecordLatestExchangeVariant(
+				utContext, ChatExchangeVariant{ResponseTimestamp: time.Now(), Response: "variant"},
+			),
+			ErrChatSessionModified,
+		)
+		assert.ErrorIs(handle1.SelectLatestExchangeVariant(utContext, 0), ErrChatSessionModified)
+		exchanges, err := handle1.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 2)
+	}
+
+	// Case 2: the change goes through once the handle is refreshed
+	{
+		assert.Nil(handle1.Refresh(utContext))
+		assert.Nil(handle1.RecordOneExchange(utContext, newExchange(2)))
+		assert.ErrorIs(handle0.RecordOneExchange(utContext, newExchange(3)), ErrChatSessionModified)
+		assert.Nil(handle0.Refresh(utContext))
+		assert.Nil(handle0.RecordOneExchange(utContext, newExchange(3)))
+		exchanges, err := handle0.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 4)
+	}
+
+	// Case 3: changes to specific exchanges do not need the latest history, but still
+	// change the session
+	{
+		exchanges, err := handle1.Exchanges(utContext)
+		assert.Nil(err)
+		newRequest := uuid.NewString()
+		assert.Nil(
+			handle1.EditExchange(
+				utContext, exchanges[0].ID, ChatExchangeEdit{Request: &newRequest, Reason: "typo"},
+			),
+		)
+		assert.Nil(handle1.DeleteExchanges(utContext, []string{exchanges[1].ID}, "unneeded"))
+		assert.ErrorIs(handle1.DeleteLatestExchange(utContext), ErrChatSessionModified)
+		assert.ErrorIs(handle0.DeleteLatestExchange(utContext), ErrChatSessionModified)
+		assert.Nil(handle1.Refresh(utContext))
+		assert.Nil(handle1.DeleteLatestExchange(utContext))
+		exchanges, err = handle1.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 2)
+		assert.Equal(newRequest, exchanges[0].Request)
+	}
+
+	// Case 4: changing the session settings, metadata, or state does not load the latest
+	// history into the handle
+	{
+		settings, err := handle0.Settings(utContext)
+		assert.Nil(err)
+		settings.MaxTokens = 1024
+		assert.Nil(handle0.ChangeSettings(utContext, settings))
+		assert.Nil(handle0.ChangeMetadata(utContext, ChatSessionMetadata{Title: "concurrent"}))
+		assert.ErrorIs(handle0.DeleteLatestExchange(utContext), ErrChatSessionModified)
+		assert.Nil(handle0.ChangeState(utContext, ChatSessionStateClose))
+		assert.ErrorIs(handle0.DeleteLatestExchange(utContext), ErrChatSessionModified)
+
+		// The changed columns are reloaded
+		settings, err = handle0.Settings(utContext)
+		assert.Nil(err)
+		assert.Equal(1024, settings.MaxTokens)
+		metadata, err := handle0.Metadata(utContext)
+		assert.Nil(err)
+		assert.Equal("concurrent", metadata.Title)
+		state, err := handle0.SessionState(utContext)
+		assert.Nil(err)
+		assert.Equal(ChatSessionStateClose, state)
+	}
+}
+
+func TestSQLChatSessionPinnedNotes(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatSessionPinnedNotes(t, userManager)
+}
+
+// testChatSessionPinnedNotes test suite for notes pinned to chat sessions
+func testChatSessionPinnedNotes(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	session0, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	session0ID, err := session0.SessionID(utContext)
+	assert.Nil(err)
+	session1, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+
+	// Case 0: no notes pinned
+	{
+		notes, err := session0.PinnedNotes(utContext)
+		assert.Nil(err)
+		assert.Empty(notes)
+	}
+
+	// Case 1: pin notes
+	noteIDs := []string{}
+	{
+		_, err := session0.PinNote(utContext, ChatSessionNote{Content: " \n"})
+		assert.NotNil(err)
+
+		noteID, err := session0.PinNote(utContext, ChatSessionNote{Content: "Stack is Go 1.21 + Postgres"})
+		assert.Nil(err)
+		noteIDs = append(noteIDs, noteID)
+		noteID, err = session0.PinNote(
+			utContext, ChatSessionNote{Content: "package main\n", Source: "main.go"},
+		)
+		assert.Nil(err)
+		noteIDs = append(noteIDs, noteID)
+
+		notes, err := session0.PinnedNotes(utContext)
+		assert.Nil(err)
+		assert.Len(notes, 2)
+		assert.Equal(noteIDs[0], notes[0].ID)
+		assert.Equal("Stack is Go 1.21 + Postgres", notes[0].Content)
+		assert.Empty(notes[0].Source)
+		assert.False(notes[0].CreatedAt.IsZero())
+		assert.Equal(noteIDs[1], notes[1].ID)
+		assert.Equal("main.go", notes[1].Source)
+
+		// Notes of one session are not visible in another
+		notes, err = session1.PinnedNotes(utContext)
+		assert.Nil(err)
+		assert.Empty(notes)
+	}
+
+	// Case 2: forked sessions copy the pinned notes
+	{
+		forked, err := chatManager.ForkSession(utContext, session0ID, -1)
+		assert.Nil(err)
+		notes, err := forked.PinnedNotes(utContext)
+		assert.Nil(err)
+		assert.Len(notes, 2)
+		assert.NotEqual(noteIDs[0], notes[0].ID)
+		assert.Equal("Stack is Go 1.21 + Postgres", notes[0].Content)
+		assert.Equal("main.go", notes[1].Source)
+	}
+
+	// Case 3: unpin notes
+	{
+		assert.NotNil(session1.UnpinNote(utContext, noteIDs[0]))
+		assert.NotNil(session0.UnpinNote(utContext, uuid.NewString()))
+		assert.Nil(session0.UnpinNote(utContext, noteIDs[0]))
+		notes, err := session0.PinnedNotes(utContext)
+		assert.Nil(err)
+		assert.Len(notes, 1)
+		assert.Equal(noteIDs[1], notes[0].ID)
+	}
+
+	// Case 4: notes can not be pinned to sessions in the trash
+	{
+		assert.Nil(chatManager.DeleteSession(utContext, session0ID))
+		_, err := session0.PinNote(utContext, ChatSessionNote{Content: "too late"})
+		assert.NotNil(err)
+	}
+}
+
+func TestSQLChatSessionPresets(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatSessionPresets(t, userManager)
+}
+
+// testChatSessionPresets test suite for chat session presets
+func testChatSessionPresets(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager0, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+	user1, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager1, err := user1.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	// Case 0: no presets
+	{
+		presets, err := chatManager0.ListPresets(utContext)
+		assert.Nil(err)
+		assert.Empty(presets)
+		_, err = chatManager0.GetPreset(utContext, "code-review")
+		assert.NotNil(err)
+	}
+
+	codeReview := GetDefaultChatSessionParams("turbo")
+	temperature := float32(0.1)
+	penalty := float32(0.5)
+	codeReview.Temperature = &temperature
+	codeReview.FrequencyPenalty = &penalty
+	codeReview.Stop = []string{"END"}
+
+	// Case 1: record presets
+	{
+		assert.NotNil(chatManager0.RecordPreset(
+			utContext, ChatSessionPreset{Name: "code review", Settings: codeReview},
+		))
+		assert.NotNil(chatManager0.RecordPreset(
+			utContext, ChatSessionPreset{Name: "", Settings: codeReview},
+		))
+		invalid := codeReview
+		invalid.Model = "unknown"
+		assert.NotNil(chatManager0.RecordPreset(
+			utContext, ChatSessionPreset{Name: "invalid", Settings: invalid},
+		))
+
+		assert.Nil(chatManager0.RecordPreset(
+			utContext, ChatSessionPreset{Name: "code-review", Settings: codeReview},
+		))
+		assert.Nil(chatManager0.RecordPreset(
+			utContext, ChatSessionPreset{Name: "brainstorm", Settings: GetDefaultChatSessionParams("davinci")},
+		))
+		assert.NotNil(chatManager0.RecordPreset(
+			utContext, ChatSessionPreset{Name: "code-review", Settings: codeReview},
+		))
+
+		presets, err := chatManager0.ListPresets(utContext)
+		assert.Nil(err)
+		assert.Len(presets, 2)
+		assert.Equal("brainstorm", presets[0].Name)
+		assert.Equal("davinci", presets[0].Settings.Model)
+		assert.Equal("code-review", presets[1].Name)
+		assert.EqualValues(codeReview, presets[1].Settings)
+
+		preset, err := chatManager0.GetPreset(utContext, "code-review")
+		assert.Nil(err)
+		assert.EqualValues(codeReview, preset.Settings)
+	}
+
+	// Case 2: presets are per user
+	{
+		presets, err := chatManager1.ListPresets(utContext)
+		assert.Nil(err)
+		assert.Empty(presets)
+		assert.Nil(chatManager1.RecordPreset(
+			utContext, ChatSessionPreset{Name: "code-review", Settings: GetDefaultChatSessionParams("ada")},
+		))
+		preset, err := chatManager0.GetPreset(utContext, "code-review")
+		assert.Nil(err)
+		assert.Equal("turbo", preset.Settings.Model)
+	}
+
+	// Case 3: update a preset
+	{
+		updated := GetDefaultChatSessionParams("curie")
+		updated.MaxTokens = 512
+		assert.NotNil(chatManager0.UpdatePreset(
+			utContext, ChatSessionPreset{Name: "unknown", Settings: updated},
+		))
+		invalid := updated
+		invalid.MaxTokens = 1
+		assert.NotNil(chatManager0.UpdatePreset(
+			utContext, ChatSessionPreset{Name: "code-review", Settings: invalid},
+		))
+		assert.Nil(chatManager0.UpdatePreset(
+			utContext, ChatSessionPreset{Name: "code-review", Settings: updated},
+		))
+		preset, err := chatManager0.GetPreset(utContext, "code-review")
+		assert.Nil(err)
+		assert.EqualValues(updated, preset.Settings)
+		preset, err = chatManager1.GetPreset(utContext, "code-review")
+		assert.Nil(err)
+		assert.Equal("ada", preset.Settings.Model)
+	}
+
+	// Case 4: presets are removed with the user
+	{
+		user0ID, err := user0.GetID(utContext)
+		assert.Nil(err)
+		assert.Nil(userManager.DeleteUser(utContext, user0ID))
+		presets, _ := chatManager0.ListPresets(utContext)
+		assert.Empty(presets)
+		presets, err = chatManager1.ListPresets(utContext)
+		assert.Nil(err)
+		assert.Len(presets, 1)
+	}
+}
+
+func TestSQLChatExchangeAttachments(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatExchangeAttachments(t, userManager)
+}
+
+// testChatExchangeAttachments test suite for files attached to chat exchanges
+func testChatExchangeAttachments(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	session0, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	session0ID, err := session0.SessionID(utContext)
+	assert.Nil(err)
+
+	currentTime := time.Now()
+	newExchange := func(idx int, attachments []ChatExchangeAttachment) ChatExchange {
+		return ChatExchange{
+			RequestTimestamp:  currentTime.Add(time.Second * time.Duration(idx*2)),
+			Request:           fmt.Sprintf("req-%d", idx),
+			ResponseTimestamp: currentTime.Add(time.Second * time.Duration(idx*2+1)),
+			Response:          fmt.Sprintf("resp-%d", idx),
+			Attachments:       attachments,
+		}
+	}
+	attachments := []ChatExchangeAttachment{
+		{Name: "main.go", Content: "package main\n"},
+		{Name: "go.mod", Content: "module example\n"},
+	}
+
+	// Case 0: an attachment must be named
+	{
+		assert.NotNil(session0.RecordOneExchange(
+			utContext, newExchange(0, []ChatExchangeAttachment{{Content: "package main\n"}}),
+		))
+		exchanges, err := session0.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Empty(exchanges)
+	}
+
+	// Case 1: attachments are read back with their exchange, in order
+	{
+		assert.Nil(session0.RecordOneExchange(utContext, newExchange(0, attachments)))
+		assert.Nil(session0.RecordOneExchange(utContext, newExchange(1, nil)))
+
+		exchanges, err := session0.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 2)
+		assert.Equal(attachments, exchanges[0].Attachments)
+		assert.Empty(exchanges[1].Attachments)
+
+		first, err := session0.FirstExchange(utContext)
+		assert.Nil(err)
+		assert.Equal(attachments, first.Attachments)
+
+		latest, err := session0.LatestExchanges(utContext, 2)
+		assert.Nil(err)
+		assert.Len(latest, 2)
+		assert.Equal("req-0", latest[0].Request)
+		assert.Equal(attachments, latest[0].Attachments)
+	}
+
+	// Case 2: replacing the newest exchange replaces its attachments
+	{
+		replacement := []ChatExchangeAttachment{{Name: "README.md", Content: "# Example\n"}}
+		assert.Nil(session0.ReplaceLatestExchange(utContext, newExchange(2, replacement)))
+		exchanges, err := session0.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 2)
+		assert.Equal(attachments, exchanges[0].Attachments)
+		assert.Equal(replacement, exchanges[1].Attachments)
+
+		assert.Nil(session0.ReplaceLatestExchange(utContext, newExchange(3, nil)))
+		exchanges, err = session0.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Empty(exchanges[1].Attachments)
+	}
+
+	// Case 3: forked sessions copy the attachments
+	{
+		forked, err := chatManager.ForkSession(utContext, session0ID, -1)
+		assert.Nil(err)
+		exchanges, err := forked.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 2)
+		assert.Equal(attachments, exchanges[0].Attachments)
+		assert.Empty(exchanges[1].Attachments)
+	}
+}
@@ -0,0 +1,192 @@
+package persistence
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alwitt/goutils"
+	"github.com/apex/log"
+	"github.com/oklog/ulid/v2"
+)
+
+// memoryUserEntry in-memory record representing a user
+type memoryUserEntry struct {
+	ID              string
+	Name            string
+	APIToken        string
+	APITokenSource  APITokenSource
+	RetentionPolicy RetentionPolicy
+	// DefaultChatSettings request settings new chat sessions start with. Empty if not set.
+	DefaultChatSettings ChatSessionParameters
+	// Presets chat session presets, keyed by name
+	Presets         map[string]ChatSessionParameters
+	ActiveSessionID *string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// memoryChatSessionEntry in-memory record representing a chat session
+type memoryChatSessionEntry struct {
+	ID             string
+	State          ChatSessionState
+	UserID         string
+	CommonSettings ChatSessionParameters
+	Metadata       ChatSessionMetadata
+	// AuditRecords audit records of changes made to the exchanges, oldest first
+	AuditRecords []ChatExchangeAuditRecord
+	// Exchanges the session exchanges, sorted by request timestamp
+	Exchanges []memoryChatExchangeEntry
+	// PinnedNotes notes pinned to the session, oldest first
+	PinnedNotes []ChatSessionNote
+	// Version of the session history, advanced by every change to the exchanges
+	Version   int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// DeletedAt when the session was moved to the trash. Nil if not in the trash.
+	DeletedAt *time.Time
+}
+
+/*
+insertExchange record a new exchange, keeping the exchanges sorted by request timestamp
+
+	@param exchange ChatExchange - the exchange
+	@return the new exchange entry ID
+*/
+func (e *memoryChatSessionEntry) insertExchange(exchange ChatExchange) string {
+	exchangeID := ulid.Make().String()
+	exchange.ID = exchangeID
+	if len(exchange.Attachments) > 0 {
+		exchange.Attachments = append([]ChatExchangeAttachment{}, exchange.Attachments...)
+	}
+	newEntry := memoryChatExchangeEntry{
+		ID: exchangeID, ChatExchange: exchange, CreatedAt: time.Now(),
+	}
+	insertAt := sort.Search(len(e.Exchanges), func(idx int) bool {
+		return e.Exchanges[idx].RequestTimestamp.After(exchange.RequestTimestamp)
+	})
+	e.Exchanges = append(e.Exchanges, memoryChatExchangeEntry{})
+	copy(e.Exchanges[insertAt+1:], e.Exchanges[insertAt:])
+	e.Exchanges[insertAt] = newEntry
+	return exchangeID
+}
+
+/*
+lastActivity when the session was last used
+
+	@return when the latest response was received, or when the session was created
+*/
+func (e *memoryChatSessionEntry) lastActivity() time.Time {
+	result := e.CreatedAt
+	for idx, oneExchange := range e.Exchanges {
+		if idx == 0 || oneExchange.ResponseTimestamp.After(result) {
+			result = oneExchange.ResponseTimestamp
+		}
+	}
+	return result
+}
+
+/*
+summary summarize the session for listing
+
+	@return the session summary
+*/
+func (e *memoryChatSessionEntry) summary() ChatSessionSummary {
+	result := ChatSessionSummary{
+		SessionID: e.ID,
+		State:     e.State,
+		Model:     e.CommonSettings.Model,
+		Metadata: ChatSessionMetadata{
+			Title: e.Metadata.Title, Description: e.Metadata.Description,
+		},
+		ExchangeCount: len(e.Exchanges),
+		CreatedAt:     e.CreatedAt,
+	}
+	if len(e.Metadata.Tags) > 0 {
+		result.Metadata.Tags = append([]string{}, e.Metadata.Tags...)
+	}
+	if len(e.Exchanges) > 0 {
+		result.FirstRequest = e.Exchanges[0].Request
+	}
+	return result
+}
+
+// memoryChatExchangeEntry in-memory record representing one chat session exchange
+type memoryChatExchangeEntry struct {
+	ID string
+	ChatExchange
+	// Variants response variants, oldest first. Only recorded once the exchange is regenerated.
+	Variants  []ChatExchangeVariant
+	CreatedAt time.Time
+}
+
+/*
+memoryStore in-memory data store shared by all handles of one in-memory user manager
+
+All access to the store must be done while holding the lock.
+*/
+type memoryStore struct {
+	lock sync.RWMutex
+	// users user records, keyed by user ID
+	users map[string]*memoryUserEntry
+	// userOrder user IDs in creation order
+	userOrder []string
+	// sessions chat session records, keyed by session ID
+	sessions map[string]*memoryChatSessionEntry
+	// sessionOrder session IDs in creation order
+	sessionOrder []string
+}
+
+// In-memory persistence layer driver
+type memoryUserPersistence struct {
+	goutils.Component
+	store *memoryStore
+}
+
+// In-memory persistence layer driver specific to chat session management
+type memoryChatPersistence struct {
+	goutils.Component
+	driver *memoryUserPersistence
+	user   *memoryUserHandle
+}
+
+/*
+GetMemoryUserManager define a new in-memory user manager
+
+Nothing is written to disk, and all data is lost once the manager is released. The manager is
+thread-safe.
+
+	@return user manager
+*/
+func GetMemoryUserManager() (UserManager, error) {
+	logTags := log.Fields{"module": "persistence", "component": "user-manager", "instance": "memory"}
+	return &memoryUserPersistence{
+		Component: goutils.Component{
+			LogTags:         logTags,
+			LogTagModifiers: []goutils.LogMetadataModifier{},
+		},
+		store: &memoryStore{
+			users:        map[string]*memoryUserEntry{},
+			userOrder:    []string{},
+			sessions:     map[string]*memoryChatSessionEntry{},
+			sessionOrder: []string{},
+		},
+	}, nil
+}
+
+/*
+removeFromOrder helper function to remove an ID from an ordering list
+
+	@param order []string - ordering list
+	@param id string - ID to remove
+	@return updated ordering list
+*/
+func removeFromOrder(order []string, id string) []string {
+	result := []string{}
+	for _, entry := range order {
+		if entry != id {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
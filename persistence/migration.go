@@ -0,0 +1,500 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alwitt/goutils"
+	"github.com/apex/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlSchemaMigrationEntry SQL table recording the applied schema migrations
+type sqlSchemaMigrationEntry struct {
+	// Version schema version the migration brings the DB to
+	Version int `gorm:"primaryKey;autoIncrement:false"`
+	// Description migration description
+	Description string `gorm:"not null"`
+	// AppliedAt when the migration was applied
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName hard code table name
+func (sqlSchemaMigrationEntry) TableName() string {
+	return "schema_migrations"
+}
+
+/*
+sqlSchemaMigration one schema migration step
+
+Each migration moves the schema from version N-1 to version N, and is able to undo itself.
+Migrations operate on SQL statements directly, so that they are not affected by later changes
+to the GORM models.
+*/
+type sqlSchemaMigration struct {
+	// version schema version after applying the migration
+	version int
+	// description migration description
+	description string
+	// up apply the migration
+	up func(tx *gorm.DB) error
+	// down undo the migration
+	down func(tx *gorm.DB) error
+}
+
+/*
+execSQLStatements helper function to define a migration step from a list of SQL statements
+
+	@param statements []string - SQL statements to execute in order
+	@return migration step function
+*/
+func execSQLStatements(statements ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if tmp := tx.Exec(statement); tmp.Error != nil {
+				return tmp.Error
+			}
+		}
+		return nil
+	}
+}
+
+/*
+sqlSchemaMigrations the ordered list of schema migrations
+
+New migrations must be appended to the end of the list, with version set to the next
+schema version. Never modify a migration which has been released.
+*/
+var sqlSchemaMigrations = []sqlSchemaMigration{
+	{
+		version:     1,
+		description: "initial schema",
+		// Matches the schema previously produced by GORM AutoMigrate, so existing DBs
+		// are adopted as is.
+		up: execSQLStatements(
+			"CREATE TABLE IF NOT EXISTS `chat_sessions` (`id` text,`state` varchar(64) NOT NULL,"+
+				"`user_id` text NOT NULL,`common_settings` text NOT NULL,`created_at` datetime,"+
+				"`updated_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_users_chat_sessions` "+
+				"FOREIGN KEY (`user_id`) REFERENCES `users`(`id`))",
+			"CREATE INDEX IF NOT EXISTS `chat_session_user_id` ON `chat_sessions`(`user_id`)",
+			"CREATE TABLE IF NOT EXISTS `users` (`id` text,`name` text NOT NULL UNIQUE,"+
+				"`api_token` text NOT NULL,`active_session_id` text DEFAULT null,"+
+				"`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`),"+
+				"CONSTRAINT `fk_users_active_session` FOREIGN KEY (`active_session_id`) "+
+				"REFERENCES `chat_sessions`(`id`) ON DELETE SET NULL)",
+			"CREATE UNIQUE INDEX IF NOT EXISTS `username_index` ON `users`(`name`)",
+			"CREATE TABLE IF NOT EXISTS `chat_session_exchanges` (`id` text,"+
+				"`session_id` text NOT NULL,`request` text NOT NULL,"+
+				"`request_timestamp` datetime NOT NULL,`response` text NOT NULL,"+
+				"`response_timestamp` datetime NOT NULL,`created_at` datetime,"+
+				"`updated_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_chat_sessions_exchanges` "+
+				"FOREIGN KEY (`session_id`) REFERENCES `chat_sessions`(`id`))",
+			"CREATE INDEX IF NOT EXISTS `chat_exchange_session_id` "+
+				"ON `chat_session_exchanges`(`session_id`)",
+		),
+		down: execSQLStatements(
+			"DROP TABLE IF EXISTS `chat_session_exchanges`",
+			"DROP TABLE IF EXISTS `chat_sessions`",
+			"DROP TABLE IF EXISTS `users`",
+		),
+	},
+	{
+		version:     2,
+		description: "user API token sources",
+		up: execSQLStatements(
+			"ALTER TABLE `users` ADD COLUMN `api_token_source` varchar(16) NOT NULL DEFAULT 'literal'",
+			"ALTER TABLE `users` ADD COLUMN `api_token_reference` text NOT NULL DEFAULT ''",
+		),
+		down: execSQLStatements(
+			"UPDATE `users` SET `api_token` = '' WHERE `api_token_source` != 'literal'",
+			"ALTER TABLE `users` DROP COLUMN `api_token_reference`",
+			"ALTER TABLE `users` DROP COLUMN `api_token_source`",
+		),
+	},
+	{
+		version:     3,
+		description: "chat session metadata",
+		up: execSQLStatements(
+			"ALTER TABLE `chat_sessions` ADD COLUMN `title` text NOT NULL DEFAULT ''",
+			"ALTER TABLE `chat_sessions` ADD COLUMN `description` text NOT NULL DEFAULT ''",
+			"CREATE TABLE `chat_session_tags` (`session_id` text NOT NULL,`tag` varchar(64) NOT NULL,"+
+				"PRIMARY KEY (`session_id`,`tag`),CONSTRAINT `fk_chat_sessions_tags` "+
+				"FOREIGN KEY (`session_id`) REFERENCES `chat_sessions`(`id`) ON DELETE CASCADE)",
+			"CREATE INDEX `chat_session_tag` ON `chat_session_tags`(`tag`)",
+		),
+		down: execSQLStatements(
+			"DROP TABLE IF EXISTS `chat_session_tags`",
+			"ALTER TABLE `chat_sessions` DROP COLUMN `description`",
+			"ALTER TABLE `chat_sessions` DROP COLUMN `title`",
+		),
+	},
+	{
+		version:     4,
+		description: "chat exchange response variants",
+		up: execSQLStatements(
+			"CREATE TABLE `chat_exchange_variants` (`id` text,`exchange_id` text NOT NULL,"+
+				"`response` text NOT NULL,`response_timestamp` datetime NOT NULL,"+
+				"`model` varchar(64) NOT NULL DEFAULT '',`temperature` real DEFAULT null,"+
+				"`selected` numeric NOT NULL DEFAULT false,`created_at` datetime,"+
+				"PRIMARY KEY (`id`),CONSTRAINT `fk_chat_session_exchanges_variants` "+
+				"FOREIGN KEY (`exchange_id`) REFERENCES `chat_session_exchanges`(`id`) ON DELETE CASCADE)",
+			"CREATE INDEX `chat_exchange_variant_exchange_id` ON `chat_exchange_variants`(`exchange_id`)",
+		),
+		down: execSQLStatements("DROP TABLE IF EXISTS `chat_exchange_variants`"),
+	},
+	{
+		version:     5,
+		description: "chat exchange audit records",
+		up: execSQLStatements(
+			"CREATE TABLE `chat_exchange_audit` (`id` text,`session_id` text NOT NULL,"+
+				"`exchange_id` text NOT NULL,`action` varchar(32) NOT NULL,"+
+				"`request_timestamp` datetime NOT NULL,`reason` text NOT NULL DEFAULT '',"+
+				"`created_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_chat_sessions_audit` "+
+				"FOREIGN KEY (`session_id`) REFERENCES `chat_sessions`(`id`) ON DELETE CASCADE)",
+			"CREATE INDEX `chat_exchange_audit_session_id` ON `chat_exchange_audit`(`session_id`)",
+		),
+		down: execSQLStatements("DROP TABLE IF EXISTS `chat_exchange_audit`"),
+	},
+	{
+		version:     6,
+		description: "chat exchange session request time index",
+		// Serves the first and latest exchange lookups when listing sessions
+		up: execSQLStatements(
+			"CREATE INDEX `chat_exchange_session_request_ts` " +
+				"ON `chat_session_exchanges`(`session_id`,`request_timestamp`)",
+		),
+		down: execSQLStatements("DROP INDEX IF EXISTS `chat_exchange_session_request_ts`"),
+	},
+	{
+		version:     7,
+		description: "chat session trash",
+		up: execSQLStatements(
+			"ALTER TABLE `chat_sessions` ADD COLUMN `deleted_at` datetime DEFAULT null",
+			"CREATE INDEX `chat_session_deleted_at` ON `chat_sessions`(`deleted_at`)",
+		),
+		// Sessions in the trash would come back to life without the column, so purge them
+		down: execSQLStatements(
+			"DELETE FROM `chat_session_exchanges` WHERE `session_id` IN "+
+				"(SELECT `id` FROM `chat_sessions` WHERE `deleted_at` IS NOT NULL)",
+			"DELETE FROM `chat_sessions` WHERE `deleted_at` IS NOT NULL",
+			"DROP INDEX IF EXISTS `chat_session_deleted_at`",
+			"ALTER TABLE `chat_sessions` DROP COLUMN `deleted_at`",
+		),
+	},
+	{
+		version:     8,
+		description: "user retention policy",
+		up: execSQLStatements(
+			"ALTER TABLE `users` ADD COLUMN `retention_policy` text NOT NULL DEFAULT '{}'",
+		),
+		down: execSQLStatements("ALTER TABLE `users` DROP COLUMN `retention_policy`"),
+	},
+	{
+		version:     9,
+		description: "chat session history version",
+		up: execSQLStatements(
+			"ALTER TABLE `chat_sessions` ADD COLUMN `version` integer NOT NULL DEFAULT 0",
+		),
+		down: execSQLStatements("ALTER TABLE `chat_sessions` DROP COLUMN `version`"),
+	},
+	{
+		version:     10,
+		description: "chat session pinned notes",
+		up: execSQLStatements(
+			"CREATE TABLE `chat_session_notes` (`id` text,`session_id` text NOT NULL,"+
+				"`content` text NOT NULL,`source` text NOT NULL DEFAULT '',`created_at` datetime,"+
+				"PRIMARY KEY (`id`),CONSTRAINT `fk_chat_sessions_notes` "+
+				"FOREIGN KEY (`session_id`) REFERENCES `chat_sessions`(`id`) ON DELETE CASCADE)",
+			"CREATE INDEX `chat_session_note_session_id` ON `chat_session_notes`(`session_id`)",
+		),
+		down: execSQLStatements("DROP TABLE IF EXISTS `chat_session_notes`"),
+	},
+	{
+		version:     11,
+		description: "chat session presets",
+		up: execSQLStatements(
+			"CREATE TABLE `chat_session_presets` (`user_id` text,`name` varchar(64)," +
+				"`settings` text NOT NULL,`created_at` datetime,`updated_at` datetime," +
+				"PRIMARY KEY (`user_id`,`name`),CONSTRAINT `fk_users_chat_session_presets` " +
+				"FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE)",
+		),
+		down: execSQLStatements("DROP TABLE IF EXISTS `chat_session_presets`"),
+	},
+	{
+		version:     12,
+		description: "user default chat settings",
+		up: execSQLStatements(
+			"ALTER TABLE `users` ADD COLUMN `default_chat_settings` text NOT NULL DEFAULT '{}'",
+		),
+		down: execSQLStatements("ALTER TABLE `users` DROP COLUMN `default_chat_settings`"),
+	},
+	{
+		version:     13,
+		description: "chat exchange attachments",
+		up: execSQLStatements(
+			"CREATE TABLE `chat_exchange_attachments` (`id` text,`exchange_id` text NOT NULL,"+
+				"`name` text NOT NULL,`content` text NOT NULL,`created_at` datetime,"+
+				"PRIMARY KEY (`id`),CONSTRAINT `fk_chat_session_exchanges_attachments` "+
+				"FOREIGN KEY (`exchange_id`) REFERENCES `chat_session_exchanges`(`id`) ON DELETE CASCADE)",
+			"CREATE INDEX `chat_exchange_attachment_exchange_id` ON "+
+				"`chat_exchange_attachments`(`exchange_id`)",
+		),
+		down: execSQLStatements("DROP TABLE IF EXISTS `chat_exchange_attachments`"),
+	},
+	{
+		// The search index triggers were defined by builds supporting FTS5 outside of the
+		// migrations. They prevent builds without FTS5 from recording exchanges, so the index is
+		// now maintained by the application instead.
+		version:     14,
+		description: "drop search index triggers",
+		up: execSQLStatements(
+			"DROP TRIGGER IF EXISTS `chat_exchange_search_insert`",
+			"DROP TRIGGER IF EXISTS `chat_exchange_search_delete`",
+			"DROP TRIGGER IF EXISTS `chat_exchange_search_update`",
+		),
+		down: execSQLStatements(),
+	},
+	{
+		// Builds without FTS5 can not update the search index, so they mark it as out of date
+		// for builds with FTS5 to rebuild. The index was previously brought up to date by each
+		// search, so it starts out of date.
+		version:     15,
+		description: "search index status",
+		up: execSQLStatements(
+			"CREATE TABLE `chat_exchange_search_stale` (`id` integer,PRIMARY KEY (`id`))",
+			"INSERT INTO `chat_exchange_search_stale` (id) VALUES (1)",
+		),
+		down: execSQLStatements("DROP TABLE IF EXISTS `chat_exchange_search_stale`"),
+	},
+}
+
+/*
+LatestSQLSchemaVersion the schema version the SQL persistence layer requires
+
+	@return latest schema version
+*/
+func LatestSQLSchemaVersion() int {
+	return sqlSchemaMigrations[len(sqlSchemaMigrations)-1].version
+}
+
+/*
+SchemaMigrationStatus status of one schema migration
+*/
+type SchemaMigrationStatus struct {
+	// Version schema version the migration brings the DB to
+	Version int `yaml:"version" json:"version"`
+	// Description migration description
+	Description string `yaml:"description" json:"description"`
+	// AppliedAt when the migration was applied. Nil if not applied.
+	AppliedAt *time.Time `yaml:"applied_at,omitempty" json:"applied_at,omitempty"`
+}
+
+/*
+SchemaMigrator persistence schema management client
+*/
+type SchemaMigrator interface {
+	/*
+		SchemaVersion query the current schema version of the DB
+
+			@param ctxt context.Context - query context
+			@return current schema version. 0 if no migrations were applied.
+	*/
+	SchemaVersion(ctxt context.Context) (int, error)
+
+	/*
+		MigrationStatus query the status of all known schema migrations
+
+			@param ctxt context.Context - query context
+			@return status of each migration, ordered by version
+	*/
+	MigrationStatus(ctxt context.Context) ([]SchemaMigrationStatus, error)
+
+	/*
+		MigrateTo apply or undo migrations until the DB is at the target schema version
+
+			@param ctxt context.Context - query context
+			@param targetVersion int - target schema version
+	*/
+	MigrateTo(ctxt context.Context, targetVersion int) error
+}
+
+// sqlSchemaMigrator SQL persistence schema management client
+type sqlSchemaMigrator struct {
+	goutils.Component
+	db *gorm.DB
+}
+
+/*
+GetSQLSchemaMigrator define a new SQL schema migrator
+
+	@param dbDialector gorm.Dialector - GORM SQL dialector
+	@param logLevel logger.LogLevel - SQL log level
+	@return schema migrator
+*/
+func GetSQLSchemaMigrator(
+	dbDialector gorm.Dialector, logLevel logger.LogLevel,
+) (SchemaMigrator, error) {
+	db, err := openSQLDB(dbDialector, logLevel)
+	if err != nil {
+		return nil, err
+	}
+	return defineSQLSchemaMigrator(db)
+}
+
+// defineSQLSchemaMigrator define a new SQL schema migrator using an existing DB connection
+func defineSQLSchemaMigrator(db *gorm.DB) (*sqlSchemaMigrator, error) {
+	// The migration table is the only table not managed by migrations
+	if tmp := db.Exec(
+		"CREATE TABLE IF NOT EXISTS `schema_migrations` (`version` integer,`description` text NOT NULL," +
+			"`applied_at` datetime NOT NULL,PRIMARY KEY (`version`))",
+	); tmp.Error != nil {
+		return nil, tmp.Error
+	}
+
+	logTags := log.Fields{"module": "persistence", "component": "schema-migrator", "instance": "sql"}
+	return &sqlSchemaMigrator{
+		Component: goutils.Component{
+			LogTags:         logTags,
+			LogTagModifiers: []goutils.LogMetadataModifier{},
+		}, db: db,
+	}, nil
+}
+
+/*
+SchemaVersion query the current schema version of the DB
+
+	@param ctxt context.Context - query context
+	@return current schema version. 0 if no migrations were applied.
+*/
+func (m *sqlSchemaMigrator) SchemaVersion(ctxt context.Context) (int, error) {
+	logtags := m.GetLogTagsForContext(ctxt)
+	var version *int
+	if tmp := m.db.
+		Model(&sqlSchemaMigrationEntry{}).
+		Select("max(version)").
+		Scan(&version); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Error("Failed to read schema version")
+		return 0, tmp.Error
+	}
+	if version == nil {
+		return 0, nil
+	}
+	return *version, nil
+}
+
+/*
+MigrationStatus query the status of all known schema migrations
+
+	@param ctxt context.Context - query context
+	@return status of each migration, ordered by version
+*/
+func (m *sqlSchemaMigrator) MigrationStatus(ctxt context.Context) ([]SchemaMigrationStatus, error) {
+	logtags := m.GetLogTagsForContext(ctxt)
+	var applied []sqlSchemaMigrationEntry
+	if tmp := m.db.Order("version").Find(&applied); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Error("Failed to read applied migrations")
+		return nil, tmp.Error
+	}
+	appliedAt := map[int]time.Time{}
+	for _, entry := range applied {
+		appliedAt[entry.Version] = entry.AppliedAt
+	}
+
+	result := []SchemaMigrationStatus{}
+	for _, migration := range sqlSchemaMigrations {
+		status := SchemaMigrationStatus{
+			Version: migration.version, Description: migration.description,
+		}
+		if ts, ok := appliedAt[migration.version]; ok {
+			status.AppliedAt = &ts
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+/*
+MigrateTo apply or undo migrations until the DB is at the target schema version
+
+Each migration step is applied in its own transaction.
+
+	@param ctxt context.Context - query context
+	@param targetVersion int - target schema version
+*/
+func (m *sqlSchemaMigrator) MigrateTo(ctxt context.Context, targetVersion int) error {
+	logtags := m.GetLogTagsForContext(ctxt)
+
+	if targetVersion < 0 || targetVersion > LatestSQLSchemaVersion() {
+		return fmt.Errorf(
+			"target schema version %d not within [0, %d]", targetVersion, LatestSQLSchemaVersion(),
+		)
+	}
+
+	currentVersion, err := m.SchemaVersion(ctxt)
+	if err != nil {
+		return err
+	}
+	if currentVersion > LatestSQLSchemaVersion() {
+		return fmt.Errorf(
+			"DB schema version %d is newer than supported version %d",
+			currentVersion,
+			LatestSQLSchemaVersion(),
+		)
+	}
+
+	// Apply migrations
+	for _, migration := range sqlSchemaMigrations {
+		if migration.version <= currentVersion || migration.version > targetVersion {
+			continue
+		}
+		log.
+			WithFields(logtags).
+			Infof("Applying schema migration %d: %s", migration.version, migration.description)
+		if err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&sqlSchemaMigrationEntry{
+				Version:     migration.version,
+				Description: migration.description,
+				AppliedAt:   time.Now().UTC(),
+			}).Error
+		}); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Schema migration %d failed", migration.version)
+			return err
+		}
+	}
+
+	// Undo migrations
+	for idx := len(sqlSchemaMigrations) - 1; idx >= 0; idx-- {
+		migration := sqlSchemaMigrations[idx]
+		if migration.version > currentVersion || migration.version <= targetVersion {
+			continue
+		}
+		log.
+			WithFields(logtags).
+			Infof("Undoing schema migration %d: %s", migration.version, migration.description)
+		if err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.down(tx); err != nil {
+				return err
+			}
+			return tx.
+				Where(&sqlSchemaMigrationEntry{Version: migration.version}).
+				Delete(&sqlSchemaMigrationEntry{}).
+				Error
+		}); err != nil {
+			log.
+				WithError(err).
+				WithFields(logtags).
+				Errorf("Undoing schema migration %d failed", migration.version)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/logger"
+)
+
+func TestSQLSchemaMigration(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	utContext := context.Background()
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	uut, err := GetSQLSchemaMigrator(GetSqliteDialector(testDB), logger.Info)
+	assert.Nil(err)
+
+	// Case 0: new DB has no migrations applied
+	{
+		version, err := uut.SchemaVersion(utContext)
+		assert.Nil(err)
+		assert.Equal(0, version)
+		status, err := uut.MigrationStatus(utContext)
+		assert.Nil(err)
+		assert.Len(status, len(sqlSchemaMigrations))
+		for _, oneStatus := range status {
+			assert.Nil(oneStatus.AppliedAt)
+		}
+	}
+
+	// Case 1: invalid target version
+	assert.NotNil(uut.MigrateTo(utContext, LatestSQLSchemaVersion()+1))
+	assert.NotNil(uut.MigrateTo(utContext, -1))
+
+	// Case 2: migrate to latest
+	assert.Nil(uut.MigrateTo(utContext, LatestSQLSchemaVersion()))
+	{
+		version, err := uut.SchemaVersion(utContext)
+		assert.Nil(err)
+		assert.Equal(LatestSQLSchemaVersion(), version)
+		status, err := uut.MigrationStatus(utContext)
+		assert.Nil(err)
+		for _, oneStatus := range status {
+			assert.NotNil(oneStatus.AppliedAt)
+		}
+	}
+
+	// Case 3: user manager works against the migrated DB
+	{
+		userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+		assert.Nil(err)
+		user, err := userManager.RecordNewUser(utContext, uuid.NewString())
+		assert.Nil(err)
+		chatManager, err := user.ChatSessionManager(utContext)
+		assert.Nil(err)
+		_, err = chatManager.NewSession(utContext, "turbo")
+		assert.Nil(err)
+	}
+
+	// Case 4: undo all migrations
+	assert.Nil(uut.MigrateTo(utContext, 0))
+	{
+		version, err := uut.SchemaVersion(utContext)
+		assert.Nil(err)
+		assert.Equal(0, version)
+	}
+
+	// Case 5: user manager initializes a DB without any migrations applied
+	{
+		userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+		assert.Nil(err)
+		allUsers, err := userManager.ListUsers(utContext)
+		assert.Nil(err)
+		assert.Len(allUsers, 0)
+		version, err := uut.SchemaVersion(utContext)
+		assert.Nil(err)
+		assert.Equal(LatestSQLSchemaVersion(), version)
+	}
+
+	// Case 6: user manager does not upgrade a DB downgraded on purpose
+	assert.Nil(uut.MigrateTo(utContext, LatestSQLSchemaVersion()-1))
+	{
+		_, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+		assert.ErrorIs(err, ErrSQLSchemaOutdated)
+		version, err := uut.SchemaVersion(utContext)
+		assert.Nil(err)
+		assert.Equal(LatestSQLSchemaVersion()-1, version)
+	}
+
+	// Case 7: user manager does not upgrade a DB created before schema versioning
+	{
+		legacyDB := fmt.Sprintf("/tmp/%s-legacy.db", testInstance)
+		db, err := openSQLDB(GetSqliteDialector(legacyDB), logger.Info)
+		assert.Nil(err)
+		// The initial schema matches the tables previously created by GORM AutoMigrate
+		assert.Nil(sqlSchemaMigrations[0].up(db))
+		_, err = GetSQLUserManager(GetSqliteDialector(legacyDB), logger.Info, nil)
+		assert.ErrorIs(err, ErrSQLSchemaOutdated)
+		legacy, err := GetSQLSchemaMigrator(GetSqliteDialector(legacyDB), logger.Info)
+		assert.Nil(err)
+		version, err := legacy.SchemaVersion(utContext)
+		assert.Nil(err)
+		assert.Equal(0, version)
+		assert.Nil(legacy.MigrateTo(utContext, LatestSQLSchemaVersion()))
+		_, err = GetSQLUserManager(GetSqliteDialector(legacyDB), logger.Info, nil)
+		assert.Nil(err)
+	}
+}
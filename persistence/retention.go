@@ -0,0 +1,150 @@
+package persistence
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+/*
+RetentionPolicy limits how much chat history is kept for a user
+
+A limit of zero is not enforced. Chat sessions in the trash count against the limits.
+
+The max age applies to each exchange: a chat session last used longer ago than the max age is
+pruned as a whole, while the exchanges older than the max age are pruned from a chat session
+which is still in use.
+*/
+type RetentionPolicy struct {
+	// MaxAge prune chat exchanges whose request was made longer ago than this
+	MaxAge time.Duration `json:"max_age,omitempty" yaml:"max_age,omitempty"`
+	// MaxSessions prune the least recently used chat sessions beyond this many
+	MaxSessions int `json:"max_sessions,omitempty" yaml:"max_sessions,omitempty"`
+	// MaxDBSize prune the least recently used chat sessions while the DB is larger than this
+	// many bytes
+	MaxDBSize int64 `json:"max_db_size,omitempty" yaml:"max_db_size,omitempty"`
+}
+
+/*
+Validate verify the retention policy is usable
+
+	@return nil if valid
+*/
+func (p RetentionPolicy) Validate() error {
+	if p.MaxAge < 0 {
+		return fmt.Errorf("retention max age can not be negative")
+	}
+	if p.MaxSessions < 0 {
+		return fmt.Errorf("retention max session count can not be negative")
+	}
+	if p.MaxDBSize < 0 {
+		return fmt.Errorf("retention max DB size can not be negative")
+	}
+	return nil
+}
+
+/*
+IsEnforced whether the retention policy sets any limit
+
+	@return whether any limit is set
+*/
+func (p RetentionPolicy) IsEnforced() bool {
+	return p.MaxAge > 0 || p.MaxSessions > 0 || p.MaxDBSize > 0
+}
+
+// RetentionLimit the retention limit which caused a chat session to be pruned
+type RetentionLimit string
+
+const (
+	// RetentionMaxAge chat session, or some of its exchanges, was last used too long ago
+	RetentionMaxAge RetentionLimit = "max-age"
+	// RetentionMaxSessions user has too many chat sessions
+	RetentionMaxSessions RetentionLimit = "max-sessions"
+	// RetentionMaxDBSize DB is too large
+	RetentionMaxDBSize RetentionLimit = "max-db-size"
+)
+
+// ChatSessionPruneCandidate a chat session which exceeds the user's retention policy
+type ChatSessionPruneCandidate struct {
+	// SessionID chat session ID
+	SessionID string `json:"id" yaml:"id"`
+	// LastActivity when the chat session was last used
+	LastActivity time.Time `json:"last_activity" yaml:"last_activity"`
+	// Size approximate number of bytes of text stored for the chat session
+	Size int64 `json:"size" yaml:"size"`
+	// Reason the retention limit the chat session exceeds
+	Reason RetentionLimit `json:"reason" yaml:"reason"`
+	// Trashed whether the chat session is in the trash
+	Trashed bool `json:"trashed,omitempty" yaml:"trashed,omitempty"`
+	// ExchangeIDs if set, only these exchanges are pruned, and the chat session is kept
+	ExchangeIDs []string `json:"exchange_ids,omitempty" yaml:"exchange_ids,omitempty"`
+	// expired exchanges of the chat session older than the retention max age
+	expired []expiredChatExchange
+}
+
+// expiredChatExchange a chat exchange older than the retention max age
+type expiredChatExchange struct {
+	// ID chat exchange ID
+	ID string
+	// Size approximate number of bytes of text stored for the chat exchange
+	Size int64
+}
+
+/*
+selectSessionsToPrune helper function to pick the chat sessions which exceed a retention policy
+
+Sessions are pruned least recently used first. When enforcing the DB size limit, the DB is
+assumed to shrink by the size of each pruned session. A session which is kept, but has
+exchanges older than the max age, is returned with only those exchanges to prune.
+
+	@param sessions []ChatSessionPruneCandidate - all chat sessions of the user, without a reason.
+	    When enforcing the max age, each lists its exchanges older than the max age.
+	@param policy RetentionPolicy - the retention policy
+	@param dbSize int64 - current DB size in bytes. The DB size limit is not enforced if zero.
+	@param currentTime time.Time - the current time
+	@return the chat sessions to prune, least recently used first
+*/
+func selectSessionsToPrune(
+	sessions []ChatSessionPruneCandidate,
+	policy RetentionPolicy,
+	dbSize int64,
+	currentTime time.Time,
+) []ChatSessionPruneCandidate {
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].LastActivity.Equal(sessions[j].LastActivity) {
+			return sessions[i].SessionID < sessions[j].SessionID
+		}
+		return sessions[i].LastActivity.Before(sessions[j].LastActivity)
+	})
+
+	remaining := len(sessions)
+	excessSize := dbSize - policy.MaxDBSize
+	result := []ChatSessionPruneCandidate{}
+	for _, oneSession := range sessions {
+		switch {
+		case policy.MaxAge > 0 && oneSession.LastActivity.Before(currentTime.Add(-policy.MaxAge)):
+			oneSession.Reason = RetentionMaxAge
+		case policy.MaxSessions > 0 && remaining > policy.MaxSessions:
+			oneSession.Reason = RetentionMaxSessions
+		case policy.MaxDBSize > 0 && dbSize > 0 && excessSize > 0:
+			oneSession.Reason = RetentionMaxDBSize
+		case len(oneSession.expired) > 0:
+			// The session is still in use, so only its old exchanges are pruned
+			oneSession.Reason = RetentionMaxAge
+			oneSession.Size = 0
+			for _, oneExchange := range oneSession.expired {
+				oneSession.ExchangeIDs = append(oneSession.ExchangeIDs, oneExchange.ID)
+				oneSession.Size += oneExchange.Size
+			}
+			excessSize -= oneSession.Size
+			result = append(result, oneSession)
+			continue
+		default:
+			continue
+		}
+		remaining--
+		excessSize -= oneSession.Size
+		result = append(result, oneSession)
+	}
+	return result
+}
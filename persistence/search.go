@@ -0,0 +1,371 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/apex/log"
+	"gorm.io/gorm"
+)
+
+// DefaultSearchResultLimit default max number of search results
+const DefaultSearchResultLimit = 20
+
+// searchSnippetTokens approximate number of words in a search result snippet
+const searchSnippetTokens = 16
+
+/*
+ChatExchangeSearchQuery parameters for searching through recorded chat exchanges
+*/
+type ChatExchangeSearchQuery struct {
+	// Terms search terms. An exchange matches if it contains all the terms.
+	Terms string
+	// SessionID only search this chat session
+	SessionID *string
+	// Since only search exchanges requested at or after this time
+	Since *time.Time
+	// Model only search chat sessions using this model
+	Model *string
+	// Limit max number of results. DefaultSearchResultLimit is used if not positive.
+	Limit int
+	// HighlightStart marker placed before each matched term in the snippets
+	HighlightStart string
+	// HighlightEnd marker placed after each matched term in the snippets
+	HighlightEnd string
+}
+
+/*
+ChatExchangeSearchResult one chat exchange matching a search
+*/
+type ChatExchangeSearchResult struct {
+	// SessionID the chat session the exchange belongs to
+	SessionID string `yaml:"session_id" json:"session_id"`
+	// RequestTimestamp when the request was made
+	RequestTimestamp time.Time `yaml:"request_ts" json:"request_ts"`
+	// RequestSnippet request text around the matched terms
+	RequestSnippet string `yaml:"request" json:"request"`
+	// ResponseSnippet response text around the matched terms
+	ResponseSnippet string `yaml:"response" json:"response"`
+}
+
+/*
+searchTerms split the search string into individual terms
+
+	@param terms string - the search string
+	@return the individual terms
+*/
+func searchTerms(terms string) []string {
+	return strings.FieldsFunc(terms, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"'
+	})
+}
+
+/*
+ftsMatchExpression convert search terms into a FTS5 MATCH expression
+
+Each term is quoted, so the terms are matched literally, and all terms must be present.
+
+	@param terms []string - search terms
+	@return MATCH expression
+*/
+func ftsMatchExpression(terms []string) string {
+	quoted := []string{}
+	for _, term := range terms {
+		quoted = append(quoted, fmt.Sprintf("\"%s\"", term))
+	}
+	return strings.Join(quoted, " ")
+}
+
+/*
+highlightSnippet build a snippet of text around the first matched term, with all matched terms
+surrounded by highlight markers. Terms are matched case-insensitively.
+
+	@param text string - the text
+	@param terms []string - search terms
+	@param start string - marker placed before each matched term
+	@param end string - marker placed after each matched term
+	@param maxWords int - approximate number of words in the snippet
+	@return the snippet
+*/
+func highlightSnippet(text string, terms []string, start, end string, maxWords int) string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return ""
+	}
+
+	matches := func(word string) bool {
+		lowered := strings.ToLower(word)
+		for _, term := range terms {
+			if strings.Contains(lowered, strings.ToLower(term)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Center the snippet on the first match
+	first := -1
+	for idx, word := range words {
+		if matches(word) {
+			first = idx
+			break
+		}
+	}
+	begin := 0
+	if first > maxWords/2 {
+		begin = first - maxWords/2
+	}
+	finish := begin + maxWords
+	if finish > len(words) {
+		finish = len(words)
+	}
+
+	builder := strings.Builder{}
+	if begin > 0 {
+		builder.WriteString("...")
+	}
+	for idx := begin; idx < finish; idx++ {
+		if idx > begin {
+			builder.WriteString(" ")
+		}
+		if matches(words[idx]) {
+			builder.WriteString(start + words[idx] + end)
+		} else {
+			builder.WriteString(words[idx])
+		}
+	}
+	if finish < len(words) {
+		builder.WriteString("...")
+	}
+	return builder.String()
+}
+
+// ============================================================================================
+// SQL full-text search index
+
+// chatExchangeSearchTable FTS5 table indexing the chat exchanges
+const chatExchangeSearchTable = "chat_exchange_search"
+
+/*
+sqlFullTextSearchAvailable check whether the SQLite library supports FTS5
+
+FTS5 is only included in go-sqlite3 when built with the "sqlite_fts5" tag.
+
+	@param tx *gorm.DB - DB transaction
+	@return whether FTS5 is supported
+*/
+func sqlFullTextSearchAvailable(tx *gorm.DB) (bool, error) {
+	var enabled int
+	if tmp := tx.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); tmp.Error != nil {
+		return false, tmp.Error
+	}
+	return enabled == 1, nil
+}
+
+// chatExchangeStaleSearchTable SQL table marking the full-text search index as out of date
+const chatExchangeStaleSearchTable = "chat_exchange_search_stale"
+
+// sqlSearchIndexState how the full-text search index over the chat exchanges is maintained
+type sqlSearchIndexState int
+
+const (
+	// sqlSearchIndexAbsent the DB has no search index
+	sqlSearchIndexAbsent sqlSearchIndexState = iota
+	// sqlSearchIndexMaintained the search index is updated whenever exchanges change
+	sqlSearchIndexMaintained
+	// sqlSearchIndexUnmaintained the DB has a search index, but this build lacks FTS5 to
+	// update it. Changes to the exchanges mark the index as out of date instead.
+	sqlSearchIndexUnmaintained
+)
+
+/*
+prepareSQLSearchIndex prepare the full-text search index over the chat exchanges
+
+The index is maintained by the application rather than by triggers, so builds without FTS5 can
+still record exchanges. Builds with FTS5 create the index if it does not exist, and rebuild it
+if a build without FTS5 changed the exchanges since.
+
+	@param db *gorm.DB - DB connection
+	@return how the search index is maintained
+*/
+func prepareSQLSearchIndex(db *gorm.DB) (sqlSearchIndexState, error) {
+	available, err := sqlFullTextSearchAvailable(db)
+	if err != nil {
+		return sqlSearchIndexAbsent, err
+	}
+	exists := db.Migrator().HasTable(chatExchangeSearchTable)
+	if !available {
+		if exists {
+			return sqlSearchIndexUnmaintained, nil
+		}
+		return sqlSearchIndexAbsent, nil
+	}
+
+	var stale int64
+	if tmp := db.Table(chatExchangeStaleSearchTable).Count(&stale); tmp.Error != nil {
+		return sqlSearchIndexAbsent, tmp.Error
+	}
+	if !exists || stale > 0 {
+		if err := db.Transaction(execSQLStatements(
+			"CREATE VIRTUAL TABLE IF NOT EXISTS `chat_exchange_search` "+
+				"USING fts5(exchange_id UNINDEXED, request, response)",
+			"DELETE FROM `chat_exchange_search`",
+			"INSERT INTO `chat_exchange_search` (exchange_id, request, response) "+
+				"SELECT id, request, response FROM `chat_session_exchanges`",
+			"DELETE FROM `chat_exchange_search_stale`",
+		)); err != nil {
+			return sqlSearchIndexAbsent, err
+		}
+	}
+	return sqlSearchIndexMaintained, nil
+}
+
+/*
+updateSearchIndex helper function to update the full-text search index entries of exchanges
+which were recorded, changed, or deleted
+
+	@param tx *gorm.DB - DB transaction
+	@param exchangeIDs []string - IDs of the changed exchanges
+*/
+func (c *sqlChatPersistence) updateSearchIndex(tx *gorm.DB, exchangeIDs []string) error {
+	if len(exchangeIDs) == 0 {
+		return nil
+	}
+	switch c.searchIndex {
+	case sqlSearchIndexMaintained:
+		if tmp := tx.Exec(
+			"DELETE FROM `chat_exchange_search` WHERE exchange_id IN ?", exchangeIDs,
+		); tmp.Error != nil {
+			return tmp.Error
+		}
+		return tx.Exec(
+			"INSERT INTO `chat_exchange_search` (exchange_id, request, response) "+
+				"SELECT id, request, response FROM `chat_session_exchanges` WHERE id IN ?",
+			exchangeIDs,
+		).Error
+	case sqlSearchIndexUnmaintained:
+		return tx.Exec("INSERT OR IGNORE INTO `chat_exchange_search_stale` (id) VALUES (1)").Error
+	}
+	return nil
+}
+
+/*
+likePattern convert a search term into a LIKE pattern matching the term literally anywhere in
+the text. "\" is the escape character.
+
+	@param term string - search term
+	@return LIKE pattern
+*/
+func likePattern(term string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+	return "%" + escaped + "%"
+}
+
+/*
+SearchExchanges search through the exchanges of all chat sessions of the associated user
+
+Uses the FTS5 full-text search index when supported, and falls back to substring matching
+otherwise.
+
+	@param ctxt context.Context - query context
+	@param query ChatExchangeSearchQuery - search parameters
+	@return matching exchanges, best matches first
+*/
+func (c *sqlChatPersistence) SearchExchanges(
+	ctxt context.Context, query ChatExchangeSearchQuery,
+) ([]ChatExchangeSearchResult, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	result := []ChatExchangeSearchResult{}
+
+	terms := searchTerms(query.Terms)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("no search terms given")
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultSearchResultLimit
+	}
+
+	userID, err := c.user.GetID(ctxt)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Unable to get associated user ID")
+		return nil, err
+	}
+
+	useFTS := c.searchIndex == sqlSearchIndexMaintained
+	type matchedEntry struct {
+		SessionID        string
+		RequestTimestamp time.Time
+		Request          string
+		Response         string
+	}
+	var entries []matchedEntry
+
+	// The search is a single read, so it runs outside a transaction, which would take the
+	// write lock
+	var stmt *gorm.DB
+	if useFTS {
+		stmt = c.db.
+			Table(chatExchangeSearchTable+" AS s").
+			Select(
+				"e.session_id, e.request_timestamp, "+
+					"snippet(chat_exchange_search, 1, ?, ?, '...', ?) AS request, "+
+					"snippet(chat_exchange_search, 2, ?, ?, '...', ?) AS response",
+				query.HighlightStart, query.HighlightEnd, searchSnippetTokens,
+				query.HighlightStart, query.HighlightEnd, searchSnippetTokens,
+			).
+			Joins("JOIN chat_session_exchanges AS e ON e.id = s.exchange_id").
+			Where("chat_exchange_search MATCH ?", ftsMatchExpression(terms)).
+			Order("rank")
+	} else {
+		stmt = c.db.
+			Table("chat_session_exchanges AS e").
+			Select("e.session_id, e.request_timestamp, e.request, e.response").
+			Order("e.request_timestamp desc")
+		for _, term := range terms {
+			pattern := likePattern(term)
+			stmt = stmt.Where(
+				`(e.request LIKE ? ESCAPE '\' OR e.response LIKE ? ESCAPE '\')`, pattern, pattern,
+			)
+		}
+	}
+	stmt = stmt.
+		Joins("JOIN chat_sessions AS c ON c.id = e.session_id").
+		Where("c.user_id = ? AND c.deleted_at IS NULL", userID)
+	if query.SessionID != nil {
+		stmt = stmt.Where("e.session_id = ?", *query.SessionID)
+	}
+	if query.Since != nil {
+		stmt = stmt.Where("datetime(e.request_timestamp) >= datetime(?)", query.Since.UTC())
+	}
+	if query.Model != nil {
+		stmt = stmt.Where("json_extract(c.common_settings, '$.model') = ?", *query.Model)
+	}
+
+	if tmp := stmt.Limit(limit).Scan(&entries); tmp.Error != nil {
+		log.WithError(tmp.Error).WithFields(logtags).Error("Chat exchange search failed")
+		return nil, tmp.Error
+	}
+
+	for _, entry := range entries {
+		oneResult := ChatExchangeSearchResult{
+			SessionID:        entry.SessionID,
+			RequestTimestamp: entry.RequestTimestamp,
+			RequestSnippet:   entry.Request,
+			ResponseSnippet:  entry.Response,
+		}
+		if !useFTS {
+			oneResult.RequestSnippet = highlightSnippet(
+				entry.Request, terms, query.HighlightStart, query.HighlightEnd, searchSnippetTokens,
+			)
+			oneResult.ResponseSnippet = highlightSnippet(
+				entry.Response, terms, query.HighlightStart, query.HighlightEnd, searchSnippetTokens,
+			)
+		}
+		result = append(result, oneResult)
+	}
+	return result, nil
+}
@@ -0,0 +1,407 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/logger"
+)
+
+func TestHighlightSnippet(t *testing.T) {
+	assert := assert.New(t)
+
+	type testCase struct {
+		text     string
+		terms    []string
+		maxWords int
+		expected string
+	}
+	testCases := []testCase{
+		{text: "", terms: []string{"a"}, maxWords: 4, expected: ""},
+		{
+			text:     "the quick brown fox",
+			terms:    []string{"Quick"},
+			maxWords: 8,
+			expected: "the [quick] brown fox",
+		},
+		{
+			text:     "one two three four five six seven eight nine",
+			terms:    []string{"six"},
+			maxWords: 4,
+			expected: "...four five [six] seven...",
+		},
+		{
+			text:     "one two three four",
+			terms:    []string{"missing"},
+			maxWords: 2,
+			expected: "one two...",
+		},
+	}
+
+	for idx, oneTest := range testCases {
+		assert.Equalf(
+			oneTest.expected,
+			highlightSnippet(oneTest.text, oneTest.terms, "[", "]", oneTest.maxWords),
+			"test case %d",
+			idx,
+		)
+	}
+}
+
+func TestSQLChatExchangeSearch(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testChatExchangeSearch(t, userManager)
+}
+
+func TestMemoryChatExchangeSearch(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	userManager, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testChatExchangeSearch(t, userManager)
+}
+
+// testChatExchangeSearch test suite for ChatSessionManager.SearchExchanges
+func testChatExchangeSearch(t *testing.T, userManager UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	user1, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager0, err := user0.ChatSessionManager(utContext)
+	assert.Nil(err)
+	chatManager1, err := user1.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	session0, err := chatManager0.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	session0ID, err := session0.SessionID(utContext)
+	assert.Nil(err)
+	session1, err := chatManager0.NewSession(utContext, "davinci")
+	assert.Nil(err)
+	session1ID, err := session1.SessionID(utContext)
+	assert.Nil(err)
+	session2, err := chatManager1.NewSession(utContext, "turbo")
+	assert.Nil(err)
+
+	currentTime := time.Now().UTC()
+	recordExchange := func(session ChatSession, offset time.Duration, request, response string) {
+		assert.Nil(session.RecordOneExchange(utContext, ChatExchange{
+			RequestTimestamp:  currentTime.Add(offset),
+			Request:           request,
+			ResponseTimestamp: currentTime.Add(offset + time.Second),
+			Response:          response,
+		}))
+	}
+	recordExchange(session0, -time.Hour*48, "How do I sort a slice in golang", "Use the sort package")
+	recordExchange(session0, -time.Hour, "What is a goroutine", "A lightweight thread in golang")
+	recordExchange(session1, 0, "Write a haiku", "Autumn moonlight, a worm digs silently")
+	recordExchange(session2, 0, "golang channels", "Channels connect goroutines")
+
+	sessionsOf := func(results []ChatExchangeSearchResult) map[string]int {
+		found := map[string]int{}
+		for _, oneResult := range results {
+			found[oneResult.SessionID]++
+		}
+		return found
+	}
+
+	// Case 0: no search terms
+	{
+		_, err := chatManager0.SearchExchanges(utContext, ChatExchangeSearchQuery{Terms: "  "})
+		assert.NotNil(err)
+	}
+
+	// Case 1: match only the user's exchanges
+	{
+		results, err := chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "golang", HighlightStart: "<", HighlightEnd: ">"},
+		)
+		assert.Nil(err)
+		assert.Len(results, 2)
+		assert.Equal(map[string]int{session0ID: 2}, sessionsOf(results))
+		for _, oneResult := range results {
+			assert.Contains(oneResult.RequestSnippet+oneResult.ResponseSnippet, "<golang>")
+		}
+	}
+
+	// Case 2: all terms must match
+	{
+		results, err := chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "golang goroutine"},
+		)
+		assert.Nil(err)
+		assert.Len(results, 1)
+		assert.Contains(results[0].RequestSnippet, "goroutine")
+	}
+
+	// Case 3: filter by time
+	{
+		since := currentTime.Add(-time.Hour * 2)
+		results, err := chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "golang", Since: &since},
+		)
+		assert.Nil(err)
+		assert.Len(results, 1)
+	}
+
+	// Case 4: filter by session and model
+	{
+		results, err := chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "golang", SessionID: &session1ID},
+		)
+		assert.Nil(err)
+		assert.Len(results, 0)
+		model := "davinci"
+		results, err = chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "moonlight", Model: &model},
+		)
+		assert.Nil(err)
+		assert.Equal(map[string]int{session1ID: 1}, sessionsOf(results))
+		model = "turbo"
+		results, err = chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "moonlight", Model: &model},
+		)
+		assert.Nil(err)
+		assert.Len(results, 0)
+	}
+
+	// Case 5: limit the results
+	{
+		results, err := chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "golang", Limit: 1},
+		)
+		assert.Nil(err)
+		assert.Len(results, 1)
+	}
+
+	// Case 6: search terms are matched literally
+	{
+		results, err := chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "\"haiku OR NOT*"},
+		)
+		assert.Nil(err)
+		assert.Len(results, 0)
+	}
+
+	// Case 7: deleted exchanges are no longer found
+	assert.Nil(session0.DeleteLatestExchange(utContext))
+	{
+		results, err := chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "goroutine"},
+		)
+		assert.Nil(err)
+		assert.Len(results, 0)
+	}
+	assert.Nil(chatManager0.DeleteSession(utContext, session1ID))
+	{
+		results, err := chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "haiku"},
+		)
+		assert.Nil(err)
+		assert.Len(results, 0)
+	}
+
+	// Case 8: "%" and "_" are matched literally
+	recordExchange(session0, 0, "Is 100% of the quota used", "Yes, read it from max_tokens")
+	recordExchange(session0, time.Second*2, "Is 1000 enough", "Raise maxitokens")
+	{
+		results, err := chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "100%"},
+		)
+		assert.Nil(err)
+		assert.Len(results, 1)
+		results, err = chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "max_tokens"},
+		)
+		assert.Nil(err)
+		assert.Len(results, 1)
+	}
+
+	// Case 9: edited exchanges are found by their new text
+	{
+		exchanges, err := session0.Exchanges(utContext)
+		assert.Nil(err)
+		newRequest := "How do I sort a slice in rust"
+		assert.Nil(session0.EditExchange(
+			utContext, exchanges[0].ID, ChatExchangeEdit{Request: &newRequest, Reason: "typo"},
+		))
+		results, err := chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "rust"},
+		)
+		assert.Nil(err)
+		assert.Len(results, 1)
+		results, err = chatManager0.SearchExchanges(
+			utContext, ChatExchangeSearchQuery{Terms: "slice golang"},
+		)
+		assert.Nil(err)
+		assert.Len(results, 0)
+	}
+}
+
+func TestSQLSearchIndexTriggersDropped(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	utContext := context.Background()
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	migrator, err := GetSQLSchemaMigrator(GetSqliteDialector(testDB), logger.Info)
+	assert.Nil(err)
+	assert.Nil(migrator.MigrateTo(utContext, 13))
+
+	// Builds supporting FTS5 used to define triggers which write to the search index, which a
+	// build without FTS5 can not do
+	assert.Nil(migrator.(*sqlSchemaMigrator).db.Exec(
+		"CREATE TRIGGER `chat_exchange_search_insert` AFTER INSERT ON `chat_session_exchanges` " +
+			"BEGIN INSERT INTO `chat_exchange_search_missing` (exchange_id) VALUES (new.id); END",
+	).Error)
+
+	assert.Nil(migrator.MigrateTo(utContext, LatestSQLSchemaVersion()))
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+	user, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user.ChatSessionManager(utContext)
+	assert.Nil(err)
+	session, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	currentTime := time.Now()
+	assert.Nil(session.RecordOneExchange(utContext, ChatExchange{
+		RequestTimestamp:  currentTime,
+		Request:           "req-0",
+		ResponseTimestamp: currentTime.Add(time.Second),
+		Response:          "resp-0",
+	}))
+}
+
+func TestSQLSearchIndexMaintenance(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	utContext := context.Background()
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	userManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+	driver := userManager.(*sqlUserPersistence)
+	if driver.searchIndex != sqlSearchIndexMaintained {
+		t.Skip("FTS5 is not supported by this build")
+	}
+
+	// Count the index entries matching a term, without searching through the chat manager
+	indexed := func(term string) int64 {
+		var count int64
+		assert.Nil(driver.db.
+			Table(chatExchangeSearchTable).
+			Where("chat_exchange_search MATCH ?", ftsMatchExpression([]string{term})).
+			Count(&count).Error)
+		return count
+	}
+
+	user, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user.ChatSessionManager(utContext)
+	assert.Nil(err)
+	session, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	currentTime := time.Now()
+	recordExchange := func(offset time.Duration, request, response string) {
+		assert.Nil(session.RecordOneExchange(utContext, ChatExchange{
+			RequestTimestamp:  currentTime.Add(offset),
+			Request:           request,
+			ResponseTimestamp: currentTime.Add(offset + time.Second),
+			Response:          response,
+		}))
+	}
+
+	// Case 0: recorded exchanges are indexed
+	recordExchange(0, "my token is hunter2", "noted")
+	recordExchange(time.Second*2, "what is a monad", "a monoid")
+	assert.Equal(int64(1), indexed("hunter2"))
+	assert.Equal(int64(1), indexed("monad"))
+
+	// Case 1: edited text is removed from the index
+	exchanges, err := session.Exchanges(utContext)
+	assert.Nil(err)
+	scrubbed := "my token is [removed]"
+	assert.Nil(session.EditExchange(
+		utContext, exchanges[0].ID, ChatExchangeEdit{Request: &scrubbed, Reason: "secret"},
+	))
+	assert.Equal(int64(0), indexed("hunter2"))
+	assert.Equal(int64(1), indexed("removed"))
+
+	// Case 2: replaced and regenerated responses are indexed
+	assert.Nil(session.ReplaceLatestExchange(utContext, ChatExchange{
+		RequestTimestamp:  currentTime.Add(time.Second * 2),
+		Request:           "what is a functor",
+		ResponseTimestamp: currentTime.Add(time.Second * 3),
+		Response:          "a mapping",
+	}))
+	assert.Equal(int64(0), indexed("monad"))
+	assert.Equal(int64(1), indexed("functor"))
+	assert.Nil(session.RecordLatestExchangeVariant(utContext, ChatExchangeVariant{
+		ResponseTimestamp: currentTime.Add(time.Second * 4), Response: "a structure preserving map",
+	}))
+	assert.Equal(int64(0), indexed("mapping"))
+	assert.Equal(int64(1), indexed("structure"))
+	assert.Nil(session.SelectLatestExchangeVariant(utContext, 0))
+	assert.Equal(int64(1), indexed("mapping"))
+	assert.Equal(int64(0), indexed("structure"))
+
+	// Case 3: forked exchanges are indexed, and purged sessions are removed from the index
+	forked, err := chatManager.ForkSession(utContext, session.(*sqlChatSessionHandle).ID, -1)
+	assert.Nil(err)
+	assert.Equal(int64(2), indexed("functor"))
+	forkedID, err := forked.SessionID(utContext)
+	assert.Nil(err)
+	assert.Nil(chatManager.PurgeSessions(utContext, []string{forkedID}))
+	assert.Equal(int64(1), indexed("functor"))
+
+	// Case 4: deleted exchanges are removed from the index
+	assert.Nil(session.DeleteLatestExchange(utContext))
+	assert.Equal(int64(0), indexed("functor"))
+
+	// Case 5: changes made without FTS5 mark the index out of date, and it is rebuilt when
+	// the DB is next opened with FTS5
+	chatManager.(*sqlChatPersistence).searchIndex = sqlSearchIndexUnmaintained
+	recordExchange(time.Second*10, "what is a lens", "a getter and setter")
+	assert.Equal(int64(0), indexed("lens"))
+	{
+		var stale int64
+		assert.Nil(driver.db.Table(chatExchangeStaleSearchTable).Count(&stale).Error)
+		assert.Equal(int64(1), stale)
+	}
+	_, err = GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+	assert.Equal(int64(1), indexed("lens"))
+	assert.Equal(int64(1), indexed("removed"))
+	{
+		var stale int64
+		assert.Nil(driver.db.Table(chatExchangeStaleSearchTable).Count(&stale).Error)
+		assert.Equal(int64(0), stale)
+	}
+}
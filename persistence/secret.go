@@ -0,0 +1,318 @@
+package persistence
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+	"gorm.io/gorm/logger"
+)
+
+// encryptedSecretPrefix prefix marking a stored value as an encrypted secret
+const encryptedSecretPrefix = "enc:v1:"
+
+const (
+	secretSaltLen = 16
+	secretKeyLen  = 32
+	// scrypt cost parameters
+	secretScryptN = 1 << 15
+	secretScryptR = 8
+	secretScryptP = 1
+)
+
+/*
+IsEncryptedSecret check whether a stored value is an encrypted secret
+
+	@param value string - the stored value
+	@return whether the value is encrypted
+*/
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+/*
+SecretCipher encrypts and decrypts secrets stored in persistence
+*/
+type SecretCipher interface {
+	/*
+		Encrypt encrypt a secret for storage
+
+			@param plaintext string - the secret
+			@return the encrypted secret
+	*/
+	Encrypt(plaintext string) (string, error)
+
+	/*
+		Decrypt decrypt a stored secret
+
+		Values which were not encrypted are returned as is.
+
+			@param stored string - the stored secret
+			@return the secret
+	*/
+	Decrypt(stored string) (string, error)
+}
+
+/*
+PassphraseSource provides the passphrase used to derive the secret encryption key
+*/
+type PassphraseSource func() (string, error)
+
+// passphraseCipher SecretCipher using AES-GCM with a key derived from a passphrase
+type passphraseCipher struct {
+	source     PassphraseSource
+	lock       sync.Mutex
+	passphrase *string
+}
+
+/*
+DefineSecretCipher define a new secret cipher
+
+Each secret is encrypted with AES-256-GCM, using a key derived with scrypt from the passphrase
+and a random per-secret salt. The passphrase source is only queried when a secret is first
+encrypted or decrypted.
+
+	@param source PassphraseSource - passphrase source
+	@return the secret cipher
+*/
+func DefineSecretCipher(source PassphraseSource) SecretCipher {
+	return &passphraseCipher{source: source}
+}
+
+// getPassphrase fetch the passphrase, querying the source once
+func (c *passphraseCipher) getPassphrase() (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.passphrase != nil {
+		return *c.passphrase, nil
+	}
+	passphrase, err := c.source()
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("secret passphrase can not be empty")
+	}
+	c.passphrase = &passphrase
+	return passphrase, nil
+}
+
+// deriveKey derive the encryption key for a salt
+func (c *passphraseCipher) deriveKey(salt []byte) (cipher.AEAD, error) {
+	passphrase, err := c.getPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	return derivePassphraseKey(passphrase, salt)
+}
+
+// derivePassphraseKey derive the AES-256-GCM encryption key for a passphrase and salt
+func derivePassphraseKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(
+		[]byte(passphrase), salt, secretScryptN, secretScryptR, secretScryptP, secretKeyLen,
+	)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/*
+Encrypt encrypt a secret for storage
+
+	@param plaintext string - the secret
+	@return the encrypted secret
+*/
+func (c *passphraseCipher) Encrypt(plaintext string) (string, error) {
+	salt := make([]byte, secretSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := c.deriveKey(salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload := append(salt, nonce...)
+	payload = aead.Seal(payload, nonce, []byte(plaintext), nil)
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+/*
+Decrypt decrypt a stored secret
+
+Values which were not encrypted are returned as is.
+
+	@param stored string - the stored secret
+	@return the secret
+*/
+func (c *passphraseCipher) Decrypt(stored string) (string, error) {
+	if !IsEncryptedSecret(stored) {
+		return stored, nil
+	}
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted secret: %w", err)
+	}
+	if len(payload) < secretSaltLen {
+		return "", fmt.Errorf("malformed encrypted secret")
+	}
+	aead, err := c.deriveKey(payload[:secretSaltLen])
+	if err != nil {
+		return "", err
+	}
+	payload = payload[secretSaltLen:]
+	if len(payload) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted secret")
+	}
+	plaintext, err := aead.Open(nil, payload[:aead.NonceSize()], payload[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt secret, wrong passphrase?")
+	}
+	return string(plaintext), nil
+}
+
+// ============================================================================================
+// Log redaction
+
+// redactedSecretPatterns patterns of secret values which must never appear in logs
+var redactedSecretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(regexp.QuoteMeta(encryptedSecretPrefix) + `[A-Za-z0-9+/=]+`),
+	// OpenAI API tokens
+	regexp.MustCompile(`sk-[A-Za-z0-9_\-]+`),
+}
+
+/*
+RedactSecrets replace any secret values within a string
+
+	@param text string - the text to redact
+	@return redacted text
+*/
+func RedactSecrets(text string) string {
+	for _, pattern := range redactedSecretPatterns {
+		text = pattern.ReplaceAllString(text, "<redacted>")
+	}
+	return text
+}
+
+// redactedSQLColumns columns holding secrets, whose bound values must never appear in logs
+var redactedSQLColumns = map[string]bool{"api_token": true}
+
+// sqlInsertColumnsPattern matches the column list of an INSERT statement
+var sqlInsertColumnsPattern = regexp.MustCompile("(?is)^\\s*INSERT INTO\\s+\\S+\\s*\\(([^)]*)\\)\\s*VALUES")
+
+// sqlComparedColumnPattern matches the column a placeholder is assigned to or compared with
+var sqlComparedColumnPattern = regexp.MustCompile("`?([A-Za-z0-9_]+)`?\\s*(?:=|!=|<>)\\s*$")
+
+/*
+redactSQLParams replace the values bound to secret columns within a SQL statement
+
+A value is bound to a column if its placeholder is assigned to or compared with the column, or
+is in the column's position within the VALUES of an INSERT statement.
+
+	@param sql string - the SQL statement, with "?" placeholders
+	@param params []interface{} - the values bound to the placeholders
+	@return the values, with those of secret columns redacted
+*/
+func redactSQLParams(sql string, params []interface{}) []interface{} {
+	redacted := make([]interface{}, len(params))
+	copy(redacted, params)
+
+	insertColumns := []string{}
+	valuesStart := -1
+	if match := sqlInsertColumnsPattern.FindStringSubmatchIndex(sql); match != nil {
+		for _, column := range strings.Split(sql[match[2]:match[3]], ",") {
+			insertColumns = append(insertColumns, strings.Trim(strings.TrimSpace(column), "`\""))
+		}
+		valuesStart = match[1]
+	}
+
+	placeholder := 0
+	valuePlaceholder := 0
+	var quote byte
+	for idx := 0; idx < len(sql) && placeholder < len(params); idx++ {
+		char := sql[idx]
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"' || char == '`':
+			quote = char
+		case char == '?':
+			column := ""
+			if valuesStart >= 0 && idx >= valuesStart {
+				column = insertColumns[valuePlaceholder%len(insertColumns)]
+				valuePlaceholder++
+			} else {
+				// Column names are short, so only look at the text just before the placeholder
+				lookBehind := idx - 64
+				if lookBehind < 0 {
+					lookBehind = 0
+				}
+				if match := sqlComparedColumnPattern.FindStringSubmatch(sql[lookBehind:idx]); match != nil {
+					column = match[1]
+				}
+			}
+			if redactedSQLColumns[strings.ToLower(column)] {
+				redacted[placeholder] = "<redacted>"
+			}
+			placeholder++
+		}
+	}
+	return redacted
+}
+
+// redactingSQLLogger GORM logger which redacts secrets from the logged SQL statements. Values
+// bound to secret columns are always redacted, and values which look like secrets are redacted
+// anywhere in the statements.
+type redactingSQLLogger struct {
+	logger.Interface
+}
+
+/*
+defineRedactingSQLLogger define a GORM logger which redacts secrets
+
+	@param logLevel logger.LogLevel - SQL log level
+	@return GORM logger
+*/
+func defineRedactingSQLLogger(logLevel logger.LogLevel) logger.Interface {
+	return &redactingSQLLogger{Interface: logger.Default.LogMode(logLevel)}
+}
+
+// LogMode log mode
+func (l *redactingSQLLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &redactingSQLLogger{Interface: l.Interface.LogMode(level)}
+}
+
+// ParamsFilter redact the values bound to secret columns before the SQL statement is logged
+func (l *redactingSQLLogger) ParamsFilter(
+	ctx context.Context, sql string, params ...interface{},
+) (string, []interface{}) {
+	return sql, redactSQLParams(sql, params)
+}
+
+// Trace print sql message
+func (l *redactingSQLLogger) Trace(
+	ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error,
+) {
+	l.Interface.Trace(ctx, begin, func() (string, int64) {
+		sql, rowsAffected := fc()
+		return RedactSecrets(sql), rowsAffected
+	}, err)
+}
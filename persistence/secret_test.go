@@ -0,0 +1,257 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	stdlog "log"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSecretCipher(t *testing.T) {
+	assert := assert.New(t)
+
+	sourceCalls := 0
+	uut := DefineSecretCipher(func() (string, error) {
+		sourceCalls++
+		return "passphrase-1", nil
+	})
+
+	// Case 0: round trip
+	encrypted, err := uut.Encrypt("sk-hello-world")
+	assert.Nil(err)
+	assert.True(IsEncryptedSecret(encrypted))
+	assert.NotContains(encrypted, "hello-world")
+	plaintext, err := uut.Decrypt(encrypted)
+	assert.Nil(err)
+	assert.Equal("sk-hello-world", plaintext)
+	assert.Equal(1, sourceCalls)
+
+	// Case 1: same secret encrypts differently every time
+	{
+		other, err := uut.Encrypt("sk-hello-world")
+		assert.Nil(err)
+		assert.NotEqual(encrypted, other)
+	}
+
+	// Case 2: values which are not encrypted are returned as is
+	plaintext, err = uut.Decrypt("sk-not-encrypted")
+	assert.Nil(err)
+	assert.Equal("sk-not-encrypted", plaintext)
+
+	// Case 3: wrong passphrase
+	{
+		wrong := DefineSecretCipher(func() (string, error) { return "passphrase-2", nil })
+		_, err := wrong.Decrypt(encrypted)
+		assert.NotNil(err)
+	}
+
+	// Case 4: malformed secret
+	{
+		_, err := uut.Decrypt(encryptedSecretPrefix + "not-base64!")
+		assert.NotNil(err)
+		_, err = uut.Decrypt(encryptedSecretPrefix + "AAAA")
+		assert.NotNil(err)
+	}
+
+	// Case 5: empty passphrase
+	{
+		empty := DefineSecretCipher(func() (string, error) { return "", nil })
+		_, err := empty.Encrypt("sk-hello-world")
+		assert.NotNil(err)
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	assert := assert.New(t)
+
+	redacted := RedactSecrets(
+		"UPDATE `users` SET `api_token`=\"enc:v1:aGVsbG8+d29y/bGQ=\",`name`=\"sk-abc_DEF-123\"",
+	)
+	assert.NotContains(redacted, "aGVsbG8")
+	assert.NotContains(redacted, "abc_DEF")
+	assert.Contains(redacted, "UPDATE `users` SET `api_token`=")
+}
+
+func TestRedactSQLParams(t *testing.T) {
+	assert := assert.New(t)
+
+	type testCase struct {
+		sql      string
+		params   []interface{}
+		expected []interface{}
+	}
+	testCases := []testCase{
+		{
+			sql:      "UPDATE `users` SET `api_token`=?,`api_token_source`=? WHERE `id` = ?",
+			params:   []interface{}{"token", "literal", "id-0"},
+			expected: []interface{}{"<redacted>", "literal", "id-0"},
+		},
+		{
+			sql:      "INSERT INTO `users` (`id`,`name`,`api_token`) VALUES (?,?,?),(?,?,?)",
+			params:   []interface{}{"id-0", "name-0", "token-0", "id-1", "name-1", "token-1"},
+			expected: []interface{}{"id-0", "name-0", "<redacted>", "id-1", "name-1", "<redacted>"},
+		},
+		{
+			sql:      "SELECT * FROM `users` WHERE name = '?' AND api_token != ?",
+			params:   []interface{}{"token"},
+			expected: []interface{}{"<redacted>"},
+		},
+		{
+			sql:      "UPDATE `chat_session_exchanges` SET `request`=? WHERE `id` = ?",
+			params:   []interface{}{"my api_token=abc", "id-0"},
+			expected: []interface{}{"my api_token=abc", "id-0"},
+		},
+	}
+
+	for idx, oneTest := range testCases {
+		assert.Equalf(
+			oneTest.expected, redactSQLParams(oneTest.sql, oneTest.params), "test case %d", idx,
+		)
+	}
+}
+
+func TestSQLLogRedactsAPIToken(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	utContext := context.Background()
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	// Capture the logged SQL statements
+	logged := bytes.Buffer{}
+	sqlLogger := &redactingSQLLogger{
+		Interface: logger.New(stdlog.New(&logged, "", 0), logger.Config{LogLevel: logger.Info}),
+	}
+	defineManager := func(cipher SecretCipher) UserManager {
+		manager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, cipher)
+		assert.Nil(err)
+		driver := manager.(*sqlUserPersistence)
+		driver.db = driver.db.Session(&gorm.Session{Logger: sqlLogger})
+		return manager
+	}
+
+	// Case 0: a token without a known prefix, stored as is
+	{
+		user, err := defineManager(nil).RecordNewUser(utContext, uuid.NewString())
+		assert.Nil(err)
+		assert.Nil(user.SetAPIToken(utContext, "custom-token-0"))
+		assert.Contains(logged.String(), "UPDATE `users` SET `api_token`=")
+		assert.NotContains(logged.String(), "custom-token-0")
+	}
+
+	// Case 1: an encrypted token
+	{
+		cipher := DefineSecretCipher(func() (string, error) { return "passphrase-1", nil })
+		manager := defineManager(cipher)
+		user, err := manager.RecordNewUser(utContext, uuid.NewString())
+		assert.Nil(err)
+		assert.Nil(user.SetAPIToken(utContext, "custom-token-1"))
+		userID, err := user.GetID(utContext)
+		assert.Nil(err)
+		var entry sqlUserEntry
+		assert.Nil(manager.(*sqlUserPersistence).db.Where(&sqlUserEntry{ID: userID}).First(&entry).Error)
+		assert.True(IsEncryptedSecret(entry.APIToken))
+		assert.NotContains(logged.String(), entry.APIToken)
+		assert.NotContains(logged.String(), "custom-token-1")
+	}
+}
+
+func TestSQLUserAPITokenEncryption(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	utContext := context.Background()
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	// Record a token without encryption
+	plainManager, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+	user0, err := plainManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	assert.Nil(user0.SetAPIToken(utContext, "sk-user-0"))
+
+	cipher1 := DefineSecretCipher(func() (string, error) { return "passphrase-1", nil })
+	uut, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, cipher1)
+	assert.Nil(err)
+
+	readStoredToken := func(userID string) string {
+		var entry sqlUserEntry
+		assert.Nil(uut.(*sqlUserPersistence).db.Where(&sqlUserEntry{ID: userID}).First(&entry).Error)
+		return entry.APIToken
+	}
+
+	// Case 0: unencrypted token is still readable
+	user0ID, err := user0.GetID(utContext)
+	assert.Nil(err)
+	{
+		user, err := uut.GetUser(utContext, user0ID)
+		assert.Nil(err)
+		token, err := user.GetAPIToken(utContext)
+		assert.Nil(err)
+		assert.Equal("sk-user-0", token)
+	}
+
+	// Case 1: new token is encrypted at rest
+	user1, err := uut.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	assert.Nil(user1.SetAPIToken(utContext, "sk-user-1"))
+	user1ID, err := user1.GetID(utContext)
+	assert.Nil(err)
+	assert.True(IsEncryptedSecret(readStoredToken(user1ID)))
+	{
+		token, err := user1.GetAPIToken(utContext)
+		assert.Nil(err)
+		assert.Equal("sk-user-1", token)
+	}
+
+	// Case 2: encrypted token can not be read without the passphrase
+	{
+		user, err := plainManager.GetUser(utContext, user1ID)
+		assert.Nil(err)
+		_, err = user.GetAPIToken(utContext)
+		assert.NotNil(err)
+	}
+
+	// Case 3: rekey
+	cipher2 := DefineSecretCipher(func() (string, error) { return "passphrase-2", nil })
+	updated, err := RekeySQLUserSecrets(
+		utContext, GetSqliteDialector(testDB), logger.Info, cipher1, cipher2,
+	)
+	assert.Nil(err)
+	assert.Equal(2, updated)
+	assert.True(IsEncryptedSecret(readStoredToken(user0ID)))
+	{
+		rekeyed, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, cipher2)
+		assert.Nil(err)
+		for userID, expected := range map[string]string{user0ID: "sk-user-0", user1ID: "sk-user-1"} {
+			user, err := rekeyed.GetUser(utContext, userID)
+			assert.Nil(err)
+			token, err := user.GetAPIToken(utContext)
+			assert.Nil(err)
+			assert.Equal(expected, token)
+		}
+	}
+
+	// Case 4: rekey with the wrong passphrase changes nothing
+	{
+		_, err := RekeySQLUserSecrets(
+			utContext, GetSqliteDialector(testDB), logger.Info, cipher1, cipher2,
+		)
+		assert.NotNil(err)
+		user, err := uut.GetUser(utContext, user1ID)
+		assert.Nil(err)
+		_, err = user.GetAPIToken(utContext)
+		assert.NotNil(err)
+	}
+}
@@ -1,6 +1,8 @@
 package persistence
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/alwitt/goutils"
@@ -14,6 +16,10 @@ import (
 type sqlUserPersistence struct {
 	goutils.Component
 	db *gorm.DB
+	// cipher for encrypting secrets at rest. Secrets are stored as is if nil.
+	cipher SecretCipher
+	// searchIndex how the full-text search index is maintained
+	searchIndex sqlSearchIndexState
 }
 
 // SQL persistence layer driver specific to chat session management
@@ -21,41 +27,107 @@ type sqlChatPersistence struct {
 	goutils.Component
 	db   *gorm.DB
 	user User
+	// searchIndex how the full-text search index is maintained
+	searchIndex sqlSearchIndexState
 }
 
+// sqliteBusyTimeoutMS how long to wait for another process to release the DB before failing
+// with "database is locked"
+const sqliteBusyTimeoutMS = 5000
+
 /*
 GetSqliteDialector define Sqlite GORM dialector
 
+The DB is opened in WAL mode, so readers do not block the writer. Transactions take the write
+lock when they start, so concurrent writers wait for each other rather than failing part way.
+
 	@param dbFile string - Sqlite DB file
 	@return GORM sqlite dialector
 */
 func GetSqliteDialector(dbFile string) gorm.Dialector {
-	return sqlite.Open(fmt.Sprintf("%s?_foreign_keys=on", dbFile))
+	return sqlite.Open(fmt.Sprintf(
+		"%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate",
+		dbFile,
+		sqliteBusyTimeoutMS,
+	))
 }
 
 /*
-GetSQLUserManager define a new SQL based user manager
+openSQLDB helper function to open a GORM SQL DB connection
 
 	@param dbDialector gorm.Dialector - GORM SQL dialector
 	@param logLevel logger.LogLevel - SQL log level
+	@return GORM DB connection
 */
-func GetSQLUserManager(dbDialector gorm.Dialector, logLevel logger.LogLevel) (UserManager, error) {
-	db, err := gorm.Open(dbDialector, &gorm.Config{
-		Logger:                 logger.Default.LogMode(logLevel),
+func openSQLDB(dbDialector gorm.Dialector, logLevel logger.LogLevel) (*gorm.DB, error) {
+	return gorm.Open(dbDialector, &gorm.Config{
+		Logger:                 defineRedactingSQLLogger(logLevel),
 		SkipDefaultTransaction: true,
 	})
+}
+
+// ErrSQLSchemaOutdated the DB schema version is older than the one this build supports. The DB
+// must be migrated explicitly, so a DB downgraded on purpose is not upgraded again.
+var ErrSQLSchemaOutdated = errors.New("DB schema version is older than supported")
+
+/*
+GetSQLUserManager define a new SQL based user manager
+
+A new DB, without any tables, is migrated to the latest schema version. Otherwise, the manager
+refuses to operate on a DB whose schema version is not the one this build supports, and fails
+with ErrSQLSchemaOutdated if the DB must be migrated first. This includes a DB created before
+schema migrations were introduced, which has tables but no applied migrations.
+
+	@param dbDialector gorm.Dialector - GORM SQL dialector
+	@param logLevel logger.LogLevel - SQL log level
+	@param cipher SecretCipher - cipher for encrypting secrets at rest. Secrets are stored
+	    as is if nil.
+*/
+func GetSQLUserManager(
+	dbDialector gorm.Dialector, logLevel logger.LogLevel, cipher SecretCipher,
+) (UserManager, error) {
+	db, err := openSQLDB(dbDialector, logLevel)
 	if err != nil {
 		return nil, err
 	}
 
 	// Prepare the databases
-	if err := db.AutoMigrate(&sqlUserEntry{}); err != nil {
+	migrator, err := defineSQLSchemaMigrator(db)
+	if err != nil {
 		return nil, err
 	}
-	if err := db.AutoMigrate(&sqlChatSessionEntry{}); err != nil {
+	currentVersion, err := migrator.SchemaVersion(context.Background())
+	if err != nil {
 		return nil, err
 	}
-	if err := db.AutoMigrate(&sqlChatExchangeEntry{}); err != nil {
+	if currentVersion > LatestSQLSchemaVersion() {
+		return nil, fmt.Errorf(
+			"DB schema version %d is newer than supported version %d",
+			currentVersion,
+			LatestSQLSchemaVersion(),
+		)
+	}
+	if currentVersion == 0 && db.Migrator().HasTable(&sqlUserEntry{}) {
+		return nil, fmt.Errorf(
+			"%w: DB predates schema versioning, supported version %d",
+			ErrSQLSchemaOutdated,
+			LatestSQLSchemaVersion(),
+		)
+	} else if currentVersion == 0 {
+		if err := migrator.MigrateTo(context.Background(), LatestSQLSchemaVersion()); err != nil {
+			return nil, err
+		}
+	} else if currentVersion < LatestSQLSchemaVersion() {
+		return nil, fmt.Errorf(
+			"%w: DB at version %d, supported version %d",
+			ErrSQLSchemaOutdated,
+			currentVersion,
+			LatestSQLSchemaVersion(),
+		)
+	}
+
+	searchIndex, err := prepareSQLSearchIndex(db)
+	if err != nil {
 		return nil, err
 	}
 
@@ -64,6 +136,106 @@ func GetSQLUserManager(dbDialector gorm.Dialector, logLevel logger.LogLevel) (Us
 		Component: goutils.Component{
 			LogTags:         logTags,
 			LogTagModifiers: []goutils.LogMetadataModifier{},
-		}, db: db,
+		}, db: db, cipher: cipher, searchIndex: searchIndex,
 	}, nil
 }
+
+/*
+encryptSecret helper function to encrypt a secret before storing it
+
+	@param plaintext string - the secret
+	@return the value to store
+*/
+func (c *sqlUserPersistence) encryptSecret(plaintext string) (string, error) {
+	if c.cipher == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	return c.cipher.Encrypt(plaintext)
+}
+
+/*
+decryptSecret helper function to decrypt a stored secret
+
+	@param stored string - the stored value
+	@return the secret
+*/
+func (c *sqlUserPersistence) decryptSecret(stored string) (string, error) {
+	if !IsEncryptedSecret(stored) {
+		return stored, nil
+	}
+	if c.cipher == nil {
+		return "", fmt.Errorf("secret is encrypted, but no passphrase was provided")
+	}
+	return c.cipher.Decrypt(stored)
+}
+
+/*
+RekeySQLUserSecrets re-encrypt all secrets stored in a SQL DB with a new cipher
+
+Secrets which were stored unencrypted are encrypted with the new cipher. All secrets are
+updated within one transaction.
+
+	@param ctxt context.Context - query context
+	@param dbDialector gorm.Dialector - GORM SQL dialector
+	@param logLevel logger.LogLevel - SQL log level
+	@param oldCipher SecretCipher - cipher the secrets are currently encrypted with
+	@param newCipher SecretCipher - cipher to encrypt the secrets with
+	@return number of secrets updated
+*/
+func RekeySQLUserSecrets(
+	ctxt context.Context,
+	dbDialector gorm.Dialector,
+	logLevel logger.LogLevel,
+	oldCipher SecretCipher,
+	newCipher SecretCipher,
+) (int, error) {
+	manager, err := GetSQLUserManager(dbDialector, logLevel, oldCipher)
+	if err != nil {
+		return 0, err
+	}
+	driver := manager.(*sqlUserPersistence)
+	logtags := driver.GetLogTagsForContext(ctxt)
+
+	updated := 0
+	err = driver.db.Transaction(func(tx *gorm.DB) error {
+		var users []sqlUserEntry
+		if tmp := tx.Find(&users); tmp.Error != nil {
+			log.WithError(tmp.Error).WithFields(logtags).Error("Failed to list users")
+			return tmp.Error
+		}
+		for _, oneUser := range users {
+			if oneUser.APIToken == "" {
+				continue
+			}
+			plaintext, err := driver.decryptSecret(oneUser.APIToken)
+			if err != nil {
+				log.
+					WithError(err).
+					WithFields(logtags).
+					Errorf("Failed to decrypt user '%s' API token", oneUser.ID)
+				return err
+			}
+			encrypted, err := newCipher.Encrypt(plaintext)
+			if err != nil {
+				log.
+					WithError(err).
+					WithFields(logtags).
+					Errorf("Failed to encrypt user '%s' API token", oneUser.ID)
+				return err
+			}
+			if tmp := tx.
+				Model(&sqlUserEntry{}).
+				Where(&sqlUserEntry{ID: oneUser.ID}).
+				Update("api_token", encrypted); tmp.Error != nil {
+				log.
+					WithError(tmp.Error).
+					WithFields(logtags).
+					Errorf("Failed to update user '%s' API token", oneUser.ID)
+				return tmp.Error
+			}
+			updated++
+		}
+		return nil
+	})
+	return updated, err
+}
@@ -0,0 +1,106 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// APITokenSourceKind how a user's API token is obtained
+type APITokenSourceKind string
+
+const (
+	// APITokenFromLiteral API token is stored in persistence
+	APITokenFromLiteral APITokenSourceKind = "literal"
+	// APITokenFromEnv API token is read from an ENV variable
+	APITokenFromEnv APITokenSourceKind = "env"
+	// APITokenFromCommand API token is the output of an external command
+	APITokenFromCommand APITokenSourceKind = "command"
+)
+
+// APITokenCommandTimeout max time an API token command is given to complete
+const APITokenCommandTimeout = time.Second * 30
+
+/*
+APITokenSource describes how a user's API token is obtained
+
+The API token is resolved each time it is needed, so tokens from ENV variables and external
+commands are never written to persistence.
+*/
+type APITokenSource struct {
+	// Kind how the API token is obtained
+	Kind APITokenSourceKind `json:"kind" yaml:"kind"`
+	// Reference the ENV variable name, or the command to run. Not used for literal tokens.
+	Reference string `json:"reference,omitempty" yaml:"reference,omitempty"`
+}
+
+/*
+SupportedAPITokenSourceKinds list the supported API token source kinds
+
+	@return supported API token source kinds
+*/
+func SupportedAPITokenSourceKinds() []APITokenSourceKind {
+	return []APITokenSourceKind{APITokenFromLiteral, APITokenFromEnv, APITokenFromCommand}
+}
+
+/*
+Validate verify the API token source is usable
+
+	@return nil if valid
+*/
+func (s APITokenSource) Validate() error {
+	switch s.Kind {
+	case APITokenFromLiteral:
+		return nil
+	case APITokenFromEnv, APITokenFromCommand:
+		if strings.TrimSpace(s.Reference) == "" {
+			return fmt.Errorf("API token source '%s' requires a reference", s.Kind)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown API token source '%s'", s.Kind)
+	}
+}
+
+/*
+resolveExternalAPIToken fetch an API token from an ENV variable or an external command
+
+The command is run through the shell, and its trimmed STDOUT is the API token. The command
+shares the terminal, so helpers which prompt (e.g. for a GPG key passphrase) work as expected.
+
+	@param ctxt context.Context - query context
+	@param source APITokenSource - the API token source
+	@return the API token
+*/
+func resolveExternalAPIToken(ctxt context.Context, source APITokenSource) (string, error) {
+	var token string
+	switch source.Kind {
+	case APITokenFromEnv:
+		token = os.Getenv(source.Reference)
+		if token == "" {
+			return "", fmt.Errorf("API token ENV variable '%s' is not set", source.Reference)
+		}
+	case APITokenFromCommand:
+		runCtxt, cancel := context.WithTimeout(ctxt, APITokenCommandTimeout)
+		defer cancel()
+		var stdout bytes.Buffer
+		cmd := exec.CommandContext(runCtxt, "sh", "-c", source.Reference)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("API token command failed: %w", err)
+		}
+		token = strings.TrimSpace(stdout.String())
+		if token == "" {
+			return "", fmt.Errorf("API token command produced no output")
+		}
+	default:
+		return "", fmt.Errorf("API token source '%s' is not external", source.Kind)
+	}
+	return token, nil
+}
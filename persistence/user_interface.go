@@ -9,7 +9,7 @@ User holds information regarding one user of the system. This includes
 
   - User ID
   - User Name
-  - User API token
+  - User API token, or where to obtain it
 */
 type User interface {
 	/*
@@ -75,6 +75,57 @@ type User interface {
 	*/
 	SetAPIToken(ctxt context.Context, newToken string) error
 
+	/*
+		GetAPITokenSource get how the user API token is obtained
+
+			@param ctxt context.Context - query context
+			@return the API token source
+	*/
+	GetAPITokenSource(ctxt context.Context) (APITokenSource, error)
+
+	/*
+		SetAPITokenSource obtain the user API token from an ENV variable or an external command
+
+		Any API token previously stored for the user is removed. Use SetAPIToken to store a literal
+		API token instead.
+
+			@param ctxt context.Context - query context
+			@param source APITokenSource - the API token source
+	*/
+	SetAPITokenSource(ctxt context.Context, source APITokenSource) error
+
+	/*
+		GetRetentionPolicy get how much chat history is kept for the user
+
+			@param ctxt context.Context - query context
+			@return the retention policy
+	*/
+	GetRetentionPolicy(ctxt context.Context) (RetentionPolicy, error)
+
+	/*
+		SetRetentionPolicy set how much chat history is kept for the user
+
+			@param ctxt context.Context - query context
+			@param policy RetentionPolicy - the retention policy
+	*/
+	SetRetentionPolicy(ctxt context.Context, policy RetentionPolicy) error
+
+	/*
+		GetDefaultChatSettings get the request settings new chat sessions of the user start with
+
+			@param ctxt context.Context - query context
+			@return the default chat session settings
+	*/
+	GetDefaultChatSettings(ctxt context.Context) (ChatSessionParameters, error)
+
+	/*
+		SetDefaultChatSettings set the request settings new chat sessions of the user start with
+
+			@param ctxt context.Context - query context
+			@param settings ChatSessionParameters - the default chat session settings
+	*/
+	SetDefaultChatSettings(ctxt context.Context, settings ChatSessionParameters) error
+
 	/*
 		Refresh helper function to sync the handler with what is stored in persistence
 
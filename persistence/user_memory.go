@@ -0,0 +1,506 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alwitt/goutils"
+	"github.com/apex/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+// memoryUserHandle wrapper object for working with an in-memory user record
+type memoryUserHandle struct {
+	goutils.Component
+	driver *memoryUserPersistence
+	id     string
+}
+
+/*
+entry fetch the user record. Caller must hold the store lock.
+
+	@return the user record
+*/
+func (h *memoryUserHandle) entry() (*memoryUserEntry, error) {
+	userEntry, ok := h.driver.store.users[h.id]
+	if !ok {
+		return nil, fmt.Errorf("user '%s' does not exist", h.id)
+	}
+	return userEntry, nil
+}
+
+/*
+GetID query for user GetID
+
+	@param ctxt context.Context - query context
+	@return the user ID
+*/
+func (h *memoryUserHandle) GetID(ctxt context.Context) (string, error) {
+	return h.id, nil
+}
+
+/*
+GetName query for user name
+
+	@param ctxt context.Context - query context
+	@return the user name
+*/
+func (h *memoryUserHandle) GetName(ctxt context.Context) (string, error) {
+	h.driver.store.lock.RLock()
+	defer h.driver.store.lock.RUnlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		return "", err
+	}
+	return userEntry.Name, nil
+}
+
+/*
+SetName set user name
+
+	@param ctxt context.Context - query context
+	@param newName string - new user name
+*/
+func (h *memoryUserHandle) SetName(ctxt context.Context, newName string) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.store.lock.Lock()
+	defer h.driver.store.lock.Unlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to update user '%s' name", h.id)
+		return err
+	}
+	for _, oneUser := range h.driver.store.users {
+		if oneUser.ID != h.id && oneUser.Name == newName {
+			err := fmt.Errorf("user name '%s' already in use", newName)
+			log.WithError(err).WithFields(logtags).Errorf("Failed to update user '%s' name", h.id)
+			return err
+		}
+	}
+	userEntry.Name = newName
+	userEntry.UpdatedAt = time.Now()
+	return nil
+}
+
+/*
+GetActiveSessionID fetch user's active session ID
+
+	@param ctxt context.Context - query context
+	@return active session ID
+*/
+func (h *memoryUserHandle) GetActiveSessionID(ctxt context.Context) (*string, error) {
+	h.driver.store.lock.RLock()
+	defer h.driver.store.lock.RUnlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		return nil, err
+	}
+	if userEntry.ActiveSessionID == nil {
+		return nil, nil
+	}
+	activeSessionID := *userEntry.ActiveSessionID
+	return &activeSessionID, nil
+}
+
+/*
+SetActiveSessionID change user's active session ID
+
+	@param ctxt context.Context - query context
+	@param sessionID string - new session ID
+*/
+func (h *memoryUserHandle) SetActiveSessionID(ctxt context.Context, sessionID string) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.store.lock.Lock()
+	defer h.driver.store.lock.Unlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to update user '%s' active session", h.id)
+		return err
+	}
+	if sessionEntry, ok := h.driver.store.sessions[sessionID]; !ok ||
+		sessionEntry.UserID != h.id ||
+		sessionEntry.DeletedAt != nil {
+		err := fmt.Errorf("chat session '%s' does not exist", sessionID)
+		log.
+			WithError(err).
+			WithFields(logtags).
+			Errorf("Failed to update user '%s' active session to '%s'", h.id, sessionID)
+		return err
+	}
+	userEntry.ActiveSessionID = &sessionID
+	userEntry.UpdatedAt = time.Now()
+	return nil
+}
+
+/*
+ClearActiveSessionID clear user's active session ID
+
+	@param ctxt context.Context - query context
+*/
+func (h *memoryUserHandle) ClearActiveSessionID(ctxt context.Context) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.store.lock.Lock()
+	defer h.driver.store.lock.Unlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to clear user '%s' active session", h.id)
+		return err
+	}
+	userEntry.ActiveSessionID = nil
+	userEntry.UpdatedAt = time.Now()
+	return nil
+}
+
+/*
+GetAPIToken get user API token
+
+	@param ctxt context.Context - query context
+	@return the user API token
+*/
+func (h *memoryUserHandle) GetAPIToken(ctxt context.Context) (string, error) {
+	h.driver.store.lock.RLock()
+	defer h.driver.store.lock.RUnlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		return "", err
+	}
+	if userEntry.APITokenSource.Kind != "" && userEntry.APITokenSource.Kind != APITokenFromLiteral {
+		return resolveExternalAPIToken(ctxt, userEntry.APITokenSource)
+	}
+	return userEntry.APIToken, nil
+}
+
+/*
+GetAPITokenSource get how the user API token is obtained
+
+	@param ctxt context.Context - query context
+	@return the API token source
+*/
+func (h *memoryUserHandle) GetAPITokenSource(ctxt context.Context) (APITokenSource, error) {
+	h.driver.store.lock.RLock()
+	defer h.driver.store.lock.RUnlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		return APITokenSource{}, err
+	}
+	if userEntry.APITokenSource.Kind == "" {
+		return APITokenSource{Kind: APITokenFromLiteral}, nil
+	}
+	return userEntry.APITokenSource, nil
+}
+
+/*
+GetRetentionPolicy get how much chat history is kept for the user
+
+	@param ctxt context.Context - query context
+	@return the retention policy
+*/
+func (h *memoryUserHandle) GetRetentionPolicy(ctxt context.Context) (RetentionPolicy, error) {
+	h.driver.store.lock.RLock()
+	defer h.driver.store.lock.RUnlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		return RetentionPolicy{}, err
+	}
+	return userEntry.RetentionPolicy, nil
+}
+
+/*
+SetRetentionPolicy set how much chat history is kept for the user
+
+	@param ctxt context.Context - query context
+	@param policy RetentionPolicy - the retention policy
+*/
+func (h *memoryUserHandle) SetRetentionPolicy(ctxt context.Context, policy RetentionPolicy) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := policy.Validate(); err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Invalid retention policy for user '%s'", h.id)
+		return err
+	}
+	h.driver.store.lock.Lock()
+	defer h.driver.store.lock.Unlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to update user '%s' retention policy", h.id)
+		return err
+	}
+	userEntry.RetentionPolicy = policy
+	userEntry.UpdatedAt = time.Now()
+	return nil
+}
+
+/*
+GetDefaultChatSettings get the request settings new chat sessions of the user start with
+
+	@param ctxt context.Context - query context
+	@return the default chat session settings
+*/
+func (h *memoryUserHandle) GetDefaultChatSettings(ctxt context.Context) (ChatSessionParameters, error) {
+	h.driver.store.lock.RLock()
+	defer h.driver.store.lock.RUnlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		return ChatSessionParameters{}, err
+	}
+	return userDefaultChatSettings(userEntry.DefaultChatSettings), nil
+}
+
+/*
+SetDefaultChatSettings set the request settings new chat sessions of the user start with
+
+	@param ctxt context.Context - query context
+	@param settings ChatSessionParameters - the default chat session settings
+*/
+func (h *memoryUserHandle) SetDefaultChatSettings(
+	ctxt context.Context, settings ChatSessionParameters,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := validator.New().Struct(&settings); err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Invalid default chat settings for user '%s'", h.id)
+		return err
+	}
+	h.driver.store.lock.Lock()
+	defer h.driver.store.lock.Unlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		log.
+			WithError(err).
+			WithFields(logtags).
+			Errorf("Failed to update user '%s' default chat settings", h.id)
+		return err
+	}
+	userEntry.DefaultChatSettings = settings
+	userEntry.UpdatedAt = time.Now()
+	return nil
+}
+
+/*
+SetAPITokenSource obtain the user API token from an ENV variable or an external command
+
+Any API token previously stored for the user is removed. Use SetAPIToken to store a literal
+API token instead.
+
+	@param ctxt context.Context - query context
+	@param source APITokenSource - the API token source
+*/
+func (h *memoryUserHandle) SetAPITokenSource(ctxt context.Context, source APITokenSource) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := source.Validate(); err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Invalid API token source for user '%s'", h.id)
+		return err
+	}
+	if source.Kind == APITokenFromLiteral {
+		err := fmt.Errorf("literal API token must be set with SetAPIToken")
+		log.WithError(err).WithFields(logtags).Errorf("Invalid API token source for user '%s'", h.id)
+		return err
+	}
+	h.driver.store.lock.Lock()
+	defer h.driver.store.lock.Unlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		log.
+			WithError(err).
+			WithFields(logtags).
+			Errorf("Failed to update user '%s' API token source", h.id)
+		return err
+	}
+	userEntry.APIToken = ""
+	userEntry.APITokenSource = source
+	userEntry.UpdatedAt = time.Now()
+	return nil
+}
+
+/*
+SetAPIToken set user API token
+
+	@param ctxt context.Context - query context
+	@param newToken string - new API token
+*/
+func (h *memoryUserHandle) SetAPIToken(ctxt context.Context, newToken string) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.store.lock.Lock()
+	defer h.driver.store.lock.Unlock()
+	userEntry, err := h.entry()
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to update user '%s' API token", h.id)
+		return err
+	}
+	userEntry.APIToken = newToken
+	userEntry.APITokenSource = APITokenSource{Kind: APITokenFromLiteral}
+	userEntry.UpdatedAt = time.Now()
+	return nil
+}
+
+/*
+Refresh helper function to sync the handler with what is stored in persistence
+
+	@param ctxt context.Context - query context
+*/
+func (h *memoryUserHandle) Refresh(ctxt context.Context) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	h.driver.store.lock.RLock()
+	defer h.driver.store.lock.RUnlock()
+	if _, err := h.entry(); err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to refresh user '%s' info", h.id)
+		return err
+	}
+	return nil
+}
+
+/*
+ChatSessionManager fetch chat session manager for a user
+
+	@param ctxt context.Context - query context
+	@return associated chat session manager
+*/
+func (h *memoryUserHandle) ChatSessionManager(ctxt context.Context) (ChatSessionManager, error) {
+	logtags := h.GetLogTagsForContext(ctxt)
+	logtags["table"] = "chat_sessions"
+	return &memoryChatPersistence{
+		Component: goutils.Component{
+			LogTags:         logtags,
+			LogTagModifiers: []goutils.LogMetadataModifier{},
+		},
+		driver: h.driver,
+		user:   h,
+	}, nil
+}
+
+// ============================================================================================
+// In-memory User Manager implementation
+
+// defineUserHandle helper function for defining new user handle object
+func (c *memoryUserPersistence) defineUserHandle(
+	ctxt context.Context, userEntry *memoryUserEntry,
+) *memoryUserHandle {
+	logtags := c.GetLogTagsForContext(ctxt)
+	logtags["table"] = "users"
+	logtags["user"] = fmt.Sprintf("(%s [%s])", userEntry.Name, userEntry.ID)
+	return &memoryUserHandle{
+		Component: goutils.Component{
+			LogTags:         logtags,
+			LogTagModifiers: []goutils.LogMetadataModifier{},
+		},
+		driver: c,
+		id:     userEntry.ID,
+	}
+}
+
+/*
+RecordNewUser record a new system user
+
+	@param ctxt context.Context - query context
+	@param userName string - user name
+	@return	new user entry
+*/
+func (c *memoryUserPersistence) RecordNewUser(ctxt context.Context, userName string) (User, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	c.store.lock.Lock()
+	defer c.store.lock.Unlock()
+
+	for _, oneUser := range c.store.users {
+		if oneUser.Name == userName {
+			err := fmt.Errorf("user name '%s' already in use", userName)
+			log.WithError(err).WithFields(logtags).Errorf("Failed to define new entry for '%s'", userName)
+			return nil, err
+		}
+	}
+
+	currentTime := time.Now()
+	newEntry := &memoryUserEntry{
+		ID: uuid.New().String(), Name: userName, CreatedAt: currentTime, UpdatedAt: currentTime,
+	}
+	c.store.users[newEntry.ID] = newEntry
+	c.store.userOrder = append(c.store.userOrder, newEntry.ID)
+
+	log.WithFields(logtags).Debugf("Defined new user entry for '%s'", userName)
+
+	return c.defineUserHandle(ctxt, newEntry), nil
+}
+
+/*
+ListUsers list all known users
+
+	@param ctxt context.Context - query context
+	@return list of known users
+*/
+func (c *memoryUserPersistence) ListUsers(ctxt context.Context) ([]User, error) {
+	c.store.lock.RLock()
+	defer c.store.lock.RUnlock()
+	result := []User{}
+	for _, userID := range c.store.userOrder {
+		result = append(result, c.defineUserHandle(ctxt, c.store.users[userID]))
+	}
+	return result, nil
+}
+
+/*
+GetUser fetch a user
+
+	@param ctxt context.Context - query context
+	@param userID string - user ID
+	@return user entry
+*/
+func (c *memoryUserPersistence) GetUser(ctxt context.Context, userID string) (User, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	c.store.lock.RLock()
+	defer c.store.lock.RUnlock()
+	userEntry, ok := c.store.users[userID]
+	if !ok {
+		err := fmt.Errorf("user '%s' does not exist", userID)
+		log.WithError(err).WithFields(logtags).Errorf("Unable to locate user '%s'", userID)
+		return nil, err
+	}
+	return c.defineUserHandle(ctxt, userEntry), nil
+}
+
+/*
+GetUserByName fetch a user by name
+
+	@param ctxt context.Context - query context
+	@param userName string - user name
+	@return user entry
+*/
+func (c *memoryUserPersistence) GetUserByName(ctxt context.Context, userName string) (User, error) {
+	logtags := c.GetLogTagsForContext(ctxt)
+	c.store.lock.RLock()
+	defer c.store.lock.RUnlock()
+	for _, userEntry := range c.store.users {
+		if userEntry.Name == userName {
+			return c.defineUserHandle(ctxt, userEntry), nil
+		}
+	}
+	err := fmt.Errorf("user named '%s' does not exist", userName)
+	log.WithError(err).WithFields(logtags).Errorf("Unable to locate user named '%s'", userName)
+	return nil, err
+}
+
+/*
+DeleteUser delete a user
+
+	@param ctxt context.Context - query context
+	@param userID string - user ID
+*/
+func (c *memoryUserPersistence) DeleteUser(ctxt context.Context, userID string) error {
+	logtags := c.GetLogTagsForContext(ctxt)
+	c.store.lock.Lock()
+	defer c.store.lock.Unlock()
+	if _, ok := c.store.users[userID]; !ok {
+		err := fmt.Errorf("user '%s' does not exist", userID)
+		log.WithError(err).WithFields(logtags).Errorf("Unable to find user '%s'", userID)
+		return err
+	}
+	// Delete all associated chat sessions
+	for sessionID, sessionEntry := range c.store.sessions {
+		if sessionEntry.UserID == userID {
+			delete(c.store.sessions, sessionID)
+			c.store.sessionOrder = removeFromOrder(c.store.sessionOrder, sessionID)
+		}
+	}
+	// Delete user
+	delete(c.store.users, userID)
+	c.store.userOrder = removeFromOrder(c.store.userOrder, userID)
+	return nil
+}
@@ -0,0 +1,38 @@
+package persistence
+
+import (
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryUserManager(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	uut, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testUserManager(t, uut)
+}
+
+func TestMemoryUserEntryCRUD(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	uut, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testUserEntryCRUD(t, uut)
+}
+
+func TestMemoryUserDefaultChatSettings(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	uut, err := GetMemoryUserManager()
+	assert.Nil(err)
+
+	testUserDefaultChatSettings(t, uut)
+}
@@ -7,20 +7,28 @@ import (
 
 	"github.com/alwitt/goutils"
 	"github.com/apex/log"
+	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 // sqlUserEntry SQL table representing a user
 type sqlUserEntry struct {
-	ID              string                `gorm:"primaryKey"`
-	Name            string                `gorm:"not null;uniqueIndex:username_index"`
-	APIToken        string                `gorm:"not null"`
-	ActiveSessionID *string               `gorm:"default:null"`
-	ActiveSession   *sqlChatSessionEntry  `gorm:"constraint:OnDelete:SET NULL;foreignKey:ActiveSessionID"`
-	ChatSessions    []sqlChatSessionEntry `gorm:"foreignKey:UserID"`
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	ID             string             `gorm:"primaryKey"`
+	Name           string             `gorm:"not null;uniqueIndex:username_index"`
+	APIToken       string             `gorm:"not null"`
+	APITokenSource APITokenSourceKind `gorm:"type:varchar(16);not null;default:literal"`
+	// APITokenReference the ENV variable name or command the API token is obtained from
+	APITokenReference string `gorm:"not null;default:''"`
+	// RetentionPolicy how much chat history is kept for the user
+	RetentionPolicy RetentionPolicy `gorm:"not null;type:text;default:'{}';serializer:json"`
+	// DefaultChatSettings request settings new chat sessions start with. Empty if not set.
+	DefaultChatSettings ChatSessionParameters `gorm:"not null;type:text;default:'{}';serializer:json"`
+	ActiveSessionID     *string               `gorm:"default:null"`
+	ActiveSession       *sqlChatSessionEntry  `gorm:"constraint:OnDelete:SET NULL;foreignKey:ActiveSessionID"`
+	ChatSessions        []sqlChatSessionEntry `gorm:"foreignKey:UserID"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
 }
 
 // TableName hard code table name
@@ -143,7 +151,156 @@ GetAPIToken get user API token
 	@return the user API token
 */
 func (h *sqlUserHandle) GetAPIToken(ctxt context.Context) (string, error) {
-	return h.APIToken, nil
+	logtags := h.GetLogTagsForContext(ctxt)
+	if h.APITokenSource != "" && h.APITokenSource != APITokenFromLiteral {
+		apiToken, err := resolveExternalAPIToken(
+			ctxt, APITokenSource{Kind: h.APITokenSource, Reference: h.APITokenReference},
+		)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Failed to resolve user '%s' API token", h.ID)
+			return "", err
+		}
+		return apiToken, nil
+	}
+	apiToken, err := h.driver.decryptSecret(h.APIToken)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to decrypt user '%s' API token", h.ID)
+		return "", err
+	}
+	return apiToken, nil
+}
+
+/*
+GetAPITokenSource get how the user API token is obtained
+
+	@param ctxt context.Context - query context
+	@return the API token source
+*/
+func (h *sqlUserHandle) GetAPITokenSource(ctxt context.Context) (APITokenSource, error) {
+	if h.APITokenSource == "" || h.APITokenSource == APITokenFromLiteral {
+		return APITokenSource{Kind: APITokenFromLiteral}, nil
+	}
+	return APITokenSource{Kind: h.APITokenSource, Reference: h.APITokenReference}, nil
+}
+
+/*
+GetRetentionPolicy get how much chat history is kept for the user
+
+	@param ctxt context.Context - query context
+	@return the retention policy
+*/
+func (h *sqlUserHandle) GetRetentionPolicy(ctxt context.Context) (RetentionPolicy, error) {
+	return h.RetentionPolicy, nil
+}
+
+/*
+SetRetentionPolicy set how much chat history is kept for the user
+
+	@param ctxt context.Context - query context
+	@param policy RetentionPolicy - the retention policy
+*/
+func (h *sqlUserHandle) SetRetentionPolicy(ctxt context.Context, policy RetentionPolicy) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := policy.Validate(); err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Invalid retention policy for user '%s'", h.ID)
+		return err
+	}
+	return h.driver.db.Transaction(func(tx *gorm.DB) error {
+		// Select the column, so a policy without limits is also written
+		tmp := tx.
+			Model(&h.sqlUserEntry).
+			Select("retention_policy").
+			Updates(&sqlUserEntry{RetentionPolicy: policy}).
+			First(&h.sqlUserEntry)
+		if tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to update user '%s' retention policy", h.ID)
+			return tmp.Error
+		}
+		return nil
+	})
+}
+
+/*
+GetDefaultChatSettings get the request settings new chat sessions of the user start with
+
+	@param ctxt context.Context - query context
+	@return the default chat session settings
+*/
+func (h *sqlUserHandle) GetDefaultChatSettings(ctxt context.Context) (ChatSessionParameters, error) {
+	return userDefaultChatSettings(h.DefaultChatSettings), nil
+}
+
+/*
+SetDefaultChatSettings set the request settings new chat sessions of the user start with
+
+	@param ctxt context.Context - query context
+	@param settings ChatSessionParameters - the default chat session settings
+*/
+func (h *sqlUserHandle) SetDefaultChatSettings(
+	ctxt context.Context, settings ChatSessionParameters,
+) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := validator.New().Struct(&settings); err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Invalid default chat settings for user '%s'", h.ID)
+		return err
+	}
+	return h.driver.db.Transaction(func(tx *gorm.DB) error {
+		tmp := tx.
+			Model(&h.sqlUserEntry).
+			Updates(&sqlUserEntry{DefaultChatSettings: settings}).
+			First(&h.sqlUserEntry)
+		if tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to update user '%s' default chat settings", h.ID)
+			return tmp.Error
+		}
+		return nil
+	})
+}
+
+/*
+SetAPITokenSource obtain the user API token from an ENV variable or an external command
+
+Any API token previously stored for the user is removed. Use SetAPIToken to store a literal
+API token instead.
+
+	@param ctxt context.Context - query context
+	@param source APITokenSource - the API token source
+*/
+func (h *sqlUserHandle) SetAPITokenSource(ctxt context.Context, source APITokenSource) error {
+	logtags := h.GetLogTagsForContext(ctxt)
+	if err := source.Validate(); err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Invalid API token source for user '%s'", h.ID)
+		return err
+	}
+	if source.Kind == APITokenFromLiteral {
+		err := fmt.Errorf("literal API token must be set with SetAPIToken")
+		log.WithError(err).WithFields(logtags).Errorf("Invalid API token source for user '%s'", h.ID)
+		return err
+	}
+	return h.driver.db.Transaction(func(tx *gorm.DB) error {
+		tmp := tx.
+			Model(&h.sqlUserEntry).
+			Updates(map[string]interface{}{
+				"api_token":           "",
+				"api_token_source":    source.Kind,
+				"api_token_reference": source.Reference,
+			}).
+			First(&h.sqlUserEntry)
+		if tmp.Error != nil {
+			log.
+				WithError(tmp.Error).
+				WithFields(logtags).
+				Errorf("Failed to update user '%s' API token source", h.ID)
+			return tmp.Error
+		}
+		return nil
+	})
 }
 
 /*
@@ -175,8 +332,20 @@ SetAPIToken set user API token
 */
 func (h *sqlUserHandle) SetAPIToken(ctxt context.Context, newToken string) error {
 	logtags := h.GetLogTagsForContext(ctxt)
+	storedToken, err := h.driver.encryptSecret(newToken)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Failed to encrypt user '%s' API token", h.ID)
+		return err
+	}
 	return h.driver.db.Transaction(func(tx *gorm.DB) error {
-		tmp := tx.Model(&h.sqlUserEntry).Updates(&sqlUserEntry{APIToken: newToken}).First(&h.sqlUserEntry)
+		tmp := tx.
+			Model(&h.sqlUserEntry).
+			Updates(map[string]interface{}{
+				"api_token":           storedToken,
+				"api_token_source":    APITokenFromLiteral,
+				"api_token_reference": "",
+			}).
+			First(&h.sqlUserEntry)
 		if tmp.Error != nil {
 			log.
 				WithError(tmp.Error).
@@ -202,8 +371,9 @@ func (h *sqlUserHandle) ChatSessionManager(ctxt context.Context) (ChatSessionMan
 			LogTags:         logtags,
 			LogTagModifiers: []goutils.LogMetadataModifier{},
 		},
-		db:   h.driver.db,
-		user: h,
+		db:          h.driver.db,
+		user:        h,
+		searchIndex: h.driver.searchIndex,
 	}, nil
 }
 
@@ -365,6 +535,10 @@ func (c *sqlUserPersistence) DeleteUser(ctxt context.Context, userID string) err
 		log.WithError(err).WithFields(logtags).Errorf("Unable to delete user '%s' chats", userID)
 		return err
 	}
+	if _, err := chatManager.EmptyTrash(ctxt, 0); err != nil {
+		log.WithError(err).WithFields(logtags).Errorf("Unable to purge user '%s' chats", userID)
+		return err
+	}
 	// Delete user
 	return c.db.Transaction(func(tx *gorm.DB) error {
 		if tmp := tx.Where(&sqlUserEntry{ID: userID}).Delete(&sqlUserEntry{}); tmp.Error != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/google/uuid"
@@ -18,9 +19,16 @@ func TestSQLUserManager(t *testing.T) {
 	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
 	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
 
-	uut, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info)
+	uut, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
 	assert.Nil(err)
 
+	testUserManager(t, uut)
+}
+
+// testUserManager test suite for UserManager
+func testUserManager(t *testing.T, uut UserManager) {
+	assert := assert.New(t)
+
 	utContext := context.Background()
 
 	// Case 0: no users
@@ -88,9 +96,16 @@ func TestSQLUserEntryCRUD(t *testing.T) {
 	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
 	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
 
-	uut, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info)
+	uut, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
 	assert.Nil(err)
 
+	testUserEntryCRUD(t, uut)
+}
+
+// testUserEntryCRUD test suite for User
+func testUserEntryCRUD(t *testing.T, uut UserManager) {
+	assert := assert.New(t)
+
 	utContext := context.Background()
 
 	// Case 0: create new user
@@ -122,5 +137,149 @@ func TestSQLUserEntryCRUD(t *testing.T) {
 		api, err := userEntry.GetAPIToken(utContext)
 		assert.Nil(err)
 		assert.Equal(newAPI, api)
+		source, err := userEntry.GetAPITokenSource(utContext)
+		assert.Nil(err)
+		assert.Equal(APITokenSource{Kind: APITokenFromLiteral}, source)
+	}
+
+	// Case 3: invalid API token sources
+	assert.NotNil(userEntry.SetAPITokenSource(utContext, APITokenSource{Kind: APITokenFromEnv}))
+	assert.NotNil(userEntry.SetAPITokenSource(utContext, APITokenSource{Kind: APITokenFromLiteral}))
+	assert.NotNil(
+		userEntry.SetAPITokenSource(utContext, APITokenSource{Kind: "file", Reference: "/tmp"}),
+	)
+	{
+		api, err := userEntry.GetAPIToken(utContext)
+		assert.Nil(err)
+		assert.Equal(newAPI, api)
+	}
+
+	// Case 4: API token from ENV variable
+	envVar := fmt.Sprintf("UT_API_TOKEN_%d", time.Now().UnixNano())
+	envSource := APITokenSource{Kind: APITokenFromEnv, Reference: envVar}
+	assert.Nil(userEntry.SetAPITokenSource(utContext, envSource))
+	{
+		source, err := userEntry.GetAPITokenSource(utContext)
+		assert.Nil(err)
+		assert.Equal(envSource, source)
+		_, err = userEntry.GetAPIToken(utContext)
+		assert.NotNil(err)
+	}
+	envAPI := uuid.NewString()
+	t.Setenv(envVar, envAPI)
+	{
+		api, err := userEntry.GetAPIToken(utContext)
+		assert.Nil(err)
+		assert.Equal(envAPI, api)
+	}
+
+	// Case 5: API token from command
+	cmdAPI := uuid.NewString()
+	cmdSource := APITokenSource{Kind: APITokenFromCommand, Reference: fmt.Sprintf("echo '  %s  '", cmdAPI)}
+	assert.Nil(userEntry.SetAPITokenSource(utContext, cmdSource))
+	{
+		api, err := userEntry.GetAPIToken(utContext)
+		assert.Nil(err)
+		assert.Equal(cmdAPI, api)
+	}
+	assert.Nil(
+		userEntry.SetAPITokenSource(utContext, APITokenSource{Kind: APITokenFromCommand, Reference: "false"}),
+	)
+	{
+		_, err := userEntry.GetAPIToken(utContext)
+		assert.NotNil(err)
+	}
+
+	// Case 6: back to literal API token
+	assert.Nil(userEntry.SetAPIToken(utContext, newAPI))
+	{
+		api, err := userEntry.GetAPIToken(utContext)
+		assert.Nil(err)
+		assert.Equal(newAPI, api)
+		source, err := userEntry.GetAPITokenSource(utContext)
+		assert.Nil(err)
+		assert.Equal(APITokenFromLiteral, source.Kind)
+	}
+}
+
+func TestSQLUserDefaultChatSettings(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	testInstance := fmt.Sprintf("ut-%s", uuid.NewString())
+	testDB := fmt.Sprintf("/tmp/%s.db", testInstance)
+
+	uut, err := GetSQLUserManager(GetSqliteDialector(testDB), logger.Info, nil)
+	assert.Nil(err)
+
+	testUserDefaultChatSettings(t, uut)
+}
+
+// testUserDefaultChatSettings test suite for the default chat session settings of a user
+func testUserDefaultChatSettings(t *testing.T, uut UserManager) {
+	assert := assert.New(t)
+
+	utContext := context.Background()
+
+	user0, err := uut.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	user0ID, err := user0.GetID(utContext)
+	assert.Nil(err)
+	user1, err := uut.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+
+	// Case 0: package defaults are used until the user sets their own
+	{
+		settings, err := user0.GetDefaultChatSettings(utContext)
+		assert.Nil(err)
+		assert.EqualValues(GetDefaultChatSessionParams(DefaultChatModel), settings)
+	}
+
+	// Case 1: invalid settings
+	{
+		invalid := GetDefaultChatSessionParams("unknown")
+		assert.NotNil(user0.SetDefaultChatSettings(utContext, invalid))
+		invalid = GetDefaultChatSessionParams("davinci")
+		invalid.MaxTokens = 0
+		assert.NotNil(user0.SetDefaultChatSettings(utContext, invalid))
+	}
+
+	// Case 2: set the default settings
+	preferred := GetDefaultChatSessionParams("davinci")
+	temperature := float32(1.2)
+	preferred.Temperature = &temperature
+	preferred.MaxTokens = 1024
+	assert.Nil(user0.SetDefaultChatSettings(utContext, preferred))
+	{
+		settings, err := user0.GetDefaultChatSettings(utContext)
+		assert.Nil(err)
+		assert.EqualValues(preferred, settings)
+		reloaded, err := uut.GetUser(utContext, user0ID)
+		assert.Nil(err)
+		settings, err = reloaded.GetDefaultChatSettings(utContext)
+		assert.Nil(err)
+		assert.EqualValues(preferred, settings)
+		settings, err = user1.GetDefaultChatSettings(utContext)
+		assert.Nil(err)
+		assert.EqualValues(GetDefaultChatSessionParams(DefaultChatModel), settings)
+	}
+
+	// Case 3: new sessions start with the default settings
+	{
+		chatManager, err := user0.ChatSessionManager(utContext)
+		assert.Nil(err)
+		session, err := chatManager.NewSession(utContext, "")
+		assert.Nil(err)
+		settings, err := session.Settings(utContext)
+		assert.Nil(err)
+		assert.EqualValues(preferred, settings)
+
+		session, err = chatManager.NewSession(utContext, "ada")
+		assert.Nil(err)
+		settings, err = session.Settings(utContext)
+		assert.Nil(err)
+		assert.Equal("ada", settings.Model)
+		assert.Equal(preferred.MaxTokens, settings.MaxTokens)
+		assert.Equal(temperature, *settings.Temperature)
 	}
 }
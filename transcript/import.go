@@ -0,0 +1,215 @@
+package transcript
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/apex/log"
+	"github.com/go-playground/validator/v10"
+)
+
+// defaultImportModel model of imported chat sessions which do not name a supported model
+const defaultImportModel = "turbo"
+
+/*
+ContentHash hash of the exchange content, used to detect exchanges which were already imported
+
+The hash covers the request time, to the second, and the request and response text, ignoring
+leading and trailing whitespace.
+
+	@return the content hash
+*/
+func (e ExchangeTranscript) ContentHash() string {
+	hasher := sha256.New()
+	_, _ = fmt.Fprintf(
+		hasher,
+		"%d\x00%s\x00%s",
+		e.RequestTimestamp.Unix(),
+		strings.TrimSpace(e.Request),
+		strings.TrimSpace(e.Response),
+	)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+/*
+ImportResult outcome of importing a transcript
+*/
+type ImportResult struct {
+	// Imported IDs of the new chat sessions
+	Imported []string
+	// Skipped headings of the source chat sessions which were not imported, because all their
+	// exchanges are already in one chat session
+	Skipped []string
+}
+
+/*
+existingExchangeHashes collect the exchange content hashes of each chat session of the user
+
+Only the exchange content used by the hashes is loaded.
+
+	@param ctxt context.Context - query context
+	@param chatManager persistence.ChatSessionManager - chat session manager
+	@return the exchange content hashes of each chat session with exchanges
+*/
+func existingExchangeHashes(
+	ctxt context.Context, chatManager persistence.ChatSessionManager,
+) ([]map[string]bool, error) {
+	contents, err := chatManager.ExchangeContents(ctxt)
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]bool{}
+	for _, exchanges := range contents {
+		hashes := map[string]bool{}
+		for _, oneExchange := range exchanges {
+			hashes[ExchangeTranscript{
+				RequestTimestamp: oneExchange.RequestTimestamp,
+				Request:          oneExchange.Request,
+				Response:         oneExchange.Response,
+			}.ContentHash()] = true
+		}
+		result = append(result, hashes)
+	}
+	return result, nil
+}
+
+/*
+importSession create a new chat session from a chat session transcript
+
+	@param ctxt context.Context - query context
+	@param chatManager persistence.ChatSessionManager - chat session manager
+	@param source SessionTranscript - the chat session transcript
+	@return the new chat session
+*/
+func importSession(
+	ctxt context.Context, chatManager persistence.ChatSessionManager, source SessionTranscript,
+) (persistence.ChatSession, error) {
+	model := defaultImportModel
+	if source.Settings.Model != "" {
+		if err := validator.New().Struct(&source.Settings); err != nil {
+			return nil, fmt.Errorf("session settings not valid: %w", err)
+		}
+		model = source.Settings.Model
+	}
+
+	session, err := chatManager.NewSession(ctxt, model)
+	if err != nil {
+		return nil, err
+	}
+	populate := func() error {
+		if source.Settings.Model != "" {
+			if err := session.ChangeSettings(ctxt, source.Settings); err != nil {
+				return err
+			}
+		}
+		if source.Title != "" || source.Description != "" || len(source.Tags) > 0 {
+			if err := session.ChangeMetadata(ctxt, persistence.ChatSessionMetadata{
+				Title: source.Title, Description: source.Description, Tags: source.Tags,
+			}); err != nil {
+				return err
+			}
+		}
+		for _, oneExchange := range source.Exchanges {
+			if err := session.RecordOneExchange(ctxt, persistence.ChatExchange{
+				RequestTimestamp:  oneExchange.RequestTimestamp,
+				Request:           oneExchange.Request,
+				ResponseTimestamp: oneExchange.ResponseTimestamp,
+				Response:          oneExchange.Response,
+				Attachments:       oneExchange.Attachments,
+			}); err != nil {
+				return err
+			}
+		}
+		switch source.State {
+		case persistence.ChatSessionStateClose, persistence.ChatSessionStateArchived:
+			return session.ChangeState(ctxt, source.State)
+		}
+		return nil
+	}
+	if err := populate(); err != nil {
+		// Do not leave a partially imported session behind
+		if sessionID, idErr := session.SessionID(ctxt); idErr == nil {
+			_ = chatManager.DeleteSession(ctxt, sessionID)
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+/*
+Import create chat sessions for the user from a transcript
+
+Original timestamps are kept. A source chat session is skipped if all its exchanges are already
+in one chat session of the user, so importing the same transcript again does not create
+duplicates. A source chat session without exchanges has nothing to compare, so it is always
+imported.
+
+	@param ctxt context.Context - query context
+	@param chatManager persistence.ChatSessionManager - chat session manager of the user
+	@param source Transcript - the transcript to import
+	@return the import outcome
+*/
+func Import(
+	ctxt context.Context, chatManager persistence.ChatSessionManager, source Transcript,
+) (ImportResult, error) {
+	result := ImportResult{Imported: []string{}, Skipped: []string{}}
+	logtags := log.Fields{"module": "transcript", "component": "import"}
+
+	existing, err := existingExchangeHashes(ctxt, chatManager)
+	if err != nil {
+		log.WithError(err).WithFields(logtags).Error("Failed to read existing chat sessions")
+		return result, err
+	}
+
+	for _, oneSession := range source.Sessions {
+		heading := sessionHeading(oneSession)
+
+		hashes := map[string]bool{}
+		for _, oneExchange := range oneSession.Exchanges {
+			hashes[oneExchange.ContentHash()] = true
+		}
+		// Only a session with exchanges can be compared against the existing sessions
+		duplicate := false
+		for _, existingHashes := range existing {
+			if len(hashes) == 0 {
+				break
+			}
+			duplicate = true
+			for hash := range hashes {
+				if !existingHashes[hash] {
+					duplicate = false
+					break
+				}
+			}
+			if duplicate {
+				break
+			}
+		}
+		if duplicate {
+			log.WithFields(logtags).Debugf("Skipping '%s' which was already imported", heading)
+			result.Skipped = append(result.Skipped, heading)
+			continue
+		}
+
+		session, err := importSession(ctxt, chatManager, oneSession)
+		if err != nil {
+			log.WithError(err).WithFields(logtags).Errorf("Failed to import '%s'", heading)
+			return result, err
+		}
+		sessionID, err := session.SessionID(ctxt)
+		if err != nil {
+			return result, err
+		}
+		result.Imported = append(result.Imported, sessionID)
+		// Guard against duplicates within the same transcript
+		if len(hashes) > 0 {
+			existing = append(existing, hashes)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,251 @@
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/apex/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscriptRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	utContext := context.Background()
+
+	userManager, err := persistence.GetMemoryUserManager()
+	assert.Nil(err)
+
+	newChatManager := func() persistence.ChatSessionManager {
+		user, err := userManager.RecordNewUser(utContext, uuid.NewString())
+		assert.Nil(err)
+		chatManager, err := user.ChatSessionManager(utContext)
+		assert.Nil(err)
+		return chatManager
+	}
+
+	// Prepare the source sessions
+	source := newChatManager()
+	session0, err := source.NewSession(utContext, "davinci")
+	assert.Nil(err)
+	assert.Nil(session0.ChangeMetadata(utContext, persistence.ChatSessionMetadata{
+		Title: "Sorting in Go", Description: "How to sort", Tags: []string{"golang", "work"},
+	}))
+	currentTime := time.Now()
+	timeDelta := time.Second * 5
+	for itr := 0; itr < 3; itr++ {
+		exchange := persistence.ChatExchange{
+			RequestTimestamp:  currentTime,
+			Request:           fmt.Sprintf("req-%d\n\n# Heading\n\nmore", itr),
+			ResponseTimestamp: currentTime.Add(timeDelta),
+			Response:          fmt.Sprintf("resp-%d\n\n---\n\n```go\nfmt.Println(%d)\n```", itr, itr),
+		}
+		if itr == 1 {
+			exchange.Attachments = []persistence.ChatExchangeAttachment{
+				{Name: "main.go", Content: "\tpackage main\n\n**Response** (none)\n```go\n```\n"},
+				{Name: "notes.md", Content: "# Notes\n"},
+			}
+		}
+		assert.Nil(session0.RecordOneExchange(utContext, exchange))
+		currentTime = currentTime.Add(timeDelta * 2)
+	}
+	assert.Nil(session0.CloseSession(utContext))
+	session1, err := source.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	assert.Nil(session1.RecordOneExchange(utContext, persistence.ChatExchange{
+		RequestTimestamp:  currentTime,
+		Request:           "hello",
+		ResponseTimestamp: currentTime.Add(timeDelta),
+		Response:          "world",
+	}))
+	empty, err := source.NewSession(utContext, "turbo")
+	assert.Nil(err)
+
+	export, err := DefineTranscript(
+		utContext, []persistence.ChatSession{session0, session1, empty},
+	)
+	assert.Nil(err)
+
+	verifyImported := func(chatManager persistence.ChatSessionManager, sessionIDs []string) {
+		assert.Len(sessionIDs, 3)
+		// The session without exchanges is imported as an empty session
+		importedEmpty, err := chatManager.GetSession(utContext, sessionIDs[2])
+		assert.Nil(err)
+		emptyExchanges, err := importedEmpty.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(emptyExchanges, 0)
+		imported, err := chatManager.GetSession(utContext, sessionIDs[0])
+		assert.Nil(err)
+		state, err := imported.SessionState(utContext)
+		assert.Nil(err)
+		assert.Equal(persistence.ChatSessionStateClose, state)
+		settings, err := imported.Settings(utContext)
+		assert.Nil(err)
+		assert.Equal("davinci", settings.Model)
+		metadata, err := imported.Metadata(utContext)
+		assert.Nil(err)
+		assert.Equal("Sorting in Go", metadata.Title)
+		assert.Equal("How to sort", metadata.Description)
+		assert.Equal([]string{"golang", "work"}, metadata.Tags)
+		exchanges, err := imported.Exchanges(utContext)
+		assert.Nil(err)
+		assert.Len(exchanges, 3)
+		for idx, oneExchange := range exchanges {
+			original := export.Sessions[0].Exchanges[idx]
+			assert.Equal(original.Request, oneExchange.Request)
+			assert.Equal(original.Response, oneExchange.Response)
+			assert.Equal(original.Attachments, oneExchange.Attachments)
+			assert.Equal(original.RequestTimestamp.Unix(), oneExchange.RequestTimestamp.Unix())
+			assert.Equal(original.ResponseTimestamp.Unix(), oneExchange.ResponseTimestamp.Unix())
+		}
+	}
+
+	// Case 0: JSON round trip
+	jsonTarget := newChatManager()
+	{
+		output := bytes.Buffer{}
+		assert.Nil(Write(&output, export, FormatJSON))
+		parsed, err := Parse(&output, SourceCLIGPTJSON)
+		assert.Nil(err)
+		result, err := Import(utContext, jsonTarget, parsed)
+		assert.Nil(err)
+		verifyImported(jsonTarget, result.Imported)
+		assert.Len(result.Skipped, 0)
+	}
+
+	// Case 1: importing again creates no duplicates of sessions with exchanges
+	{
+		result, err := Import(utContext, jsonTarget, export)
+		assert.Nil(err)
+		assert.Len(result.Imported, 1)
+		assert.Len(result.Skipped, 2)
+		sessions, err := jsonTarget.ListSessions(utContext)
+		assert.Nil(err)
+		assert.Len(sessions, 4)
+	}
+
+	// Case 2: Markdown round trip
+	markdownTarget := newChatManager()
+	{
+		output := bytes.Buffer{}
+		assert.Nil(Write(&output, export, FormatMarkdown))
+		parsed, err := Parse(&output, SourceMarkdown)
+		assert.Nil(err)
+		assert.Len(parsed.Sessions, 3)
+		result, err := Import(utContext, markdownTarget, parsed)
+		assert.Nil(err)
+		verifyImported(markdownTarget, result.Imported)
+	}
+
+	// Case 3: the same exchanges from another format are also detected
+	{
+		result, err := Import(utContext, markdownTarget, export)
+		assert.Nil(err)
+		assert.Len(result.Imported, 1)
+		assert.Len(result.Skipped, 2)
+	}
+
+	// Case 4: unsupported schema version
+	{
+		_, err := Parse(strings.NewReader(`{"schema_version": 99, "sessions": []}`), SourceCLIGPTJSON)
+		assert.NotNil(err)
+	}
+}
+
+func TestChatGPTImport(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	utContext := context.Background()
+
+	// The second request was edited, creating two branches. The user last saw branch "b".
+	conversations := `[{
+		"id": "conv-0",
+		"title": "Edited conversation",
+		"create_time": 1680000000.5,
+		"current_node": "a2b",
+		"mapping": {
+			"root": {"id": "root", "message": null, "parent": null, "children": ["sys"]},
+			"sys": {"id": "sys", "parent": "root", "children": ["u1"], "message": {
+				"author": {"role": "system"}, "create_time": null,
+				"content": {"content_type": "text", "parts": ["You are helpful"]}}},
+			"u1": {"id": "u1", "parent": "sys", "children": ["a1"], "message": {
+				"author": {"role": "user"}, "create_time": 1680000001.25,
+				"content": {"content_type": "multimodal_text", "parts": [{"asset": "image"}, "What is this?"]}}},
+			"a1": {"id": "a1", "parent": "u1", "children": ["t1"], "message": {
+				"author": {"role": "assistant"}, "create_time": 1680000002,
+				"content": {"content_type": "text", "parts": ["A cat"]}}},
+			"t1": {"id": "t1", "parent": "a1", "children": ["u2a", "u2b"], "message": {
+				"author": {"role": "tool"}, "create_time": 1680000003,
+				"content": {"content_type": "text", "parts": ["tool output"]}}},
+			"u2a": {"id": "u2a", "parent": "t1", "children": ["a2a"], "message": {
+				"author": {"role": "user"}, "create_time": 1680000010,
+				"content": {"content_type": "text", "parts": ["Original question"]}}},
+			"a2a": {"id": "a2a", "parent": "u2a", "children": [], "message": {
+				"author": {"role": "assistant"}, "create_time": 1680000011,
+				"content": {"content_type": "text", "parts": ["Original answer"]}}},
+			"u2b": {"id": "u2b", "parent": "t1", "children": ["a2b"], "message": {
+				"author": {"role": "user"}, "create_time": 1680000020,
+				"content": {"content_type": "text", "parts": ["Edited question"]}}},
+			"a2b": {"id": "a2b", "parent": "u2b", "children": [], "message": {
+				"author": {"role": "assistant"}, "create_time": 1680000021,
+				"content": {"content_type": "text", "parts": ["Edited answer"]}}}
+		}
+	}, {
+		"id": "conv-1",
+		"title": "Unanswered",
+		"create_time": 1680000100,
+		"mapping": {
+			"u1": {"id": "u1", "parent": null, "children": [], "message": {
+				"author": {"role": "user"}, "create_time": 1680000101,
+				"content": {"content_type": "text", "parts": ["Anyone there?"]}}}
+		}
+	}]`
+
+	parsed, err := Parse(strings.NewReader(conversations), SourceChatGPT)
+	assert.Nil(err)
+	assert.Len(parsed.Sessions, 2)
+	{
+		session := parsed.Sessions[0]
+		assert.Equal("Edited conversation", session.Title)
+		assert.Contains(session.Description, "conv-0")
+		assert.Len(session.Exchanges, 2)
+		assert.Equal("What is this?", session.Exchanges[0].Request)
+		assert.Equal("A cat", session.Exchanges[0].Response)
+		assert.Equal(
+			time.Unix(1680000001, 250000000).UnixNano(), session.Exchanges[0].RequestTimestamp.UnixNano(),
+		)
+		assert.Equal("Edited question", session.Exchanges[1].Request)
+		assert.Equal("Edited answer", session.Exchanges[1].Response)
+		assert.Equal(int64(1680000021), session.Exchanges[1].ResponseTimestamp.Unix())
+	}
+	assert.Len(parsed.Sessions[1].Exchanges, 0)
+
+	userManager, err := persistence.GetMemoryUserManager()
+	assert.Nil(err)
+	user, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	result, err := Import(utContext, chatManager, parsed)
+	assert.Nil(err)
+	assert.Len(result.Imported, 2)
+	assert.Len(result.Skipped, 0)
+	imported, err := chatManager.GetSession(utContext, result.Imported[0])
+	assert.Nil(err)
+	settings, err := imported.Settings(utContext)
+	assert.Nil(err)
+	assert.Equal("turbo", settings.Model)
+	exchanges, err := imported.Exchanges(utContext)
+	assert.Nil(err)
+	assert.Len(exchanges, 2)
+	assert.Equal("Edited question", exchanges[1].Request)
+}
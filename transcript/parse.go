@@ -0,0 +1,484 @@
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alwitt/cli-gpt/persistence"
+)
+
+// SourceFormat format of a transcript to import
+type SourceFormat string
+
+const (
+	// SourceCLIGPTJSON ENUM for import source "JSON export of this application"
+	SourceCLIGPTJSON SourceFormat = "cli-gpt-json"
+	// SourceChatGPT ENUM for import source "web ChatGPT conversations.json"
+	SourceChatGPT SourceFormat = "chatgpt"
+	// SourceMarkdown ENUM for import source "Markdown export of this application"
+	SourceMarkdown SourceFormat = "markdown"
+)
+
+/*
+SupportedSourceFormats list the supported import source formats
+
+	@return the supported source formats
+*/
+func SupportedSourceFormats() []string {
+	return []string{string(SourceCLIGPTJSON), string(SourceChatGPT), string(SourceMarkdown)}
+}
+
+/*
+Parse read a transcript to import
+
+	@param input io.Reader - the transcript source
+	@param format SourceFormat - the source format
+	@return the transcript
+*/
+func Parse(input io.Reader, format SourceFormat) (Transcript, error) {
+	switch format {
+	case SourceCLIGPTJSON:
+		return ParseJSON(input)
+	case SourceChatGPT:
+		return ParseChatGPT(input)
+	case SourceMarkdown:
+		return ParseMarkdown(input)
+	default:
+		return Transcript{}, fmt.Errorf("unsupported import format '%s'", format)
+	}
+}
+
+/*
+ParseJSON read a transcript written by a JSON export
+
+	@param input io.Reader - the transcript source
+	@return the transcript
+*/
+func ParseJSON(input io.Reader) (Transcript, error) {
+	var result Transcript
+	if err := json.NewDecoder(input).Decode(&result); err != nil {
+		return result, err
+	}
+	if result.SchemaVersion < 1 || result.SchemaVersion > SchemaVersion {
+		return result, fmt.Errorf("unsupported transcript schema version %d", result.SchemaVersion)
+	}
+	return result, nil
+}
+
+// ================================================================================
+
+// chatGPTConversation one conversation in a web ChatGPT conversations.json export
+type chatGPTConversation struct {
+	ID          string                 `json:"id"`
+	Title       string                 `json:"title"`
+	CreateTime  float64                `json:"create_time"`
+	CurrentNode string                 `json:"current_node"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+}
+
+// chatGPTNode one node of the message tree of a web ChatGPT conversation
+type chatGPTNode struct {
+	ID       string          `json:"id"`
+	Message  *chatGPTMessage `json:"message"`
+	Parent   string          `json:"parent"`
+	Children []string        `json:"children"`
+}
+
+// chatGPTMessage one message of a web ChatGPT conversation
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime *float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+	} `json:"content"`
+}
+
+/*
+text the text content of the message. Non-text parts, such as images, are dropped.
+
+	@return the message text
+*/
+func (m chatGPTMessage) text() string {
+	if m.Content.ContentType != "text" && m.Content.ContentType != "multimodal_text" {
+		return ""
+	}
+	parts := []string{}
+	for _, rawPart := range m.Content.Parts {
+		var part string
+		if err := json.Unmarshal(rawPart, &part); err != nil {
+			continue
+		}
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+/*
+chatGPTTimestamp convert a web ChatGPT timestamp, in fractional seconds since epoch
+
+	@param ts float64 - the timestamp
+	@return the timestamp
+*/
+func chatGPTTimestamp(ts float64) time.Time {
+	seconds, fraction := math.Modf(ts)
+	return time.Unix(int64(seconds), int64(fraction*1e9)).UTC()
+}
+
+/*
+linearHistory reduce the message tree of the conversation to the linear history leading to the
+message the user last saw
+
+Edited requests and regenerated responses create branches in the tree. Only the branch which
+ends at the current node is kept. If the current node is not known, the latest branch is
+followed from the root instead.
+
+	@return the messages in chronological order
+*/
+func (c chatGPTConversation) linearHistory() []chatGPTMessage {
+	nodeIDs := []string{}
+	if _, ok := c.Mapping[c.CurrentNode]; ok {
+		visited := map[string]bool{}
+		for nodeID := c.CurrentNode; nodeID != "" && !visited[nodeID]; {
+			visited[nodeID] = true
+			nodeIDs = append([]string{nodeID}, nodeIDs...)
+			nodeID = c.Mapping[nodeID].Parent
+		}
+	} else {
+		nodeID := ""
+		for oneID, node := range c.Mapping {
+			if _, ok := c.Mapping[node.Parent]; !ok {
+				nodeID = oneID
+				break
+			}
+		}
+		visited := map[string]bool{}
+		for nodeID != "" && !visited[nodeID] {
+			visited[nodeID] = true
+			nodeIDs = append(nodeIDs, nodeID)
+			children := c.Mapping[nodeID].Children
+			nodeID = ""
+			if len(children) > 0 {
+				nodeID = children[len(children)-1]
+			}
+		}
+	}
+
+	result := []chatGPTMessage{}
+	for _, nodeID := range nodeIDs {
+		if node, ok := c.Mapping[nodeID]; ok && node.Message != nil {
+			result = append(result, *node.Message)
+		}
+	}
+	return result
+}
+
+/*
+sessionTranscript convert the conversation into a chat session transcript
+
+Each user message is paired with the assistant messages which follow it. User messages without
+a response, and system or tool messages, are dropped.
+
+	@return the chat session transcript
+*/
+func (c chatGPTConversation) sessionTranscript() SessionTranscript {
+	result := SessionTranscript{
+		Title:     strings.TrimSpace(c.Title),
+		Exchanges: []ExchangeTranscript{},
+	}
+	if c.ID != "" {
+		result.Description = fmt.Sprintf("Imported from ChatGPT conversation %s", c.ID)
+	}
+
+	conversationStart := chatGPTTimestamp(c.CreateTime)
+	lastTimestamp := conversationStart
+	var pending *ExchangeTranscript
+	flush := func() {
+		if pending != nil && pending.Response != "" {
+			result.Exchanges = append(result.Exchanges, *pending)
+		}
+		pending = nil
+	}
+	for _, message := range c.linearHistory() {
+		text := message.text()
+		if text == "" {
+			continue
+		}
+		timestamp := lastTimestamp
+		if message.CreateTime != nil {
+			timestamp = chatGPTTimestamp(*message.CreateTime)
+		}
+		lastTimestamp = timestamp
+
+		switch message.Author.Role {
+		case "user":
+			flush()
+			pending = &ExchangeTranscript{RequestTimestamp: timestamp, Request: text}
+		case "assistant":
+			if pending == nil {
+				continue
+			}
+			if pending.Response != "" {
+				pending.Response += "\n\n"
+			}
+			pending.Response += text
+			pending.ResponseTimestamp = timestamp
+		}
+	}
+	flush()
+
+	return result
+}
+
+/*
+ParseChatGPT read the conversations.json file of a web ChatGPT data export
+
+Each conversation becomes one chat session.
+
+	@param input io.Reader - the transcript source
+	@return the transcript
+*/
+func ParseChatGPT(input io.Reader) (Transcript, error) {
+	result := Transcript{
+		SchemaVersion: SchemaVersion, ExportedAt: time.Now().UTC(), Sessions: []SessionTranscript{},
+	}
+	var conversations []chatGPTConversation
+	if err := json.NewDecoder(input).Decode(&conversations); err != nil {
+		return result, err
+	}
+	for _, oneConversation := range conversations {
+		result.Sessions = append(result.Sessions, oneConversation.sessionTranscript())
+	}
+	return result, nil
+}
+
+// ================================================================================
+
+/*
+parseMarkdownTimestamp read the timestamp of a request or response heading, such as
+"**Request** (2006-01-02 15:04:05 UTC)"
+
+	@param line string - the heading line
+	@param label string - the heading label
+	@return the timestamp, and whether the line is such a heading
+*/
+func parseMarkdownTimestamp(line, label string) (time.Time, bool, error) {
+	prefix := fmt.Sprintf("**%s** (", label)
+	if !strings.HasPrefix(line, prefix) || !strings.HasSuffix(line, ")") {
+		return time.Time{}, false, nil
+	}
+	ts, err := time.Parse(timestampFormat, strings.TrimSuffix(strings.TrimPrefix(line, prefix), ")"))
+	return ts, true, err
+}
+
+/*
+ParseMarkdown read a transcript written by a Markdown export
+
+	@param input io.Reader - the transcript source
+	@return the transcript
+*/
+func ParseMarkdown(input io.Reader) (Transcript, error) {
+	result := Transcript{
+		SchemaVersion: SchemaVersion, ExportedAt: time.Now().UTC(), Sessions: []SessionTranscript{},
+	}
+
+	lines := []string{}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+
+	// Which part of the document is being read
+	const (
+		inPreamble = iota
+		inRequest
+		inAttachment
+		inResponse
+	)
+
+	var session *SessionTranscript
+	var exchange *ExchangeTranscript
+	position := inPreamble
+	body := []string{}
+	// attachmentFence the code fence of the attachment being read. Empty outside the code block.
+	attachmentFence := ""
+	attachmentLines := []string{}
+	flushBody := func() {
+		text := strings.TrimSpace(strings.Join(body, "\n"))
+		body = []string{}
+		switch position {
+		case inPreamble:
+			if session != nil && exchange == nil && text != "" {
+				session.Description = text
+			}
+		case inRequest:
+			exchange.Request = text
+		case inResponse:
+			exchange.Response = text
+			session.Exchanges = append(session.Exchanges, *exchange)
+			exchange = nil
+		}
+	}
+	flushSession := func() {
+		flushBody()
+		if session != nil {
+			result.Sessions = append(result.Sessions, *session)
+		}
+		session = nil
+		position = inPreamble
+	}
+
+	// nextIsSessionHeading whether the next non-empty line after idx starts a new session
+	nextIsSessionHeading := func(idx int) bool {
+		for _, line := range lines[idx+1:] {
+			if strings.TrimSpace(line) != "" {
+				return strings.HasPrefix(line, "# ")
+			}
+		}
+		return false
+	}
+
+	for idx, line := range lines {
+		switch {
+		case position == inAttachment && attachmentFence != "":
+			// The attachment content is kept as is until the code block ends
+			if strings.TrimSpace(line) != attachmentFence {
+				attachmentLines = append(attachmentLines, line)
+				continue
+			}
+			content := strings.Join(attachmentLines, "\n")
+			if content != "" {
+				content += "\n"
+			}
+			exchange.Attachments[len(exchange.Attachments)-1].Content = content
+			attachmentFence = ""
+
+		case position == inAttachment && strings.HasPrefix(line, "```"):
+			attachmentFence = strings.TrimSpace(line)
+			attachmentLines = []string{}
+
+		case strings.HasPrefix(line, "# ") && (session == nil || position == inPreamble && exchange == nil && len(body) == 0):
+			flushSession()
+			session = &SessionTranscript{Exchanges: []ExchangeTranscript{}}
+			title := strings.TrimSpace(strings.TrimPrefix(line, "# "))
+			if !strings.HasPrefix(title, "Chat session ") {
+				session.Title = title
+			}
+
+		case strings.TrimSpace(line) == "---" && nextIsSessionHeading(idx):
+			flushSession()
+
+		case session == nil:
+			continue
+
+		case strings.HasPrefix(line, "## Exchange ") && position != inRequest:
+			flushBody()
+			exchange = &ExchangeTranscript{}
+			position = inPreamble
+
+		case exchange != nil && position == inPreamble && strings.HasPrefix(line, "**Request** ("):
+			ts, _, err := parseMarkdownTimestamp(line, "Request")
+			if err != nil {
+				return result, fmt.Errorf("line %d: %w", idx+1, err)
+			}
+			exchange.RequestTimestamp = ts
+			position = inRequest
+
+		case exchange != nil &&
+			(position == inRequest || position == inAttachment) &&
+			strings.HasPrefix(line, "**Attached:** `"):
+			flushBody()
+			exchange.Attachments = append(exchange.Attachments, persistence.ChatExchangeAttachment{
+				Name: strings.Trim(strings.TrimPrefix(line, "**Attached:** "), "`"),
+			})
+			position = inAttachment
+
+		case exchange != nil &&
+			(position == inRequest || position == inAttachment) &&
+			strings.HasPrefix(line, "**Response** ("):
+			ts, _, err := parseMarkdownTimestamp(line, "Response")
+			if err != nil {
+				return result, fmt.Errorf("line %d: %w", idx+1, err)
+			}
+			flushBody()
+			exchange.ResponseTimestamp = ts
+			position = inResponse
+
+		case position == inPreamble && exchange == nil && strings.HasPrefix(line, "- **"):
+			if err := parseMarkdownSessionField(session, line); err != nil {
+				return result, fmt.Errorf("line %d: %w", idx+1, err)
+			}
+
+		default:
+			body = append(body, line)
+		}
+	}
+	if exchange != nil && position != inResponse {
+		return result, fmt.Errorf("last exchange has no response")
+	}
+	flushSession()
+
+	return result, nil
+}
+
+/*
+parseMarkdownSessionField read one chat session field, such as "- **Model:** turbo"
+
+Unknown fields are ignored.
+
+	@param session *SessionTranscript - the chat session being read
+	@param line string - the field line
+*/
+func parseMarkdownSessionField(session *SessionTranscript, line string) error {
+	name, value, ok := strings.Cut(strings.TrimPrefix(line, "- **"), ":**")
+	if !ok {
+		return nil
+	}
+	value = strings.TrimSpace(value)
+	parseFloat := func() (*float32, error) {
+		parsed, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s '%s' not valid: %w", name, value, err)
+		}
+		result := float32(parsed)
+		return &result, nil
+	}
+	var err error
+	switch name {
+	case "Session":
+		session.SessionID = strings.Trim(value, "`")
+	case "State":
+		session.State = persistence.ChatSessionState(value)
+	case "Model":
+		session.Settings.Model = value
+	case "Max tokens":
+		if session.Settings.MaxTokens, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("max tokens '%s' not valid: %w", value, err)
+		}
+	case "Temperature":
+		session.Settings.Temperature, err = parseFloat()
+	case "Top P":
+		session.Settings.TopP, err = parseFloat()
+	case "Tags":
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				session.Tags = append(session.Tags, tag)
+			}
+		}
+	}
+	return err
+}
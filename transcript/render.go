@@ -0,0 +1,238 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Format transcript output format
+type Format string
+
+const (
+	// FormatJSON ENUM for transcript format "JSON"
+	FormatJSON Format = "json"
+	// FormatMarkdown ENUM for transcript format "Markdown"
+	FormatMarkdown Format = "markdown"
+	// FormatHTML ENUM for transcript format "HTML"
+	FormatHTML Format = "html"
+)
+
+/*
+SupportedFormats list the supported transcript output formats
+
+	@return the supported formats
+*/
+func SupportedFormats() []string {
+	return []string{string(FormatMarkdown), string(FormatJSON), string(FormatHTML)}
+}
+
+// timestampFormat how timestamps are shown in the rendered transcripts
+const timestampFormat = "2006-01-02 15:04:05 MST"
+
+/*
+formatTimestamp format a timestamp for the rendered transcripts
+
+	@param ts time.Time - the timestamp
+	@return the formatted timestamp, in UTC
+*/
+func formatTimestamp(ts time.Time) string {
+	return ts.UTC().Format(timestampFormat)
+}
+
+/*
+sessionHeading the heading of one chat session in the rendered transcripts
+
+	@param session SessionTranscript - the chat session
+	@return the heading
+*/
+func sessionHeading(session SessionTranscript) string {
+	if title := strings.TrimSpace(session.Title); title != "" {
+		return title
+	}
+	return fmt.Sprintf("Chat session %s", session.SessionID)
+}
+
+/*
+markdownFence the code fence to place around content. The fence is longer than any run of
+backticks in the content, so the content can not end the block early.
+
+	@param content string - the content
+	@return the code fence
+*/
+func markdownFence(content string) string {
+	longestRun := 0
+	currentRun := 0
+	for _, char := range content {
+		if char == '`' {
+			currentRun++
+			if currentRun > longestRun {
+				longestRun = currentRun
+			}
+		} else {
+			currentRun = 0
+		}
+	}
+	fenceLength := 3
+	if longestRun >= fenceLength {
+		fenceLength = longestRun + 1
+	}
+	return strings.Repeat("`", fenceLength)
+}
+
+/*
+fencedContent place content in a markdown code block
+
+	@param content string - the content
+	@return the code block
+*/
+func fencedContent(content string) string {
+	fence := markdownFence(content)
+	return fmt.Sprintf("%s\n%s\n%s", fence, strings.TrimSuffix(content, "\n"), fence)
+}
+
+/*
+RenderMarkdown render the transcript as a Markdown document
+
+	@param transcript Transcript - the transcript
+	@return the Markdown document
+*/
+func RenderMarkdown(transcript Transcript) string {
+	builder := strings.Builder{}
+
+	for idx, session := range transcript.Sessions {
+		if idx > 0 {
+			_, _ = builder.WriteString("---\n\n")
+		}
+		_, _ = builder.WriteString(fmt.Sprintf("# %s\n\n", sessionHeading(session)))
+		if description := strings.TrimSpace(session.Description); description != "" {
+			_, _ = builder.WriteString(fmt.Sprintf("%s\n\n", description))
+		}
+
+		// Session metadata
+		_, _ = builder.WriteString(fmt.Sprintf("- **Session:** `%s`\n", session.SessionID))
+		_, _ = builder.WriteString(fmt.Sprintf("- **State:** %s\n", session.State))
+		_, _ = builder.WriteString(fmt.Sprintf("- **Model:** %s\n", session.Settings.Model))
+		_, _ = builder.WriteString(
+			fmt.Sprintf("- **Max tokens:** %d\n", session.Settings.MaxTokens),
+		)
+		if session.Settings.Temperature != nil {
+			_, _ = builder.WriteString(
+				fmt.Sprintf("- **Temperature:** %g\n", *session.Settings.Temperature),
+			)
+		}
+		if session.Settings.TopP != nil {
+			_, _ = builder.WriteString(fmt.Sprintf("- **Top P:** %g\n", *session.Settings.TopP))
+		}
+		if len(session.Tags) > 0 {
+			_, _ = builder.WriteString(
+				fmt.Sprintf("- **Tags:** %s\n", strings.Join(session.Tags, ", ")),
+			)
+		}
+		_, _ = builder.WriteString(
+			fmt.Sprintf("- **Last activity:** %s\n\n", formatTimestamp(session.LastActivity)),
+		)
+
+		// Session exchanges
+		for exchangeIdx, exchange := range session.Exchanges {
+			_, _ = builder.WriteString(fmt.Sprintf("## Exchange %d\n\n", exchangeIdx+1))
+			_, _ = builder.WriteString(
+				fmt.Sprintf("**Request** (%s)\n\n", formatTimestamp(exchange.RequestTimestamp)),
+			)
+			_, _ = builder.WriteString(fmt.Sprintf("%s\n\n", strings.TrimSpace(exchange.Request)))
+			for _, attachment := range exchange.Attachments {
+				_, _ = builder.WriteString(fmt.Sprintf("**Attached:** `%s`\n\n", attachment.Name))
+				_, _ = builder.WriteString(fmt.Sprintf("%s\n\n", fencedContent(attachment.Content)))
+			}
+			_, _ = builder.WriteString(
+				fmt.Sprintf("**Response** (%s)\n\n", formatTimestamp(exchange.ResponseTimestamp)),
+			)
+			_, _ = builder.WriteString(fmt.Sprintf("%s\n\n", strings.TrimSpace(exchange.Response)))
+		}
+	}
+
+	return builder.String()
+}
+
+// htmlStyle style sheet embedded in the HTML transcripts
+const htmlStyle = `body {
+  max-width: 50em;
+  margin: 2em auto;
+  padding: 0 1em;
+  font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif;
+  line-height: 1.5;
+  color: #24292f;
+}
+h1 { border-bottom: 1px solid #d0d7de; padding-bottom: 0.3em; }
+h2 { margin-top: 2em; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; border-radius: 6px; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d0d7de; padding: 0.3em 0.8em; }
+hr { margin: 3em 0; }
+`
+
+/*
+RenderHTML render the transcript as a self-contained HTML document
+
+Raw HTML found in the requests or responses is omitted.
+
+	@param transcript Transcript - the transcript
+	@return the HTML document
+*/
+func RenderHTML(transcript Transcript) (string, error) {
+	converter := goldmark.New(goldmark.WithExtensions(extension.GFM))
+	body := bytes.Buffer{}
+	if err := converter.Convert([]byte(RenderMarkdown(transcript)), &body); err != nil {
+		return "", err
+	}
+
+	title := "Chat transcript"
+	if len(transcript.Sessions) == 1 {
+		title = sessionHeading(transcript.Sessions[0])
+	}
+
+	builder := strings.Builder{}
+	_, _ = builder.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	_, _ = builder.WriteString(fmt.Sprintf("<title>%s</title>\n", html.EscapeString(title)))
+	_, _ = builder.WriteString(fmt.Sprintf("<style>\n%s</style>\n", htmlStyle))
+	_, _ = builder.WriteString("</head>\n<body>\n")
+	_, _ = builder.Write(body.Bytes())
+	_, _ = builder.WriteString("</body>\n</html>\n")
+	return builder.String(), nil
+}
+
+/*
+Write write the transcript in the requested format
+
+	@param output io.Writer - where to write the transcript
+	@param transcript Transcript - the transcript
+	@param format Format - the output format
+*/
+func Write(output io.Writer, transcript Transcript, format Format) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(&transcript)
+	case FormatMarkdown:
+		_, err := io.WriteString(output, RenderMarkdown(transcript))
+		return err
+	case FormatHTML:
+		rendered, err := RenderHTML(transcript)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(output, rendered)
+		return err
+	default:
+		return fmt.Errorf("unsupported transcript format '%s'", format)
+	}
+}
@@ -0,0 +1,193 @@
+package transcript
+
+import (
+	"context"
+	"time"
+
+	"github.com/alwitt/cli-gpt/persistence"
+)
+
+/*
+SchemaVersion version of the transcript JSON schema
+
+The version is only changed when a field is removed or changes meaning. New optional fields
+may be added without changing the version.
+*/
+const SchemaVersion = 1
+
+/*
+Transcript a set of exported chat sessions
+
+This is the document written by a JSON export.
+*/
+type Transcript struct {
+	// SchemaVersion version of the transcript JSON schema
+	SchemaVersion int `json:"schema_version"`
+	// ExportedAt when the transcript was exported
+	ExportedAt time.Time `json:"exported_at"`
+	// Sessions the exported chat sessions
+	Sessions []SessionTranscript `json:"sessions"`
+}
+
+/*
+SessionTranscript one exported chat session
+*/
+type SessionTranscript struct {
+	// SessionID the chat session ID
+	SessionID string `json:"session_id"`
+	// State the chat session state
+	State persistence.ChatSessionState `json:"state"`
+	// Title the chat session title
+	Title string `json:"title,omitempty"`
+	// Description the chat session description
+	Description string `json:"description,omitempty"`
+	// Tags the chat session tags
+	Tags []string `json:"tags,omitempty"`
+	// Settings the session wide API request parameters
+	Settings persistence.ChatSessionParameters `json:"settings"`
+	// LastActivity when the chat session was last used
+	LastActivity time.Time `json:"last_activity"`
+	// Exchanges the chat session exchanges, in chronological order
+	Exchanges []ExchangeTranscript `json:"exchanges"`
+}
+
+/*
+ExchangeTranscript one exported chat exchange
+*/
+type ExchangeTranscript struct {
+	// ID the exchange ID
+	ID string `json:"id,omitempty"`
+	// RequestTimestamp when the request was made
+	RequestTimestamp time.Time `json:"request_ts"`
+	// Request the user request
+	Request string `json:"request"`
+	// ResponseTimestamp when the response was received
+	ResponseTimestamp time.Time `json:"response_ts"`
+	// Response the model response
+	Response string `json:"response"`
+	// Attachments files sent along with the request
+	Attachments []persistence.ChatExchangeAttachment `json:"attachments,omitempty"`
+}
+
+/*
+DefineSessionTranscript export one chat session
+
+	@param ctxt context.Context - query context
+	@param session persistence.ChatSession - the chat session
+	@return the exported chat session
+*/
+func DefineSessionTranscript(
+	ctxt context.Context, session persistence.ChatSession,
+) (SessionTranscript, error) {
+	var result SessionTranscript
+	var err error
+
+	if result.SessionID, err = session.SessionID(ctxt); err != nil {
+		return result, err
+	}
+	if result.State, err = session.SessionState(ctxt); err != nil {
+		return result, err
+	}
+	metadata, err := session.Metadata(ctxt)
+	if err != nil {
+		return result, err
+	}
+	result.Title = metadata.Title
+	result.Description = metadata.Description
+	result.Tags = metadata.Tags
+	if result.Settings, err = session.Settings(ctxt); err != nil {
+		return result, err
+	}
+	if result.LastActivity, err = session.LastActivity(ctxt); err != nil {
+		return result, err
+	}
+
+	exchanges, err := session.Exchanges(ctxt)
+	if err != nil {
+		return result, err
+	}
+	result.Exchanges = []ExchangeTranscript{}
+	for _, oneExchange := range exchanges {
+		result.Exchanges = append(result.Exchanges, ExchangeTranscript{
+			ID:                oneExchange.ID,
+			RequestTimestamp:  oneExchange.RequestTimestamp,
+			Request:           oneExchange.Request,
+			ResponseTimestamp: oneExchange.ResponseTimestamp,
+			Response:          oneExchange.Response,
+			Attachments:       oneExchange.Attachments,
+		})
+	}
+
+	return result, nil
+}
+
+/*
+DefineTranscript export a set of chat sessions
+
+	@param ctxt context.Context - query context
+	@param sessions []persistence.ChatSession - the chat sessions
+	@return the transcript
+*/
+func DefineTranscript(ctxt context.Context, sessions []persistence.ChatSession) (Transcript, error) {
+	result := Transcript{
+		SchemaVersion: SchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		Sessions:      []SessionTranscript{},
+	}
+	for _, oneSession := range sessions {
+		sessionTranscript, err := DefineSessionTranscript(ctxt, oneSession)
+		if err != nil {
+			return result, err
+		}
+		result.Sessions = append(result.Sessions, sessionTranscript)
+	}
+	return result, nil
+}
+
+/*
+WithoutAttachments copy of the transcript with the files attached to the requests left out
+
+	@return the transcript without attachments
+*/
+func (t Transcript) WithoutAttachments() Transcript {
+	result := t
+	result.Sessions = make([]SessionTranscript, len(t.Sessions))
+	for sessionIdx, oneSession := range t.Sessions {
+		oneSession.Exchanges = make([]ExchangeTranscript, len(t.Sessions[sessionIdx].Exchanges))
+		for exchangeIdx, oneExchange := range t.Sessions[sessionIdx].Exchanges {
+			oneExchange.Attachments = nil
+			oneSession.Exchanges[exchangeIdx] = oneExchange
+		}
+		result.Sessions[sessionIdx] = oneSession
+	}
+	return result
+}
+
+/*
+OnlyExchanges copy of the transcript with only some exchanges of one chat session kept. Other
+chat sessions are not changed.
+
+	@param sessionID string - the chat session ID
+	@param exchangeIDs []string - IDs of the exchanges of the chat session to keep
+	@return the transcript with only those exchanges of the chat session
+*/
+func (t Transcript) OnlyExchanges(sessionID string, exchangeIDs []string) Transcript {
+	keep := map[string]bool{}
+	for _, exchangeID := range exchangeIDs {
+		keep[exchangeID] = true
+	}
+	result := t
+	result.Sessions = make([]SessionTranscript, len(t.Sessions))
+	for sessionIdx, oneSession := range t.Sessions {
+		if oneSession.SessionID == sessionID {
+			oneSession.Exchanges = []ExchangeTranscript{}
+			for _, oneExchange := range t.Sessions[sessionIdx].Exchanges {
+				if keep[oneExchange.ID] {
+					oneSession.Exchanges = append(oneSession.Exchanges, oneExchange)
+				}
+			}
+		}
+		result.Sessions[sessionIdx] = oneSession
+	}
+	return result
+}
@@ -0,0 +1,144 @@
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alwitt/cli-gpt/persistence"
+	"github.com/apex/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscriptExport(t *testing.T) {
+	assert := assert.New(t)
+	log.SetLevel(log.DebugLevel)
+
+	utContext := context.Background()
+
+	userManager, err := persistence.GetMemoryUserManager()
+	assert.Nil(err)
+	user, err := userManager.RecordNewUser(utContext, uuid.NewString())
+	assert.Nil(err)
+	chatManager, err := user.ChatSessionManager(utContext)
+	assert.Nil(err)
+
+	session0, err := chatManager.NewSession(utContext, "turbo")
+	assert.Nil(err)
+	assert.Nil(session0.ChangeMetadata(utContext, persistence.ChatSessionMetadata{
+		Title: "Sorting in Go", Description: "How to sort", Tags: []string{"golang"},
+	}))
+	currentTime := time.Now()
+	timeDelta := time.Second * 5
+	for itr := 0; itr < 2; itr++ {
+		exchange := persistence.ChatExchange{
+			RequestTimestamp:  currentTime,
+			Request:           fmt.Sprintf("req-%d", itr),
+			ResponseTimestamp: currentTime.Add(timeDelta),
+			Response:          fmt.Sprintf("resp-%d <script>alert(1)</script>", itr),
+		}
+		if itr == 1 {
+			exchange.Attachments = []persistence.ChatExchangeAttachment{
+				{Name: "README.md", Content: "```go\nfunc main() {}\n```\n"},
+			}
+		}
+		assert.Nil(session0.RecordOneExchange(utContext, exchange))
+		currentTime = currentTime.Add(timeDelta * 2)
+	}
+	session1, err := chatManager.NewSession(utContext, "davinci")
+	assert.Nil(err)
+	session1ID, err := session1.SessionID(utContext)
+	assert.Nil(err)
+
+	uut, err := DefineTranscript(utContext, []persistence.ChatSession{session0, session1})
+	assert.Nil(err)
+	assert.Equal(SchemaVersion, uut.SchemaVersion)
+	assert.Len(uut.Sessions, 2)
+	assert.Equal("Sorting in Go", uut.Sessions[0].Title)
+	assert.Equal([]string{"golang"}, uut.Sessions[0].Tags)
+	assert.Equal(persistence.ChatSessionStateOpen, uut.Sessions[0].State)
+	assert.Len(uut.Sessions[0].Exchanges, 2)
+	assert.Equal("req-1", uut.Sessions[0].Exchanges[1].Request)
+	assert.Len(uut.Sessions[0].Exchanges[1].Attachments, 1)
+	assert.NotEmpty(uut.Sessions[0].Exchanges[1].ID)
+	assert.Equal("davinci", uut.Sessions[1].Settings.Model)
+	assert.Len(uut.Sessions[1].Exchanges, 0)
+
+	// Case 0: JSON is stable across a round trip
+	{
+		output := bytes.Buffer{}
+		assert.Nil(Write(&output, uut, FormatJSON))
+		assert.Contains(output.String(), `"schema_version": 1`)
+		var parsed Transcript
+		assert.Nil(json.Unmarshal(output.Bytes(), &parsed))
+		assert.Len(parsed.Sessions, 2)
+		assert.Equal(uut.Sessions[0].Exchanges[0].Response, parsed.Sessions[0].Exchanges[0].Response)
+		assert.Equal(
+			uut.Sessions[0].Exchanges[0].RequestTimestamp.Unix(),
+			parsed.Sessions[0].Exchanges[0].RequestTimestamp.Unix(),
+		)
+		assert.Equal("How to sort", parsed.Sessions[0].Description)
+	}
+
+	// Case 1: Markdown
+	{
+		output := bytes.Buffer{}
+		assert.Nil(Write(&output, uut, FormatMarkdown))
+		rendered := output.String()
+		assert.True(strings.HasPrefix(rendered, "# Sorting in Go\n"))
+		assert.Contains(rendered, "## Exchange 2\n")
+		assert.Contains(rendered, "- **Model:** turbo\n")
+		assert.Contains(rendered, "- **Tags:** golang\n")
+		assert.Contains(rendered, fmt.Sprintf("# Chat session %s\n", session1ID))
+		assert.Contains(
+			rendered,
+			"req-1\n\n**Attached:** `README.md`\n\n````\n```go\nfunc main() {}\n```\n````\n\n",
+		)
+	}
+
+	// Case 2: HTML does not carry raw HTML from the responses
+	{
+		output := bytes.Buffer{}
+		assert.Nil(Write(&output, uut, FormatHTML))
+		rendered := output.String()
+		assert.True(strings.HasPrefix(rendered, "<!DOCTYPE html>"))
+		assert.Contains(rendered, "<title>Chat transcript</title>")
+		assert.Contains(rendered, "<h1>Sorting in Go</h1>")
+		assert.NotContains(rendered, "<script>")
+	}
+
+	// Case 3: attachments left out
+	{
+		withoutAttachments := uut.WithoutAttachments()
+		assert.Empty(withoutAttachments.Sessions[0].Exchanges[1].Attachments)
+		assert.Equal("req-1", withoutAttachments.Sessions[0].Exchanges[1].Request)
+		// The original transcript is not changed
+		assert.Len(uut.Sessions[0].Exchanges[1].Attachments, 1)
+
+		output := bytes.Buffer{}
+		assert.Nil(Write(&output, withoutAttachments, FormatMarkdown))
+		assert.NotContains(output.String(), "**Attached:**")
+	}
+
+	// Case 4: unknown format
+	{
+		output := bytes.Buffer{}
+		assert.NotNil(Write(&output, uut, Format("pdf")))
+	}
+
+	// Case 5: only some exchanges of one session kept
+	{
+		session0ID := uut.Sessions[0].SessionID
+		oneExchange := uut.OnlyExchanges(session0ID, []string{uut.Sessions[0].Exchanges[1].ID})
+		assert.Len(oneExchange.Sessions, 2)
+		assert.Len(oneExchange.Sessions[0].Exchanges, 1)
+		assert.Equal("req-1", oneExchange.Sessions[0].Exchanges[0].Request)
+		// The original transcript is not changed
+		assert.Len(uut.Sessions[0].Exchanges, 2)
+	}
+}